@@ -0,0 +1,551 @@
+package analysis
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/cfg"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// the methods of the crit section types that start a region lease. the region
+// ends when the crit.Release returned by the method is called
+var acquireMethods = map[string]leaseMethod{
+	"Acquire":  {},
+	"RAcquire": {read: true},
+}
+
+// isAcquireCall returns the lease method if the call is to one of the acquire
+// methods of a crit.Section derived type or of a crit section type
+func isAcquireCall(info *types.Info, call *ast.CallExpr) (leaseMethod, bool) {
+	sel, ok := ast.Unparen(call.Fun).(*ast.SelectorExpr)
+	if !ok {
+		return leaseMethod{}, false
+	}
+	m, ok := acquireMethods[sel.Sel.Name]
+	if !ok {
+		return leaseMethod{}, false
+	}
+	t := info.TypeOf(sel.X)
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	if !isCritDerived(t) && !isCritSectionType(t) {
+		return leaseMethod{}, false
+	}
+	return m, true
+}
+
+// acquisition is a call to an acquire method and what happens to the release
+// function returned by it
+type acquisition struct {
+	call   *ast.CallExpr
+	method leaseMethod
+
+	// the variable the release function is assigned to. nil if the release
+	// function is discarded or deferred
+	release types.Object
+
+	// the release function is discarded, either as an expression statement or
+	// by assigning it to the blank identifier
+	discarded bool
+
+	// the release function is called by a defer statement. for example,
+	// defer C.Acquire()()
+	deferred bool
+}
+
+// heldSet is the set of acquisitions that are held at a point in a function.
+// a nil set means that the point has not been reached by the analysis
+type heldSet map[*acquisition]bool
+
+// meet returns the acquisitions that are held in both sets
+func (h heldSet) meet(o heldSet) heldSet {
+	if h == nil {
+		return o.copy()
+	}
+	m := make(heldSet)
+	for a := range h {
+		if o[a] {
+			m[a] = true
+		}
+	}
+	return m
+}
+
+// join returns the acquisitions that are in either set
+func (h heldSet) join(o heldSet) heldSet {
+	j := h.copy()
+	for a := range o {
+		j[a] = true
+	}
+	return j
+}
+
+func (h heldSet) copy() heldSet {
+	c := make(heldSet)
+	for a := range h {
+		c[a] = true
+	}
+	return c
+}
+
+// regionFlow is the dataflow analysis of the acquire regions of a function.
+// an access is leased if it is reached by an acquisition on every path through
+// the function and the release has not been called on any of those paths
+type regionFlow struct {
+	info *types.Info
+	g    *cfg.CFG
+
+	// the acquisitions in source order, and by call and release variable
+	order     []*acquisition
+	acqs      map[*ast.CallExpr]*acquisition
+	byRelease map[types.Object]*acquisition
+
+	// the acquisitions held on entry to each block, and the acquisitions that
+	// might have been released on entry to each block
+	in       map[*cfg.Block]heldSet
+	released map[*cfg.Block]heldSet
+}
+
+// newRegionFlow finds the acquisitions in the body of the function and, if
+// there are any, builds the control flow graph and the held sets
+func newRegionFlow(info *types.Info, body *ast.BlockStmt) *regionFlow {
+	rf := &regionFlow{
+		info:      info,
+		acqs:      make(map[*ast.CallExpr]*acquisition),
+		byRelease: make(map[types.Object]*acquisition),
+		in:        make(map[*cfg.Block]heldSet),
+		released:  make(map[*cfg.Block]heldSet),
+	}
+
+	var stack []ast.Node
+	ast.Inspect(body, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		if _, ok := n.(*ast.FuncLit); ok {
+			return false
+		}
+		stack = append(stack, n)
+
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		m, ok := isAcquireCall(info, call)
+		if !ok {
+			return true
+		}
+		a := &acquisition{call: call, method: m}
+
+		// the release function must be assigned to a variable, discarded
+		// or deferred. any other use of it can't be followed and the
+		// acquisition is ignored
+		switch p := stack[len(stack)-2].(type) {
+		case *ast.ExprStmt:
+			a.discarded = true
+		case *ast.AssignStmt:
+			if len(p.Lhs) != 1 || len(p.Rhs) != 1 {
+				return true
+			}
+			id, ok := p.Lhs[0].(*ast.Ident)
+			if !ok {
+				return true
+			}
+			if id.Name == "_" {
+				a.discarded = true
+			} else if a.release = info.ObjectOf(id); a.release == nil {
+				return true
+			}
+		case *ast.ValueSpec:
+			if len(p.Names) != 1 || len(p.Values) != 1 {
+				return true
+			}
+			if p.Names[0].Name == "_" {
+				a.discarded = true
+			} else {
+				a.release = info.Defs[p.Names[0]]
+			}
+		case *ast.CallExpr:
+			d, ok := stack[len(stack)-3].(*ast.DeferStmt)
+			if !ok || p.Fun != call || d.Call != p {
+				return true
+			}
+			a.deferred = true
+		default:
+			return true
+		}
+
+		rf.order = append(rf.order, a)
+		rf.acqs[call] = a
+		if a.release != nil {
+			rf.byRelease[a.release] = a
+		}
+		return true
+	})
+
+	if len(rf.acqs) == 0 {
+		return rf
+	}
+
+	rf.g = cfg.New(body, func(call *ast.CallExpr) bool {
+		return !isNoReturn(info, call)
+	})
+
+	// the held sets only ever get smaller, and the released sets only ever
+	// get bigger, once a block has been reached so the loop ends
+	rf.in[rf.g.Blocks[0]] = make(heldSet)
+	rf.released[rf.g.Blocks[0]] = make(heldSet)
+	for changed := true; changed; {
+		changed = false
+		for _, b := range rf.g.Blocks {
+			in := rf.in[b]
+			if in == nil {
+				continue
+			}
+			out, released := rf.transfer(in, rf.released[b], b.Nodes, nil)
+			for _, s := range b.Succs {
+				m := rf.in[s].meet(out)
+				j := rf.released[s].join(released)
+				if rf.in[s] == nil || len(m) != len(rf.in[s]) || len(j) != len(rf.released[s]) {
+					rf.in[s] = m
+					rf.released[s] = j
+					changed = true
+				}
+			}
+		}
+	}
+
+	return rf
+}
+
+// transfer returns the acquisitions held and the acquisitions that might have
+// been released after the nodes, given the same sets before them. if twice is
+// not nil it is called with each call of a release function that might
+// already have been called
+func (rf *regionFlow) transfer(in heldSet, rel heldSet, nodes []ast.Node, twice func(*ast.Ident)) (heldSet, heldSet) {
+	held := in.copy()
+	released := rel.copy()
+
+	// a call of the release function, either directly or deferred
+	call := func(id *ast.Ident) {
+		a, ok := rf.byRelease[rf.info.Uses[id]]
+		if !ok {
+			return
+		}
+		if released[a] && twice != nil {
+			twice(id)
+		}
+		released[a] = true
+	}
+
+	for _, n := range nodes {
+		ast.Inspect(n, func(nd ast.Node) bool {
+			switch x := nd.(type) {
+			case *ast.FuncLit:
+				return false
+			case *ast.DeferStmt:
+				// a deferred release is not called until the function
+				// returns
+				if id := identOf(x.Call.Fun); id != nil {
+					if _, ok := rf.byRelease[rf.info.Uses[id]]; ok {
+						call(id)
+						return false
+					}
+				}
+			case *ast.CallExpr:
+				if a, ok := rf.acqs[x]; ok {
+					held[a] = true
+					delete(released, a)
+				}
+				if id := identOf(x.Fun); id != nil {
+					call(id)
+				}
+			case *ast.Ident:
+				// any use of the release function other than a deferred
+				// call is assumed to release the lease
+				if a, ok := rf.byRelease[rf.info.Uses[x]]; ok {
+					delete(held, a)
+				}
+			}
+			return true
+		})
+	}
+	return held, released
+}
+
+// releasedTwice returns the calls of release functions that might already
+// have been called, in source order
+func (rf *regionFlow) releasedTwice() []*ast.Ident {
+	if rf.g == nil {
+		return nil
+	}
+	seen := make(map[*ast.Ident]bool)
+	var twice []*ast.Ident
+	for _, b := range rf.g.Blocks {
+		if rf.in[b] == nil {
+			continue
+		}
+		rf.transfer(rf.in[b], rf.released[b], b.Nodes, func(id *ast.Ident) {
+			if !seen[id] {
+				seen[id] = true
+				twice = append(twice, id)
+			}
+		})
+	}
+	sort.Slice(twice, func(i, j int) bool {
+		return twice[i].Pos() < twice[j].Pos()
+	})
+	return twice
+}
+
+// identOf returns the expression as an identifier or nil if it is not one
+func identOf(e ast.Expr) *ast.Ident {
+	id, _ := ast.Unparen(e).(*ast.Ident)
+	return id
+}
+
+// at returns whether an acquisition is held at the position and whether every
+// acquisition held is a read lease
+func (rf *regionFlow) at(pos token.Pos) (held bool, read bool) {
+	if rf.g == nil {
+		return false, false
+	}
+
+	// the smallest node containing the position
+	var blk *cfg.Block
+	idx := -1
+	var size token.Pos
+	for _, b := range rf.g.Blocks {
+		for i, n := range b.Nodes {
+			if n.Pos() <= pos && pos < n.End() && (idx < 0 || n.End()-n.Pos() < size) {
+				blk, idx, size = b, i, n.End()-n.Pos()
+			}
+		}
+	}
+	if blk == nil || rf.in[blk] == nil {
+		return false, false
+	}
+
+	h, _ := rf.transfer(rf.in[blk], rf.released[blk], blk.Nodes[:idx], nil)
+	if len(h) == 0 {
+		return false, false
+	}
+	read = true
+	for a := range h {
+		read = read && a.method.read
+	}
+	return true, read
+}
+
+// unreleased returns the position of a return statement, or the end of the
+// function, that can be reached from the acquisition without the release
+// function being used. returns false if the release function is used on every
+// path
+func (rf *regionFlow) unreleased(a *acquisition, end token.Pos) (token.Pos, bool) {
+	uses := func(n ast.Node) bool {
+		var used bool
+		ast.Inspect(n, func(nd ast.Node) bool {
+			if id, ok := nd.(*ast.Ident); ok && rf.info.Uses[id] == a.release {
+				used = true
+			}
+			return !used
+		})
+		return used
+	}
+
+	// the block and index of the node containing the acquisition
+	var start *cfg.Block
+	idx := -1
+	for _, b := range rf.g.Blocks {
+		for i, n := range b.Nodes {
+			if n.Pos() <= a.call.Pos() && a.call.End() <= n.End() {
+				start, idx = b, i
+			}
+		}
+	}
+	if start == nil {
+		return token.NoPos, false
+	}
+
+	visited := make(map[*cfg.Block]bool)
+	var search func(b *cfg.Block, nodes []ast.Node) (token.Pos, bool)
+	search = func(b *cfg.Block, nodes []ast.Node) (token.Pos, bool) {
+		for _, n := range nodes {
+			if uses(n) {
+				return token.NoPos, false
+			}
+		}
+		if len(b.Succs) == 0 {
+			if len(b.Nodes) == 0 {
+				return end, b.Live
+			}
+			switch n := b.Nodes[len(b.Nodes)-1].(type) {
+			case *ast.ReturnStmt:
+				return n.Pos(), true
+			case *ast.ExprStmt:
+				if call, ok := n.X.(*ast.CallExpr); ok && isNoReturn(rf.info, call) {
+					return token.NoPos, false
+				}
+			}
+			return end, true
+		}
+		for _, s := range b.Succs {
+			if visited[s] {
+				continue
+			}
+			visited[s] = true
+			if pos, ok := search(s, s.Nodes); ok {
+				return pos, true
+			}
+		}
+		return token.NoPos, false
+	}
+	return search(start, start.Nodes[idx+1:])
+}
+
+// the functions that never return, in addition to the panic builtin
+var noReturnFunctions = map[string]bool{
+	"os.Exit":        true,
+	"runtime.Goexit": true,
+	"log.Fatal":      true,
+	"log.Fatalf":     true,
+	"log.Fatalln":    true,
+	"log.Panic":      true,
+	"log.Panicf":     true,
+	"log.Panicln":    true,
+}
+
+// isNoReturn returns true if the call is to a function that never returns
+func isNoReturn(info *types.Info, call *ast.CallExpr) bool {
+	switch fn := typeutil.Callee(info, call).(type) {
+	case *types.Builtin:
+		return fn.Name() == "panic"
+	case *types.Func:
+		return fn.Pkg() != nil && noReturnFunctions[fn.Pkg().Path()+"."+fn.Name()]
+	}
+	return false
+}
+
+// acquireRegions caches the region analysis of each function. functions in
+// the package being analysed use the type information of the pass. functions
+// reached through the callgraph use the type information of the load made for
+// the callgraph
+type acquireRegions struct {
+	infos map[*types.Package]*types.Info
+	flows map[ast.Node]*regionFlow
+}
+
+func newAcquireRegions(initial []*packages.Package) *acquireRegions {
+	ar := &acquireRegions{
+		infos: make(map[*types.Package]*types.Info),
+		flows: make(map[ast.Node]*regionFlow),
+	}
+	packages.Visit(initial, nil, func(p *packages.Package) {
+		if p.Types != nil && p.TypesInfo != nil {
+			ar.infos[p.Types] = p.TypesInfo
+		}
+	})
+	return ar
+}
+
+// flow returns the region analysis of the function declaration or function
+// literal
+func (ar *acquireRegions) flow(info *types.Info, nf ast.Node) *regionFlow {
+	if rf, ok := ar.flows[nf]; ok {
+		return rf
+	}
+	var body *ast.BlockStmt
+	switch f := nf.(type) {
+	case *ast.FuncDecl:
+		body = f.Body
+	case *ast.FuncLit:
+		body = f.Body
+	}
+	var rf *regionFlow
+	if body != nil {
+		rf = newRegionFlow(info, body)
+	}
+	ar.flows[nf] = rf
+	return rf
+}
+
+// at returns whether the position in the function is inside an acquire
+// region and whether the region is a read lease
+func (ar *acquireRegions) at(info *types.Info, nf ast.Node, pos token.Pos) (bool, bool) {
+	if ar == nil {
+		return false, false
+	}
+	rf := ar.flow(info, nf)
+	if rf == nil {
+		return false, false
+	}
+	return rf.at(pos)
+}
+
+// site returns whether the call site of the callgraph edge is inside an acquire
+// region of the calling function. calls made by go and defer statements run
+// outside of the region
+func (ar *acquireRegions) site(e *callgraph.Edge) (bool, bool) {
+	if ar == nil || e.Site == nil || e.Caller.Func == nil || e.Caller.Func.Pkg == nil {
+		return false, false
+	}
+	if _, ok := e.Site.(*ssa.Call); !ok {
+		return false, false
+	}
+	info := ar.infos[e.Caller.Func.Pkg.Pkg]
+	if info == nil {
+		return false, false
+	}
+	return ar.at(info, e.Caller.Func.Syntax(), e.Site.Pos())
+}
+
+// checkAcquireRelease reports calls to an acquire method where the release
+// function is discarded, or where there is a path through the function that
+// doesn't use the release function
+func checkAcquireRelease(pass *analysis.Pass, rep *reporter, inspect *inspector.Inspector, ar *acquireRegions) {
+	inspect.WithStack([]ast.Node{(*ast.FuncDecl)(nil), (*ast.FuncLit)(nil)}, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+		rf := ar.flow(pass.TypesInfo, n)
+		if rf == nil || rf.g == nil {
+			return true
+		}
+
+		end := n.End() - 1
+		for _, a := range rf.order {
+			sel := ast.Unparen(a.call.Fun).(*ast.SelectorExpr)
+			subj := subject{
+				typ:   typeName(pass.TypesInfo.TypeOf(sel.X)),
+				field: sel.Sel.Name,
+				fn:    functionName(stack),
+			}
+			switch {
+			case a.deferred:
+			case a.discarded:
+				rep.reportDetail(a.call.Pos(), RuleAcquireRelease, subj, "the release function is discarded")
+			default:
+				if pos, ok := rf.unreleased(a, end); ok {
+					rep.reportExtra(a.call.Pos(), RuleAcquireRelease, subj, extra{
+						detail: "not released on every path",
+						related: []analysis.RelatedInformation{{
+							Pos:     pos,
+							Message: "reached without calling " + a.release.Name(),
+						}},
+					})
+				}
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,151 @@
+package analysis
+
+import (
+	"go/ast"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// the names of the mutex fields that are recognised in adoption mode
+var adoptMutexNames = map[string]bool{
+	"mu":   true,
+	"lock": true,
+}
+
+// adoptedMutex returns the name of the mutex field if the type is a struct,
+// or a pointer to a struct, with a sync.Mutex or sync.RWMutex field named mu
+// or lock. crit.Section derived types are never adopted
+func adoptedMutex(t types.Type) (string, bool) {
+	if t == nil || isCritDerived(t) {
+		return "", false
+	}
+	t = types.Unalias(t)
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	s, ok := t.Underlying().(*types.Struct)
+	if !ok {
+		return "", false
+	}
+	for i := 0; i < s.NumFields(); i++ {
+		f := s.Field(i)
+		if adoptMutexNames[f.Name()] && isMutexType(f.Type()) {
+			return f.Name(), true
+		}
+	}
+	return "", false
+}
+
+// isUnguardedType returns true if the field type is safe to use without the
+// mutex. this includes the types in the sync and sync/atomic packages, and
+// channels
+func isUnguardedType(t types.Type) bool {
+	t = types.Unalias(t)
+	if _, ok := t.Underlying().(*types.Chan); ok {
+		return true
+	}
+	if n, ok := t.(*types.Named); ok && n.Obj().Pkg() != nil {
+		switch n.Obj().Pkg().Path() {
+		case "sync", "sync/atomic":
+			return true
+		}
+	}
+	return false
+}
+
+// checkAdoption treats any struct with a mutex field named mu or lock as if it
+// were a crit.Section derived type, and reports accesses to the other fields
+// of the struct made outside of a Lock()/Unlock() window. it is intended to
+// give a preview of the analysis for code that does not yet use crit.Section
+//
+// the windows are found lexically, in source order, inside each function. a
+// deferred Unlock() keeps the window open until the end of the function. the
+// following are assumed to be called with the mutex held:
+//
+//   - functions with names ending in Locked, by convention
+//   - constructors, with names beginning with new or New
+func checkAdoption(pass *analysis.Pass, rep *reporter, inspect *inspector.Inspector) {
+	inspect.Preorder([]ast.Node{(*ast.FuncDecl)(nil), (*ast.FuncLit)(nil)}, func(n ast.Node) {
+		var body *ast.BlockStmt
+		var name string
+		switch f := n.(type) {
+		case *ast.FuncDecl:
+			body = f.Body
+			name = f.Name.Name
+		case *ast.FuncLit:
+			body = f.Body
+		}
+		if body == nil {
+			return
+		}
+		if strings.HasSuffix(name, "Locked") || strings.HasPrefix(name, "new") || strings.HasPrefix(name, "New") {
+			return
+		}
+
+		// the mutexes that are held, keyed by the expression for the mutex.
+		// for example, s.mu
+		held := make(map[string]bool)
+
+		ast.Inspect(body, func(nd ast.Node) bool {
+			switch m := nd.(type) {
+			case *ast.FuncLit:
+				// function literals are checked separately
+				return false
+
+			case *ast.DeferStmt:
+				// a deferred unlock does not end the window
+				return false
+
+			case *ast.CallExpr:
+				fn, ok := typeutil.Callee(pass.TypesInfo, m).(*types.Func)
+				if !ok {
+					return true
+				}
+				sel, ok := m.Fun.(*ast.SelectorExpr)
+				if !ok || !isMutexType(pass.TypesInfo.TypeOf(sel.X)) {
+					return true
+				}
+				switch fn.Name() {
+				case "Lock", "RLock":
+					held[types.ExprString(sel.X)] = true
+				case "Unlock", "RUnlock":
+					held[types.ExprString(sel.X)] = false
+				}
+
+			case *ast.SelectorExpr:
+				mu, ok := adoptedMutex(pass.TypesInfo.TypeOf(m.X))
+				if !ok {
+					return true
+				}
+				s, ok := pass.TypesInfo.Selections[m]
+				if !ok || s.Kind() != types.FieldVal || m.Sel.Name == mu {
+					return true
+				}
+				if isUnguardedType(pass.TypesInfo.TypeOf(m)) {
+					return true
+				}
+				if held[types.ExprString(m.X)+"."+mu] {
+					return true
+				}
+				rep.report(m.Pos(), RuleAdoptAccess, subject{
+					typ:   typeString(pass.TypesInfo.TypeOf(m.X)),
+					field: m.Sel.Name,
+					fn:    name,
+				})
+			}
+			return true
+		})
+	})
+}
+
+// typeString returns the type without a pointer, qualified by package path
+func typeString(t types.Type) string {
+	if p, ok := types.Unalias(t).(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	return types.TypeString(t, nil)
+}
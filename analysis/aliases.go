@@ -0,0 +1,295 @@
+package analysis
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// aliases maps variables that are pointers to a crit.Section derived type to
+// the expression they were assigned from. for example, after p := &C the
+// variable p is mapped to the expression &C
+//
+// pointers to the crit section types themselves are also recorded. for
+// example, after s := &C.Section the variable s is mapped to &C.Section
+//
+// variables of type crit.Instrumented are mapped to the Leaser they wrap
+//
+// pointers to structs that contain a crit.Section derived type in one of their
+// fields are also recorded, so that a section reached through the pointer can
+// be resolved. for example, after srv := &app.server the expression
+// srv.state is the same instance as app.server.state
+//
+// the pointer receiver of an unexported method is mapped to the receiver used
+// where the method is called. for example, after app.server.handle() the
+// receiver of handle() is mapped to &app.server
+//
+// a variable that is assigned from more than one expression is mapped to nil.
+// such a variable could point to any instance
+type aliases map[types.Object]ast.Expr
+
+// findAliases looks for pointers to crit.Section derived types, and to the crit
+// section types, in the package and records what they are assigned from
+func findAliases(pass *analysis.Pass) aliases {
+	al := make(aliases)
+
+	recordObj := func(obj types.Object, rhs ast.Expr) {
+		switch {
+		case isCritPointer(obj.Type()), isSectionPointer(obj.Type()), isOwnerPointer(obj.Type()):
+		case isInstrumentedType(obj.Type()):
+			if rhs != nil {
+				rhs = instrumentedLeaser(pass, rhs)
+			}
+		default:
+			return
+		}
+		if e, ok := al[obj]; ok {
+			if e == nil || rhs == nil || types.ExprString(e) != types.ExprString(rhs) {
+				al[obj] = nil
+			}
+			return
+		}
+		al[obj] = rhs
+	}
+
+	record := func(lhs ast.Expr, rhs ast.Expr) {
+		id, ok := lhs.(*ast.Ident)
+		if !ok || id.Name == "_" {
+			return
+		}
+		if obj := pass.TypesInfo.ObjectOf(id); obj != nil {
+			recordObj(obj, rhs)
+		}
+	}
+
+	// the pointer receivers of unexported methods in the package. the
+	// receiver of an exported method can be anything in another package
+	receivers := make(map[*types.Func]types.Object)
+	for _, f := range pass.Files {
+		for _, d := range f.Decls {
+			fd, ok := d.(*ast.FuncDecl)
+			if !ok || fd.Recv == nil || fd.Name.IsExported() || len(fd.Recv.List[0].Names) != 1 {
+				continue
+			}
+			fn, ok := pass.TypesInfo.Defs[fd.Name].(*types.Func)
+			if !ok {
+				continue
+			}
+			if recv := pass.TypesInfo.Defs[fd.Recv.List[0].Names[0]]; recv != nil {
+				if _, ok := types.Unalias(recv.Type()).(*types.Pointer); ok {
+					receivers[fn] = recv
+				}
+			}
+		}
+	}
+
+	// method is called for every selection of a method with a pointer
+	// receiver. the receiver is only recorded where the method is called.
+	// any other use, such as a method value, could be called with any
+	// receiver
+	method := func(sel *ast.SelectorExpr, called bool) {
+		s, ok := pass.TypesInfo.Selections[sel]
+		if !ok || s.Kind() != types.MethodVal {
+			return
+		}
+		fn, ok := s.Obj().(*types.Func)
+		if !ok {
+			return
+		}
+		recv, ok := receivers[fn.Origin()]
+		if !ok {
+			return
+		}
+		if !called {
+			recordObj(recv, nil)
+			return
+		}
+		x := sel.X
+		if _, ok := types.Unalias(pass.TypesInfo.TypeOf(x)).(*types.Pointer); !ok {
+			x = &ast.UnaryExpr{OpPos: x.Pos(), Op: token.AND, X: x}
+		}
+		recordObj(recv, x)
+	}
+
+	// selectors that are the function of a call. the call is visited before
+	// the selector
+	calls := make(map[*ast.SelectorExpr]bool)
+
+	for _, f := range pass.Files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch m := n.(type) {
+			case *ast.AssignStmt:
+				if len(m.Lhs) != len(m.Rhs) {
+					for _, lhs := range m.Lhs {
+						record(lhs, nil)
+					}
+					return true
+				}
+				for i := range m.Lhs {
+					record(m.Lhs[i], m.Rhs[i])
+				}
+			case *ast.ValueSpec:
+				for i, name := range m.Names {
+					if i < len(m.Values) && len(m.Names) == len(m.Values) {
+						record(name, m.Values[i])
+					}
+				}
+			case *ast.RangeStmt:
+				if m.Key != nil {
+					record(m.Key, nil)
+				}
+				if m.Value != nil {
+					record(m.Value, nil)
+				}
+			case *ast.CallExpr:
+				if sel, ok := ast.Unparen(m.Fun).(*ast.SelectorExpr); ok {
+					method(sel, true)
+					calls[sel] = true
+				}
+			case *ast.SelectorExpr:
+				if !calls[m] {
+					method(m, false)
+				}
+			}
+			return true
+		})
+	}
+
+	return al
+}
+
+// isCritPointer returns true if the type is a pointer to a crit.Section
+// derived type
+func isCritPointer(t types.Type) bool {
+	p, ok := types.Unalias(t).(*types.Pointer)
+	return ok && isCritDerived(p.Elem())
+}
+
+// isOwnerPointer returns true if the type is a pointer to a struct that is not
+// itself a crit.Section derived type but that contains one, in one of its
+// fields or in the fields of a struct field
+func isOwnerPointer(t types.Type) bool {
+	p, ok := types.Unalias(t).(*types.Pointer)
+	if !ok || isCritDerived(p.Elem()) {
+		return false
+	}
+	return ownsSection(p.Elem(), make(map[types.Type]bool))
+}
+
+// ownsSection returns true if the struct type has a field that is a
+// crit.Section derived type, directly or in a struct field. pointer fields
+// are not followed
+func ownsSection(t types.Type, seen map[types.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+	s, ok := t.Underlying().(*types.Struct)
+	if !ok {
+		return false
+	}
+	for i := 0; i < s.NumFields(); i++ {
+		ft := s.Field(i).Type()
+		if _, ok := types.Unalias(ft).(*types.Pointer); ok {
+			continue
+		}
+		if isCritDerived(ft) || ownsSection(ft, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSectionPointer returns true if the type is a pointer to one of the crit
+// section types
+func isSectionPointer(t types.Type) bool {
+	p, ok := types.Unalias(t).(*types.Pointer)
+	return ok && isCritSectionType(p.Elem())
+}
+
+// maximum number of aliases that will be followed when resolving a section
+// path. prevents infinite recursion with code like p = q; q = p
+const maxAliasDepth = 10
+
+// instanceType returns the crit.Section derived type if the expression creates
+// a new instance of the type. the expression can be a composite literal, the
+// address of a composite literal or a call to new()
+func instanceType(pass *analysis.Pass, e ast.Expr) (*types.TypeName, bool) {
+	switch x := e.(type) {
+	case *ast.ParenExpr:
+		return instanceType(pass, x.X)
+	case *ast.CompositeLit:
+		return critDerived(pass.TypesInfo.TypeOf(x))
+	case *ast.UnaryExpr:
+		if _, ok := x.X.(*ast.CompositeLit); ok {
+			return instanceType(pass, x.X)
+		}
+	case *ast.CallExpr:
+		if id, ok := x.Fun.(*ast.Ident); ok && len(x.Args) == 1 {
+			if _, ok := pass.TypesInfo.ObjectOf(id).(*types.Builtin); ok && id.Name == "new" {
+				return critDerived(pass.TypesInfo.TypeOf(x.Args[0]))
+			}
+		}
+	}
+	return nil, false
+}
+
+// the name of the wrapper type in the crit package and the name of the
+// function that creates one
+const (
+	critInstrumentedType = "Instrumented"
+	newInstrumented      = "NewInstrumented"
+)
+
+// isInstrumentedType returns true if the type is crit.Instrumented or a pointer
+// to it
+func isInstrumentedType(t types.Type) bool {
+	t = types.Unalias(t)
+	if p, ok := t.(*types.Pointer); ok {
+		t = types.Unalias(p.Elem())
+	}
+	n, ok := t.(*types.Named)
+	if !ok || n.Obj().Pkg() == nil {
+		return false
+	}
+	return n.Obj().Name() == critInstrumentedType && isCritPackage(n.Obj().Pkg().Path())
+}
+
+// instrumentedLeaser returns the expression for the Leaser wrapped by the
+// crit.Instrumented created by the expression. if the expression does not
+// create a crit.Instrumented, for example because it is another variable,
+// then the expression is returned unchanged
+func instrumentedLeaser(pass *analysis.Pass, e ast.Expr) ast.Expr {
+	switch x := e.(type) {
+	case *ast.ParenExpr:
+		return instrumentedLeaser(pass, x.X)
+	case *ast.UnaryExpr:
+		if _, ok := x.X.(*ast.CompositeLit); ok {
+			return instrumentedLeaser(pass, x.X)
+		}
+	case *ast.CompositeLit:
+		for _, elt := range x.Elts {
+			kv, ok := elt.(*ast.KeyValueExpr)
+			if !ok {
+				continue
+			}
+			if k, ok := kv.Key.(*ast.Ident); ok && k.Name == "Leaser" {
+				return kv.Value
+			}
+		}
+		if len(x.Elts) > 0 {
+			if _, ok := x.Elts[0].(*ast.KeyValueExpr); !ok {
+				return x.Elts[0]
+			}
+		}
+	case *ast.CallExpr:
+		fn, ok := typeutil.Callee(pass.TypesInfo, x).(*types.Func)
+		if ok && fn.Name() == newInstrumented && fn.Pkg() != nil && isCritPackage(fn.Pkg().Path()) && len(x.Args) > 0 {
+			return x.Args[0]
+		}
+	}
+	return e
+}
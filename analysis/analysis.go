@@ -1,268 +1,773 @@
 package analysis
 
 import (
+	"context"
 	"errors"
-	"fmt"
 	"go/ast"
 	"go/token"
 	"go/types"
-	"log"
+	"log/slog"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
 
 	"golang.org/x/tools/go/analysis"
 	"golang.org/x/tools/go/analysis/passes/inspect"
 	"golang.org/x/tools/go/ast/inspector"
 	"golang.org/x/tools/go/callgraph"
-	"golang.org/x/tools/go/callgraph/cha"
-	"golang.org/x/tools/go/callgraph/vta"
 	"golang.org/x/tools/go/packages"
-	"golang.org/x/tools/go/ssa"
-	"golang.org/x/tools/go/ssa/ssautil"
+	"golang.org/x/tools/go/types/typeutil"
 )
 
 var CritSection = &analysis.Analyzer{
-	Name:     "CritSection",
-	Doc:      "check for access of critical sections outside of a lease function",
-	Run:      run,
-	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Name:       "CritSection",
+	Doc:        "check for access of critical sections outside of a lease function",
+	Run:        run,
+	Requires:   []*analysis.Analyzer{inspect.Analyzer, Directives, Program},
+	ResultType: reflect.TypeOf((*Result)(nil)),
 }
 
-// information about the crit package
+// the names of the lease functions in the crit package. the full set of lease
+// methods is in the leaseMethods registry
 const (
-	critName      = "github.com/jetsetilly/critsec/crit.Section"
-	leaseFunction = "Lease"
+	leaseFunction  = "Lease"
+	rleaseFunction = "RLease"
 )
 
+// isLeaseFunction returns true if the name is the name of a lease method or of
+// one of the lease functions of the crit package
+func isLeaseFunction(name string) bool {
+	if _, ok := lookupLeaseMethod(name); ok {
+		return true
+	}
+	_, ok := lookupLeaseFunction(name)
+	return ok
+}
+
+// analyzer flags
+var (
+	configFile     string
+	debugTimings   bool
+	debugDecisions bool
+	leaseLoopMax   int
+	initOnce       bool
+	multiInstance  string
+	singleRoutine  bool
+	retains        string
+	fieldTags      bool
+	adoptMode      bool
+	binaries       string
+	plugins        string
+	critModules    string
+	extraLeases    string
+	minCritVersion int
+	sections       sectionList
+	initPhase      initPhasePolicy
+	logEvents      logLevel
+
+	leaseSizeStatements int
+	leaseSizeCalls      int
+)
+
+func init() {
+	CritSection.Flags.StringVar(&configFile, "config", "", "the critsec configuration file")
+	CritSection.Flags.IntVar(&leaseLoopMax, "leaseloop.max", 3, "the largest lease body, in statements, that is reported when Lease is called inside a loop (rule CS006)")
+	CritSection.Flags.IntVar(&leaseSizeStatements, "leasesize.statements", 20, "the maximum number of statements in a lease body (rule CS007)")
+	CritSection.Flags.IntVar(&leaseSizeCalls, "leasesize.calls", 5, "the maximum number of functions called from a lease body (rule CS007)")
+	CritSection.Flags.BoolVar(&initOnce, "initonce", false, "allow fields that are only written during initialisation to be used without Lease")
+	CritSection.Flags.Var(&initPhase, "initphase", "the `policy` for accesses during package initialisation, in init() and in the values of package level variables. check reports them in the same way as any other access. setup allows accesses that can only be made during package initialisation to be made without Lease")
+	CritSection.Flags.StringVar(&multiInstance, "allow-multiple-instances", "", "comma-separated list of crit.Section derived types that can have more than one instance (rule CS004)")
+	CritSection.Flags.BoolVar(&singleRoutine, "singlegoroutine", false, "report types that are only used from a single goroutine once with the info rule CS019, instead of reporting each unleased access")
+	CritSection.Flags.StringVar(&retains, "retains", "", "comma-separated list of syscall, golang.org/x/sys or cgo functions that keep the pointers passed to them (rule CS020). cgo functions are named C.name")
+	CritSection.Flags.BoolVar(&fieldTags, "fieldtags", false, "read the policy of a field from its crit struct tag as well as from the field directives")
+	CritSection.Flags.BoolVar(&adoptMode, "adopt", false, "treat structs with a sync.Mutex field named mu or lock as crit sections and report accesses outside of Lock/Unlock (rule CS026)")
+	CritSection.Flags.StringVar(&binaries, "binaries", "", "comma-separated list of main package patterns. accesses that are leased in some of the binaries but not in others are reported (rule CS030)")
+	CritSection.Flags.StringVar(&plugins, "plugins", "", "comma-separated list of plugin packages, built with -buildmode=plugin. the exported functions and variables of the packages are treated as entry points called by the host binary. a path ending in /... matches every package below it")
+	CritSection.Flags.StringVar(&critModules, "crit-module", "", "comma-separated list of module or package paths of forks of the crit package. the forks are treated the same as the crit package")
+	CritSection.Flags.StringVar(&extraLeases, "lease-methods", "", "comma-separated list of additional lease methods for forks of the crit package. each method is given as name[:read][:conditional][:args]. the args option is for methods and crit package functions that lease the sections passed to them as well as the receiver")
+	CritSection.Flags.IntVar(&minCritVersion, "min-crit-version", 0, "the lowest API version of the crit package (crit.APIVersion) that is accepted. a package using an older crit package is reported (rule CS040)")
+	CritSection.Flags.Var(&sections, "section", "restrict the analysis to the named crit.Section derived types. can be given more than once and each value can be a comma-separated list")
+	CritSection.Flags.Var(&logEvents, "log", "the `level` of the structured log written to stderr. off, info or debug. info logs the analysis of each package and debug adds the phases of the analysis and the decision made for each access")
+	CritSection.Flags.BoolVar(&debugTimings, "debug.timings", false, "print a summary of how long each phase of the analysis takes")
+	CritSection.Flags.BoolVar(&debugDecisions, "debug.decisions", false, "print how the lease check was decided for each access")
+}
+
+// LoadConfig is the basis of the configuration used to load the program when
+// building the callgraph. drivers should set it if the packages being analysed
+// were loaded with an overlay or with build flags, so that the callgraph is
+// built from the same source
+var LoadConfig packages.Config
+
+// ProgramPatterns are the patterns of the packages being analysed. drivers that
+// analyse more than one package in a run should set it so that the program is
+// loaded and its callgraph built once, and shared by every package in it. when
+// it is empty the program is loaded from the package being analysed
+var ProgramPatterns []string
+
 func run(pass *analysis.Pass) (any, error) {
-	pcfg := packages.Config{
-		Mode: packages.LoadAllSyntax,
-		Fset: pass.Fset,
+	lg := newLogger(pass.Pkg.Path())
+	lg.Info("analysis started")
+
+	tm := timings{log: lg}
+	if debugTimings {
+		defer tm.print(os.Stderr, pass.Pkg.Path())
 	}
-	initial, err := packages.Load(&pcfg, ".")
-	if err != nil {
-		log.Fatalf(err.Error())
+
+	var cfg Config
+	if configFile != "" {
+		var err error
+		cfg, err = ReadConfig(configFile)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	// create VTA graph. the construct of the graph is important for the
-	// checkLease() function, particularly the recursive check() function
-	prog, _ := ssautil.AllPackages(initial, ssa.InstantiateGenerics)
-	prog.Build()
-	funcs := ssautil.AllFunctions(prog)
-	graph := vta.CallGraph(funcs, cha.CallGraph(prog))
+	// the program and its callgraph are built by the Program analyzer. the
+	// time taken is added to the timings unless the program was cached
+	built := pass.ResultOf[Program].(*program)
+	initial, graph := built.initial, built.graph
+	tm.phases = append(tm.phases, built.phases...)
 
-	for _, f := range pass.Files {
-		critSecTypesByName := make(map[string]types.Type)
-		critSecTypesUsed := make(map[string]bool)
-
-		// identify crit.Section types
-		var newCritSecType types.Type
-		ast.Inspect(f, func(n ast.Node) bool {
-			switch n := n.(type) {
-			case *ast.Ident:
-				if newCritSecType == nil {
-					return true
+	done := tm.start("inspection")
+
+	rep := newReporter(pass, cfg)
+	chk := newLeaseChecker(pass, graph)
+	chk.regions = newAcquireRegions(initial)
+
+	// reports suppressed by the ignore directives. directives that can't be
+	// used are reported so that they are not silently ineffective
+	var bad []malformed
+	rep.ignores, bad = findIgnores(pass)
+	for _, b := range bad {
+		rep.reportDetail(b.pos, RuleIgnoreDirective, subject{}, b.reason)
+	}
+
+	// crit.Section derived types that have been instantiated. for simplicity,
+	// only one instance of each type is allowed. test functions are run
+	// independently of each other so each test function is allowed an
+	// instance of its own
+	type instanceKey struct {
+		id   *types.TypeName
+		test ast.Node
+	}
+	critSecTypesUsed := make(map[instanceKey]bool)
+
+	// the directives of objects in the package and in the packages it
+	// imports
+	dirs := pass.ResultOf[Directives].(*directives)
+
+	// test doubles are allowed more than one instance and can be passed by
+	// value
+	tds := findTestDoubles(pass, rep)
+
+	// types that are allowed more than one instance
+	multi := dirs.multi
+	allowMultiple := func(id *types.TypeName) bool {
+		if multi[id] || tds[id] {
+			return true
+		}
+		for _, name := range strings.Split(multiInstance, ",") {
+			name = strings.TrimSpace(name)
+			if name == id.Name() || name == qualifiedName(id) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// functions that have the requires directive. calls to these functions
+	// are checked in the same way as accesses
+	requiresFuncs := dirs.requires
+
+	// uses and replacements of channel fields
+	chans := newChanTracker()
+
+	// pointers to crit.Section derived types and the instance they point to
+	al := findAliases(pass)
+
+	// functions that create and return a new instance
+	constructors := findConstructors(pass)
+
+	// positions where a multiple instance has been reported. a single
+	// expression can create more than one instance (eg. an array of a
+	// crit.Section derived type) but should only be reported once
+	instanceReported := make(map[token.Pos]bool)
+
+	// the position of the first instance of each crit.Section derived type
+	instancePos := make(map[string]token.Pos)
+
+	// instance is called for every instance of a crit.Section derived type
+	// that is created
+	instance := func(n ast.Node, id *types.TypeName, stack []ast.Node) {
+		// the instance is counted where the constructor is called
+		if inConstructorOf(pass, constructors, id, stack) {
+			return
+		}
+
+		// instances that are part of a test double are not counted
+		var t types.Type
+		switch x := n.(type) {
+		case *ast.ValueSpec:
+			t = pass.TypesInfo.TypeOf(x.Type)
+		case ast.Expr:
+			t = pass.TypesInfo.TypeOf(x)
+		}
+		if tds.has(t) {
+			return
+		}
+
+		// the first instance is where a goroutine-confined type is reported
+		if _, ok := instancePos[qualifiedName(id)]; !ok {
+			instancePos[qualifiedName(id)] = n.Pos()
+		}
+
+		// for simplicity, only one instance of a critsec type can be
+		// instantiated
+		if allowMultiple(id) {
+			return
+		}
+
+		key := instanceKey{id: id, test: enclosingTest(pass, stack)}
+		if _, ok := critSecTypesUsed[key]; !ok {
+			critSecTypesUsed[key] = true
+			return
+		}
+
+		// but only report on it if the function is in the graph
+		nf, ok := nearestFunction(stack)
+		if !ok {
+			return
+		}
+		if !isFunctionInGraph(pass, graph, nf) {
+			return
+		}
+
+		if instanceReported[n.Pos()] {
+			return
+		}
+		instanceReported[n.Pos()] = true
+
+		rep.report(n.Pos(), RuleMultipleInstance, subject{
+			typ: qualifiedName(id),
+			fn:  functionName(stack),
+		})
+	}
+
+	// the goroutines that accesses can be reached from. unleased accesses
+	// are held back until it is known whether their type is confined to a
+	// single goroutine
+	orig := newOrigins(graph, chk.wrapped)
+	used := make(goroutines)
+	var pending []pendingReport
+
+	// map of inspected tokens. if we've seen one before we ignore it
+	inspectedPos := make(map[token.Pos]bool)
+
+	// inspect the AST and match with SelectorExprs and the expressions that
+	// create instances
+	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+
+	// fields that are only written during initialisation. the initonce flag
+	// relaxes what counts as initialisation
+	initFields := findInitOnce(pass, inspect, initOnce)
+
+	// calls to the Start() function of the sections
+	starts := findStarts(pass, inspect)
+	fins := findFinalizers(pass, inspect)
+	hands := findHandlers(pass, inspect)
+	dcs := findDoubleChecks(pass, inspect)
+
+	// instances handed between goroutines with the transfer directive
+	trans := findTransfers(pass, inspect, constructors)
+	ph := newPhases(pass.Fset, graph, starts, append(fins.nodes(pass, graph), hands.nodes(pass, graph)...))
+	if initPhase == initPhaseSetup {
+		ph.findInitOnly()
+	}
+
+	// methods used as values. creating the value is not an access but the
+	// reports for accesses in the method show where the value was created
+	mvs := findMethodValues(pass, inspect)
+
+	// fields that are guarded by a mutex rather than the crit.Section
+	guardedFields := checkMixedLocks(pass, rep, inspect)
+
+	// fields declared as not requiring the lease
+	unguardedFields := checkFieldPolicy(pass, rep, inspect)
+
+	// fields declared in other packages that do not require the lease
+	for v := range dirs.fields {
+		if v.Pkg() != pass.Pkg {
+			unguardedFields[v] = true
+		}
+	}
+
+	rep.result.Model = findModel(pass, inspect, dirs, initFields, guardedFields, unguardedFields)
+
+	inspect.WithStack(nil, func(n ast.Node, push bool, stack []ast.Node) bool {
+		// nodes are only checked when they are pushed onto the stack
+		if !push {
+			return true
+		}
+
+		// ignore nodes at a position that has already been checked. for
+		// example, a call to a function with the requires directive and the
+		// selector expression for the function being called
+		if _, ok := inspectedPos[n.Pos()]; ok {
+			return true
+		}
+
+		// the rule that will be reported if the access is not leased
+		var rule Rule
+
+		// the crit.Section derived instance being accessed. used when
+		// suggesting fixes
+		var section ast.Expr
+
+		// what the access is about
+		var subj subject
+
+		// the channel field being assigned to, if any
+		var chanAssign *types.Var
+
+		// how the field is changed without being assigned to, if it is. for
+		// example, a write to a map element
+		var mutation string
+
+		switch m := n.(type) {
+
+		// make sure no crit.Section types are passed as function parameters
+		case *ast.FuncDecl:
+			if m.Type.Params == nil {
+				return true
+			}
+
+			// check function is in graph before making any more decisions
+			if !isFunctionInGraph(pass, graph, m) {
+				return true
+			}
+
+			for _, p := range m.Type.Params.List {
+				// a parameter that receives a transferred instance owns it
+				if len(p.Names) > 0 && trans.ownedVar(pass, p.Names[0]) {
+					continue
 				}
-				critSecTypesByName[n.Name] = newCritSecType
-				critSecTypesByName[fmt.Sprintf("*%s", n.Name)] = types.NewPointer(newCritSecType)
-				newCritSecType = nil
-			case *ast.TypeSpec:
-				t, ok := n.Type.(*ast.StructType)
-				if !ok {
+
+				t := pass.TypesInfo.TypeOf(p.Type)
+				if isCritDerived(t) && !tds.has(t) {
+					rep.report(n.Pos(), RuleParameter, subject{
+						typ: typeName(t),
+						fn:  functionName(stack),
+					})
 					return true
 				}
-				for _, fld := range t.Fields.List {
-					if len(fld.Names) == 0 {
-						if s, ok := fld.Type.(*ast.SelectorExpr); ok {
-							if pass.TypesInfo.Types[s].Type.String() == critName {
-								newCritSecType = pass.TypesInfo.TypeOf(t)
-							}
-						}
-					}
-				}
 			}
 			return true
-		})
 
-		// map of inspected tokens. if we've seen one before we ignore it
-		inspectedPos := make(map[token.Pos]bool)
+		// reading a value from a critical section will begin with a
+		// selector expression
+		case *ast.SelectorExpr:
+			// check that the node type is one that we're interested in. a
+			// field promoted through an embedded crit.Section derived type
+			// is a field of the embedded type
+			promoted, isPromoted := promotedSection(pass, m)
+			if !isCritDerived(pass.TypesInfo.TypeOf(m.X)) && !isPromoted {
+				return true
+			}
 
-		// inspect the AST and match with SelectorExprs and AssignStmts
-		inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
-		inspect.WithStack(nil, func(n ast.Node, push bool, stack []ast.Node) bool {
-			// update inspectedPos map with new token position
-			if _, ok := inspectedPos[n.Pos()]; ok {
+			// we don't want to match with the selector that calls the
+			// lease function, or any other method of the crit types. nor do
+			// we want to match with a nested section that is only being
+			// used to reach its own fields
+			if isSectionMember(pass, m) || isNestedSection(pass, m, stack) {
+				return true
+			}
+			if mvs.selectors[m] {
 				return true
 			}
-			inspectedPos[n.Pos()] = true
 
-			var msg string
+			// fields that are only written during initialisation, and
+			// fields that are guarded by a mutex, do not require the lease
+			if f := selectedField(pass, m); initFields[f] || guardedFields[f] || unguardedFields[f] {
+				return true
+			}
 
-			switch m := n.(type) {
+			// the methods of crit.COW do not require the lease
+			if isCOWOp(pass, m, stack) {
+				return true
+			}
 
-			// make sure no crit.Section types are passed as function parameters
-			case *ast.FuncDecl:
-				if m.Type.Params == nil {
+			// channel operations do not require the lease but the uses
+			// are recorded in case the channel is replaced elsewhere
+			if field, ok := chanField(pass, m); ok && isChanOp(pass, m, stack) {
+				nf, ok := nearestFunction(stack)
+				if !ok || !isFunctionInGraph(pass, graph, nf) {
 					return true
 				}
-
-				// check function is in graph before making any more decisions
-				if !isFunctionInGraph(pass, graph, m) {
-					return true
+				if !chk.checkLease(nf).leased() {
+					chans.use(field, m.Pos())
 				}
+				return true
+			}
 
-				for _, p := range m.Type.Params.List {
-					switch e := p.Type.(type) {
-					case *ast.StarExpr:
-						id, ok := e.X.(*ast.Ident)
-						if !ok {
-							return true
-						}
-						if _, ok := critSecTypesByName[id.Name]; ok {
-							pass.Reportf(n.Pos(), "crit.Section types cannot be passed to a function")
-							return true
-						}
-					case *ast.Ident:
-						id := e
-						if _, ok := critSecTypesByName[id.Name]; ok {
-							pass.Reportf(n.Pos(), "crit.Section types cannot be passed to a function")
-							return true
-						}
-					}
-				}
+			// report rule for selector expression
+			rule = RuleAccess
+			section = m.X
+			subj.field = m.Sel.Name
+			if obj, ok := critDerived(pass.TypesInfo.TypeOf(m.X)); ok {
+				promoted = obj
+			}
+			subj.typ = qualifiedName(promoted)
+			subj.section = sectionName(promoted)
+
+			// the selector is being assigned to. this is checked here
+			// rather than with the statement so that every form of
+			// assignment is found wherever the statement appears
+			if isAssigned(m, stack) {
+				rule = RuleAssignment
+
+				// assignments to channel fields are noted in case the
+				// channel is also used without the lease
+				chanAssign, _ = chanField(pass, m)
+			} else {
+				mutation = fieldMutation(pass, m, stack)
+			}
+
+			// instances handed to another goroutine with the transfer
+			// directive are owned by one function at a time
+			if trans.afterTransfer(pass, section, m.Pos()) {
+				subj.fn = functionName(stack)
+				rep.report(m.Pos(), RuleAfterTransfer, subj)
+				return true
+			}
+			if trans.owns(pass, section, m.Pos()) {
 				return true
+			}
 
-			// reading a value from a critical section will begin with a
-			// selector expression
-			case *ast.SelectorExpr:
-				ct := pass.TypesInfo.TypeOf(m.X)
-
-				// check that the node type is one that we're interested in
-				var found bool
-				for _, c := range critSecTypesByName {
-					if types.ConvertibleTo(ct, c) {
-						found = true
-						break // for loop
-					}
-				}
-				if !found {
-					return true
-				}
+		// calls to functions with the requires directive are checked as though
+		// they were accesses
+		case *ast.CallExpr:
+			for _, id := range newInstances(pass, m) {
+				instance(n, id, stack)
+			}
 
-				// we don't want to match with the selector that calls the
-				// lease function
-				if m.Sel.Name == leaseFunction {
-					return true
+			callee := typeutil.Callee(pass.TypesInfo, m)
+			if fn, ok := callee.(*types.Func); ok {
+				if id, ok := constructors[fn]; ok {
+					instance(n, id, stack)
 				}
+			}
+			if !requiresFuncs[callee] {
+				return true
+			}
 
-				// report message for selector expression
-				msg = "access of crit.Section without Lease"
+			rule = RuleRequiresCall
+			subj.field = qualifiedName(callee)
 
-			case *ast.ValueSpec:
-				id, ok := m.Type.(*ast.Ident)
-				if !ok {
-					return true
-				}
+		case *ast.CompositeLit:
+			for _, id := range literalInstances(pass, m) {
+				instance(n, id, stack)
+			}
+			return true
 
-				// for simplicity, only one instance of a critsec type can
-				// be instantiated
-				if _, ok := critSecTypesUsed[id.Name]; ok {
-					// bit only report on it if the function is in the graph
-					nf, ok := nearestFunction(stack)
-					if !ok {
-						return true
+		case *ast.ValueSpec:
+			// a declaration without values creates a zero value of the type
+			// for each name. declarations with values are counted when the
+			// values are visited
+			if m.Type != nil && len(m.Values) == 0 {
+				for _, id := range instancesOf(pass.TypesInfo.TypeOf(m.Type)) {
+					for range m.Names {
+						instance(n, id, stack)
 					}
+				}
+			}
+			return true
 
-					if !isFunctionInGraph(pass, graph, nf) {
-						return true
-					}
+		default:
+			return true
+		}
 
-					pass.Reportf(n.Pos(), "multiple instance of a crit.Section derived type")
-					return true
-				}
+		// update inspectedPos map with the token position now that the node
+		// is known to be one that should be checked
+		inspectedPos[n.Pos()] = true
 
-				critSecTypesUsed[id.Name] = true
-				return true
+		// accesses of types outside of the section flag are not checked at
+		// all, which is where most of the time is spent
+		if !inScope(subj.typ) {
+			return true
+		}
 
-			// assignment includes short var declarations
-			case *ast.AssignStmt:
-				switch m.Tok.String() {
-				// short var declaration
-				case ":=":
-					compexpr, ok := m.Rhs[0].(*ast.CompositeLit)
-					if !ok {
-						return true
-					}
-					id, ok := compexpr.Type.(*ast.Ident)
-					if !ok {
-						return true
-					}
+		// the value of a package level variable has no containing function.
+		// the variable declaration stands in for the package initializer
+		// that runs it
+		nf, ok := nearestFunction(stack)
+		if !ok {
+			if nf, ok = packageVarInit(stack); !ok {
+				return true
+			}
+		}
 
-					// for simplicity, only one instance of a critsec type can
-					// be instantiated
-					if _, ok := critSecTypesUsed[id.Name]; ok {
-						// bit only report on it if the function is in the graph
-						nf, ok := nearestFunction(stack)
-						if !ok {
-							return true
-						}
-
-						if !isFunctionInGraph(pass, graph, nf) {
-							return true
-						}
-
-						pass.Reportf(n.Pos(), "multiple instance of a crit.Section derived type")
-						return true
-					}
+		// finalizers are never called by anything in the callgraph but are
+		// still run. the same can be true of handlers
+		finalizer := fins.registered(pass, nf)
+		hd, isHandler := hands.registered(pass, nf, n.Pos())
+		if !finalizer && !isHandler && !isFunctionInGraph(pass, graph, nf) {
+			return true
+		}
 
-					critSecTypesUsed[id.Name] = true
-					return true
+		// accesses made before the section is started in the same
+		// function are part of the setup of the section
+		if rule.ID != RuleRequiresCall.ID && starts.before(nf, subj.typ, n.Pos()) {
+			rep.model(n.Pos(), rule, subj, stack, mutation, AccessSetup)
+			return true
+		}
 
-				default:
-					lhs := m.Lhs[len(m.Lhs)-1]
-					sel, ok := lhs.(*ast.SelectorExpr)
-					if !ok {
-						return true
-					}
+		d := chk.checkLease(nf)
+		d.acquired, d.acquiredRead = chk.regions.at(pass.TypesInfo, nf, n.Pos())
+		if debugDecisions {
+			d.print(os.Stderr, pass, n, nf, rule)
+		}
 
-					ct := pass.TypesInfo.TypeOf(sel.X)
+		// the attributes of the decision are only worked out if they will be
+		// logged
+		if lg.Enabled(context.Background(), slog.LevelDebug) {
+			lg.Debug("decision",
+				"pos", pass.Fset.Position(n.Pos()).String(),
+				"rule", rule.ID,
+				"function", describeFunction(pass, nf),
+				"nodes", len(d.nodes),
+				"status", d.status())
+		}
 
-					// check that the node type is one that we're interested in
-					var found bool
-					for _, c := range critSecTypesByName {
-						if types.ConvertibleTo(ct, c) {
-							found = true
-							break // for loop
-						}
-					}
-					if !found {
-						return true
-					}
+		// with the setup policy, accesses that can only be made during
+		// package initialisation are part of the setup of the section
+		if initPhase == initPhaseSetup && !d.leased() && !d.conditional() && ph.initialising(d.nodes) &&
+			(rule.ID == RuleAccess.ID || rule.ID == RuleAssignment.ID) {
+			rep.model(n.Pos(), rule, subj, stack, mutation, AccessSetup)
+			return true
+		}
 
-					// report message for assignment statements
-					msg = "assignment to crit.Section without Lease"
-				}
+		// accesses count towards the coverage in the result
+		if rule.ID == RuleAccess.ID || rule.ID == RuleAssignment.ID {
+			rep.result.Accesses++
+			if d.leased() {
+				rep.result.Leased++
+			}
+		}
+		rep.model(n.Pos(), rule, subj, stack, mutation, d.status())
 
-			default:
+		// for types that are started, an unleased access is only a problem if
+		// it can happen after the section is started
+		if !d.leased() && !d.conditional() && starts.started(subj.typ) &&
+			(rule.ID == RuleAccess.ID || rule.ID == RuleAssignment.ID) {
+			if !ph.running(subj.typ, d.nodes) && !starts.after(nf, subj.typ, n.Pos()) {
 				return true
 			}
+			rule = RuleAfterStart
+		}
 
-			nf, ok := nearestFunction(stack)
-			if !ok {
-				return true
+		// a finalizer runs on a goroutine of its own. the access is reported
+		// with a rule of its own because the callgraph does not show how the
+		// function is called
+		if finalizer && !d.leased() && (rule.ID == RuleAccess.ID || rule.ID == RuleAssignment.ID) {
+			rule = RuleFinalizer
+		}
+
+		// so does a handler, such as a function registered with
+		// http.Server.RegisterOnShutdown(), or the code after receiving a
+		// signal. the detail says how the function came to be a handler
+		var detail string
+		if isHandler && !d.leased() && (rule.ID == RuleAccess.ID || rule.ID == RuleAssignment.ID) {
+			rule = RuleHandler
+			detail = hd.detail
+		}
+
+		// an unleased read that is checked again with the lease is the first
+		// half of double-checked locking. the suggested fix uses InitOnce()
+		// in place of the lease
+		var fixes []analysis.SuggestedFix
+		if dc, ok := dcs[n.Pos()]; ok && !d.leased() && rule.ID == RuleAccess.ID {
+			rule = RuleDoubleChecked
+			detail = dc.detail
+			fixes = dc.fixes
+		}
+
+		// the goroutines the access can be reached from
+		ors := orig.of(d.nodes)
+		if rule.ID == RuleAccess.ID || rule.ID == RuleAssignment.ID {
+			used.add(subj.typ, ors)
+		}
+
+		subj.fn = functionName(stack)
+		if _, ok := nf.(*ast.ValueSpec); ok {
+			subj.fn = "init"
+		}
+
+		// a write while a read lease is held, either directly or through a
+		// helper function. reads are allowed under either lease, but changing
+		// the contents of a map or slice field is a write even though the
+		// field is only read
+		if d.leased() && d.underRead() {
+			if rule.ID == RuleAssignment.ID {
+				rep.reportExtra(n.Pos(), RuleReadLeaseWrite, subj, extra{related: d.relatedRead()})
+			} else if mutation != "" {
+				rep.reportExtra(n.Pos(), RuleReadLeaseWrite, subj, extra{detail: mutation, related: d.relatedRead()})
 			}
+		}
 
-			if !isFunctionInGraph(pass, graph, nf) {
-				return true
+		switch {
+		case d.conditional():
+			rep.reportExtra(n.Pos(), RuleConditional, subj, extra{
+				detail:  rule.Message,
+				related: append(append(d.related(), mvs.related(pass, nf, d.unprotected)...), relatedOrigins(ors)...),
+				fixes:   leaseFixes(pass, section, stack, nf),
+			})
+		case !d.leased():
+			ex := extra{
+				detail:  detail,
+				related: append(mvs.related(pass, nf, d.unprotected), relatedOrigins(ors)...),
+				fixes:   append(fixes, leaseFixes(pass, section, stack, nf)...),
+				cause:   d.cause(nf, subj.fn),
 			}
 
-			if ok := checkLease(pass, graph, nf); !ok {
-				pass.Reportf(n.Pos(), msg)
+			// whether the access is used from more than one goroutine isn't
+			// known until every access has been seen
+			if rule.ID == RuleAccess.ID || rule.ID == RuleAssignment.ID {
+				pending = append(pending, pendingReport{pos: n.Pos(), rule: rule, subj: subj, ex: ex})
+			} else {
+				rep.reportExtra(n.Pos(), rule, subj, ex)
 			}
+		case chanAssign != nil:
+			chans.replace(chanAssign, n.Pos(), subj)
+		}
 
-			return true
-		})
+		return true
+	})
+
+	// types that are confined to a single goroutine are reported once, in
+	// place of the unleased accesses. with the singlegoroutine flag they are
+	// reported with the confined rule, where the related information is the
+	// origin shared by every access. otherwise the types in a main package are
+	// reported as unnecessary
+	unnecessary := checkUnusedSections(pass, rep, inspect, used)
+	confined := make(map[string]bool)
+	for _, p := range pending {
+		if unnecessary[p.subj.typ] {
+			continue
+		}
+		if !singleRoutine || !used.single(p.subj.typ) {
+			rep.reportExtra(p.pos, p.rule, p.subj, p.ex)
+			continue
+		}
+		if confined[p.subj.typ] {
+			continue
+		}
+		confined[p.subj.typ] = true
+
+		pos := p.pos
+		if ip, ok := instancePos[p.subj.typ]; ok {
+			pos = ip
+		}
+		rep.reportExtra(pos, RuleConfined, subject{typ: p.subj.typ}, extra{related: p.ex.related})
+	}
+
+	chans.report(pass, rep)
+
+	checkLeaseLoops(pass, rep, inspect)
+	checkLeaseSize(pass, rep, inspect)
+	checkWrongLease(pass, rep, inspect, al)
+	checkPublish(pass, rep, inspect)
+	checkSharedStores(pass, rep, inspect)
+	checkSnapshots(pass, rep, inspect)
+	checkSelfAlias(pass, rep, inspect, initFields, guardedFields, unguardedFields)
+	checkValueUse(pass, rep, inspect)
+	checkPrint(pass, rep, inspect)
+	checkForeign(pass, rep, inspect, graph, chk)
+	checkEmbedding(pass, rep, inspect, tds)
+	checkLeaseFlow(pass, rep, inspect)
+	checkGlobalWrites(pass, rep, inspect)
+	checkReadOnlyLeases(pass, rep, inspect)
+	checkEmptyLeases(pass, rep, inspect)
+	checkLeaserImplementations(pass, rep, inspect, tds)
+	checkInterfaceMethods(pass, rep, inspect, initFields, guardedFields, unguardedFields)
+	checkGetters(pass, rep, inspect, chk, initFields, guardedFields, unguardedFields)
+	checkAcquireRelease(pass, rep, inspect, chk.regions)
+	checkReleaseMisuse(pass, rep, inspect, chk.regions)
+	checkCritVersion(pass, rep)
+	if binaries != "" {
+		if err := checkBinaries(pass, rep, inspect, initFields, guardedFields, unguardedFields); err != nil {
+			return nil, err
+		}
+	}
+	if adoptMode {
+		checkAdoption(pass, rep, inspect)
+	}
+
+	done()
+	rep.result.Timings = tm.result()
+
+	lg.Info("analysis finished",
+		"accesses", rep.result.Accesses,
+		"leased", rep.result.Leased,
+		"reports", len(rep.result.Findings),
+		"duration", tm.total())
+
+	rep.flush()
+	return rep.result, nil
+}
+
+// loadPatterns returns the patterns that will load the package being analysed.
+// packages made from a list of files on the command line do not have a path
+// that can be loaded and so the list of files is used instead
+func loadPatterns(pass *analysis.Pass) []string {
+	if pass.Pkg.Path() != "command-line-arguments" {
+		// an external test package is loaded with the package it tests
+		return []string{strings.TrimSuffix(pass.Pkg.Path(), "_test")}
+	}
+
+	var patterns []string
+	for _, f := range pass.Files {
+		patterns = append(patterns, pass.Fset.Position(f.Pos()).Filename)
+	}
+	return patterns
+}
+
+// illTyped returns the paths of the packages, and the packages they import,
+// that have type errors. an SSA program can't be built for them
+func illTyped(pkgs []*packages.Package) []string {
+	var bad []string
+	packages.Visit(pkgs, nil, func(p *packages.Package) {
+		if p.IllTyped {
+			bad = append(bad, p.PkgPath)
+		}
+	})
+	return bad
+}
+
+// isAssigned returns true if the expression at the top of the stack is being
+// assigned to. this includes increment and decrement statements, and the key
+// and value of a range statement that does not declare new variables
+func isAssigned(e ast.Expr, stack []ast.Node) bool {
+	if len(stack) < 2 {
+		return false
 	}
 
-	return nil, nil
+	switch p := stack[len(stack)-2].(type) {
+	case *ast.AssignStmt:
+		if p.Tok == token.DEFINE {
+			return false
+		}
+		for _, lhs := range p.Lhs {
+			if lhs == e {
+				return true
+			}
+		}
+	case *ast.IncDecStmt:
+		return p.X == e
+	case *ast.RangeStmt:
+		return p.Tok == token.ASSIGN && (p.Key == e || p.Value == e)
+	}
+	return false
 }
 
 // find the most recent function declaration or function literal that was
@@ -280,49 +785,160 @@ func nearestFunction(stack []ast.Node) (ast.Node, bool) {
 	return nil, false
 }
 
+// leaseChecker decides whether accesses in a function are protected by a
+// lease. the result for each callgraph node is cached because the same
+// function will often contain many accesses
+type leaseChecker struct {
+	pass    *analysis.Pass
+	graph   *callgraph.Graph
+	memo    map[*callgraph.Node]*pathStatus
+	wrapped wrappedCalls
+
+	// the Acquire() regions of the functions in the callgraph. a call made
+	// inside a region is protected in the same way as a call from a lease
+	// function. may be nil
+	regions *acquireRegions
+}
+
+func newLeaseChecker(pass *analysis.Pass, graph *callgraph.Graph) *leaseChecker {
+	return &leaseChecker{
+		pass:    pass,
+		graph:   graph,
+		memo:    make(map[*callgraph.Node]*pathStatus),
+		wrapped: findWrappedCalls(graph),
+	}
+}
+
 // check if the crit.Section.Lease() function is part of the call graph for the
 // node. the node represents the nearest containing function
 //
 // the nf argument is the containing function of the access being checked,
 // returned by nearestFunction(), of the critical section access
-func checkLease(pass *analysis.Pass, graph *callgraph.Graph, nf ast.Node) bool {
-
-	// recursive check to find the deepest call to leaseFunction
-	var check func(*callgraph.Edge) bool
+func (c *leaseChecker) checkLease(nf ast.Node) decision {
+	var d decision
+
+	// accesses inside a function with the requires directive are always
+	// treated as leased
+	if requiresLease(nf) {
+		d.requires = true
+		return d
+	}
 
-	// the implementation of the check function is reliant on the callgraph
-	// being a VTA graph. it is likely that a differently constructed callgraph
-	// will not produce the same results
-	check = func(e *callgraph.Edge) bool {
-		if e.Caller.Func.Name() == leaseFunction {
-			return true
+	// find the callgraph nodes for the containing function. sorted so that
+	// the decision is the same every time. the value of a package level
+	// variable is run by the package initializer
+	var nodes []*callgraph.Node
+	if _, ok := nf.(*ast.ValueSpec); ok {
+		nodes = c.initNodes()
+	} else {
+		for f, n := range c.graph.Nodes {
+			if f != nil && positionCompare(c.pass, nf.Pos(), f.Pos()) {
+				nodes = append(nodes, n)
+			}
 		}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Func.String() < nodes[j].Func.String()
+	})
 
-		for _, in := range e.Caller.In {
-			return check(in)
+	for _, n := range nodes {
+		d.nodes = append(d.nodes, n)
+		s := c.status(n)
+		if s.protected != nil && d.protected == nil {
+			d.protected = s.protected
+		}
+		if s.unprotected != nil && d.unprotected == nil {
+			d.unprotected = s.unprotected
 		}
+		if s.read != nil && d.read == nil {
+			d.read = s.read
+		}
+	}
 
-		return false
+	return d
+}
+
+// status returns the path status of the callgraph node by following every
+// caller of the node until either a lease function or a function with no
+// callers is found
+//
+// the implementation is reliant on the callgraph being a VTA graph. it is
+// likely that a differently constructed callgraph will not produce the same
+// results
+func (c *leaseChecker) status(n *callgraph.Node) *pathStatus {
+	if s, ok := c.memo[n]; ok {
+		return s
 	}
 
-	done := errors.New("done")
+	// the status is added to the memo before the callers are followed. if
+	// there is a cycle in the callgraph then the incomplete status will be
+	// seen, which is the same as ignoring the cycle
+	s := &pathStatus{}
+	c.memo[n] = s
+
+	// functions passed to sync.Once.Do() and similar are called by the
+	// eventual callers of the wrapper rather than by the sync package
+	in := n.In
+	if w, ok := c.wrapped[n.Func]; ok {
+		in = w
+	}
 
-	err := callgraph.GraphVisitEdges(graph, func(e *callgraph.Edge) error {
-		if positionCompare(pass, nf.Pos(), e.Callee.Func.Pos()) {
-			if check(e) {
-				return done
+	// a function without any callers is a root of the callgraph (eg. main)
+	// and is not leased
+	if len(in) == 0 {
+		s.unprotected = []*callgraph.Edge{}
+		return s
+	}
+
+	for _, e := range in {
+		// a function run on a new goroutine doesn't hold the leases of the
+		// function that started it
+		if isGoroutineStart(e) {
+			if s.unprotected == nil {
+				s.unprotected = []*callgraph.Edge{e}
 			}
+			continue
+		}
+
+		if isLeaseFunction(e.Caller.Func.Name()) || ssaRequiresLease(e.Caller.Func) {
+			if s.protected == nil {
+				s.protected = []*callgraph.Edge{e}
+			}
+			if m, _ := lookupLeaseMethod(e.Caller.Func.Name()); m.read && s.read == nil {
+				s.read = []*callgraph.Edge{e}
+			}
+			continue
+		}
+
+		if held, read := c.regions.site(e); held {
+			if s.protected == nil {
+				s.protected = []*callgraph.Edge{e}
+			}
+			if read && s.read == nil {
+				s.read = []*callgraph.Edge{e}
+			}
+			continue
+		}
+
+		cs := c.status(e.Caller)
+		if cs.protected != nil && s.protected == nil {
+			s.protected = append([]*callgraph.Edge{e}, cs.protected...)
+		}
+		if cs.unprotected != nil && s.unprotected == nil {
+			s.unprotected = append([]*callgraph.Edge{e}, cs.unprotected...)
+		}
+		if cs.read != nil && s.read == nil {
+			s.read = append([]*callgraph.Edge{e}, cs.read...)
+		}
+
+		// the search can't stop early if no read lease has been found
+		// because a write under a read lease would be missed
+		if s.protected != nil && s.unprotected != nil && s.read != nil {
+			break // for loop
 		}
-		return nil
-	})
-	if errors.Is(err, done) {
-		return true
-	}
-	if err != nil {
-		log.Fatalf(err.Error())
 	}
 
-	return false
+	return s
 }
 
 // isFunctionInGraph checks that the function (represented by ast.Node) we've
@@ -339,6 +955,17 @@ func isFunctionInGraph(pass *analysis.Pass, graph *callgraph.Graph, nf ast.Node)
 		}
 	}
 
+	// the same is true of the functions run by the go test command, of the
+	// entry points of plugins, which are called by the host binary, and of
+	// the values of package level variables, which are run by the package
+	// initializer
+	if _, ok := nf.(*ast.ValueSpec); ok {
+		return true
+	}
+	if isTestRoot(pass, nf) || isPluginEntry(pass, nf) {
+		return true
+	}
+
 	// if the node is found in the callgraph then inGraph is set to true and the
 	// GraphVisitEdges() ends
 	inGraph := false
@@ -346,16 +973,14 @@ func isFunctionInGraph(pass *analysis.Pass, graph *callgraph.Graph, nf ast.Node)
 	// sentinal error returned by callgraph.GraphVisitEdges()
 	var functionFound = errors.New("functionFound")
 
-	err := callgraph.GraphVisitEdges(graph, func(e *callgraph.Edge) error {
+	// the sentinal error is the only error that can be returned
+	_ = callgraph.GraphVisitEdges(graph, func(e *callgraph.Edge) error {
 		if positionCompare(pass, nf.Pos(), e.Callee.Func.Pos()) {
 			inGraph = true
 			return functionFound
 		}
 		return nil
 	})
-	if err != nil && !errors.Is(err, functionFound) {
-		log.Fatalf(err.Error())
-	}
 
 	return inGraph
 }
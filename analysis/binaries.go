@@ -0,0 +1,226 @@
+package analysis
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/callgraph/cha"
+	"golang.org/x/tools/go/callgraph/vta"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// binary is a main package that imports the package being analysed. the lease
+// checker uses a callgraph that only contains the functions reachable from the
+// main package
+type binary struct {
+	// the package path of the main package
+	path string
+
+	// the position of the main function
+	pos token.Pos
+
+	chk *leaseChecker
+}
+
+// loadBinaries loads the main packages matching the patterns in the binaries
+// flag that import the package being analysed, directly or indirectly
+func loadBinaries(pass *analysis.Pass) ([]binary, error) {
+	pcfg := LoadConfig
+	pcfg.Mode = packages.LoadAllSyntax
+	pcfg.Fset = pass.Fset
+
+	var patterns []string
+	for _, p := range strings.Split(binaries, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	initial, err := packages.Load(&pcfg, patterns...)
+	if err != nil {
+		return nil, err
+	}
+
+	var bins []binary
+	regions := newAcquireRegions(initial)
+	for _, p := range initial {
+		if p.Name != "main" || p.PkgPath == pass.Pkg.Path() {
+			continue
+		}
+		var imports bool
+		packages.Visit([]*packages.Package{p}, func(q *packages.Package) bool {
+			imports = imports || q.PkgPath == pass.Pkg.Path()
+			return !imports
+		}, nil)
+		if !imports {
+			continue
+		}
+
+		// a binary that doesn't build is left out rather than stopping the
+		// analysis
+		if len(illTyped([]*packages.Package{p})) > 0 {
+			continue
+		}
+
+		prog, ssaPkgs := ssautil.AllPackages([]*packages.Package{p}, ssa.InstantiateGenerics)
+		prog.Build()
+		if ssaPkgs[0] == nil {
+			continue
+		}
+		mainFunc := ssaPkgs[0].Func("main")
+		if mainFunc == nil {
+			continue
+		}
+
+		graph := vta.CallGraph(ssautil.AllFunctions(prog), cha.CallGraph(prog))
+		reachableOnly(graph, mainFunc, ssaPkgs[0].Func("init"))
+		pruneGraph(graph)
+
+		chk := newLeaseChecker(pass, graph)
+		chk.regions = regions
+		bins = append(bins, binary{
+			path: p.PkgPath,
+			pos:  mainFunc.Pos(),
+			chk:  chk,
+		})
+	}
+
+	return bins, nil
+}
+
+// reachableOnly removes the nodes from the callgraph that can't be reached
+// from the roots. without this, functions in the package being analysed that
+// the binary never calls would be the roots of unleased call paths
+func reachableOnly(graph *callgraph.Graph, roots ...*ssa.Function) {
+	seen := make(map[*callgraph.Node]bool)
+	var queue []*callgraph.Node
+	for _, r := range roots {
+		if n, ok := graph.Nodes[r]; ok && r != nil {
+			seen[n] = true
+			queue = append(queue, n)
+		}
+	}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, e := range n.Out {
+			if !seen[e.Callee] {
+				seen[e.Callee] = true
+				queue = append(queue, e.Callee)
+			}
+		}
+	}
+
+	for f, n := range graph.Nodes {
+		if f != nil && !seen[n] {
+			graph.DeleteNode(n)
+		}
+	}
+}
+
+// checkBinaries reports accesses in a package that are leased in some of the
+// binaries that use the package but not in others. each binary is checked with
+// a callgraph of its own so that the call paths of one binary don't hide the
+// call paths of another
+//
+// accesses that are not leased in any binary are reported by the normal
+// analysis of the package and are not reported again
+func checkBinaries(pass *analysis.Pass, rep *reporter, inspect *inspector.Inspector, exempt ...map[*types.Var]bool) error {
+	bins, err := loadBinaries(pass)
+	if err != nil {
+		return err
+	}
+	if len(bins) < 2 {
+		return nil
+	}
+
+	isExempt := func(f *types.Var) bool {
+		for _, m := range exempt {
+			if m[f] {
+				return true
+			}
+		}
+		return false
+	}
+
+	inspect.WithStack([]ast.Node{(*ast.SelectorExpr)(nil)}, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+
+		m := n.(*ast.SelectorExpr)
+		promoted, isPromoted := promotedSection(pass, m)
+		if !isCritDerived(pass.TypesInfo.TypeOf(m.X)) && !isPromoted {
+			return true
+		}
+		if isSectionMember(pass, m) || isNestedSection(pass, m, stack) {
+			return true
+		}
+		if isExempt(selectedField(pass, m)) {
+			return true
+		}
+		nf, ok := nearestFunction(stack)
+		if !ok {
+			return true
+		}
+
+		var leased, unleased []binary
+		for _, b := range bins {
+			d := b.chk.checkLease(nf)
+			if !d.requires && len(d.nodes) == 0 {
+				// the function is not part of the binary
+				continue
+			}
+			if d.leased() {
+				leased = append(leased, b)
+			} else {
+				unleased = append(unleased, b)
+			}
+		}
+		if len(leased) == 0 || len(unleased) == 0 {
+			return true
+		}
+
+		if obj, ok := critDerived(pass.TypesInfo.TypeOf(m.X)); ok {
+			promoted = obj
+		}
+		subj := subject{
+			typ:     qualifiedName(promoted),
+			field:   m.Sel.Name,
+			fn:      functionName(stack),
+			section: sectionName(promoted),
+		}
+
+		var paths []string
+		var related []analysis.RelatedInformation
+		for _, b := range unleased {
+			paths = append(paths, b.path)
+			related = append(related, analysis.RelatedInformation{
+				Pos:     b.pos,
+				Message: fmt.Sprintf("not leased in binary %s", b.path),
+			})
+		}
+		for _, b := range leased {
+			related = append(related, analysis.RelatedInformation{
+				Pos:     b.pos,
+				Message: fmt.Sprintf("leased in binary %s", b.path),
+			})
+		}
+
+		rep.reportExtra(m.Pos(), RuleBinaryMismatch, subj, extra{
+			detail:  fmt.Sprintf("not leased in %s", strings.Join(paths, ", ")),
+			related: related,
+		})
+
+		return true
+	})
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package analysis
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// channel fields in a crit.Section derived type are treated differently to
+// other fields. channels are safe to use from more than one goroutine and so
+// sending, receiving, closing and ranging over a channel field does not
+// require the lease
+//
+// replacing the channel is an assignment to the field and so does require the
+// lease. however, if the channel is also used without the lease then the lease
+// held when the channel is replaced protects nothing. chanTracker records both
+// patterns so that the mixed use can be reported
+
+// chanField returns the field if the selector expression selects a field with
+// a channel type
+func chanField(pass *analysis.Pass, sel *ast.SelectorExpr) (*types.Var, bool) {
+	s, ok := pass.TypesInfo.Selections[sel]
+	if !ok || s.Kind() != types.FieldVal {
+		return nil, false
+	}
+	if _, ok := s.Obj().Type().Underlying().(*types.Chan); !ok {
+		return nil, false
+	}
+	return s.Obj().(*types.Var), true
+}
+
+// isChanOp returns true if the selector expression at the top of the stack is
+// used as the channel in a channel operation
+func isChanOp(pass *analysis.Pass, sel *ast.SelectorExpr, stack []ast.Node) bool {
+	if len(stack) < 2 {
+		return false
+	}
+
+	switch p := stack[len(stack)-2].(type) {
+	case *ast.UnaryExpr:
+		return p.Op == token.ARROW && p.X == sel
+	case *ast.SendStmt:
+		return p.Chan == sel
+	case *ast.RangeStmt:
+		return p.X == sel
+	case *ast.CallExpr:
+		id, ok := p.Fun.(*ast.Ident)
+		if !ok || len(p.Args) != 1 || p.Args[0] != sel {
+			return false
+		}
+		if _, ok := pass.TypesInfo.ObjectOf(id).(*types.Builtin); !ok {
+			return false
+		}
+		return id.Name == "close" || id.Name == "len" || id.Name == "cap"
+	}
+
+	return false
+}
+
+// chanReplace is a leased assignment to a channel field
+type chanReplace struct {
+	pos   token.Pos
+	field *types.Var
+	subj  subject
+}
+
+// chanTracker records the uses of channel fields made without the lease and
+// the replacements of channel fields made with the lease
+type chanTracker struct {
+	uses     map[*types.Var][]token.Pos
+	replaced []chanReplace
+}
+
+func newChanTracker() *chanTracker {
+	return &chanTracker{
+		uses: make(map[*types.Var][]token.Pos),
+	}
+}
+
+// use records a channel operation on the field that is not leased
+func (t *chanTracker) use(field *types.Var, pos token.Pos) {
+	t.uses[field] = append(t.uses[field], pos)
+}
+
+// replace records a leased assignment to the field
+func (t *chanTracker) replace(field *types.Var, pos token.Pos, subj subject) {
+	t.replaced = append(t.replaced, chanReplace{pos: pos, field: field, subj: subj})
+}
+
+// report every leased replacement of a channel field that is also used
+// without the lease. the unleased uses are attached as related information
+func (t *chanTracker) report(pass *analysis.Pass, rep *reporter) {
+	for _, r := range t.replaced {
+		uses := t.uses[r.field]
+		if len(uses) == 0 {
+			continue
+		}
+
+		var related []analysis.RelatedInformation
+		for _, pos := range uses {
+			related = append(related, analysis.RelatedInformation{
+				Pos:     pos,
+				Message: fmt.Sprintf("%s used without Lease", r.field.Name()),
+			})
+		}
+
+		rep.reportExtra(r.pos, RuleChanReplace, r.subj, extra{
+			detail:  fmt.Sprintf("%d uses without Lease", len(uses)),
+			related: related,
+		})
+	}
+}
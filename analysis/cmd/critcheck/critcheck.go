@@ -1,10 +1,230 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
 	"github.com/jetsetilly/critsec/analysis"
-	"golang.org/x/tools/go/analysis/singlechecker"
+	"github.com/jetsetilly/critsec/analysis/driver"
 )
 
 func main() {
-	singlechecker.Main(analysis.CritSection)
+	// the explain and doctor commands are handled before the command line is
+	// parsed
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "explain":
+			os.Exit(explain(os.Stdout, os.Args[2:]))
+		case "doctor":
+			os.Exit(doctor(os.Stdout, os.Args[2:]))
+		}
+	}
+	os.Exit(critcheck())
+}
+
+// critcheck runs the analysis as specified by the command line and returns the
+// exit code for the program
+func critcheck() int {
+	var prof profiling
+	flag.StringVar(&prof.cpu, "cpuprofile", "", "write CPU profile to this file")
+	flag.StringVar(&prof.mem, "memprofile", "", "write memory profile to this file")
+	flag.StringVar(&prof.trace, "trace", "", "write trace log to this file")
+
+	jsonOutput := flag.Bool("json", false, "emit JSON output")
+	lines := flag.Int("c", -1, "display offending line with this many lines of context")
+	failOn := flag.String("fail-on", "error", "the lowest severity that causes a non-zero exit code")
+	fingerprints := flag.Bool("fingerprint", false, "add the fingerprint of each report to the plain text output")
+	stdin := flag.String("stdin", "", "read the content of the named file from stdin. implies -json")
+	modfile := flag.String("modfile", "", "use the named go.mod file instead of the one in the module root")
+	summarize := flag.Bool("summary", false, "print a summary of the reports, coverage and timings for each package")
+	includeTests := flag.Bool("include-tests", false, "analyse test files. test functions are treated as roots of the callgraph")
+	minCoverage := flag.Float64("min-coverage", 0, "the lowest percentage of accesses that must be leased. a lower coverage causes a non-zero exit code")
+	listRules := flag.Bool("list-rules", false, "list the rules and their default severities. the JSON output includes the full description of each rule")
+	printVersion := flag.Bool("version", false, "print the version of critcheck")
+	group := flag.Bool("group", false, "group unleased accesses with the same root cause into one report")
+	goos := flag.String("goos", "", "analyse the packages for this operating system. the GOOS environment variable or the host is used by default")
+	goarch := flag.String("goarch", "", "analyse the packages for this architecture. the GOARCH environment variable or the host is used by default")
+	verbose := flag.Bool("v", false, "log the analysis of each package to stderr. the same as -log=info")
+	debug := flag.Bool("debug", false, "log the phases of the analysis and the decision made for each access to stderr. the same as -log=debug")
+	plan := flag.Bool("plan", false, "print a plan of the changes that fix the reports, grouped by file with an estimate of the edits needed, in place of the reports")
+	modelFile := flag.String("model", "", "write a JSON model of the sections, their fields, the lease sites and the accesses to this file")
+	checkFacts := flag.Bool("debug.facts", false, "encode and decode every fact exported by the analysis, as drivers such as gopls do, and fail if the encoding is not deterministic")
+
+	// analyzer flags are added to the command line without a prefix
+	analysis.CritSection.Flags.VisitAll(func(f *flag.Flag) {
+		flag.Var(f.Value, f.Name, f.Usage)
+	})
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "%s\n\n", analysis.CritSection.Doc)
+		fmt.Fprintf(os.Stderr, "usage: critcheck [flags] [packages]\n")
+		fmt.Fprintf(os.Stderr, "       critcheck explain [rule IDs]\n")
+		fmt.Fprintf(os.Stderr, "       critcheck doctor [packages]\n\n")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if *printVersion {
+		fmt.Printf("critcheck %s\n", driver.Version())
+		return 0
+	}
+	if *listRules {
+		if err := printRules(os.Stdout, *jsonOutput); err != nil {
+			fmt.Fprintf(os.Stderr, "critcheck: %s\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	failSeverity, err := analysis.ParseSeverity(*failOn)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "critcheck: %s\n", err)
+		return 1
+	}
+
+	stop, err := prof.start()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "critcheck: %s\n", err)
+		return 1
+	}
+	defer stop()
+
+	// the analyzer flags that were given on the command line are passed to
+	// the driver, which returns the other analyzer flags to their defaults
+	var analyzerFlags []string
+	flag.Visit(func(f *flag.Flag) {
+		if analysis.CritSection.Flags.Lookup(f.Name) != nil {
+			analyzerFlags = append(analyzerFlags, fmt.Sprintf("-%s=%s", f.Name, f.Value))
+		}
+	})
+
+	// the logging shortcuts are added after the analyzer flags so that they
+	// take precedence over the log flag
+	if *verbose {
+		analyzerFlags = append(analyzerFlags, "-log=info")
+	}
+	if *debug {
+		analyzerFlags = append(analyzerFlags, "-log=debug")
+	}
+
+	cfg := driver.Config{
+		Patterns: flag.Args(),
+		Flags:    analyzerFlags,
+		Tests:    *includeTests,
+		GOOS:     *goos,
+		GOARCH:   *goarch,
+
+		CheckFacts: *checkFacts,
+		Output: driver.Output{
+			Group:        *group,
+			Summary:      *summarize,
+			Source:       *lines >= 0,
+			Context:      *lines,
+			Fingerprints: *fingerprints,
+		},
+	}
+	if *modfile != "" {
+		cfg.BuildFlags = append(cfg.BuildFlags, fmt.Sprintf("-modfile=%s", *modfile))
+	}
+
+	// in stdin mode the content of the file is supplied as an overlay. only the
+	// package containing the file is analysed
+	if *stdin != "" {
+		filename, err := filepath.Abs(*stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "critcheck: %s\n", err)
+			return 1
+		}
+		content, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "critcheck: %s\n", err)
+			return 1
+		}
+		cfg.Overlay = map[string][]byte{filename: content}
+		cfg.Patterns = []string{fmt.Sprintf("file=%s", filename)}
+		*jsonOutput = true
+	}
+
+	rep, err := driver.Run(context.Background(), cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "critcheck: %s\n", err)
+		return 1
+	}
+
+	// packages that could not be analysed are a warning rather than a failure
+	// so that one broken package doesn't hide the reports for the others
+	for _, b := range rep.Broken {
+		fmt.Fprintf(os.Stderr, "critcheck: %s not analysed\n", b.Path)
+		for _, e := range b.Errors {
+			fmt.Fprintf(os.Stderr, "\t%s\n", e)
+		}
+	}
+
+	// the model is written in addition to the normal output
+	if *modelFile != "" {
+		if err := writeModel(rep, *modelFile); err != nil {
+			fmt.Fprintf(os.Stderr, "critcheck: %s\n", err)
+			return 1
+		}
+	}
+
+	// the coverage gate is checked for every output format. a failure is
+	// reported on stderr so that it doesn't interfere with JSON output
+	covered := true
+	if *minCoverage > 0 {
+		pct := rep.Coverage()
+		covered = pct >= *minCoverage
+		if !covered {
+			fmt.Fprintf(os.Stderr, "critcheck: %.1f%% of accesses are leased, below the minimum of %.1f%%\n", pct, *minCoverage)
+		}
+	}
+
+	// JSON output is always successful if the analysis itself succeeds, in
+	// the same way as the standard analysis drivers. the exception is the
+	// coverage gate, which must be asked for
+	if *jsonOutput {
+		write := rep.WriteJSON
+		if *plan {
+			write = rep.Plan().WriteJSON
+		}
+		if err := write(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "critcheck: %s\n", err)
+			return 1
+		}
+		if !covered {
+			return 3
+		}
+		return 0
+	}
+
+	// the plan is printed on stdout because it is the output that was asked
+	// for rather than a list of problems
+	if *plan {
+		rep.Plan().WriteText(os.Stdout)
+	} else {
+		rep.WriteText(os.Stderr)
+	}
+	if !covered || rep.Fails(failSeverity) {
+		return 3
+	}
+
+	return 0
+}
+
+// writeModel writes the model of the sections to the named file
+func writeModel(rep driver.Report, filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := rep.WriteModel(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
 }
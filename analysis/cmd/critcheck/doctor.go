@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jetsetilly/critsec/analysis/driver"
+)
+
+// doctor checks the environment for the packages in args and prints the
+// outcome of each check. the remedy is printed for every check that didn't
+// pass. returns a non-zero exit code if any of the checks failed
+func doctor(w io.Writer, args []string) int {
+	checks := driver.Doctor(context.Background(), driver.Config{Patterns: args})
+
+	fmt.Fprintf(w, "critcheck %s\n\n", driver.Version())
+
+	code := 0
+	for _, c := range checks {
+		fmt.Fprintf(w, "%-8s %-13s %s\n", c.Status, c.Name, indent(c.Detail, 23))
+		if c.Remedy != "" {
+			fmt.Fprintf(w, "%23s%s\n", "", indent(c.Remedy, 23))
+		}
+		if c.Status == driver.CheckFailed {
+			code = 1
+		}
+	}
+
+	return code
+}
+
+// indent the lines after the first line of the text by n spaces
+func indent(s string, n int) string {
+	return strings.ReplaceAll(s, "\n", "\n"+strings.Repeat(" ", n))
+}
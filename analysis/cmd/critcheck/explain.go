@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jetsetilly/critsec/analysis"
+)
+
+// explain prints a description of each rule ID in args. if args is empty then
+// a list of all rules is printed
+func explain(w io.Writer, args []string) int {
+	if len(args) == 0 {
+		for _, r := range analysis.Rules {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.ID, r.Name, r.Severity, r.Message)
+		}
+		return 0
+	}
+
+	for i, id := range args {
+		r, ok := analysis.LookupRule(id)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "critcheck: unknown rule %q\n", id)
+			return 1
+		}
+
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+
+		fmt.Fprintf(w, "%s (%s): %s\n", r.ID, r.Name, r.Message)
+		fmt.Fprintf(w, "\nDefault severity: %s\n", r.Severity)
+		fmt.Fprintf(w, "\n%s\n", r.Description)
+		fmt.Fprintf(w, "\nWhy it matters\n\n%s\n", r.Rationale)
+		fmt.Fprintf(w, "\nFalse positives\n\n%s\n", r.FalsePositives)
+		fmt.Fprintf(w, "\nRemediation\n\n%s\n", r.Remediation)
+	}
+
+	return 0
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// profiling options taken from the command line. an empty string means that
+// the profile is not wanted
+type profiling struct {
+	cpu   string
+	mem   string
+	trace string
+}
+
+// start any profiles that have been requested. the returned function must be
+// called before the program exits in order for the profiles to be written
+func (p profiling) start() (func(), error) {
+	var stops []func()
+	stop := func() {
+		for i := len(stops) - 1; i >= 0; i-- {
+			stops[i]()
+		}
+	}
+
+	if p.cpu != "" {
+		f, err := os.Create(p.cpu)
+		if err != nil {
+			return nil, err
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+		stops = append(stops, func() {
+			pprof.StopCPUProfile()
+			f.Close()
+		})
+	}
+
+	if p.trace != "" {
+		f, err := os.Create(p.trace)
+		if err != nil {
+			stop()
+			return nil, err
+		}
+		if err := trace.Start(f); err != nil {
+			f.Close()
+			stop()
+			return nil, err
+		}
+		stops = append(stops, func() {
+			trace.Stop()
+			f.Close()
+		})
+	}
+
+	if p.mem != "" {
+		stops = append(stops, func() {
+			f, err := os.Create(p.mem)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "critcheck: %s\n", err)
+				return
+			}
+			defer f.Close()
+			runtime.GC()
+			if err := pprof.WriteHeapProfile(f); err != nil {
+				fmt.Fprintf(os.Stderr, "critcheck: %s\n", err)
+			}
+		})
+	}
+
+	return stop, nil
+}
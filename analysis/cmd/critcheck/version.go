@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	critsec "github.com/jetsetilly/critsec/analysis"
+	"github.com/jetsetilly/critsec/analysis/driver"
+)
+
+// jsonRule is the form of a rule when listed with printRules()
+type jsonRule struct {
+	ID             string           `json:"id"`
+	Name           string           `json:"name"`
+	Severity       critsec.Severity `json:"severity"`
+	Message        string           `json:"message"`
+	Description    string           `json:"description"`
+	Rationale      string           `json:"rationale"`
+	FalsePositives string           `json:"false_positives"`
+	Remediation    string           `json:"remediation"`
+}
+
+// printRules lists every rule with its default severity. the JSON form includes
+// the full description of each rule and the version of critcheck
+func printRules(w io.Writer, asJSON bool) error {
+	if !asJSON {
+		fmt.Fprintf(w, "critcheck %s\n", driver.Version())
+		for _, r := range critsec.Rules {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.ID, r.Name, r.Severity, r.Message)
+		}
+		return nil
+	}
+
+	rules := make([]jsonRule, 0, len(critsec.Rules))
+	for _, r := range critsec.Rules {
+		rules = append(rules, jsonRule{
+			ID:             r.ID,
+			Name:           r.Name,
+			Severity:       r.Severity,
+			Message:        r.Message,
+			Description:    r.Description,
+			Rationale:      r.Rationale,
+			FalsePositives: r.FalsePositives,
+			Remediation:    r.Remediation,
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(struct {
+		Version string     `json:"version"`
+		Rules   []jsonRule `json:"rules"`
+	}{driver.Version(), rules})
+}
@@ -0,0 +1,263 @@
+// critcorpus runs critcheck against a list of real-world (or example)
+// repositories and compares the reports with golden files. it is intended to
+// catch changes in the precision of the analysis that the example program is
+// too small to reveal, and also regressions in performance
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// entry is a single repository in the corpus
+type entry struct {
+	// name of the entry. used to name the golden file
+	Name string `json:"name"`
+
+	// either a directory, relative to the corpus file, or a git repository
+	// that will be cloned into the work directory
+	Dir  string `json:"dir,omitempty"`
+	Repo string `json:"repo,omitempty"`
+	Ref  string `json:"ref,omitempty"`
+
+	// the package patterns to analyse. defaults to ./...
+	Patterns []string `json:"patterns,omitempty"`
+
+	// additional flags for critcheck. for example, ["-binaries", "./cmd/..."]
+	Flags []string `json:"flags,omitempty"`
+
+	// maximum amount of time the analysis should take. for example, "30s"
+	Budget string `json:"budget,omitempty"`
+}
+
+// report is a single critcheck report in the form stored in a golden file.
+// the filename is relative to the root of the repository
+type report struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func main() {
+	corpus := flag.String("corpus", "corpus.json", "the corpus file listing the repositories to analyse")
+	golden := flag.String("golden", "golden", "directory containing the golden files")
+	work := flag.String("work", filepath.Join(os.TempDir(), "critcorpus"), "directory into which repositories are cloned")
+	critcheck := flag.String("critcheck", "critcheck", "the critcheck program to run")
+	update := flag.Bool("update", false, "update the golden files rather than compare against them")
+	flag.Parse()
+
+	entries, err := readCorpus(*corpus)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "critcorpus: %s\n", err)
+		os.Exit(1)
+	}
+
+	critcheckPath, err := exec.LookPath(*critcheck)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "critcorpus: %s\n", err)
+		os.Exit(1)
+	}
+
+	var failed bool
+	for _, e := range entries {
+		if err := check(e, filepath.Dir(*corpus), *golden, *work, critcheckPath, *update); err != nil {
+			fmt.Fprintf(os.Stderr, "FAIL %s: %s\n", e.Name, err)
+			failed = true
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// readCorpus reads the list of entries from the corpus file
+func readCorpus(filename string) ([]entry, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var entries []entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	for _, e := range entries {
+		if e.Name == "" {
+			return nil, fmt.Errorf("%s: entry without a name", filename)
+		}
+		if (e.Dir == "") == (e.Repo == "") {
+			return nil, fmt.Errorf("%s: %s: entry must have one of dir or repo", filename, e.Name)
+		}
+	}
+	return entries, nil
+}
+
+// check a single entry in the corpus
+func check(e entry, base string, golden string, work string, critcheck string, update bool) error {
+	dir, err := prepare(e, base, work)
+	if err != nil {
+		return err
+	}
+
+	var budget time.Duration
+	if e.Budget != "" {
+		budget, err = time.ParseDuration(e.Budget)
+		if err != nil {
+			return fmt.Errorf("budget: %w", err)
+		}
+	}
+
+	patterns := e.Patterns
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	start := time.Now()
+	got, err := analyse(dir, critcheck, e.Flags, patterns)
+	if err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+
+	goldenFile := filepath.Join(golden, fmt.Sprintf("%s.json", e.Name))
+	if update {
+		data, err := json.MarshalIndent(got, "", "\t")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(goldenFile, append(data, '\n'), 0o644); err != nil {
+			return err
+		}
+		fmt.Printf("updated %s (%d reports)\n", goldenFile, len(got))
+		return nil
+	}
+
+	data, err := os.ReadFile(goldenFile)
+	if err != nil {
+		return err
+	}
+	var want []report
+	if err := json.Unmarshal(data, &want); err != nil {
+		return fmt.Errorf("%s: %w", goldenFile, err)
+	}
+
+	added, removed := compare(want, got)
+	for _, r := range added {
+		fmt.Printf("%s: new report: %s:%d:%d: %s\n", e.Name, r.File, r.Line, r.Column, r.Message)
+	}
+	for _, r := range removed {
+		fmt.Printf("%s: missing report: %s:%d:%d: %s\n", e.Name, r.File, r.Line, r.Column, r.Message)
+	}
+	if len(added) > 0 || len(removed) > 0 {
+		return fmt.Errorf("%d new and %d missing reports", len(added), len(removed))
+	}
+
+	if budget > 0 && elapsed > budget {
+		return fmt.Errorf("analysis took %v which is over the budget of %v", elapsed.Round(time.Millisecond), budget)
+	}
+
+	fmt.Printf("ok %s (%d reports in %v)\n", e.Name, len(got), elapsed.Round(time.Millisecond))
+	return nil
+}
+
+// prepare returns the directory containing the source for the entry. if the
+// entry is a git repository then it is cloned into the work directory if it
+// has not already been cloned
+func prepare(e entry, base string, work string) (string, error) {
+	if e.Dir != "" {
+		return filepath.Abs(filepath.Join(base, e.Dir))
+	}
+
+	dir := filepath.Join(work, e.Name)
+	if _, err := os.Stat(dir); err == nil {
+		return dir, nil
+	}
+
+	args := []string{"clone", "--quiet", "--depth", "1"}
+	if e.Ref != "" {
+		args = append(args, "--branch", e.Ref)
+	}
+	args = append(args, e.Repo, dir)
+
+	cmd := exec.Command("git", args...)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("cloning %s: %w", e.Repo, err)
+	}
+
+	return dir, nil
+}
+
+// analyse runs critcheck in the directory and returns the reports, sorted by
+// position and with filenames relative to the directory
+func analyse(dir string, critcheck string, flags []string, patterns []string) ([]report, error) {
+	var stdout, stderr bytes.Buffer
+	args := append([]string{"-json"}, flags...)
+	cmd := exec.Command(critcheck, append(args, patterns...)...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("critcheck: %w\n%s", err, stderr.String())
+	}
+
+	var reports []report
+	if err := json.Unmarshal(stdout.Bytes(), &reports); err != nil {
+		return nil, fmt.Errorf("critcheck output: %w", err)
+	}
+
+	for i := range reports {
+		if rel, err := filepath.Rel(dir, reports[i].File); err == nil {
+			reports[i].File = filepath.ToSlash(rel)
+		}
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		a, b := reports[i], reports[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+		return a.Rule < b.Rule
+	})
+
+	return reports, nil
+}
+
+// compare the golden reports with the reports from the analysis. returns the
+// reports that are not in the golden list and the golden reports that are
+// missing from the analysis
+func compare(want []report, got []report) (added []report, removed []report) {
+	count := make(map[report]int)
+	for _, r := range want {
+		count[r]++
+	}
+	for _, r := range got {
+		if count[r] > 0 {
+			count[r]--
+		} else {
+			added = append(added, r)
+		}
+	}
+	for _, r := range want {
+		if count[r] > 0 {
+			count[r]--
+			removed = append(removed, r)
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// TestCorpus builds critcheck and compares its reports for the entries in the
+// corpus with the golden files. it takes a few minutes and is skipped in short
+// mode. entries that are cloned from a repository are only checked by running
+// critcorpus
+func TestCorpus(t *testing.T) {
+	if testing.Short() {
+		t.Skip("the corpus is not checked in short mode")
+	}
+
+	entries, err := readCorpus("corpus.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	critcheck := filepath.Join(t.TempDir(), "critcheck")
+	build := exec.Command("go", "build", "-o", critcheck, "../critcheck")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("building critcheck: %v\n%s", err, out)
+	}
+
+	// the -mod flag can't be given in workspace mode, which one of the entries
+	// uses, and the examples don't need it. the corpus is analysed as it would
+	// be from the command line
+	t.Setenv("GOFLAGS", "")
+
+	for _, e := range entries {
+		t.Run(e.Name, func(t *testing.T) {
+			if e.Repo != "" {
+				t.Skip("entries cloned from a repository are not checked by the test")
+			}
+			if err := check(e, ".", "golden", os.TempDir(), critcheck, false); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+// critgen generates String() and MarshalJSON() functions for crit.Section
+// derived types. the generated functions take the lease (or the read lease of a
+// crit.RWSection) and format the fields while the lease is held, so the type can
+// be printed and serialised safely from any goroutine
+//
+// it is intended to be used with go generate:
+//
+//	//go:generate critgen -type state
+//
+// fields that cannot be serialised (channels, functions and the crit sections
+// themselves) are not included. the name of a field in the JSON output is taken
+// from the critgen tag of the field if it has one. fields with the tag
+// critgen:"-" are not included in either function. the json tag is not used
+// because the fields of a crit.Section derived type are usually unexported and
+// go vet reports json tags on unexported fields
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"go/types"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// the import path of the crit package
+const critPackage = "github.com/jetsetilly/critsec/crit"
+
+// field is a single field of the type that is included in the generated
+// functions
+type field struct {
+	// the name of the field in the type
+	name string
+
+	// the name of the field in the JSON output
+	json string
+}
+
+// generated describes the functions to be generated for a single type
+type generated struct {
+	typ string
+
+	// the lease function to use. either Lease or RLease
+	lease string
+
+	fields []field
+}
+
+func main() {
+	typeNames := flag.String("type", "", "comma-separated list of crit.Section derived types")
+	output := flag.String("output", "", "output file. defaults to <type>_critgen.go in the package directory")
+	flag.Parse()
+
+	if *typeNames == "" {
+		fmt.Fprintf(os.Stderr, "critgen: -type must be specified\n")
+		os.Exit(2)
+	}
+
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+
+	if err := run(dir, strings.Split(*typeNames, ","), *output); err != nil {
+		fmt.Fprintf(os.Stderr, "critgen: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(dir string, typeNames []string, output string) error {
+	cfg := packages.Config{
+		Mode: packages.NeedName | packages.NeedTypes | packages.NeedFiles,
+		Dir:  dir,
+	}
+	pkgs, err := packages.Load(&cfg, ".")
+	if err != nil {
+		return err
+	}
+	if len(pkgs) != 1 {
+		return fmt.Errorf("expected one package in %s", dir)
+	}
+	pkg := pkgs[0]
+	if len(pkg.Errors) > 0 {
+		return pkg.Errors[0]
+	}
+
+	var gens []generated
+	for _, name := range typeNames {
+		g, err := describe(pkg.Types, strings.TrimSpace(name))
+		if err != nil {
+			return err
+		}
+		gens = append(gens, g)
+	}
+
+	src, err := generate(pkg.Name, gens)
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		output = fmt.Sprintf("%s_critgen.go", strings.ToLower(gens[0].typ))
+		if len(pkg.GoFiles) > 0 {
+			output = filepath.Join(filepath.Dir(pkg.GoFiles[0]), output)
+		}
+	}
+	return os.WriteFile(output, src, 0o644)
+}
+
+// describe finds the type in the package and decides which of its fields are
+// to be included in the generated functions
+func describe(pkg *types.Package, name string) (generated, error) {
+	obj, ok := pkg.Scope().Lookup(name).(*types.TypeName)
+	if !ok {
+		return generated{}, fmt.Errorf("%s: type not found", name)
+	}
+	s, ok := obj.Type().Underlying().(*types.Struct)
+	if !ok {
+		return generated{}, fmt.Errorf("%s: not a struct type", name)
+	}
+
+	g := generated{typ: name}
+	for i := 0; i < s.NumFields(); i++ {
+		f := s.Field(i)
+
+		if section, ok := critSection(f.Type()); ok {
+			if f.Embedded() && g.lease == "" {
+				g.lease = "Lease"
+				if section == "RWSection" {
+					g.lease = "RLease"
+				}
+			}
+			continue
+		}
+
+		switch f.Type().Underlying().(type) {
+		case *types.Chan, *types.Signature:
+			continue
+		}
+
+		jsonName := f.Name()
+		if tag, ok := reflect.StructTag(s.Tag(i)).Lookup("critgen"); ok {
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				jsonName = tag
+			}
+		}
+
+		g.fields = append(g.fields, field{name: f.Name(), json: jsonName})
+	}
+
+	if g.lease == "" {
+		return generated{}, fmt.Errorf("%s: not a crit.Section derived type", name)
+	}
+
+	return g, nil
+}
+
+// critSection returns the name of the crit section type if the type is one of
+// the crit section types, or a pointer to one
+func critSection(t types.Type) (string, bool) {
+	if p, ok := types.Unalias(t).(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	n, ok := types.Unalias(t).(*types.Named)
+	if !ok || n.Obj().Pkg() == nil || n.Obj().Pkg().Path() != critPackage {
+		return "", false
+	}
+	switch n.Obj().Name() {
+	case "Section", "RWSection", "ChanSection":
+		return n.Obj().Name(), true
+	}
+	return "", false
+}
+
+// generate the source for the functions
+func generate(pkg string, gens []generated) ([]byte, error) {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "// Code generated by critgen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "package %s\n\n", pkg)
+	fmt.Fprintf(&b, "import (\n\t\"encoding/json\"\n\t\"fmt\"\n)\n")
+
+	for _, g := range gens {
+		var verbs []string
+		var args []string
+		for _, f := range g.fields {
+			verbs = append(verbs, fmt.Sprintf("%s: %%v", f.name))
+			args = append(args, fmt.Sprintf("c.%s", f.name))
+		}
+
+		fmt.Fprintf(&b, "\n// String formats the fields of %s while holding the lease\n", g.typ)
+		fmt.Fprintf(&b, "func (c *%s) String() string {\n", g.typ)
+		fmt.Fprintf(&b, "\tvar s string\n")
+		fmt.Fprintf(&b, "\t_ = c.%s(func() error {\n", g.lease)
+		sprintf := []string{fmt.Sprintf("%q", fmt.Sprintf("%s{%s}", g.typ, strings.Join(verbs, ", ")))}
+		sprintf = append(sprintf, args...)
+		fmt.Fprintf(&b, "\t\ts = fmt.Sprintf(%s)\n", strings.Join(sprintf, ", "))
+		fmt.Fprintf(&b, "\t\treturn nil\n")
+		fmt.Fprintf(&b, "\t})\n")
+		fmt.Fprintf(&b, "\treturn s\n")
+		fmt.Fprintf(&b, "}\n")
+
+		fmt.Fprintf(&b, "\n// MarshalJSON serialises the fields of %s while holding the lease\n", g.typ)
+		fmt.Fprintf(&b, "func (c *%s) MarshalJSON() ([]byte, error) {\n", g.typ)
+		fmt.Fprintf(&b, "\tvar data []byte\n")
+		fmt.Fprintf(&b, "\terr := c.%s(func() error {\n", g.lease)
+		fmt.Fprintf(&b, "\t\tvar err error\n")
+		fmt.Fprintf(&b, "\t\tdata, err = json.Marshal(map[string]any{\n")
+		for _, f := range g.fields {
+			fmt.Fprintf(&b, "\t\t\t%q: c.%s,\n", f.json, f.name)
+		}
+		fmt.Fprintf(&b, "\t\t})\n")
+		fmt.Fprintf(&b, "\t\treturn err\n")
+		fmt.Fprintf(&b, "\t})\n")
+		fmt.Fprintf(&b, "\treturn data, err\n")
+		fmt.Fprintf(&b, "}\n")
+	}
+
+	return format.Source(b.Bytes())
+}
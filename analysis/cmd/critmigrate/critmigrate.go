@@ -0,0 +1,157 @@
+// critmigrate converts structs that are protected by a sync.Mutex or
+// sync.RWMutex field named mu or lock into crit.Section (or crit.RWSection)
+// derived types. the mutex field is replaced by the embedded section and the
+// regions of code between Lock() and Unlock() become calls to Lease():
+//
+//	c.mu.Lock()
+//	c.count++
+//	c.mu.Unlock()
+//
+// becomes
+//
+//	_ = c.Lease(func() error {
+//		c.count++
+//		return nil
+//	})
+//
+// a Lock() followed by a deferred Unlock() at the top of a function is also
+// converted, including a final return statement. a type is only converted if
+// every use of its mutex can be converted. otherwise the type is left as it is
+// and a TODO comment is added to each use of the mutex that needs attention.
+// converting those uses by hand and running critmigrate again completes the
+// migration
+//
+// the converted files are printed to stdout unless the -w flag is given
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"sort"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/packages"
+)
+
+// the import path of the crit package. can be changed with the crit-package
+// flag for forks of the crit package
+var critPackage = "github.com/jetsetilly/critsec/crit"
+
+func main() {
+	write := flag.Bool("w", false, "write the converted files instead of printing them to stdout")
+	flag.StringVar(&critPackage, "crit-package", critPackage, "the import path of the crit package added to converted files")
+	flag.Parse()
+
+	patterns := flag.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+
+	if err := run(patterns, *write); err != nil {
+		fmt.Fprintf(os.Stderr, "critmigrate: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(patterns []string, write bool) error {
+	cfg := packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedSyntax |
+			packages.NeedTypes | packages.NeedTypesInfo,
+	}
+	pkgs, err := packages.Load(&cfg, patterns...)
+	if err != nil {
+		return err
+	}
+
+	for _, pkg := range pkgs {
+		if len(pkg.Errors) > 0 {
+			return pkg.Errors[0]
+		}
+
+		m := newMigration(pkg)
+		for _, t := range m.types {
+			if t.converted() {
+				fmt.Fprintf(os.Stderr, "%s: converted %s (%d regions)\n", pkg.PkgPath, t.obj.Name(), len(t.regions))
+			} else {
+				fmt.Fprintf(os.Stderr, "%s: %s not converted. %d uses of %s need attention\n", pkg.PkgPath, t.obj.Name(), len(t.todos), t.mutex.Name())
+			}
+		}
+
+		for _, f := range pkg.Syntax {
+			edits := m.edits(f)
+			if len(edits) == 0 {
+				continue
+			}
+			filename := pkg.Fset.Position(f.Pos()).Filename
+			src, err := apply(filename, edits, m.usesCrit(f))
+			if err != nil {
+				return fmt.Errorf("%s: %w", filename, err)
+			}
+			if write {
+				if err := os.WriteFile(filename, src, 0o644); err != nil {
+					return err
+				}
+				continue
+			}
+			fmt.Printf("// critmigrate: %s\n%s", filename, src)
+		}
+	}
+
+	return nil
+}
+
+// edit replaces the bytes between the start and end offsets with the text. an
+// insertion has the same start and end offset
+type edit struct {
+	start int
+	end   int
+	text  string
+}
+
+// apply the edits to the file. the crit package is imported if the converted
+// file uses it and the sync package is removed if it is no longer used. the
+// result is formatted
+func apply(filename string, edits []edit, usesCrit bool) ([]byte, error) {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// later edits are applied first so that the offsets of earlier edits are
+	// still correct
+	sort.SliceStable(edits, func(i, j int) bool {
+		return edits[i].start > edits[j].start
+	})
+	for _, e := range edits {
+		var b bytes.Buffer
+		b.Write(src[:e.start])
+		b.WriteString(e.text)
+		b.Write(src[e.end:])
+		src = b.Bytes()
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	if usesCrit {
+		astutil.AddImport(fset, f, critPackage)
+	}
+	if !astutil.UsesImport(f, "sync") {
+		astutil.DeleteImport(fset, f, "sync")
+	}
+	ast.SortImports(fset, f)
+
+	var b bytes.Buffer
+	if err := format.Node(&b, fset, f); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,572 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/packages"
+)
+
+// the names of the mutex fields that are converted
+var mutexNames = map[string]bool{
+	"mu":   true,
+	"lock": true,
+}
+
+// mutexType is a struct type with a mutex field that can be converted
+type mutexType struct {
+	obj   *types.TypeName
+	mutex *types.Var
+	field *ast.Field
+	file  *ast.File
+
+	// the mutex is a sync.RWMutex and the type becomes a crit.RWSection
+	rw bool
+
+	// the regions that can be converted and the uses of the mutex that
+	// can't be
+	regions []region
+	todos   []todo
+}
+
+// converted returns true if every use of the mutex can be converted
+func (t *mutexType) converted() bool {
+	return len(t.todos) == 0
+}
+
+// region is a Lock()/Unlock() region that can be converted to a lease
+type region struct {
+	file  *ast.File
+	edits []edit
+}
+
+// todo is a use of the mutex that can't be converted
+type todo struct {
+	file   *ast.File
+	pos    token.Pos
+	reason string
+}
+
+// migration is the conversion of the mutex types in a package
+type migration struct {
+	pkg   *packages.Package
+	types []*mutexType
+
+	// the types by their mutex field
+	byMutex map[*types.Var]*mutexType
+
+	// the source of each file, by filename
+	src map[string][]byte
+
+	// selectors of the mutex field that are part of a region or that have
+	// a TODO
+	consumed map[*ast.SelectorExpr]bool
+}
+
+func newMigration(pkg *packages.Package) *migration {
+	m := &migration{
+		pkg:      pkg,
+		byMutex:  make(map[*types.Var]*mutexType),
+		src:      make(map[string][]byte),
+		consumed: make(map[*ast.SelectorExpr]bool),
+	}
+
+	for _, f := range pkg.Syntax {
+		m.findTypes(f)
+	}
+	if len(m.types) == 0 {
+		return m
+	}
+
+	for _, f := range pkg.Syntax {
+		m.findRegions(f)
+	}
+
+	// any other use of the mutex can't be converted
+	for _, f := range pkg.Syntax {
+		ast.Inspect(f, func(n ast.Node) bool {
+			sel, ok := n.(*ast.SelectorExpr)
+			if !ok || m.consumed[sel] {
+				return true
+			}
+			if t, ok := m.mutexOf(sel); ok {
+				m.todo(t, f, sel, "mutex used outside of a Lock/Unlock region")
+			}
+			return true
+		})
+	}
+
+	return m
+}
+
+// findTypes finds the struct types in the file with a mutex field that can be
+// converted
+func (m *migration) findTypes(f *ast.File) {
+	ast.Inspect(f, func(n ast.Node) bool {
+		ts, ok := n.(*ast.TypeSpec)
+		if !ok {
+			return true
+		}
+		st, ok := ts.Type.(*ast.StructType)
+		if !ok {
+			return true
+		}
+		obj, ok := m.pkg.TypesInfo.Defs[ts.Name].(*types.TypeName)
+		if !ok {
+			return true
+		}
+
+		for _, fld := range st.Fields.List {
+			if len(fld.Names) != 1 || !mutexNames[fld.Names[0].Name] {
+				continue
+			}
+			name, ok := syncType(m.pkg.TypesInfo.TypeOf(fld.Type))
+			if !ok {
+				continue
+			}
+			v, ok := m.pkg.TypesInfo.Defs[fld.Names[0]].(*types.Var)
+			if !ok {
+				continue
+			}
+			t := &mutexType{
+				obj:   obj,
+				mutex: v,
+				field: fld,
+				file:  f,
+				rw:    name == "RWMutex",
+			}
+			m.types = append(m.types, t)
+			m.byMutex[v] = t
+			break
+		}
+		return true
+	})
+}
+
+// syncType returns the name of the type if it is sync.Mutex or sync.RWMutex.
+// pointers to a mutex are not converted
+func syncType(t types.Type) (string, bool) {
+	n, ok := types.Unalias(t).(*types.Named)
+	if !ok || n.Obj().Pkg() == nil || n.Obj().Pkg().Path() != "sync" {
+		return "", false
+	}
+	switch n.Obj().Name() {
+	case "Mutex", "RWMutex":
+		return n.Obj().Name(), true
+	}
+	return "", false
+}
+
+// mutexOf returns the mutex type if the selector selects the mutex field
+func (m *migration) mutexOf(sel *ast.SelectorExpr) (*mutexType, bool) {
+	s, ok := m.pkg.TypesInfo.Selections[sel]
+	if !ok {
+		return nil, false
+	}
+	v, ok := s.Obj().(*types.Var)
+	if !ok {
+		return nil, false
+	}
+	t, ok := m.byMutex[v]
+	return t, ok
+}
+
+// mutexCall returns the selector of the mutex and the name of the method if
+// the expression is a call to a method of a mutex that is being converted
+func (m *migration) mutexCall(e ast.Expr) (*ast.SelectorExpr, string, *mutexType, bool) {
+	call, ok := e.(*ast.CallExpr)
+	if !ok || len(call.Args) != 0 {
+		return nil, "", nil, false
+	}
+	method, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return nil, "", nil, false
+	}
+	sel, ok := method.X.(*ast.SelectorExpr)
+	if !ok {
+		return nil, "", nil, false
+	}
+	t, ok := m.mutexOf(sel)
+	if !ok {
+		return nil, "", nil, false
+	}
+	return sel, method.Sel.Name, t, true
+}
+
+// the unlock method for each lock method, and the lease function that
+// replaces the lock
+var (
+	unlockMethod = map[string]string{"Lock": "Unlock", "RLock": "RUnlock"}
+	leaseMethod  = map[string]string{"Lock": "Lease", "RLock": "RLease"}
+)
+
+// findRegions finds the Lock()/Unlock() regions in every statement list of
+// the file
+func (m *migration) findRegions(f *ast.File) {
+	var stack []ast.Node
+	ast.Inspect(f, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+
+		// the nearest function and whether the statement list is the body
+		// of the function
+		var fn *ast.FuncType
+		var body bool
+		for i := len(stack) - 1; i >= 0; i-- {
+			switch p := stack[i].(type) {
+			case *ast.FuncDecl:
+				fn, body = p.Type, p.Body == n && i == len(stack)-1
+			case *ast.FuncLit:
+				fn, body = p.Type, p.Body == n && i == len(stack)-1
+			default:
+				continue
+			}
+			break
+		}
+
+		switch s := n.(type) {
+		case *ast.BlockStmt:
+			m.findInList(f, s.List, fn, body)
+		case *ast.CaseClause:
+			m.findInList(f, s.Body, fn, false)
+		case *ast.CommClause:
+			m.findInList(f, s.Body, fn, false)
+		}
+
+		stack = append(stack, n)
+		return true
+	})
+}
+
+// findInList finds the regions that start in the statement list. fn is the
+// type of the function containing the list and body is true if the list is
+// the body of the function
+func (m *migration) findInList(f *ast.File, list []ast.Stmt, fn *ast.FuncType, body bool) {
+	for i, s := range list {
+		es, ok := s.(*ast.ExprStmt)
+		if !ok {
+			continue
+		}
+		sel, method, t, ok := m.mutexCall(es.X)
+		if !ok {
+			continue
+		}
+		unlock, ok := unlockMethod[method]
+		if !ok {
+			continue
+		}
+		recv := types.ExprString(sel.X)
+
+		// Lock() followed immediately by a deferred Unlock()
+		if i+1 < len(list) {
+			if ds, ok := list[i+1].(*ast.DeferStmt); ok {
+				if dsel, dm, _, ok := m.mutexCall(ds.Call); ok && dm == unlock && types.ExprString(dsel.X) == recv {
+					m.consumed[dsel] = true
+					if !body {
+						m.todo(t, f, sel, "deferred Unlock in a nested block")
+						continue
+					}
+					m.deferRegion(t, f, sel, method, s, ds, list[i+2:], fn)
+					continue
+				}
+			}
+		}
+
+		// Lock() with an Unlock() later in the same list
+		j := -1
+		for k := i + 1; k < len(list); k++ {
+			if es, ok := list[k].(*ast.ExprStmt); ok {
+				if usel, um, _, ok := m.mutexCall(es.X); ok && um == unlock && types.ExprString(usel.X) == recv {
+					m.consumed[usel] = true
+					j = k
+					break
+				}
+			}
+		}
+		if j < 0 {
+			m.todo(t, f, sel, fmt.Sprintf("no matching %s in the same block", unlock))
+			continue
+		}
+		if reason, ok := m.escapes(list[i+1 : j]); ok {
+			m.todo(t, f, sel, reason)
+			continue
+		}
+
+		m.consumed[sel] = true
+		t.regions = append(t.regions, region{
+			file: f,
+			edits: []edit{
+				m.replace(s, fmt.Sprintf("_ = %s.%s(func() error {", recv, leaseMethod[method])),
+				m.replace(list[j], "return nil\n})"),
+			},
+		})
+	}
+}
+
+// deferRegion converts a Lock() and deferred Unlock() at the top level of a
+// function. the region is the rest of the function, which can end with a
+// return statement
+func (m *migration) deferRegion(t *mutexType, f *ast.File, sel *ast.SelectorExpr, method string, lock ast.Stmt, unlock *ast.DeferStmt, rest []ast.Stmt, fn *ast.FuncType) {
+	if len(rest) == 0 {
+		m.todo(t, f, sel, "nothing after the deferred Unlock")
+		return
+	}
+
+	// the final return statement is moved out of the lease
+	var ret *ast.ReturnStmt
+	if r, ok := rest[len(rest)-1].(*ast.ReturnStmt); ok {
+		ret = r
+		rest = rest[:len(rest)-1]
+	}
+	if reason, ok := m.escapes(rest); ok {
+		m.todo(t, f, sel, reason)
+		return
+	}
+
+	// the types of the results of the function
+	var results []string
+	if fn.Results != nil {
+		for _, r := range fn.Results.List {
+			n := len(r.Names)
+			if n == 0 {
+				n = 1
+			}
+			for k := 0; k < n; k++ {
+				results = append(results, types.ExprString(r.Type))
+			}
+		}
+	}
+
+	recv := types.ExprString(sel.X)
+	open := fmt.Sprintf("_ = %s.%s(func() error {", recv, leaseMethod[method])
+	rg := region{file: f}
+
+	switch {
+	case ret == nil:
+		rg.edits = append(rg.edits, m.insert(rest[len(rest)-1].End(), "\nreturn nil\n})"))
+	case len(ret.Results) == 0 && len(results) > 0:
+		m.todo(t, f, sel, "bare return with named results")
+		return
+	case len(ret.Results) == 0:
+		rg.edits = append(rg.edits, m.replace(ret, "return nil\n})"))
+	case len(ret.Results) != len(results):
+		m.todo(t, f, sel, "return of a call with multiple results")
+		return
+	default:
+		// the results are evaluated inside the lease and returned after it
+		var decls, names, values []string
+		for k, r := range results {
+			name := fmt.Sprintf("ret%d", k)
+			names = append(names, name)
+			decls = append(decls, fmt.Sprintf("var %s %s\n", name, r))
+			values = append(values, m.text(ret.Results[k]))
+		}
+		open = strings.Join(decls, "") + open
+		rg.edits = append(rg.edits, m.replace(ret, fmt.Sprintf("%s = %s\nreturn nil\n})\nreturn %s",
+			strings.Join(names, ", "), strings.Join(values, ", "), strings.Join(names, ", "))))
+	}
+
+	m.consumed[sel] = true
+	rg.edits = append(rg.edits, edit{
+		start: m.offset(lock.Pos()),
+		end:   m.offset(unlock.End()),
+		text:  open,
+	})
+	t.regions = append(t.regions, rg)
+}
+
+// escapes returns the reason if control can leave the statements other than
+// by reaching the end of them, or if control can enter the statements other
+// than at the start. a region that can be left or entered in this way can't be
+// moved into a function literal without changing what it does
+//
+// a labelled branch is allowed if the label is inside the region, in which
+// case the branch is still valid once the region is moved into a function
+// literal
+func (m *migration) escapes(stmts []ast.Stmt) (string, bool) {
+	if len(stmts) == 0 {
+		return "", false
+	}
+
+	var reason string
+	var stack []ast.Node
+
+	// the labels defined in the region
+	labels := make(map[types.Object]bool)
+	for _, s := range stmts {
+		ast.Inspect(s, func(n ast.Node) bool {
+			if l, ok := n.(*ast.LabeledStmt); ok {
+				labels[m.pkg.TypesInfo.Defs[l.Label]] = true
+			}
+			_, lit := n.(*ast.FuncLit)
+			return !lit
+		})
+	}
+
+	for _, s := range stmts {
+		ast.Inspect(s, func(n ast.Node) bool {
+			if reason != "" {
+				return false
+			}
+			if n == nil {
+				stack = stack[:len(stack)-1]
+				return true
+			}
+
+			switch b := n.(type) {
+			case *ast.FuncLit:
+				return false
+			case *ast.ReturnStmt:
+				reason = "return inside the region"
+			case *ast.DeferStmt:
+				reason = "defer inside the region"
+			case *ast.BranchStmt:
+				if b.Label != nil {
+					if !labels[m.pkg.TypesInfo.Uses[b.Label]] {
+						reason = fmt.Sprintf("%s %s leaves the region", b.Tok, b.Label.Name)
+					}
+					break
+				}
+				if !breakable(stack, b.Tok) {
+					reason = fmt.Sprintf("%s leaves the region", b.Tok)
+				}
+			}
+			if reason != "" {
+				return false
+			}
+
+			stack = append(stack, n)
+			return true
+		})
+		if reason != "" {
+			return reason, true
+		}
+	}
+
+	// a goto from outside the region to a label inside it
+	start, end := stmts[0].Pos(), stmts[len(stmts)-1].End()
+	for id, obj := range m.pkg.TypesInfo.Uses {
+		if labels[obj] && (id.Pos() < start || id.Pos() >= end) {
+			return fmt.Sprintf("goto %s enters the region", id.Name), true
+		}
+	}
+
+	return "", false
+}
+
+// breakable returns true if the break or continue statement is inside a
+// statement that it applies to
+func breakable(stack []ast.Node, tok token.Token) bool {
+	for _, n := range stack {
+		switch n.(type) {
+		case *ast.ForStmt, *ast.RangeStmt:
+			return true
+		case *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+			if tok == token.BREAK {
+				return true
+			}
+		}
+	}
+	return tok == token.FALLTHROUGH
+}
+
+// todo records a use of the mutex that can't be converted. the TODO comment is
+// added before the statement containing the use
+func (m *migration) todo(t *mutexType, f *ast.File, sel *ast.SelectorExpr, reason string) {
+	m.consumed[sel] = true
+	pos := sel.Pos()
+	path, _ := astutil.PathEnclosingInterval(f, sel.Pos(), sel.End())
+	for _, n := range path {
+		if s, ok := n.(ast.Stmt); ok {
+			if _, ok := n.(*ast.BlockStmt); !ok {
+				pos = s.Pos()
+				break
+			}
+		}
+	}
+	t.todos = append(t.todos, todo{file: f, pos: pos, reason: reason})
+}
+
+// edits returns the edits to make to the file
+func (m *migration) edits(f *ast.File) []edit {
+	var edits []edit
+	seen := make(map[int]bool)
+
+	for _, t := range m.types {
+		if !t.converted() {
+			for _, td := range t.todos {
+				if td.file != f || seen[m.offset(td.pos)] {
+					continue
+				}
+				seen[m.offset(td.pos)] = true
+				edits = append(edits, m.insert(td.pos, fmt.Sprintf("// TODO(critmigrate): %s\n", td.reason)))
+			}
+			if t.file == f {
+				edits = append(edits, m.insert(t.field.Pos(), fmt.Sprintf("// TODO(critmigrate): %s can be converted once the uses of %s marked TODO are converted\n", t.obj.Name(), t.mutex.Name())))
+			}
+			continue
+		}
+
+		if t.file == f {
+			section := "crit.Section"
+			if t.rw {
+				section = "crit.RWSection"
+			}
+			edits = append(edits, edit{start: m.offset(t.field.Pos()), end: m.offset(t.field.End()), text: section})
+		}
+		for _, r := range t.regions {
+			if r.file == f {
+				edits = append(edits, r.edits...)
+			}
+		}
+	}
+
+	return edits
+}
+
+// usesCrit returns true if a type declared in the file is converted
+func (m *migration) usesCrit(f *ast.File) bool {
+	for _, t := range m.types {
+		if t.file == f && t.converted() {
+			return true
+		}
+	}
+	return false
+}
+
+// offset returns the offset of the position in its file
+func (m *migration) offset(pos token.Pos) int {
+	return m.pkg.Fset.Position(pos).Offset
+}
+
+// replace returns an edit that replaces the node with the text
+func (m *migration) replace(n ast.Node, text string) edit {
+	return edit{start: m.offset(n.Pos()), end: m.offset(n.End()), text: text}
+}
+
+// insert returns an edit that inserts the text at the position
+func (m *migration) insert(pos token.Pos, text string) edit {
+	return edit{start: m.offset(pos), end: m.offset(pos), text: text}
+}
+
+// text returns the source of the node
+func (m *migration) text(n ast.Node) string {
+	filename := m.pkg.Fset.Position(n.Pos()).Filename
+	src, ok := m.src[filename]
+	if !ok {
+		var err error
+		src, err = os.ReadFile(filename)
+		if err != nil {
+			return types.ExprString(n.(ast.Expr))
+		}
+		m.src[filename] = src
+	}
+	return string(src[m.offset(n.Pos()):m.offset(n.End())])
+}
@@ -0,0 +1,116 @@
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Severity of a rule
+type Severity int
+
+// list of severities in increasing order
+const (
+	SeverityOff Severity = iota
+	SeverityInfo
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityOff:
+		return "off"
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return "unknown"
+}
+
+// ParseSeverity returns the Severity for the string. the string is not case
+// sensitive
+func ParseSeverity(s string) (Severity, error) {
+	for sev := SeverityOff; sev <= SeverityError; sev++ {
+		if strings.EqualFold(s, sev.String()) {
+			return sev, nil
+		}
+	}
+	return SeverityOff, fmt.Errorf("unknown severity %q", s)
+}
+
+// MarshalJSON implements the json.Marshaler interface
+func (s Severity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface
+func (s *Severity) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	sev, err := ParseSeverity(str)
+	if err != nil {
+		return err
+	}
+	*s = sev
+	return nil
+}
+
+// RuleConfig overrides the default behaviour of a rule
+type RuleConfig struct {
+	Severity *Severity `json:"severity,omitempty"`
+}
+
+// Config is the contents of a critsec configuration file. the file is JSON
+// encoded. for example:
+//
+//	{
+//		"rules": {
+//			"CS004": { "severity": "warning" }
+//		}
+//	}
+type Config struct {
+	// rule configuration keyed by rule ID
+	Rules map[string]RuleConfig `json:"rules,omitempty"`
+}
+
+// ReadConfig reads and validates the configuration file
+func ReadConfig(filename string) (Config, error) {
+	var cfg Config
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return cfg, err
+	}
+
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	for id := range cfg.Rules {
+		if _, ok := LookupRule(id); !ok {
+			return cfg, fmt.Errorf("%s: unknown rule %q", filename, id)
+		}
+	}
+
+	return cfg, nil
+}
+
+// Severity returns the severity of the rule after any override in the
+// configuration has been applied
+func (cfg Config) Severity(rule Rule) Severity {
+	for id, rc := range cfg.Rules {
+		if strings.EqualFold(id, rule.ID) && rc.Severity != nil {
+			return *rc.Severity
+		}
+	}
+	return rule.Severity
+}
@@ -0,0 +1,48 @@
+package analysis
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// the name of the copy-on-write type in the crit package
+const critCOWType = "COW"
+
+// isCOWType returns true if the type is an instance of crit.COW or a pointer to
+// one
+func isCOWType(t types.Type) bool {
+	t = types.Unalias(t)
+	if p, ok := t.(*types.Pointer); ok {
+		t = types.Unalias(p.Elem())
+	}
+	n, ok := t.(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := n.Origin().Obj()
+	if obj.Pkg() == nil {
+		return false
+	}
+	return obj.Name() == critCOWType && isCritPackage(obj.Pkg().Path())
+}
+
+// isCOWOp returns true if the selector expression at the top of the stack is a
+// crit.COW field of a crit.Section derived type that is used to call one of
+// the methods of crit.COW. the methods of crit.COW are safe to call without
+// the lease
+//
+// values returned by Load() are immutable and can be read without the lease
+func isCOWOp(pass *analysis.Pass, sel *ast.SelectorExpr, stack []ast.Node) bool {
+	if !isCOWType(pass.TypesInfo.TypeOf(sel)) || len(stack) < 3 {
+		return false
+	}
+
+	method, ok := stack[len(stack)-2].(*ast.SelectorExpr)
+	if !ok || method.X != sel {
+		return false
+	}
+	call, ok := stack[len(stack)-3].(*ast.CallExpr)
+	return ok && call.Fun == method
+}
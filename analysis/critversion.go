@@ -0,0 +1,149 @@
+package analysis
+
+import (
+	"fmt"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// CritAPIVersion is the version of the API of the crit package known to the
+// analysis. it must be increased at the same time as crit.APIVersion
+const CritAPIVersion = 1
+
+// the name of the constant in the crit package that gives its API version
+const critAPIConstant = "APIVersion"
+
+// the methods of the section types that take a function and that are known to
+// the analysis, other than the lease methods
+var otherCritMethods = map[string]bool{
+	"InitOnce": true,
+}
+
+// CritAPIVersionOf returns the API version of the crit package. a crit package
+// from before the version was added, or a fork without it, has a version of
+// zero
+func CritAPIVersionOf(crit *types.Package) int {
+	c, ok := crit.Scope().Lookup(critAPIConstant).(*types.Const)
+	if !ok {
+		return 0
+	}
+	v, ok := constant.Int64Val(c.Val())
+	if !ok {
+		return 0
+	}
+	return int(v)
+}
+
+// checkCritVersion reports a package that imports a crit package that is not
+// compatible with the analysis. this is a crit package with a newer API version
+// than the analysis knows, a crit package with a lower API version than the
+// min-crit-version flag, or a crit package with methods or functions that look
+// like lease functions but that the analysis doesn't know
+//
+// the report is made at the import of the crit package
+func checkCritVersion(pass *analysis.Pass, rep *reporter) {
+	if isCritPackage(pass.Pkg.Path()) {
+		return
+	}
+
+	var crit *types.Package
+	for _, imp := range pass.Pkg.Imports() {
+		if isCritPackage(imp.Path()) {
+			crit = imp
+			break
+		}
+	}
+	if crit == nil {
+		return
+	}
+	pos := importPos(pass, crit.Path())
+	if !pos.IsValid() {
+		return
+	}
+
+	var details []string
+	v := CritAPIVersionOf(crit)
+	if v > CritAPIVersion {
+		details = append(details, fmt.Sprintf("the crit package has API version %d but the analysis only knows version %d", v, CritAPIVersion))
+	}
+	if v < minCritVersion {
+		details = append(details, fmt.Sprintf("the crit package has API version %d, lower than the minimum of %d", v, minCritVersion))
+	}
+	if unknown := unknownLeaseFunctions(crit); len(unknown) > 0 {
+		details = append(details, fmt.Sprintf("not known to the analysis: %s", strings.Join(unknown, ", ")))
+	}
+	if len(details) == 0 {
+		return
+	}
+
+	rep.reportDetail(pos, RuleCritVersion, subject{field: critAPIConstant}, strings.Join(details, "; "))
+}
+
+// importPos returns the position of the first import of the package in the
+// files of the pass
+func importPos(pass *analysis.Pass, path string) token.Pos {
+	for _, f := range pass.Files {
+		for _, spec := range f.Imports {
+			if p, err := strconv.Unquote(spec.Path.Value); err == nil && p == path {
+				return spec.Pos()
+			}
+		}
+	}
+	return token.NoPos
+}
+
+// unknownLeaseFunctions returns the exported methods of the types in the crit
+// package, and the exported functions, whose last parameter is a func() error
+// and which are not known to the analysis. these are most likely lease methods
+// added to a newer crit package. the names are sorted
+func unknownLeaseFunctions(crit *types.Package) []string {
+	var unknown []string
+	scope := crit.Scope()
+	for _, name := range scope.Names() {
+		switch obj := scope.Lookup(name).(type) {
+		case *types.Func:
+			if !obj.Exported() || !takesLeasedFunction(obj) {
+				continue
+			}
+			if _, ok := lookupLeaseFunction(obj.Name()); !ok {
+				unknown = append(unknown, fmt.Sprintf("crit.%s()", obj.Name()))
+			}
+		case *types.TypeName:
+			if !obj.Exported() {
+				continue
+			}
+			ms := types.NewMethodSet(types.NewPointer(obj.Type()))
+			for i := 0; i < ms.Len(); i++ {
+				fn, ok := ms.At(i).Obj().(*types.Func)
+				if !ok || !fn.Exported() || !takesLeasedFunction(fn) || otherCritMethods[fn.Name()] {
+					continue
+				}
+				if _, ok := lookupLeaseMethod(fn.Name()); !ok {
+					unknown = append(unknown, fmt.Sprintf("%s.%s()", obj.Name(), fn.Name()))
+				}
+			}
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// takesLeasedFunction returns true if the last parameter of the function is a
+// func() error, which is the form of the function passed to a lease method
+func takesLeasedFunction(fn *types.Func) bool {
+	params := fn.Type().(*types.Signature).Params()
+	if params.Len() == 0 {
+		return false
+	}
+	sig, ok := params.At(params.Len() - 1).Type().Underlying().(*types.Signature)
+	if !ok || sig.Params().Len() != 0 || sig.Results().Len() != 1 {
+		return false
+	}
+	return types.Identical(sig.Results().At(0).Type(), types.Universe.Lookup("error").Type())
+}
@@ -0,0 +1,188 @@
+package analysis
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/callgraph"
+)
+
+// pathStatus records the chains of calls from a callgraph node. a nil chain
+// means that no such chain exists. a chain is a list of edges leading away
+// from the node, ending either with a call from the lease function or with a
+// function that has no callers
+//
+// the read chain is a protected chain that ends with a call from a read lease
+// (ie. RLease). it can be the same as the protected chain
+type pathStatus struct {
+	protected   []*callgraph.Edge
+	unprotected []*callgraph.Edge
+	read        []*callgraph.Edge
+}
+
+// decision records how checkLease() came to its conclusion
+type decision struct {
+	// the containing function has the requires directive. no callgraph
+	// nodes are considered in this case
+	requires bool
+
+	// the access is inside an Acquire() region of the containing function.
+	// acquiredRead is true if the region is a read lease
+	acquired     bool
+	acquiredRead bool
+
+	// the callgraph nodes that were matched with the containing function
+	nodes []*callgraph.Node
+
+	// the first protected and unprotected chain found from the matched nodes
+	protected   []*callgraph.Edge
+	unprotected []*callgraph.Edge
+
+	// the first chain found that is protected by a read lease. a write is
+	// not allowed under a read lease
+	read []*callgraph.Edge
+}
+
+// leased returns true if the access is leased on all call paths
+func (d decision) leased() bool {
+	return d.requires || d.acquired || (d.protected != nil && d.unprotected == nil)
+}
+
+// conditional returns true if the access is leased on some call paths but
+// not others
+func (d decision) conditional() bool {
+	return !d.requires && !d.acquired && d.protected != nil && d.unprotected != nil
+}
+
+// status returns the outcome of the decision as one of the access statuses
+// used by the model
+func (d decision) status() string {
+	switch {
+	case d.conditional():
+		return AccessConditional
+	case d.leased():
+		return AccessLeased
+	}
+	return AccessUnleased
+}
+
+// underRead returns true if the access is leased with a read lease. a read
+// lease in an Acquire() region of the containing function takes the place of
+// the read chain
+func (d decision) underRead() bool {
+	if d.acquired {
+		return d.acquiredRead
+	}
+	return d.read != nil
+}
+
+// related returns the protected and unprotected chains as related
+// information for a diagnostic
+func (d decision) related() []analysis.RelatedInformation {
+	var related []analysis.RelatedInformation
+	add := func(chain []*callgraph.Edge, label string) {
+		for _, e := range chain {
+			related = append(related, analysis.RelatedInformation{
+				Pos:     edgePos(e),
+				Message: fmt.Sprintf("%s: %s called by %s", label, e.Callee.Func.Name(), e.Caller.Func.Name()),
+			})
+		}
+	}
+	add(d.protected, "leased")
+	add(d.unprotected, "not leased")
+	return related
+}
+
+// cause returns the root cause of an unleased access. the nf argument is the
+// function containing the access and fn is its name
+func (d decision) cause(nf ast.Node, fn string) *Cause {
+	if len(d.unprotected) == 0 {
+		return &Cause{Pos: nf.Pos(), Message: fmt.Sprintf("%s is not leased", fn)}
+	}
+	e := d.unprotected[len(d.unprotected)-1]
+	return &Cause{
+		Pos:     edgePos(e),
+		Message: fmt.Sprintf("%s called by %s without a lease", e.Callee.Func.Name(), e.Caller.Func.Name()),
+	}
+}
+
+// relatedRead returns the read chain as related information for a diagnostic
+func (d decision) relatedRead() []analysis.RelatedInformation {
+	var related []analysis.RelatedInformation
+	for _, e := range d.read {
+		related = append(related, analysis.RelatedInformation{
+			Pos:     edgePos(e),
+			Message: fmt.Sprintf("read lease: %s called by %s", e.Callee.Func.Name(), e.Caller.Func.Name()),
+		})
+	}
+	return related
+}
+
+// edgePos returns the position of the call site for the edge. if there is no
+// call site then the position of the calling function is used
+func edgePos(e *callgraph.Edge) token.Pos {
+	if pos := e.Pos(); pos.IsValid() {
+		return pos
+	}
+	return e.Caller.Func.Pos()
+}
+
+// print the decision in a form suitable for the -debug.decisions flag. the n
+// argument is the access being checked and nf is the containing function
+func (d decision) print(w io.Writer, pass *analysis.Pass, n ast.Node, nf ast.Node, rule Rule) {
+	fmt.Fprintf(w, "%s: %s\n", pass.Fset.Position(n.Pos()), rule.ID)
+	fmt.Fprintf(w, "\tcontaining function: %s\n", describeFunction(pass, nf))
+
+	if d.acquired {
+		fmt.Fprintf(w, "\taccess is inside an Acquire region\n")
+	}
+	if d.requires {
+		fmt.Fprintf(w, "\tcontaining function has the %s%s directive\n", directivePrefix, directiveRequires)
+	} else if len(d.nodes) == 0 {
+		fmt.Fprintf(w, "\tno callgraph node matched\n")
+	}
+
+	for _, n := range d.nodes {
+		fmt.Fprintf(w, "\tmatched node: %s\n", n.Func)
+	}
+
+	printChain := func(label string, chain []*callgraph.Edge) {
+		if chain == nil {
+			return
+		}
+		fmt.Fprintf(w, "\t%s chain:\n", label)
+		for _, e := range chain {
+			fmt.Fprintf(w, "\t\tcalled by: %s\n", e.Caller.Func)
+		}
+		if len(chain) == 0 || !isLeaseFunction(chain[len(chain)-1].Caller.Func.Name()) {
+			fmt.Fprintf(w, "\t\t(no further callers)\n")
+		}
+	}
+	printChain("leased", d.protected)
+	printChain("not leased", d.unprotected)
+	printChain("read lease", d.read)
+
+	switch {
+	case d.leased():
+		fmt.Fprintf(w, "\tleased: yes\n")
+	case d.conditional():
+		fmt.Fprintf(w, "\tleased: on some paths\n")
+	default:
+		fmt.Fprintf(w, "\tleased: no\n")
+	}
+}
+
+// describeFunction returns a short description of a function declaration or
+// function literal
+func describeFunction(pass *analysis.Pass, nf ast.Node) string {
+	switch f := nf.(type) {
+	case *ast.FuncDecl:
+		return fmt.Sprintf("%s (%s)", f.Name.Name, pass.Fset.Position(f.Pos()))
+	case *ast.FuncLit:
+		return fmt.Sprintf("function literal (%s)", pass.Fset.Position(f.Pos()))
+	}
+	return fmt.Sprintf("unknown (%s)", pass.Fset.Position(nf.Pos()))
+}
@@ -0,0 +1,147 @@
+package analysis
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ssa"
+)
+
+// critsec directives are written as comments in the same style as Go compiler
+// directives. ie. with no space between the slashes and the directive
+const directivePrefix = "//critsec:"
+
+// list of directives
+const (
+	// the function must only be called by code that holds the lease. accesses
+	// inside the function are treated as leased and calls to the function are
+	// checked instead
+	directiveRequires = "requires"
+
+	// the function is the constructor for a crit.Section derived type. fields
+	// that are only written in constructors can be read without the lease if
+	// the initonce flag is set
+	directiveConstructor = "constructor"
+
+	// the field is protected by the named sync.Mutex or sync.RWMutex field in
+	// the same struct rather than by the crit.Section. accesses to the field
+	// do not require the lease
+	directiveGuardedBy = "guardedby"
+
+	// the field does, or does not, require the lease. the guarded directive
+	// is the default and is only useful to make the policy of the field
+	// explicit
+	directiveGuarded   = "guarded"
+	directiveUnguarded = "unguarded"
+
+	// the crit.Section derived type can have more than one instance. the
+	// directive is written in the doc comment of the type declaration
+	directiveMulti = "multi"
+
+	// ownership of the instance sent on the channel, or passed to the
+	// function, moves to the receiver. the directive is written on the
+	// statement or on the line before it
+	directiveTransfer = "transfer"
+
+	// the package-level variable can be written from inside a lease. the
+	// directive is written in the doc comment or the line comment of the
+	// variable declaration
+	directiveLeaseWrite = "leasewrite"
+
+	// the type is a mock or a fake used by tests. instances of the type, and
+	// of the crit.Section derived types it embeds, are not counted as
+	// instances and the type can be passed by value. the directive is only
+	// recognised in the doc comment of a type declared in a test file
+	directiveTestDouble = "testdouble"
+
+	// reports for the listed rules are not made for the line, the function
+	// or the block of lines. see ignores
+	directiveIgnore      = "ignore"
+	directiveIgnoreBegin = "ignore-begin"
+	directiveIgnoreEnd   = "ignore-end"
+)
+
+// hasDirective returns true if the comment group contains the named directive
+func hasDirective(doc *ast.CommentGroup, name string) bool {
+	_, ok := directiveArgs(doc, name)
+	return ok
+}
+
+// directiveArgs returns the arguments to the named directive in the comment
+// group. returns false if the directive is not in the comment group
+func directiveArgs(doc *ast.CommentGroup, name string) ([]string, bool) {
+	if doc == nil {
+		return nil, false
+	}
+	for _, c := range doc.List {
+		d, ok := strings.CutPrefix(c.Text, directivePrefix)
+		if !ok {
+			continue
+		}
+		if f := strings.Fields(d); len(f) > 0 && f[0] == name {
+			return f[1:], true
+		}
+	}
+	return nil, false
+}
+
+// requiresLease returns true if the node is a function declaration with the
+// requires directive
+func requiresLease(nf ast.Node) bool {
+	if f, ok := nf.(*ast.FuncDecl); ok {
+		return hasDirective(f.Doc, directiveRequires)
+	}
+	return false
+}
+
+// isConstructor returns true if the node is a function declaration with the
+// constructor directive
+func isConstructor(nf ast.Node) bool {
+	if f, ok := nf.(*ast.FuncDecl); ok {
+		return hasDirective(f.Doc, directiveConstructor)
+	}
+	return false
+}
+
+// multiInstanceTypes returns the types declared in the package with the multi
+// directive
+func multiInstanceTypes(pass *analysis.Pass) map[*types.TypeName]bool {
+	multi := make(map[*types.TypeName]bool)
+	for _, f := range pass.Files {
+		for _, d := range f.Decls {
+			gd, ok := d.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				ts := spec.(*ast.TypeSpec)
+
+				// the doc comment of a type declaration with a single spec
+				// belongs to the declaration rather than to the spec
+				doc := ts.Doc
+				if doc == nil && len(gd.Specs) == 1 {
+					doc = gd.Doc
+				}
+				if !hasDirective(doc, directiveMulti) {
+					continue
+				}
+				if id, ok := pass.TypesInfo.Defs[ts.Name].(*types.TypeName); ok {
+					multi[id] = true
+				}
+			}
+		}
+	}
+	return multi
+}
+
+// ssaRequiresLease returns true if the SSA function was declared with the
+// requires directive
+func ssaRequiresLease(f *ssa.Function) bool {
+	if f == nil {
+		return false
+	}
+	return requiresLease(f.Syntax())
+}
@@ -0,0 +1,229 @@
+package analysis
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// doubleCheck is the read of a field in the condition of an if statement,
+// where the body of the if statement leases the section and checks the field
+// again before assigning to it. this is double-checked locking
+type doubleCheck struct {
+	detail string
+
+	// the suggested fix that replaces the if statement with a call to
+	// InitOnce(). nil if the if statement isn't simple enough
+	fixes []analysis.SuggestedFix
+}
+
+// doubleChecks maps the position of the first read of the field to the double
+// check it is part of. whether the read is leased is decided with every other
+// access
+type doubleChecks map[token.Pos]doubleCheck
+
+// findDoubleChecks looks for double-checked locking. for example:
+//
+//	if C.x == nil {
+//		_ = C.Lease(func() error {
+//			if C.x == nil {
+//				C.x = newX()
+//			}
+//			return nil
+//		})
+//	}
+//
+// the second check can be in the function passed to a lease method or after a
+// call to Acquire() in the body of the first if statement. the field must be
+// assigned to in the body of the second if statement
+func findDoubleChecks(pass *analysis.Pass, inspect *inspector.Inspector) doubleChecks {
+	dcs := make(doubleChecks)
+
+	inspect.Preorder([]ast.Node{(*ast.IfStmt)(nil)}, func(n ast.Node) {
+		outer := n.(*ast.IfStmt)
+		for _, sel := range conditionFields(pass, outer.Cond) {
+			if _, ok := dcs[sel.Pos()]; ok {
+				continue
+			}
+			lc, inner, ok := findSecondCheck(pass, outer.Body, types.ExprString(sel))
+			if !ok {
+				continue
+			}
+			dc := doubleCheck{
+				detail: fmt.Sprintf("%s is checked again at line %d after the lease is taken. use InitOnce() or publish the value atomically",
+					types.ExprString(sel), pass.Fset.Position(inner.Pos()).Line),
+			}
+			if fix, ok := initOnceFix(pass, outer, lc, inner); ok {
+				dc.fixes = append(dc.fixes, fix)
+			}
+			dcs[sel.Pos()] = dc
+		}
+	})
+
+	return dcs
+}
+
+// conditionFields returns the fields of crit.Section derived types that are
+// read in the condition of an if statement
+func conditionFields(pass *analysis.Pass, cond ast.Expr) []*ast.SelectorExpr {
+	var fields []*ast.SelectorExpr
+	ast.Inspect(cond, func(nd ast.Node) bool {
+		switch x := nd.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.SelectorExpr:
+			if isCritDerived(pass.TypesInfo.TypeOf(x.X)) && !isSectionMember(pass, x) && selectedField(pass, x) != nil {
+				fields = append(fields, x)
+				return false
+			}
+		}
+		return true
+	})
+	return fields
+}
+
+// findSecondCheck looks in the body of the first if statement of a double
+// check for the second if statement. the second if statement must be in the
+// function passed to a lease method, or after a call to Acquire(), and must
+// read the field in its condition and assign to it in its body. the lease
+// call is returned if the second if statement is in a function literal passed
+// to a lease method
+func findSecondCheck(pass *analysis.Pass, body *ast.BlockStmt, field string) (leaseCall, *ast.IfStmt, bool) {
+	var lc leaseCall
+	var inner *ast.IfStmt
+	var acquired bool
+
+	var find func(nd ast.Node, leased bool, call leaseCall) bool
+	find = func(nd ast.Node, leased bool, call leaseCall) bool {
+		ast.Inspect(nd, func(nd ast.Node) bool {
+			if inner != nil {
+				return false
+			}
+			switch x := nd.(type) {
+			case *ast.FuncLit:
+				return false
+			case *ast.CallExpr:
+				if _, ok := isAcquireCall(pass.TypesInfo, x); ok {
+					acquired = true
+				}
+				if c, ok := isLeaseCall(pass, x); ok && c.lit != nil {
+					for _, arg := range x.Args {
+						find(arg, false, leaseCall{})
+					}
+					find(c.lit.Body, true, c)
+					return false
+				}
+			case *ast.IfStmt:
+				if (leased || acquired) && checksAndAssigns(pass, x, field) {
+					inner = x
+					lc = call
+					return false
+				}
+			}
+			return true
+		})
+		return inner != nil
+	}
+
+	if !find(body, false, leaseCall{}) {
+		return leaseCall{}, nil, false
+	}
+	return lc, inner, true
+}
+
+// checksAndAssigns returns true if the if statement reads the field in its
+// condition and assigns to it in its body
+func checksAndAssigns(pass *analysis.Pass, ifs *ast.IfStmt, field string) bool {
+	var checks bool
+	for _, sel := range conditionFields(pass, ifs.Cond) {
+		checks = checks || types.ExprString(sel) == field
+	}
+	if !checks {
+		return false
+	}
+
+	var assigns bool
+	ast.Inspect(ifs.Body, func(nd ast.Node) bool {
+		if as, ok := nd.(*ast.AssignStmt); ok {
+			for _, lhs := range as.Lhs {
+				assigns = assigns || types.ExprString(ast.Unparen(lhs)) == field
+			}
+		}
+		return !assigns
+	})
+	return assigns
+}
+
+// initOnceFix suggests replacing a double check with a call to InitOnce(). the
+// fix is only suggested when the first if statement contains nothing but the
+// call to Lease(), and the function passed to Lease() contains nothing but the
+// second if statement and a return of nil. the body of the second if statement
+// becomes the function passed to InitOnce()
+func initOnceFix(pass *analysis.Pass, outer *ast.IfStmt, lc leaseCall, inner *ast.IfStmt) (analysis.SuggestedFix, bool) {
+	if lc.lit == nil || lc.recv == nil || lc.call.Fun.(*ast.SelectorExpr).Sel.Name != leaseFunction {
+		return analysis.SuggestedFix{}, false
+	}
+	if outer.Init != nil || outer.Else != nil || inner.Init != nil || inner.Else != nil {
+		return analysis.SuggestedFix{}, false
+	}
+	if len(outer.Body.List) != 1 || len(lc.lit.Body.List) != 2 || lc.lit.Body.List[0] != inner {
+		return analysis.SuggestedFix{}, false
+	}
+	switch s := outer.Body.List[0].(type) {
+	case *ast.ExprStmt:
+		if s.X != lc.call {
+			return analysis.SuggestedFix{}, false
+		}
+	case *ast.AssignStmt:
+		if len(s.Lhs) != 1 || len(s.Rhs) != 1 || s.Rhs[0] != lc.call {
+			return analysis.SuggestedFix{}, false
+		}
+		if id, ok := s.Lhs[0].(*ast.Ident); !ok || id.Name != "_" {
+			return analysis.SuggestedFix{}, false
+		}
+	default:
+		return analysis.SuggestedFix{}, false
+	}
+	ret, ok := lc.lit.Body.List[1].(*ast.ReturnStmt)
+	if !ok || len(ret.Results) != 1 || !pass.TypesInfo.Types[ret.Results[0]].IsNil() {
+		return analysis.SuggestedFix{}, false
+	}
+
+	// InitOnce() is a method of the crit section types and is promoted to the
+	// derived types. crit.Instrumented does not have it
+	t := pass.TypesInfo.TypeOf(lc.recv)
+	if !isCritDerived(t) && !isCritSectionType(t) && !isSectionPointer(t) {
+		return analysis.SuggestedFix{}, false
+	}
+
+	indent := strings.Repeat("\t", pass.Fset.Position(outer.Pos()).Column-1)
+	var body strings.Builder
+	for _, s := range inner.Body.List {
+		var b bytes.Buffer
+		if printer.Fprint(&b, pass.Fset, s) != nil {
+			return analysis.SuggestedFix{}, false
+		}
+		fmt.Fprintf(&body, "%s\t%s\n", indent, strings.ReplaceAll(b.String(), "\n", "\n"+indent+"\t"))
+	}
+	var x bytes.Buffer
+	if printer.Fprint(&x, pass.Fset, lc.recv) != nil {
+		return analysis.SuggestedFix{}, false
+	}
+
+	return analysis.SuggestedFix{
+		Message: "initialise with InitOnce",
+		TextEdits: []analysis.TextEdit{{
+			Pos: outer.Pos(),
+			End: outer.End(),
+			NewText: []byte(fmt.Sprintf("_ = %s.%s(func() error {\n%s%s\treturn nil\n%s})",
+				x.String(), initOnceFunction, body.String(), indent, indent)),
+		}},
+	}, true
+}
@@ -0,0 +1,59 @@
+package driver
+
+import (
+	"fmt"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// BrokenPackage is a package that matched the patterns but could not be
+// analysed because it, or a package it imports, has errors
+type BrokenPackage struct {
+	Path   string
+	Errors []string
+}
+
+// brokenPackages returns the errors that prevent each of the packages from
+// being analysed. packages that can be analysed are not in the map
+//
+// a package can't be analysed if it has errors or if any package it imports
+// has errors, because the analyzer builds the whole program from source
+func brokenPackages(pkgs []*packages.Package) map[*packages.Package][]string {
+	// the errors in each package. an imported package with errors is a
+	// single error in the package that imports it
+	errs := make(map[*packages.Package][]string)
+	seen := make(map[*packages.Package]bool)
+	var visit func(pkg *packages.Package) []string
+	visit = func(pkg *packages.Package) []string {
+		if seen[pkg] {
+			return errs[pkg]
+		}
+		seen[pkg] = true
+
+		var e []string
+		for _, err := range pkg.Errors {
+			e = append(e, err.Error())
+		}
+		for _, imp := range pkg.Imports {
+			if len(visit(imp)) > 0 {
+				e = append(e, fmt.Sprintf("imports %s, which has errors", imp.PkgPath))
+			}
+		}
+
+		// a package is ill-typed if a package it imports is ill-typed, even if
+		// there are no errors in the package itself
+		if pkg.IllTyped && len(e) == 0 {
+			e = append(e, "package has type errors")
+		}
+		errs[pkg] = e
+		return e
+	}
+
+	broken := make(map[*packages.Package][]string)
+	for _, pkg := range pkgs {
+		if e := visit(pkg); len(e) > 0 {
+			broken[pkg] = e
+		}
+	}
+	return broken
+}
@@ -0,0 +1,55 @@
+package driver
+
+import (
+	"fmt"
+	"go/token"
+
+	critsec "github.com/jetsetilly/critsec/analysis"
+)
+
+// Cluster is a group of unleased accesses with the same root cause. a single
+// missing lease can cause many reports and it is the root cause that needs to
+// be fixed
+type Cluster struct {
+	// the position and description of the root cause
+	Posn  token.Position
+	Cause string
+
+	// the highest severity of the accesses
+	Severity critsec.Severity
+
+	Accesses []Diagnostic
+}
+
+// Message returns the message for the cluster as a whole
+func (c Cluster) Message() string {
+	return fmt.Sprintf("root cause of %d unleased accesses: %s", len(c.Accesses), c.Cause)
+}
+
+// Clusters groups the diagnostics by their root cause. a diagnostic without a
+// root cause, or with a root cause that it doesn't share, is returned as a
+// cluster of one. the clusters are in the order of the first diagnostic in
+// each cluster
+func (r Report) Clusters() []Cluster {
+	var cs []Cluster
+	idx := make(map[Related]int)
+	for _, d := range r.Diagnostics {
+		if d.Cause == nil {
+			cs = append(cs, Cluster{Severity: d.Severity, Accesses: []Diagnostic{d}})
+			continue
+		}
+		if i, ok := idx[*d.Cause]; ok {
+			cs[i].Accesses = append(cs[i].Accesses, d)
+			cs[i].Severity = max(cs[i].Severity, d.Severity)
+			continue
+		}
+		idx[*d.Cause] = len(cs)
+		cs = append(cs, Cluster{
+			Posn:     d.Cause.Posn,
+			Cause:    d.Cause.Message,
+			Severity: d.Severity,
+			Accesses: []Diagnostic{d},
+		})
+	}
+	return cs
+}
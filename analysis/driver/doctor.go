@@ -0,0 +1,406 @@
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/version"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	critsec "github.com/jetsetilly/critsec/analysis"
+	"golang.org/x/tools/go/packages"
+)
+
+// CheckStatus is the outcome of a Check
+type CheckStatus int
+
+// the outcomes of a check. a warning is a problem that might cause the analysis
+// to be wrong or incomplete. a failure is a problem that stops the analysis
+const (
+	CheckOK CheckStatus = iota
+	CheckWarning
+	CheckFailed
+)
+
+func (s CheckStatus) String() string {
+	switch s {
+	case CheckOK:
+		return "ok"
+	case CheckWarning:
+		return "warning"
+	case CheckFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// Check is one of the checks of the environment made by Doctor()
+type Check struct {
+	// a short name for what was checked
+	Name   string
+	Status CheckStatus
+
+	// what was found
+	Detail string
+
+	// what to do about a warning or a failure. empty if the status is ok
+	Remedy string
+}
+
+// the environment of the go command that is of interest to Doctor()
+type goEnv struct {
+	GOVERSION  string
+	GOWORK     string
+	GOCACHE    string
+	GOMODCACHE string
+	GOFLAGS    string
+}
+
+// Doctor checks that the environment is one in which the packages specified by
+// the config can be analysed. every check is made even if an earlier check
+// fails, unless the later check can't be made without the earlier one
+//
+// most problems with the analysis turn out to be problems with the environment
+// rather than with the analysis. the checks are the ones that have been needed
+// most often to find out what is wrong
+func Doctor(ctx context.Context, cfg Config) []Check {
+	pcfg := packages.Config{
+		Context:    ctx,
+		Dir:        cfg.Dir,
+		Tests:      cfg.Tests,
+		BuildFlags: cfg.BuildFlags,
+		Overlay:    cfg.Overlay,
+	}
+	if cfg.GOOS != "" || cfg.GOARCH != "" {
+		pcfg.Env = platformEnv(cfg.GOOS, cfg.GOARCH)
+	}
+
+	var checks []Check
+
+	env, c := checkGo(pcfg)
+	checks = append(checks, c)
+	if c.Status == CheckFailed {
+		return checks
+	}
+	checks = append(checks, checkCache(env)...)
+
+	c = checkModule(pcfg, env)
+	checks = append(checks, c)
+	if c.Status == CheckFailed {
+		return checks
+	}
+
+	patterns := cfg.Patterns
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+	pcfg.Mode = packages.LoadAllSyntax | packages.NeedModule
+	pkgs, err := packages.Load(&pcfg, patterns...)
+	if err != nil {
+		return append(checks, Check{
+			Name:   "packages",
+			Status: CheckFailed,
+			Detail: strings.TrimSpace(err.Error()),
+			Remedy: "check that the package patterns are correct and that `go list` accepts them",
+		})
+	}
+	pkgs = testVariants(pkgs)
+
+	checks = append(checks, checkPackages(pkgs))
+	checks = append(checks, checkCrit(pkgs))
+	checks = append(checks, checkBuildTags(pkgs, env, cfg.BuildFlags))
+
+	return checks
+}
+
+// checkGo checks that the go command can be run and that its version is not
+// newer than the version critcheck was built with. the environment of the go
+// command is returned
+func checkGo(cfg packages.Config) (goEnv, Check) {
+	c := Check{Name: "go"}
+
+	cmd := exec.Command("go", "env", "-json", "GOVERSION", "GOWORK", "GOCACHE", "GOMODCACHE", "GOFLAGS")
+	cmd.Dir = cfg.Dir
+	cmd.Env = cfg.Env
+	out, err := cmd.Output()
+	if err != nil {
+		c.Status = CheckFailed
+		c.Detail = fmt.Sprintf("the go command could not be run: %s", commandError(err))
+		c.Remedy = "install Go and make sure that the go command is in the PATH"
+		return goEnv{}, c
+	}
+
+	var env goEnv
+	if err := json.Unmarshal(out, &env); err != nil {
+		c.Status = CheckFailed
+		c.Detail = fmt.Sprintf("the output of go env could not be read: %s", err)
+		c.Remedy = "check that `go env -json` works in this directory"
+		return goEnv{}, c
+	}
+
+	built := runtime.Version()
+	c.Detail = fmt.Sprintf("%s, critcheck built with %s", env.GOVERSION, built)
+	if version.IsValid(env.GOVERSION) && version.IsValid(built) && version.Compare(env.GOVERSION, built) > 0 {
+		c.Status = CheckWarning
+		c.Remedy = fmt.Sprintf("critcheck may not understand packages built with %s. rebuild critcheck with the same version of Go:\n"+
+			"go install github.com/jetsetilly/critsec/analysis/cmd/critcheck@latest", version.Lang(env.GOVERSION))
+	}
+	return env, c
+}
+
+// checkCache checks that the build cache and the module cache can be used
+func checkCache(env goEnv) []Check {
+	build := Check{Name: "build cache", Detail: env.GOCACHE}
+	switch {
+	case env.GOCACHE == "" || env.GOCACHE == "off":
+		build.Status = CheckFailed
+		build.Detail = "the build cache is turned off"
+		build.Remedy = "the go command needs the build cache to load packages. unset GOCACHE or set it to a writable directory"
+	default:
+		if err := writable(env.GOCACHE); err != nil {
+			build.Status = CheckFailed
+			build.Detail = fmt.Sprintf("%s: %s", env.GOCACHE, err)
+			build.Remedy = "set GOCACHE to a writable directory. if the cache is damaged, remove it with `go clean -cache`"
+		}
+	}
+
+	mod := Check{Name: "module cache", Detail: env.GOMODCACHE}
+	if _, err := os.Stat(env.GOMODCACHE); err == nil {
+		if err := writable(env.GOMODCACHE); err != nil {
+			mod.Status = CheckWarning
+			mod.Detail = fmt.Sprintf("%s: %s", env.GOMODCACHE, err)
+			mod.Remedy = "modules that have not been downloaded can't be loaded. run `go mod download` as a user that can write to GOMODCACHE"
+		}
+	} else if !os.IsNotExist(err) {
+		mod.Status = CheckWarning
+		mod.Detail = err.Error()
+		mod.Remedy = "set GOMODCACHE to a directory that can be read"
+	}
+
+	return []Check{build, mod}
+}
+
+// writable returns an error if a file can't be created in the directory
+func writable(dir string) error {
+	f, err := os.CreateTemp(dir, "critcheck-doctor-")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// checkModule checks that the directory is in a module, or in a workspace that
+// includes the module, and that the go version required by the module is not
+// newer than the version critcheck was built with
+func checkModule(cfg packages.Config, env goEnv) Check {
+	c := Check{Name: "module"}
+
+	cmd := exec.Command("go", "list", "-m", "-f", "{{.Path}} {{.GoVersion}}")
+	cmd.Dir = cfg.Dir
+	cmd.Env = cfg.Env
+	out, err := cmd.Output()
+
+	// outside of a module the go command lists a pseudo-module for the
+	// command line arguments
+	if err == nil && strings.HasPrefix(string(out), "command-line-arguments") {
+		err = fmt.Errorf("not in a module")
+	}
+	if err != nil {
+		c.Status = CheckFailed
+		c.Detail = commandError(err)
+		switch env.GOWORK {
+		case "", "off":
+			c.Remedy = "run critcheck in the directory of a module, or create one with `go mod init`"
+		default:
+			c.Remedy = fmt.Sprintf("the workspace %s is in use. add the module to it with `go work use`, or set GOWORK=off", env.GOWORK)
+		}
+		return c
+	}
+
+	var mods []string
+	built := runtime.Version()
+	for _, l := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		path, goversion, _ := strings.Cut(l, " ")
+		mods = append(mods, path)
+		if goversion == "" || !version.IsValid(built) {
+			continue
+		}
+		goversion = "go" + goversion
+		if version.IsValid(goversion) && version.Compare(goversion, built) > 0 {
+			c.Status = CheckFailed
+			c.Remedy = fmt.Sprintf("%s requires %s but critcheck was built with %s. rebuild critcheck with a newer version of Go:\n"+
+				"go install github.com/jetsetilly/critsec/analysis/cmd/critcheck@latest", path, goversion, built)
+		}
+	}
+
+	switch env.GOWORK {
+	case "", "off":
+		c.Detail = strings.Join(mods, ", ")
+	default:
+		c.Detail = fmt.Sprintf("%s, in the workspace %s", strings.Join(mods, ", "), env.GOWORK)
+	}
+	return c
+}
+
+// checkPackages checks that the packages loaded without errors
+func checkPackages(pkgs []*packages.Package) Check {
+	c := Check{Name: "packages"}
+	if len(pkgs) == 0 {
+		c.Status = CheckFailed
+		c.Detail = "no packages match the patterns"
+		c.Remedy = "check the package patterns. run critcheck from the module root with ./... to analyse every package"
+		return c
+	}
+
+	broken := brokenPackages(pkgs)
+	if len(broken) == 0 {
+		c.Detail = fmt.Sprintf("%d packages loaded", len(pkgs))
+		if len(pkgs) == 1 {
+			c.Detail = "1 package loaded"
+		}
+		return c
+	}
+
+	// the first error of the first broken package is enough to get started
+	var paths []string
+	for _, pkg := range pkgs {
+		if _, ok := broken[pkg]; ok {
+			paths = append(paths, pkg.PkgPath)
+		}
+	}
+	sort.Strings(paths)
+	var first string
+	for pkg, e := range broken {
+		if pkg.PkgPath == paths[0] {
+			first = e[0]
+		}
+	}
+
+	c.Status = CheckFailed
+	if len(broken) < len(pkgs) {
+		c.Status = CheckWarning
+	}
+	c.Detail = fmt.Sprintf("%d of %d packages have errors and can't be analysed: %s\n%s: %s",
+		len(broken), len(pkgs), strings.Join(paths, ", "), paths[0], first)
+	c.Remedy = "fix the errors shown by `go build`. `go mod tidy` adds missing dependencies to go.mod"
+	return c
+}
+
+// checkCrit checks that the packages import the crit package, that its API
+// version is known to the analysis and that the version of the module is the
+// same as the version of the analysis
+func checkCrit(pkgs []*packages.Package) Check {
+	c := Check{Name: "crit package"}
+
+	var crit *packages.Package
+	packages.Visit(pkgs, func(pkg *packages.Package) bool {
+		if pkg.PkgPath == modulePath+"/crit" {
+			crit = pkg
+		}
+		return crit == nil
+	}, nil)
+
+	if crit == nil {
+		c.Status = CheckWarning
+		c.Detail = "the packages don't import the crit package so there is nothing to check"
+		c.Remedy = "check the package patterns. a fork of the crit package must be named with the -crit-module flag"
+		return c
+	}
+
+	// the API version is the more reliable test of compatibility, because
+	// it can be checked for a crit package that has been replaced
+	apiVersion := critsec.CritAPIVersionOf(crit.Types)
+	api := fmt.Sprintf("API version %d", apiVersion)
+	if apiVersion > critsec.CritAPIVersion {
+		c.Status = CheckWarning
+		c.Detail = fmt.Sprintf("%s, critcheck knows API version %d", api, critsec.CritAPIVersion)
+		c.Remedy = "lease methods added to the crit package are not recognised. install a newer version of critcheck:\n" +
+			"go install github.com/jetsetilly/critsec/analysis/cmd/critcheck@latest"
+		return c
+	}
+
+	if crit.Module == nil {
+		c.Detail = api + ", no module information for the crit package"
+		return c
+	}
+
+	mod := crit.Module
+	if mod.Replace != nil {
+		if mod.Replace.Version == "" {
+			c.Detail = fmt.Sprintf("%s, replaced by %s", api, filepath.Clean(mod.Replace.Path))
+			return c
+		}
+		mod = mod.Replace
+	}
+
+	v := mod.Version
+	if v == "" {
+		v = "(devel)"
+	}
+	current, _, _ := strings.Cut(Version(), " ")
+	c.Detail = fmt.Sprintf("%s %s, critcheck %s", v, api, current)
+	if v != current && v != "(devel)" && current != "(devel)" {
+		c.Status = CheckWarning
+		c.Remedy = fmt.Sprintf("lease methods that are not in both versions are not recognised. install the same version of critcheck:\n"+
+			"go install github.com/jetsetilly/critsec/analysis/cmd/critcheck@%s", v)
+	}
+	return c
+}
+
+// checkBuildTags reports the build tags in use and the files that are left out
+// of the analysis by build constraints
+func checkBuildTags(pkgs []*packages.Package, env goEnv, buildFlags []string) Check {
+	c := Check{Name: "build tags"}
+
+	var tags []string
+	for _, f := range append(strings.Fields(env.GOFLAGS), buildFlags...) {
+		if t, ok := strings.CutPrefix(f, "-tags="); ok {
+			tags = append(tags, t)
+		}
+	}
+
+	var ignored []string
+	for _, pkg := range pkgs {
+		for _, f := range pkg.IgnoredFiles {
+			ignored = append(ignored, filepath.Base(filepath.Dir(f))+"/"+filepath.Base(f))
+		}
+	}
+
+	c.Detail = "no build tags"
+	if len(tags) > 0 {
+		c.Detail = "build tags " + strings.Join(tags, ",")
+	}
+	if len(ignored) == 0 {
+		return c
+	}
+
+	const maxListed = 5
+	listed := ignored
+	if len(listed) > maxListed {
+		listed = append(listed[:maxListed:maxListed], "...")
+	}
+	c.Status = CheckWarning
+	files := fmt.Sprintf("%d files are", len(ignored))
+	if len(ignored) == 1 {
+		files = "1 file is"
+	}
+	c.Detail = fmt.Sprintf("%s. %s left out by build constraints: %s", c.Detail, files, strings.Join(listed, ", "))
+	c.Remedy = "accesses in files that are left out are not checked. analyse them with the -goos and -goarch flags, " +
+		"or with the build tags set in GOFLAGS, for example GOFLAGS=-tags=integration"
+	return c
+}
+
+// commandError returns the error from a command, including what the command
+// wrote to stderr
+func commandError(err error) string {
+	if ee, ok := err.(*exec.ExitError); ok && len(ee.Stderr) > 0 {
+		return strings.TrimSpace(string(ee.Stderr))
+	}
+	return err.Error()
+}
@@ -0,0 +1,559 @@
+// Package driver runs the CritSection analyzer in the same way as the
+// critcheck command. it is for programs that want the reports from critcheck
+// without running the critcheck binary:
+//
+//	rep, err := driver.Run(ctx, driver.Config{
+//		Patterns: []string{"./..."},
+//		Flags:    []string{"-section=pool.conn"},
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	rep.WriteText(os.Stderr)
+//	if rep.Fails(critsec.SeverityError) {
+//		...
+//	}
+//
+// the analyzer flags are package level variables so only one call to Run() can
+// be in progress at a time. concurrent calls wait for the earlier call to
+// finish
+package driver
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"go/token"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+
+	critsec "github.com/jetsetilly/critsec/analysis"
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/packages"
+)
+
+// Config specifies the packages to analyse and how the report should be
+// written
+type Config struct {
+	// the packages to analyse. the current package is analysed if there are
+	// no patterns
+	Patterns []string
+
+	// the directory in which to load the packages. the current directory is
+	// used if it is empty
+	Dir string
+
+	// flags for the analyzer in the same form as the critcheck command line.
+	// for example, []string{"-section=pool.conn", "-initonce"}. flags that
+	// are not given have their default value
+	Flags []string
+
+	// analyse test files. test functions are treated as roots of the
+	// callgraph
+	Tests bool
+
+	// the target platform of the analysis. files are selected by their build
+	// constraints for the platform, which changes the sections and accesses
+	// that exist. the GOOS and GOARCH environment variables, or the host
+	// platform, are used if they are empty
+	GOOS   string
+	GOARCH string
+
+	// build flags and file overlays passed to the build system when the
+	// packages are loaded. see packages.Config for details
+	BuildFlags []string
+	Overlay    map[string][]byte
+
+	// encode and decode every fact exported by the analysis, and check that
+	// the encoding is deterministic. this is the same as the -debug=s mode of
+	// the standard analysis drivers and shows that drivers that analyse each
+	// package separately, such as gopls, will give the same results
+	CheckFacts bool
+
+	// how the report is written
+	Output Output
+}
+
+// Output options for the Report
+type Output struct {
+	// group unleased accesses with the same root cause into one diagnostic
+	Group bool
+
+	// add a summary of the reports, coverage and timings for each package
+	Summary bool
+
+	// print the offending line after each diagnostic in the text output,
+	// with the number of lines of context either side of it
+	Source  bool
+	Context int
+
+	// add the fingerprint of each diagnostic to the text output
+	Fingerprints bool
+}
+
+// Report is the outcome of a call to Run()
+type Report struct {
+	Diagnostics []Diagnostic
+
+	// the result of the analyzer for each package
+	Packages []PackageResult
+
+	// the packages that could not be analysed because of errors in the
+	// package or in the packages it imports
+	Broken []BrokenPackage
+
+	// nil unless the summary was asked for in the Output options
+	Summary *Summary
+
+	output  Output
+	overlay map[string][]byte
+	fset    *token.FileSet
+}
+
+// running is held for the duration of Run()
+var running sync.Mutex
+
+// Run the analyzer on the packages specified by the config
+func Run(ctx context.Context, cfg Config) (Report, error) {
+	running.Lock()
+	defer running.Unlock()
+
+	if err := setFlags(cfg.Flags); err != nil {
+		return Report{}, err
+	}
+
+	fset := token.NewFileSet()
+	pcfg := packages.Config{
+		Context:    ctx,
+		Dir:        cfg.Dir,
+		Fset:       fset,
+		Tests:      cfg.Tests,
+		BuildFlags: cfg.BuildFlags,
+		Overlay:    cfg.Overlay,
+	}
+	if cfg.GOOS != "" || cfg.GOARCH != "" {
+		pcfg.Env = platformEnv(cfg.GOOS, cfg.GOARCH)
+	}
+
+	patterns := cfg.Patterns
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+
+	// the analyzer loads the whole program itself and must see the same
+	// overlay and build flags as the packages being analysed
+	critsec.LoadConfig = pcfg
+	critsec.ProgramPatterns = patterns
+
+	pkgs, err := load(pcfg, patterns)
+	if err != nil {
+		return Report{}, err
+	}
+
+	// packages with errors are left out of the analysis so that one broken
+	// package doesn't prevent the others from being analysed. the run only
+	// fails if none of the packages can be analysed
+	broken := brokenPackages(pkgs)
+	var healthy []*packages.Package
+	var skipped []BrokenPackage
+	var errs []string
+	for _, pkg := range pkgs {
+		if e, ok := broken[pkg]; ok {
+			skipped = append(skipped, BrokenPackage{Path: pkg.PkgPath, Errors: e})
+			errs = append(errs, e...)
+			continue
+		}
+		healthy = append(healthy, pkg)
+	}
+	if len(healthy) == 0 && len(errs) > 0 {
+		return Report{}, fmt.Errorf("%s", strings.Join(errs, "\n"))
+	}
+
+	diags, results, err := analyze(ctx, fset, healthy, critsec.CritSection, newFacts(cfg.CheckFacts))
+	if err != nil {
+		return Report{}, err
+	}
+	sortDiagnostics(diags)
+
+	rep := Report{
+		Diagnostics: diags,
+		Packages:    results,
+		Broken:      skipped,
+		output:      cfg.Output,
+		overlay:     cfg.Overlay,
+		fset:        fset,
+	}
+	if cfg.Output.Summary {
+		rep.Summary = summarise(diags, results, skipped)
+		rep.Summary.Platform = platform(pcfg)
+	}
+	return rep, nil
+}
+
+// sortDiagnostics sorts the diagnostics by file, line, column, rule ID and
+// message. the analyzer sorts the diagnostics for each package but the
+// packages are analysed in dependency order
+func sortDiagnostics(diags []Diagnostic) {
+	sort.SliceStable(diags, func(i, j int) bool {
+		a, b := diags[i], diags[j]
+		if a.Posn.Filename != b.Posn.Filename {
+			return a.Posn.Filename < b.Posn.Filename
+		}
+		if a.Posn.Line != b.Posn.Line {
+			return a.Posn.Line < b.Posn.Line
+		}
+		if a.Posn.Column != b.Posn.Column {
+			return a.Posn.Column < b.Posn.Column
+		}
+		if a.Category != b.Category {
+			return a.Category < b.Category
+		}
+		return a.Message < b.Message
+	})
+}
+
+// platformEnv returns the environment with the target platform replaced by
+// the GOOS and GOARCH values that are not empty. the build system uses the
+// last value of a variable in the environment
+func platformEnv(goos string, goarch string) []string {
+	env := os.Environ()
+	if goos != "" {
+		env = append(env, fmt.Sprintf("GOOS=%s", goos))
+	}
+	if goarch != "" {
+		env = append(env, fmt.Sprintf("GOARCH=%s", goarch))
+	}
+	return env
+}
+
+// platform returns the target platform of the build system for the
+// configuration, in the form GOOS/GOARCH. the go command is asked because the
+// platform can also be set by the go env file. returns the empty string if the
+// go command fails
+func platform(cfg packages.Config) string {
+	cmd := exec.Command("go", "env", "GOOS", "GOARCH")
+	cmd.Dir = cfg.Dir
+	cmd.Env = cfg.Env
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	f := strings.Fields(string(out))
+	if len(f) != 2 {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s", f[0], f[1])
+}
+
+// setFlags returns the analyzer flags to their default values and then sets the
+// flags in the list. errors are returned rather than printed
+func setFlags(args []string) error {
+	fs := &critsec.CritSection.Flags
+	fs.SetOutput(io.Discard)
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if e := f.Value.Set(f.DefValue); e != nil && err == nil {
+			err = e
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument in analyzer flags: %s", fs.Arg(0))
+	}
+	return nil
+}
+
+// Fails returns true if any diagnostic has the severity or higher
+func (r Report) Fails(severity critsec.Severity) bool {
+	for _, d := range r.Diagnostics {
+		if d.Severity >= severity {
+			return true
+		}
+	}
+	return false
+}
+
+// Coverage returns the percentage of accesses in all packages that are leased.
+// a run with no accesses is fully covered
+func (r Report) Coverage() float64 {
+	var accesses, leased int
+	for _, p := range r.Packages {
+		accesses += p.Result.Accesses
+		leased += p.Result.Leased
+	}
+	if accesses == 0 {
+		return 100
+	}
+	return float64(leased) * 100 / float64(accesses)
+}
+
+// readFile returns the content of the file. the content is taken from the
+// overlay if possible
+func (r Report) readFile(filename string) ([]byte, error) {
+	if content, ok := r.overlay[filename]; ok {
+		return content, nil
+	}
+	return os.ReadFile(filename)
+}
+
+// Diagnostic is an analysis.Diagnostic with the position resolved
+type Diagnostic struct {
+	analysis.Diagnostic
+	Posn    token.Position
+	End     token.Position
+	Fixes   []Fix
+	Related []Related
+
+	// additional information about the diagnostic taken from the result of
+	// the CritSection analyzer
+	Severity    critsec.Severity
+	Fingerprint string
+	Cause       *Related
+
+	// the path of the package the diagnostic was reported for
+	Package string
+}
+
+// Fix is an analysis.SuggestedFix with the positions resolved
+type Fix struct {
+	Message string
+	Edits   []Edit
+}
+
+// Edit is an analysis.TextEdit with the positions resolved
+type Edit struct {
+	Start   token.Position
+	End     token.Position
+	NewText string
+}
+
+// Related is an analysis.RelatedInformation with the position resolved
+type Related struct {
+	Posn    token.Position
+	Message string
+}
+
+// resolveRelated resolves the positions in the related information
+func resolveRelated(fset *token.FileSet, rel []analysis.RelatedInformation) []Related {
+	var resolved []Related
+	for _, r := range rel {
+		resolved = append(resolved, Related{
+			Posn:    fset.Position(r.Pos),
+			Message: r.Message,
+		})
+	}
+	return resolved
+}
+
+// resolveFixes resolves the positions in the suggested fixes
+func resolveFixes(fset *token.FileSet, fixes []analysis.SuggestedFix) []Fix {
+	var resolved []Fix
+	for _, f := range fixes {
+		r := Fix{Message: f.Message}
+		for _, e := range f.TextEdits {
+			end := e.End
+			if !end.IsValid() {
+				end = e.Pos
+			}
+			r.Edits = append(r.Edits, Edit{
+				Start:   fset.Position(e.Pos),
+				End:     fset.Position(end),
+				NewText: string(e.NewText),
+			})
+		}
+		resolved = append(resolved, r)
+	}
+	return resolved
+}
+
+// load the packages matching the patterns. the packages will be loaded with
+// enough information for the analyzer to be run on them. the packages they
+// import are loaded from source so that the facts for them can be found
+//
+// errors in the packages are not returned. packages with errors are found
+// with brokenPackages()
+func load(cfg packages.Config, patterns []string) ([]*packages.Package, error) {
+	cfg.Mode = packages.LoadAllSyntax
+	pkgs, err := packages.Load(&cfg, patterns...)
+	if err != nil {
+		return nil, err
+	}
+
+	return testVariants(pkgs), nil
+}
+
+// testVariants removes packages that would be analysed twice when the packages
+// are loaded with their tests. a package with tests is loaded both with and
+// without its test files, and only the variant with the test files is kept.
+// the generated test main packages are also removed
+func testVariants(pkgs []*packages.Package) []*packages.Package {
+	variants := make(map[string]bool)
+	for _, pkg := range pkgs {
+		if id, _, ok := strings.Cut(pkg.ID, " ["); ok {
+			variants[id] = true
+		}
+	}
+
+	var keep []*packages.Package
+	for _, pkg := range pkgs {
+		if variants[pkg.ID] || strings.HasSuffix(pkg.ID, ".test") {
+			continue
+		}
+		keep = append(keep, pkg)
+	}
+	return keep
+}
+
+// analyze runs the analyzer on each package and returns the diagnostics
+// reported by it, and the result of the CritSection analyzer for each package.
+// analyzers required by the analyzer are run first but their diagnostics are
+// not returned. the context is checked before each package is analysed
+//
+// analyzers that export facts are also run on every package imported by the
+// packages, so that the facts are available when the packages are analysed.
+// the imported packages are analysed before the packages that import them
+func analyze(ctx context.Context, fset *token.FileSet, pkgs []*packages.Package, a *analysis.Analyzer, fcts *facts) ([]Diagnostic, []PackageResult, error) {
+	var diags []Diagnostic
+	var pkgResults []PackageResult
+
+	// the analyzers that export facts
+	var factAnalyzers []*analysis.Analyzer
+	seen := make(map[*analysis.Analyzer]bool)
+	var required func(a *analysis.Analyzer)
+	required = func(a *analysis.Analyzer) {
+		if seen[a] {
+			return
+		}
+		seen[a] = true
+		for _, req := range a.Requires {
+			required(req)
+		}
+		if len(a.FactTypes) > 0 {
+			factAnalyzers = append(factAnalyzers, a)
+		}
+	}
+	required(a)
+
+	// every package in dependency order
+	roots := make(map[*packages.Package]bool)
+	for _, pkg := range pkgs {
+		roots[pkg] = true
+	}
+	var order []*packages.Package
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		order = append(order, pkg)
+	})
+
+	for _, pkg := range order {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+
+		results := make(map[*analysis.Analyzer]any)
+
+		// run analyzer, and all analyzers it requires, on the package. the
+		// report function is nil for analyzers other than the root analyzer
+		var run func(a *analysis.Analyzer, report func(analysis.Diagnostic)) (any, error)
+		run = func(a *analysis.Analyzer, report func(analysis.Diagnostic)) (any, error) {
+			if r, ok := results[a]; ok {
+				return r, nil
+			}
+
+			resultOf := make(map[*analysis.Analyzer]any)
+			for _, req := range a.Requires {
+				r, err := run(req, nil)
+				if err != nil {
+					return nil, err
+				}
+				resultOf[req] = r
+			}
+
+			if report == nil {
+				report = func(analysis.Diagnostic) {}
+			}
+
+			pass := &analysis.Pass{
+				Analyzer:     a,
+				Fset:         fset,
+				Files:        pkg.Syntax,
+				OtherFiles:   pkg.OtherFiles,
+				IgnoredFiles: pkg.IgnoredFiles,
+				Pkg:          pkg.Types,
+				TypesInfo:    pkg.TypesInfo,
+				TypesSizes:   pkg.TypesSizes,
+				ResultOf:     resultOf,
+				Report:       report,
+			}
+			fcts.bind(pass, pkg)
+
+			r, err := a.Run(pass)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", a.Name, pkg.PkgPath, err)
+			}
+			if fcts.err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", a.Name, pkg.PkgPath, fcts.err)
+			}
+			results[a] = r
+
+			return r, nil
+		}
+
+		// imported packages only need their facts
+		if !roots[pkg] {
+			for _, fa := range factAnalyzers {
+				if _, err := run(fa, nil); err != nil {
+					return nil, nil, err
+				}
+			}
+			continue
+		}
+
+		// index of the first diagnostic for this package
+		first := len(diags)
+
+		r, err := run(a, func(d analysis.Diagnostic) {
+			diags = append(diags, Diagnostic{
+				Diagnostic: d,
+				Posn:       fset.Position(d.Pos),
+				End:        fset.Position(d.End),
+				Fixes:      resolveFixes(fset, d.SuggestedFixes),
+				Related:    resolveRelated(fset, d.Related),
+				Package:    pkg.PkgPath,
+			})
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// diagnostics from analyzers other than CritSection are always
+		// treated as errors
+		res, _ := r.(*critsec.Result)
+		if res != nil {
+			pkgResults = append(pkgResults, PackageResult{Path: pkg.PkgPath, Result: res})
+		}
+		for i := first; i < len(diags); i++ {
+			diags[i].Severity = critsec.SeverityError
+			if res == nil {
+				continue
+			}
+			if f, ok := res.Finding(diags[i].Pos, diags[i].Category); ok {
+				diags[i].Severity = f.Severity
+				diags[i].Fingerprint = f.Fingerprint
+				if f.Cause != nil {
+					diags[i].Cause = &Related{Posn: fset.Position(f.Cause.Pos), Message: f.Cause.Message}
+				}
+			}
+		}
+	}
+
+	return diags, pkgResults, nil
+}
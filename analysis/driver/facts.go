@@ -0,0 +1,144 @@
+package driver
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"go/types"
+	"reflect"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/packages"
+)
+
+// factKey identifies a fact. the object is nil for a package fact
+type factKey struct {
+	obj types.Object
+	pkg *types.Package
+	typ reflect.Type
+}
+
+// facts holds the facts exported by every package that has been analysed. the
+// packages are loaded together so they share the same type objects and the
+// facts can be used by the packages that import them without being encoded
+//
+// if roundTrip is true then every fact is gob encoded and decoded when it is
+// exported, in the same way as the -debug=s mode of the standard analysis
+// drivers. this shows that the facts will survive drivers that analyse each
+// package separately, such as gopls. the fact is encoded twice to show that the
+// encoding is deterministic
+type facts struct {
+	store     map[factKey]analysis.Fact
+	roundTrip bool
+
+	// the first error from encoding or decoding a fact
+	err error
+}
+
+func newFacts(roundTrip bool) *facts {
+	return &facts{
+		store:     make(map[factKey]analysis.Fact),
+		roundTrip: roundTrip,
+	}
+}
+
+// bind sets the fact functions of the pass. a pass can import the facts of the
+// package being analysed and of the packages it imports
+func (f *facts) bind(pass *analysis.Pass, pkg *packages.Package) {
+	visible := make(map[*types.Package]bool)
+	packages.Visit([]*packages.Package{pkg}, func(p *packages.Package) bool {
+		if visible[p.Types] {
+			return false
+		}
+		visible[p.Types] = true
+		return true
+	}, nil)
+
+	factTypes := make(map[reflect.Type]bool)
+	for _, t := range pass.Analyzer.FactTypes {
+		factTypes[reflect.TypeOf(t)] = true
+	}
+
+	pass.ImportObjectFact = func(obj types.Object, fact analysis.Fact) bool {
+		if obj == nil {
+			return false
+		}
+		return f.get(factKey{obj: obj, pkg: obj.Pkg(), typ: reflect.TypeOf(fact)}, fact)
+	}
+	pass.ExportObjectFact = func(obj types.Object, fact analysis.Fact) {
+		if obj.Pkg() != pass.Pkg {
+			panic(fmt.Sprintf("%s: fact exported for %s, which belongs to another package", pass.Analyzer.Name, obj))
+		}
+		f.set(factKey{obj: obj, pkg: obj.Pkg(), typ: reflect.TypeOf(fact)}, fact)
+	}
+	pass.ImportPackageFact = func(p *types.Package, fact analysis.Fact) bool {
+		return f.get(factKey{pkg: p, typ: reflect.TypeOf(fact)}, fact)
+	}
+	pass.ExportPackageFact = func(fact analysis.Fact) {
+		f.set(factKey{pkg: pass.Pkg, typ: reflect.TypeOf(fact)}, fact)
+	}
+	pass.AllObjectFacts = func() []analysis.ObjectFact {
+		var all []analysis.ObjectFact
+		for k, v := range f.store {
+			if k.obj != nil && visible[k.pkg] && factTypes[k.typ] {
+				all = append(all, analysis.ObjectFact{Object: k.obj, Fact: v})
+			}
+		}
+		return all
+	}
+	pass.AllPackageFacts = func() []analysis.PackageFact {
+		var all []analysis.PackageFact
+		for k, v := range f.store {
+			if k.obj == nil && visible[k.pkg] && factTypes[k.typ] {
+				all = append(all, analysis.PackageFact{Package: k.pkg, Fact: v})
+			}
+		}
+		return all
+	}
+}
+
+// get copies the fact with the key into the fact pointed to by ptr
+func (f *facts) get(key factKey, ptr analysis.Fact) bool {
+	v, ok := f.store[key]
+	if !ok {
+		return false
+	}
+	reflect.ValueOf(ptr).Elem().Set(reflect.ValueOf(v).Elem())
+	return true
+}
+
+// set the fact with the key, encoding and decoding it first if required
+func (f *facts) set(key factKey, fact analysis.Fact) {
+	if f.roundTrip {
+		var err error
+		fact, err = roundTrip(fact)
+		if err != nil {
+			if f.err == nil {
+				f.err = err
+			}
+			return
+		}
+	}
+	f.store[key] = fact
+}
+
+// roundTrip encodes and decodes the fact. an error is returned if the fact
+// can't be encoded or if encoding it twice gives different results
+func roundTrip(fact analysis.Fact) (analysis.Fact, error) {
+	var a, b bytes.Buffer
+	if err := gob.NewEncoder(&a).Encode(fact); err != nil {
+		return nil, fmt.Errorf("encoding %T fact: %w", fact, err)
+	}
+	if err := gob.NewEncoder(&b).Encode(fact); err != nil {
+		return nil, fmt.Errorf("encoding %T fact: %w", fact, err)
+	}
+	if !bytes.Equal(a.Bytes(), b.Bytes()) {
+		return nil, fmt.Errorf("encoding of %T fact is not deterministic", fact)
+	}
+
+	decoded := reflect.New(reflect.TypeOf(fact).Elem()).Interface().(analysis.Fact)
+	if err := gob.NewDecoder(&a).Decode(decoded); err != nil {
+		return nil, fmt.Errorf("decoding %T fact: %w", fact, err)
+	}
+	return decoded, nil
+}
@@ -0,0 +1,131 @@
+package driver
+
+import (
+	"encoding/json"
+	"go/token"
+	"io"
+)
+
+// Model is the model of the sections, leases and accesses in every package,
+// with the positions resolved. it is written with WriteModel()
+type Model struct {
+	Version  string         `json:"version"`
+	Packages []PackageModel `json:"packages"`
+}
+
+// PackageModel is the model for one package
+type PackageModel struct {
+	Package  string         `json:"package"`
+	Sections []SectionModel `json:"sections"`
+	Leases   []LeaseModel   `json:"leases"`
+	Accesses []AccessModel  `json:"accesses"`
+}
+
+// Location is a resolved position in the model
+type Location struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+// SectionModel is a crit.Section derived type and its fields
+type SectionModel struct {
+	Location
+	Name   string       `json:"name"`
+	Kind   string       `json:"kind"`
+	Multi  bool         `json:"multi,omitempty"`
+	Fields []FieldModel `json:"fields"`
+}
+
+// FieldModel is a field of a crit.Section derived type and what guards it
+type FieldModel struct {
+	Location
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Guard string `json:"guard"`
+}
+
+// LeaseModel is a call to a lease method
+type LeaseModel struct {
+	Location
+	Section  string `json:"section,omitempty"`
+	Method   string `json:"method"`
+	Function string `json:"function"`
+}
+
+// AccessModel is an access of a field of a crit.Section derived type and
+// whether it is leased
+type AccessModel struct {
+	Location
+	Section  string `json:"section"`
+	Field    string `json:"field"`
+	Function string `json:"function"`
+	Write    bool   `json:"write"`
+	Status   string `json:"status"`
+}
+
+// Model returns the model of the sections, leases and accesses in the packages
+// that were analysed
+func (r Report) Model() Model {
+	loc := func(pos token.Pos) Location {
+		p := r.fset.Position(pos)
+		return Location{File: p.Filename, Line: p.Line, Column: p.Column}
+	}
+
+	m := Model{Version: Version(), Packages: []PackageModel{}}
+	for _, p := range r.Packages {
+		pm := PackageModel{
+			Package:  p.Path,
+			Sections: []SectionModel{},
+			Leases:   []LeaseModel{},
+			Accesses: []AccessModel{},
+		}
+		for _, s := range p.Result.Model.Sections {
+			sm := SectionModel{
+				Location: loc(s.Pos),
+				Name:     s.Name,
+				Kind:     s.Kind,
+				Multi:    s.Multi,
+				Fields:   []FieldModel{},
+			}
+			for _, f := range s.Fields {
+				sm.Fields = append(sm.Fields, FieldModel{
+					Location: loc(f.Pos),
+					Name:     f.Name,
+					Type:     f.Type,
+					Guard:    f.Guard,
+				})
+			}
+			pm.Sections = append(pm.Sections, sm)
+		}
+		for _, l := range p.Result.Model.Leases {
+			pm.Leases = append(pm.Leases, LeaseModel{
+				Location: loc(l.Pos),
+				Section:  l.Section,
+				Method:   l.Method,
+				Function: l.Function,
+			})
+		}
+		for _, a := range p.Result.Model.Accesses {
+			pm.Accesses = append(pm.Accesses, AccessModel{
+				Location: loc(a.Pos),
+				Section:  a.Section,
+				Field:    a.Field,
+				Function: a.Function,
+				Write:    a.Write,
+				Status:   a.Status,
+			})
+		}
+		m.Packages = append(m.Packages, pm)
+	}
+	return m
+}
+
+// WriteModel writes the model of the sections, leases and accesses as JSON.
+// empty lists are written as empty arrays rather than null so that the output
+// is simpler to consume
+func (r Report) WriteModel(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(r.Model())
+}
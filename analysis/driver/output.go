@@ -0,0 +1,284 @@
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+
+	critsec "github.com/jetsetilly/critsec/analysis"
+)
+
+// WriteText writes the diagnostics in the same plain text form used by the
+// standard analysis drivers. the offending line is printed along with the
+// number of lines of context either side of it if Source is set in the Output
+// options. fingerprints are added to the end of the line if requested
+//
+// diagnostics with a severity lower than error have the severity added to the
+// start of the message. related information is printed on indented lines
+// after the diagnostic
+//
+// if Group is set then unleased accesses with the same root cause are printed
+// as one entry, with the accesses on indented lines after it. the summary is
+// printed after the diagnostics if it was asked for
+func (r Report) WriteText(w io.Writer) {
+	if !r.output.Group {
+		for _, d := range r.Diagnostics {
+			r.printDiagnostic(w, d)
+		}
+	} else {
+		for _, c := range r.Clusters() {
+			if len(c.Accesses) == 1 {
+				r.printDiagnostic(w, c.Accesses[0])
+				continue
+			}
+			msg := c.Message()
+			if c.Severity < critsec.SeverityError {
+				msg = fmt.Sprintf("%s: %s", c.Severity, msg)
+			}
+			fmt.Fprintf(w, "%s: %s\n", c.Posn, msg)
+			for _, d := range c.Accesses {
+				msg := d.Message
+				if r.output.Fingerprints && d.Fingerprint != "" {
+					msg = fmt.Sprintf("%s (%s)", msg, d.Fingerprint)
+				}
+				fmt.Fprintf(w, "\t%s: %s\n", d.Posn, msg)
+			}
+			r.printContext(w, c.Posn, c.Posn)
+		}
+	}
+
+	if r.Summary != nil {
+		r.Summary.print(w)
+	}
+}
+
+// printDiagnostic writes a single diagnostic for WriteText()
+func (r Report) printDiagnostic(w io.Writer, d Diagnostic) {
+	msg := d.Message
+	if d.Severity < critsec.SeverityError {
+		msg = fmt.Sprintf("%s: %s", d.Severity, msg)
+	}
+	if r.output.Fingerprints && d.Fingerprint != "" {
+		msg = fmt.Sprintf("%s (%s)", msg, d.Fingerprint)
+	}
+	fmt.Fprintf(w, "%s: %s\n", d.Posn, msg)
+	for _, rel := range d.Related {
+		fmt.Fprintf(w, "\t%s: %s\n", rel.Posn, rel.Message)
+	}
+
+	end := d.End
+	if !end.IsValid() {
+		end = d.Posn
+	}
+	r.printContext(w, d.Posn, end)
+}
+
+// printContext writes the lines between start and end with the number of lines
+// of context either side. nothing is written unless Source is set in the
+// Output options
+func (r Report) printContext(w io.Writer, start token.Position, end token.Position) {
+	if !r.output.Source {
+		return
+	}
+	context := max(r.output.Context, 0)
+	data, _ := r.readFile(start.Filename)
+	lines := strings.Split(string(data), "\n")
+	for i := start.Line - context; i <= end.Line+context; i++ {
+		if 1 <= i && i <= len(lines) {
+			fmt.Fprintf(w, "%d\t%s\n", i, lines[i-1])
+		}
+	}
+}
+
+// jsonDiagnostic is the form of a diagnostic when written with WriteJSON()
+type jsonDiagnostic struct {
+	File        string           `json:"file"`
+	Line        int              `json:"line"`
+	Column      int              `json:"column"`
+	EndLine     int              `json:"end_line,omitempty"`
+	EndColumn   int              `json:"end_column,omitempty"`
+	Rule        string           `json:"rule"`
+	Severity    critsec.Severity `json:"severity"`
+	Message     string           `json:"message"`
+	Fingerprint string           `json:"fingerprint,omitempty"`
+	Related     []jsonRelated    `json:"related,omitempty"`
+	CodeActions []jsonCodeAction `json:"code_actions,omitempty"`
+
+	// the unleased accesses with the same root cause. only used when the
+	// diagnostics are grouped, in which case the position and message of the
+	// diagnostic are of the root cause
+	Accesses []jsonDiagnostic `json:"accesses,omitempty"`
+
+	// the version of the analysis that made the report. reports from different
+	// runs can be merged by downstream tools without losing track of which
+	// version made them
+	Version string `json:"version"`
+}
+
+// jsonRelated is the form of related information in a jsonDiagnostic
+type jsonRelated struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+}
+
+// the following types describe a code action using the same JSON schema as the
+// language server protocol. this means that editor plugins can pass the code
+// actions to the editor without any conversion
+
+type jsonCodeAction struct {
+	Title string            `json:"title"`
+	Kind  string            `json:"kind"`
+	Edit  jsonWorkspaceEdit `json:"edit"`
+}
+
+type jsonWorkspaceEdit struct {
+	Changes map[string][]jsonTextEdit `json:"changes"`
+}
+
+type jsonTextEdit struct {
+	Range   jsonRange `json:"range"`
+	NewText string    `json:"newText"`
+}
+
+type jsonRange struct {
+	Start jsonPosition `json:"start"`
+	End   jsonPosition `json:"end"`
+}
+
+// line and character are both zero based. character is measured in UTF-16
+// code units
+type jsonPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// lspPosition converts a token.Position into a position as used by the
+// language server protocol. the content of the file is required in order to
+// count the UTF-16 code units in the line up to the position
+func lspPosition(content []byte, p token.Position) jsonPosition {
+	pos := jsonPosition{Line: p.Line - 1}
+	start := p.Offset - (p.Column - 1)
+	if start < 0 || p.Offset > len(content) {
+		pos.Character = p.Column - 1
+		return pos
+	}
+	pos.Character = len(utf16.Encode([]rune(string(content[start:p.Offset]))))
+	return pos
+}
+
+// codeActions converts the fixes for a diagnostic into code actions. the
+// readFile function is used to retrieve the content of the file being changed
+func codeActions(fixes []Fix, readFile func(string) ([]byte, error)) []jsonCodeAction {
+	var actions []jsonCodeAction
+	for _, f := range fixes {
+		action := jsonCodeAction{
+			Title: f.Message,
+			Kind:  "quickfix",
+			Edit: jsonWorkspaceEdit{
+				Changes: make(map[string][]jsonTextEdit),
+			},
+		}
+		for _, e := range f.Edits {
+			content, err := readFile(e.Start.Filename)
+			if err != nil {
+				continue
+			}
+			uri := (&url.URL{Scheme: "file", Path: filepath.ToSlash(e.Start.Filename)}).String()
+			action.Edit.Changes[uri] = append(action.Edit.Changes[uri], jsonTextEdit{
+				Range: jsonRange{
+					Start: lspPosition(content, e.Start),
+					End:   lspPosition(content, e.End),
+				},
+				NewText: e.NewText,
+			})
+		}
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+// toJSON converts the diagnostic to the form used by WriteJSON()
+func toJSON(d Diagnostic, readFile func(string) ([]byte, error)) jsonDiagnostic {
+	var rel []jsonRelated
+	for _, r := range d.Related {
+		rel = append(rel, jsonRelated{
+			File:    r.Posn.Filename,
+			Line:    r.Posn.Line,
+			Column:  r.Posn.Column,
+			Message: r.Message,
+		})
+	}
+	return jsonDiagnostic{
+		File:        d.Posn.Filename,
+		Line:        d.Posn.Line,
+		Column:      d.Posn.Column,
+		EndLine:     d.End.Line,
+		EndColumn:   d.End.Column,
+		Rule:        d.Category,
+		Severity:    d.Severity,
+		Message:     d.Message,
+		Fingerprint: d.Fingerprint,
+		Related:     rel,
+		CodeActions: codeActions(d.Fixes, readFile),
+		Version:     Version(),
+	}
+}
+
+// WriteJSON writes the diagnostics as a JSON array. an empty array is written
+// if there are no diagnostics. suggested fixes are written as code actions
+//
+// if Group is set in the Output options then unleased accesses with the same
+// root cause are written as one diagnostic, with the accesses in the accesses
+// field
+//
+// if the summary was asked for then the output is an object containing the
+// array of diagnostics and the summary
+func (r Report) WriteJSON(w io.Writer) error {
+	out := make([]jsonDiagnostic, 0, len(r.Diagnostics))
+	if r.output.Group {
+		for _, c := range r.Clusters() {
+			if len(c.Accesses) == 1 {
+				out = append(out, toJSON(c.Accesses[0], r.readFile))
+				continue
+			}
+			jd := jsonDiagnostic{
+				File:     c.Posn.Filename,
+				Line:     c.Posn.Line,
+				Column:   c.Posn.Column,
+				Rule:     c.Accesses[0].Category,
+				Severity: c.Severity,
+				Message:  c.Message(),
+				Version:  Version(),
+			}
+			for _, d := range c.Accesses {
+				jd.Accesses = append(jd.Accesses, toJSON(d, r.readFile))
+			}
+			out = append(out, jd)
+		}
+	} else {
+		for _, d := range r.Diagnostics {
+			out = append(out, toJSON(d, r.readFile))
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+
+	// the summary changes the output from a list of diagnostics to an object
+	if r.Summary != nil {
+		return enc.Encode(struct {
+			Version     string           `json:"version"`
+			Diagnostics []jsonDiagnostic `json:"diagnostics"`
+			Summary     *Summary         `json:"summary"`
+		}{Version(), out, r.Summary})
+	}
+
+	return enc.Encode(out)
+}
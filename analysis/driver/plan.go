@@ -0,0 +1,259 @@
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"io"
+	"sort"
+	"strings"
+
+	critsec "github.com/jetsetilly/critsec/analysis"
+)
+
+// StepKind is the kind of change made by a step of a Plan
+type StepKind string
+
+// the kinds of step in a plan. a requires step adds the requires directive to
+// a function and leases the calls to it. a review step is a report that has no
+// suggested fix and must be looked at by hand
+const (
+	StepRequires StepKind = "requires"
+	StepGetter   StepKind = "getter"
+	StepWrap     StepKind = "wrap"
+	StepFix      StepKind = "fix"
+	StepReview   StepKind = "review"
+)
+
+// the order of the kinds of step in the plan for a file. the requires
+// directives come first because they change which accesses are reported
+var stepOrder = map[StepKind]int{
+	StepRequires: 0,
+	StepGetter:   1,
+	StepWrap:     2,
+	StepFix:      3,
+	StepReview:   4,
+}
+
+// Plan is the list of changes that fix the reports, grouped by file. it is
+// made with Report.Plan()
+type Plan struct {
+	Version string     `json:"version"`
+	Files   []FilePlan `json:"files"`
+
+	// the totals for every file
+	Steps   int `json:"steps"`
+	Edits   int `json:"edits"`
+	Reports int `json:"reports"`
+}
+
+// FilePlan is the steps of a plan for one file
+type FilePlan struct {
+	File  string `json:"file"`
+	Steps []Step `json:"steps"`
+
+	// the totals for the steps
+	Edits   int `json:"edits"`
+	Reports int `json:"reports"`
+}
+
+// Step is one change in a plan
+type Step struct {
+	Location
+	Kind        StepKind `json:"kind"`
+	Description string   `json:"description"`
+
+	// the calls that must be leased once the requires directive is added. only
+	// used by a requires step
+	Calls []PlanCall `json:"calls,omitempty"`
+
+	// the estimated number of edits needed to make the change and the number
+	// of reports that are fixed by it
+	Edits   int `json:"edits"`
+	Reports int `json:"reports"`
+}
+
+// PlanCall is a call that must be leased
+type PlanCall struct {
+	Location
+	Message string `json:"message"`
+}
+
+// Plan puts the diagnostics together into a plan of the changes that will fix
+// them. the plan is made from the suggested fixes of the diagnostics:
+//
+//   - an unleased access in a function that is called without a lease is fixed
+//     by adding the requires directive to the function and leasing the calls.
+//     the calls are the root causes of the accesses
+//   - other unleased accesses are fixed by wrapping the statement in Lease().
+//     accesses in the same statement share the step
+//   - a getter is fixed with the suggested fix, if there is one
+//   - any other report with a suggested fix is fixed with the first fix
+//   - a report without a suggested fix must be reviewed
+//
+// the number of edits is an estimate. a requires step counts one edit for the
+// directive and one for each call, and a review step counts one edit
+func (r Report) Plan() Plan {
+	var steps []*Step
+	requires := make(map[token.Position]*Step)
+	calls := make(map[*Step]map[token.Position]bool)
+	wraps := make(map[[2]token.Position]*Step)
+
+	for _, d := range r.Diagnostics {
+		wrap, req := leaseFixesOf(d.Fixes)
+
+		// the root cause of an access in a function that is called without a
+		// lease is the outermost unleased call. otherwise the cause is the
+		// function itself, at the same position as the requires directive
+		if req != nil && d.Cause != nil && d.Cause.Posn != req.Edits[0].Start {
+			fn := req.Edits[0].Start
+			s, ok := requires[fn]
+			if !ok {
+				name := strings.TrimPrefix(req.Message, critsec.FixRequires+" to ")
+				s = &Step{
+					Location:    location(fn),
+					Kind:        StepRequires,
+					Description: fmt.Sprintf("%s to %s and lease the calls to it", critsec.FixRequires, name),
+					Edits:       1,
+				}
+				requires[fn] = s
+				calls[s] = make(map[token.Position]bool)
+				steps = append(steps, s)
+			}
+			s.Reports++
+			if !calls[s][d.Cause.Posn] {
+				calls[s][d.Cause.Posn] = true
+				s.Calls = append(s.Calls, PlanCall{Location: location(d.Cause.Posn), Message: d.Cause.Message})
+				s.Edits++
+			}
+			continue
+		}
+
+		if wrap != nil {
+			rng := [2]token.Position{wrap.Edits[0].Start, wrap.Edits[0].End}
+			s, ok := wraps[rng]
+			if !ok {
+				s = &Step{
+					Location:    location(rng[0]),
+					Kind:        StepWrap,
+					Description: "wrap the statement in Lease()",
+					Edits:       1,
+				}
+				wraps[rng] = s
+				steps = append(steps, s)
+			}
+			s.Reports++
+			continue
+		}
+
+		s := &Step{
+			Location: location(d.Posn),
+			Reports:  1,
+		}
+		switch {
+		case d.Category == critsec.RuleGetter.ID && len(d.Fixes) > 0:
+			s.Kind = StepGetter
+			s.Description = fmt.Sprintf("%s: %s", d.Fixes[0].Message, d.Message)
+			s.Edits = len(d.Fixes[0].Edits)
+		case len(d.Fixes) > 0:
+			s.Kind = StepFix
+			s.Description = fmt.Sprintf("%s: %s", d.Fixes[0].Message, d.Message)
+			s.Edits = len(d.Fixes[0].Edits)
+		default:
+			s.Kind = StepReview
+			s.Description = fmt.Sprintf("review by hand: %s", d.Message)
+			s.Edits = 1
+		}
+		steps = append(steps, s)
+	}
+
+	// steps are grouped by file and are in the order of their kind and then
+	// their position
+	sort.SliceStable(steps, func(i, j int) bool {
+		a, b := steps[i], steps[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if stepOrder[a.Kind] != stepOrder[b.Kind] {
+			return stepOrder[a.Kind] < stepOrder[b.Kind]
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+
+	p := Plan{Version: Version(), Files: []FilePlan{}}
+	for _, s := range steps {
+		if len(p.Files) == 0 || p.Files[len(p.Files)-1].File != s.File {
+			p.Files = append(p.Files, FilePlan{File: s.File})
+		}
+		f := &p.Files[len(p.Files)-1]
+		f.Steps = append(f.Steps, *s)
+		f.Edits += s.Edits
+		f.Reports += s.Reports
+		p.Steps++
+		p.Edits += s.Edits
+		p.Reports += s.Reports
+	}
+	return p
+}
+
+// leaseFixesOf returns the fixes that wrap the statement in Lease() and that
+// add the requires directive to the function. either can be nil
+func leaseFixesOf(fixes []Fix) (wrap *Fix, req *Fix) {
+	for i, f := range fixes {
+		if len(f.Edits) == 0 {
+			continue
+		}
+		switch {
+		case f.Message == critsec.FixWrapLease:
+			wrap = &fixes[i]
+		case strings.HasPrefix(f.Message, critsec.FixRequires+" to "):
+			req = &fixes[i]
+		}
+	}
+	return wrap, req
+}
+
+// location converts a token.Position to a Location
+func location(p token.Position) Location {
+	return Location{File: p.Filename, Line: p.Line, Column: p.Column}
+}
+
+func (l Location) String() string {
+	return fmt.Sprintf("%s:%d:%d", l.File, l.Line, l.Column)
+}
+
+// plural returns the count and the noun, with an s added if the count is not
+// one
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// WriteText writes the plan in plain text. the steps for each file are
+// numbered in the order they should be made
+func (p Plan) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "plan (critcheck %s)\n", p.Version)
+	for _, f := range p.Files {
+		fmt.Fprintf(w, "%s: %s, %s for %s\n", f.File, plural(len(f.Steps), "step"), plural(f.Edits, "edit"), plural(f.Reports, "report"))
+		for i, s := range f.Steps {
+			fmt.Fprintf(w, "\t%d. %s: %s (%s, %s)\n", i+1, s.Location, s.Description, plural(s.Edits, "edit"), plural(s.Reports, "report"))
+			for _, c := range s.Calls {
+				fmt.Fprintf(w, "\t\t%s: %s\n", c.Location, c.Message)
+			}
+		}
+	}
+	fmt.Fprintf(w, "total: %s, %s for %s\n", plural(p.Steps, "step"), plural(p.Edits, "edit"), plural(p.Reports, "report"))
+}
+
+// WriteJSON writes the plan as JSON. a plan with no steps has an empty list of
+// files
+func (p Plan) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(p)
+}
@@ -0,0 +1,168 @@
+package driver
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	critsec "github.com/jetsetilly/critsec/analysis"
+)
+
+// the number of phases listed in the slowest phases of the summary
+const slowestPhases = 5
+
+// PackageResult is the result of the CritSection analyzer for a package
+type PackageResult struct {
+	Path   string
+	Result *critsec.Result
+}
+
+// Summary of a run of the analysis
+type Summary struct {
+	// the target platform the packages were analysed for, in the form
+	// GOOS/GOARCH. empty if the platform could not be found
+	Platform string `json:"platform,omitempty"`
+
+	Packages []PackageSummary `json:"packages"`
+	Total    PackageSummary   `json:"total"`
+	Slowest  []PhaseSummary   `json:"slowest"`
+}
+
+// PackageSummary is the number of reports for each rule in a package, and the
+// proportion of accesses that are leased. the total for all packages has an
+// empty package path
+type PackageSummary struct {
+	Package  string         `json:"package,omitempty"`
+	Rules    map[string]int `json:"rules"`
+	Accesses int            `json:"accesses"`
+	Leased   int            `json:"leased"`
+
+	// the package was not analysed because of errors in it or in the
+	// packages it imports. the reports and coverage are empty
+	Broken bool `json:"broken,omitempty"`
+}
+
+// PhaseSummary is the time taken by a phase of the analysis of a package
+type PhaseSummary struct {
+	Package  string        `json:"package"`
+	Phase    string        `json:"phase"`
+	Duration time.Duration `json:"-"`
+	Seconds  float64       `json:"seconds"`
+}
+
+// summarise the diagnostics and the results of the analysis
+func summarise(diags []Diagnostic, results []PackageResult, broken []BrokenPackage) *Summary {
+	sum := &Summary{
+		Total: PackageSummary{Rules: make(map[string]int)},
+	}
+
+	idx := make(map[string]int)
+	for _, r := range results {
+		idx[r.Path] = len(sum.Packages)
+		sum.Packages = append(sum.Packages, PackageSummary{
+			Package:  r.Path,
+			Rules:    make(map[string]int),
+			Accesses: r.Result.Accesses,
+			Leased:   r.Result.Leased,
+		})
+		sum.Total.Accesses += r.Result.Accesses
+		sum.Total.Leased += r.Result.Leased
+
+		for _, t := range r.Result.Timings {
+			sum.Slowest = append(sum.Slowest, PhaseSummary{
+				Package:  r.Path,
+				Phase:    t.Phase,
+				Duration: t.Duration,
+				Seconds:  t.Duration.Seconds(),
+			})
+		}
+	}
+
+	for _, b := range broken {
+		sum.Packages = append(sum.Packages, PackageSummary{
+			Package: b.Path,
+			Rules:   make(map[string]int),
+			Broken:  true,
+		})
+	}
+
+	for _, d := range diags {
+		if i, ok := idx[d.Package]; ok {
+			sum.Packages[i].Rules[d.Category]++
+		}
+		sum.Total.Rules[d.Category]++
+	}
+
+	sort.Slice(sum.Packages, func(i, j int) bool {
+		return sum.Packages[i].Package < sum.Packages[j].Package
+	})
+	sort.SliceStable(sum.Slowest, func(i, j int) bool {
+		return sum.Slowest[i].Duration > sum.Slowest[j].Duration
+	})
+	if len(sum.Slowest) > slowestPhases {
+		sum.Slowest = sum.Slowest[:slowestPhases]
+	}
+
+	return sum
+}
+
+// coverage returns the proportion of accesses that are leased as a string
+func (p PackageSummary) coverage() string {
+	if p.Accesses == 0 {
+		return "no accesses"
+	}
+	return fmt.Sprintf("%d/%d leased (%.0f%%)", p.Leased, p.Accesses, float64(p.Leased)*100/float64(p.Accesses))
+}
+
+// rules returns the number of reports for each rule as a string, in rule order
+func (p PackageSummary) rules() string {
+	if len(p.Rules) == 0 {
+		return "no reports"
+	}
+	var ids []string
+	for id := range p.Rules {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	var s []string
+	for _, id := range ids {
+		s = append(s, fmt.Sprintf("%s %d", id, p.Rules[id]))
+	}
+	return strings.Join(s, ", ")
+}
+
+// print the summary in plain text
+func (sum *Summary) print(w io.Writer) {
+	if sum.Platform != "" {
+		fmt.Fprintf(w, "summary (critcheck %s, %s)\n", Version(), sum.Platform)
+	} else {
+		fmt.Fprintf(w, "summary (critcheck %s)\n", Version())
+	}
+	for _, p := range sum.Packages {
+		if p.Broken {
+			fmt.Fprintf(w, "\t%s: not analysed because of errors\n", p.Package)
+			continue
+		}
+		fmt.Fprintf(w, "\t%s: %s; %s\n", p.Package, p.rules(), p.coverage())
+	}
+	var broken int
+	for _, p := range sum.Packages {
+		if p.Broken {
+			broken++
+		}
+	}
+	if broken > 0 {
+		fmt.Fprintf(w, "\ttotal: %s; %s; %d not analysed\n", sum.Total.rules(), sum.Total.coverage(), broken)
+	} else {
+		fmt.Fprintf(w, "\ttotal: %s; %s\n", sum.Total.rules(), sum.Total.coverage())
+	}
+
+	if len(sum.Slowest) > 0 {
+		fmt.Fprintf(w, "slowest phases\n")
+		for _, p := range sum.Slowest {
+			fmt.Fprintf(w, "\t%s: %s %v\n", p.Package, p.Phase, p.Duration.Round(time.Millisecond))
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package driver
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// the path of the module containing the analysis
+const modulePath = "github.com/jetsetilly/critsec"
+
+// Version returns the version of the analysis. this is the version of the
+// critsec module. for a build in the module itself the version is a
+// pseudo-version that already includes the VCS revision and whether the tree
+// was modified. the revision is only added if the version is (devel), which is
+// what older versions of Go give for a build in the module itself
+//
+// a program that embeds the driver reports the version of the critsec module
+// it depends on rather than its own version
+func Version() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+
+	if info.Main.Path != modulePath {
+		for _, dep := range info.Deps {
+			if dep.Path != modulePath {
+				continue
+			}
+			if dep.Replace != nil {
+				dep = dep.Replace
+			}
+			if dep.Version == "" {
+				return "(devel)"
+			}
+			return dep.Version
+		}
+	}
+
+	v := info.Main.Version
+	if v != "" && v != "(devel)" {
+		return v
+	}
+	v = "(devel)"
+
+	var rev string
+	var modified bool
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			rev = s.Value
+		case "vcs.modified":
+			modified = s.Value == "true"
+		}
+	}
+	if rev != "" {
+		if len(rev) > 12 {
+			rev = rev[:12]
+		}
+		if modified {
+			rev += "+dirty"
+		}
+		v = fmt.Sprintf("%s %s", v, rev)
+	}
+	return v
+}
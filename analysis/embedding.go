@@ -0,0 +1,75 @@
+package analysis
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// promotedSection returns the crit.Section derived type that the selected
+// field is promoted from. for example, if wrapper embeds the crit.Section
+// derived type state then w.value is the value field of state
+//
+//	type wrapper struct {
+//		other.State
+//	}
+//
+// returns false if the selector is not a field promoted through an embedded
+// crit.Section derived type
+func promotedSection(pass *analysis.Pass, sel *ast.SelectorExpr) (*types.TypeName, bool) {
+	s, ok := pass.TypesInfo.Selections[sel]
+	if !ok || s.Kind() != types.FieldVal || len(s.Index()) < 2 {
+		return nil, false
+	}
+
+	t := s.Recv()
+	for _, i := range s.Index()[:len(s.Index())-1] {
+		if p, ok := types.Unalias(t).(*types.Pointer); ok {
+			t = p.Elem()
+		}
+		st, ok := t.Underlying().(*types.Struct)
+		if !ok {
+			return nil, false
+		}
+		t = st.Field(i).Type()
+		if id, ok := critDerived(t); ok {
+			return id, true
+		}
+	}
+
+	return nil, false
+}
+
+// checkEmbedding reports struct types that embed a crit.Section derived type
+// declared in another package. the fields of the embedded type are promoted
+// and are easy to reach without realising that they are protected. a test
+// double in an external test package is expected to embed the type it stands
+// in for and is not reported
+func checkEmbedding(pass *analysis.Pass, rep *reporter, inspect *inspector.Inspector, tds testDoubles) {
+	inspect.Preorder([]ast.Node{(*ast.TypeSpec)(nil)}, func(n ast.Node) {
+		ts := n.(*ast.TypeSpec)
+		st, ok := ts.Type.(*ast.StructType)
+		if !ok {
+			return
+		}
+		if id, ok := pass.TypesInfo.Defs[ts.Name].(*types.TypeName); ok && tds[id] {
+			return
+		}
+
+		for _, f := range st.Fields.List {
+			if len(f.Names) > 0 {
+				continue
+			}
+			id, ok := critDerived(pass.TypesInfo.TypeOf(f.Type))
+			if !ok || id.Pkg() == nil || id.Pkg() == pass.Pkg {
+				continue
+			}
+			rep.report(f.Pos(), RuleEmbedding, subject{
+				typ:   qualifiedName(id),
+				field: ts.Name.Name,
+			})
+		}
+	})
+}
@@ -0,0 +1,159 @@
+package analysis
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// checkEmptyLeases reports calls to lease functions where the function literal
+// does nothing with the section. the body is empty, only returns, or never
+// uses a crit.Section derived value
+//
+// calls to functions in the same package and calls of function values are
+// assumed to use the section, because the analysis does not follow them
+func checkEmptyLeases(pass *analysis.Pass, rep *reporter, inspect *inspector.Inspector) {
+	inspect.WithStack([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+
+		lc, ok := isLeaseCall(pass, n.(*ast.CallExpr))
+		if !ok || lc.lit == nil {
+			return true
+		}
+
+		var detail string
+		trivial := true
+		switch {
+		case len(lc.lit.Body.List) == 0:
+			detail = "the function is empty"
+		case onlyReturns(pass, lc.lit.Body):
+			detail = "the function only returns"
+		case !usesSection(pass, lc.lit.Body):
+			detail = "the function does not use the section"
+			trivial = false
+		default:
+			return true
+		}
+
+		subj := subject{
+			typ:   typeName(pass.TypesInfo.TypeOf(lc.recv)),
+			field: lc.call.Fun.(*ast.SelectorExpr).Sel.Name,
+			fn:    functionName(stack),
+		}
+
+		var fixes []analysis.SuggestedFix
+		if trivial {
+			if fix, ok := removeLeaseFix(pass, lc, stack); ok {
+				fixes = append(fixes, fix)
+			}
+		}
+		rep.reportDetail(n.Pos(), RuleEmptyLease, subj, detail, fixes...)
+
+		return true
+	})
+}
+
+// onlyReturns returns true if every statement in the block is a return
+// statement with constant or nil results
+func onlyReturns(pass *analysis.Pass, block *ast.BlockStmt) bool {
+	for _, s := range block.List {
+		rs, ok := s.(*ast.ReturnStmt)
+		if !ok {
+			return false
+		}
+		for _, r := range rs.Results {
+			tv, ok := pass.TypesInfo.Types[r]
+			if !ok || (tv.Value == nil && !tv.IsNil()) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// usesSection returns true if the block might use a crit.Section derived value.
+// any expression with a crit.Section derived type counts as a use, as does any
+// call that the analysis doesn't follow
+func usesSection(pass *analysis.Pass, block *ast.BlockStmt) bool {
+	var uses bool
+	ast.Inspect(block, func(nd ast.Node) bool {
+		if uses {
+			return false
+		}
+		e, ok := nd.(ast.Expr)
+		if !ok {
+			return true
+		}
+		uses = isCritDerived(pass.TypesInfo.TypeOf(e))
+		if call, ok := e.(*ast.CallExpr); ok && !uses {
+			uses = callMightUseSection(pass, call)
+		}
+		return !uses
+	})
+	return uses
+}
+
+// callMightUseSection returns true if the call is to a function that might use
+// a crit.Section derived value without it being passed to the function.
+// functions in other packages can only reach the sections of this package
+// through their arguments, which are checked separately
+func callMightUseSection(pass *analysis.Pass, call *ast.CallExpr) bool {
+	if tv, ok := pass.TypesInfo.Types[call.Fun]; ok && tv.IsType() {
+		return false
+	}
+	switch fn := typeutil.Callee(pass.TypesInfo, call).(type) {
+	case *types.Builtin:
+		return false
+	case *types.Func:
+		return fn.Pkg() == pass.Pkg
+	}
+
+	// function values
+	return true
+}
+
+// removeLeaseFix suggests removing the lease altogether. the function literal
+// must be empty or only return. the fix is only suggested if it returns nil
+// and the call is a statement on its own or its result is assigned to the
+// blank identifier
+func removeLeaseFix(pass *analysis.Pass, lc leaseCall, stack []ast.Node) (analysis.SuggestedFix, bool) {
+	for _, s := range lc.lit.Body.List {
+		for _, r := range s.(*ast.ReturnStmt).Results {
+			if tv := pass.TypesInfo.Types[r]; !tv.IsNil() {
+				return analysis.SuggestedFix{}, false
+			}
+		}
+	}
+	if len(stack) < 2 {
+		return analysis.SuggestedFix{}, false
+	}
+
+	var stmt ast.Stmt
+	switch p := stack[len(stack)-2].(type) {
+	case *ast.ExprStmt:
+		stmt = p
+	case *ast.AssignStmt:
+		if len(p.Lhs) != 1 || len(p.Rhs) != 1 {
+			return analysis.SuggestedFix{}, false
+		}
+		if id, ok := p.Lhs[0].(*ast.Ident); !ok || id.Name != "_" {
+			return analysis.SuggestedFix{}, false
+		}
+		stmt = p
+	default:
+		return analysis.SuggestedFix{}, false
+	}
+
+	return analysis.SuggestedFix{
+		Message: "remove the lease",
+		TextEdits: []analysis.TextEdit{{
+			Pos: stmt.Pos(),
+			End: stmt.End(),
+		}},
+	}, true
+}
@@ -0,0 +1,197 @@
+package analysis
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"reflect"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// Directives finds the directives and field policies that change how the
+// CritSection analyzer treats objects that can be used by other packages. they
+// are exported as facts so that a package that uses the objects is checked in
+// the same way as the package that declares them, whichever driver is running
+// the analysis
+//
+// the facts contain only exported fields of basic types so that they can be
+// gob encoded by drivers that run the analysis of each package separately,
+// such as gopls and go vet. the encoding of such a fact is always the same
+var Directives = &analysis.Analyzer{
+	Name:       "CritDirectives",
+	Doc:        "find the critsec directives of objects that can be used by other packages",
+	Run:        runDirectives,
+	ResultType: reflect.TypeOf((*directives)(nil)),
+	FactTypes:  []analysis.Fact{new(requiresFact), new(multiFact), new(fieldFact)},
+}
+
+// requiresFact is exported for functions with the requires directive
+type requiresFact struct {
+	Requires bool
+}
+
+func (*requiresFact) AFact() {}
+
+func (f *requiresFact) String() string {
+	return "requires"
+}
+
+// multiFact is exported for crit.Section derived types with the multi
+// directive
+type multiFact struct {
+	Multi bool
+}
+
+func (*multiFact) AFact() {}
+
+func (f *multiFact) String() string {
+	return "multi"
+}
+
+// the reason given by a fieldFact for a mutex field of a crit.Section derived
+// type
+const reasonMutex = "mutex"
+
+// fieldFact is exported for fields of crit.Section derived types that do not
+// require the lease. the reason is the policy of the field or reasonMutex
+type fieldFact struct {
+	Reason string
+}
+
+func (*fieldFact) AFact() {}
+
+func (f *fieldFact) String() string {
+	return fmt.Sprintf("field %s", f.Reason)
+}
+
+// directives is the result of the Directives analyzer. it contains the
+// directives for objects in the package and in every package it imports
+type directives struct {
+	// functions with the requires directive
+	requires map[types.Object]bool
+
+	// types with the multi directive
+	multi map[*types.TypeName]bool
+
+	// fields that do not require the lease
+	fields map[*types.Var]bool
+}
+
+func runDirectives(pass *analysis.Pass) (any, error) {
+	dirs := &directives{
+		requires: make(map[types.Object]bool),
+		multi:    make(map[*types.TypeName]bool),
+		fields:   make(map[*types.Var]bool),
+	}
+
+	for _, f := range pass.Files {
+		for _, d := range f.Decls {
+			if fd, ok := d.(*ast.FuncDecl); ok && requiresLease(fd) {
+				if obj, ok := pass.TypesInfo.Defs[fd.Name].(*types.Func); ok {
+					pass.ExportObjectFact(obj, &requiresFact{Requires: true})
+				}
+			}
+		}
+	}
+
+	for id := range multiInstanceTypes(pass) {
+		pass.ExportObjectFact(id, &multiFact{Multi: true})
+	}
+
+	for _, f := range pass.Files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			ts, ok := n.(*ast.TypeSpec)
+			if !ok {
+				return true
+			}
+			obj, ok := pass.TypesInfo.Defs[ts.Name].(*types.TypeName)
+			if !ok || !isCritDerived(obj.Type()) {
+				return true
+			}
+			for v, reason := range unleasedFields(pass, obj, ts) {
+				pass.ExportObjectFact(v, &fieldFact{Reason: reason})
+			}
+			return true
+		})
+	}
+
+	// the facts include those exported by the packages that have been
+	// imported as well as the facts exported above
+	for _, f := range pass.AllObjectFacts() {
+		switch f.Fact.(type) {
+		case *requiresFact:
+			dirs.requires[f.Object] = true
+		case *multiFact:
+			if id, ok := f.Object.(*types.TypeName); ok {
+				dirs.multi[id] = true
+			}
+		case *fieldFact:
+			if v, ok := f.Object.(*types.Var); ok {
+				dirs.fields[v] = true
+			}
+		}
+	}
+
+	return dirs, nil
+}
+
+// unleasedFields returns the fields of the crit.Section derived type that do
+// not require the lease, along with the reason. these are the mutex fields,
+// the fields declared as unguarded and the fields guarded by one of the mutex
+// fields
+func unleasedFields(pass *analysis.Pass, obj *types.TypeName, ts *ast.TypeSpec) map[*types.Var]string {
+	fields := make(map[*types.Var]string)
+
+	s, ok := obj.Type().Underlying().(*types.Struct)
+	if !ok {
+		return fields
+	}
+	for i := 0; i < s.NumFields(); i++ {
+		if isMutexType(s.Field(i).Type()) {
+			fields[s.Field(i)] = reasonMutex
+		}
+	}
+
+	st, ok := ts.Type.(*ast.StructType)
+	if !ok {
+		return fields
+	}
+	for _, f := range st.Fields.List {
+		p, _ := fieldPolicy(f)
+		if mu, ok := strings.CutPrefix(p, policyGuardedBy+" "); ok {
+			if !hasMutexField(s, mu) {
+				continue
+			}
+		} else if p != policyUnguarded {
+			continue
+		}
+		for _, name := range f.Names {
+			if v, ok := pass.TypesInfo.Defs[name].(*types.Var); ok {
+				fields[v] = p
+			}
+		}
+	}
+
+	return fields
+}
+
+// hasMutexField returns true if the struct has a sync.Mutex or sync.RWMutex
+// field with the name. an embedded mutex can be named with or without the
+// package name
+func hasMutexField(s *types.Struct, name string) bool {
+	for i := 0; i < s.NumFields(); i++ {
+		f := s.Field(i)
+		if !isMutexType(f.Type()) {
+			continue
+		}
+		if f.Name() == name {
+			return true
+		}
+		if f.Embedded() && name == fmt.Sprintf("sync.%s", f.Name()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package analysis
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// the key of the struct tag that declares the policy of a field. the tag is an
+// alternative to the field directives for code generators that can write tags
+// but not comments. the values are:
+//
+//	crit:"guarded"        the field requires the lease (the default)
+//	crit:"unguarded"      the field does not require the lease
+//	crit:"guardedby=mu"   the same as the guardedby directive
+//
+// tags are only used if the fieldtags flag is set
+const fieldTagKey = "crit"
+
+// the policies of a field. the policy for guardedby includes the name of the
+// mutex, separated by a space
+const (
+	policyGuarded   = "guarded"
+	policyUnguarded = "unguarded"
+	policyGuardedBy = "guardedby"
+)
+
+// commentPolicy returns the policy declared by the directives in the doc
+// comment or the line comment of the field
+func commentPolicy(f *ast.Field) (string, bool) {
+	for _, doc := range []*ast.CommentGroup{f.Doc, f.Comment} {
+		if args, ok := directiveArgs(doc, directiveGuardedBy); ok && len(args) > 0 {
+			return fmt.Sprintf("%s %s", policyGuardedBy, args[0]), true
+		}
+		if hasDirective(doc, directiveUnguarded) {
+			return policyUnguarded, true
+		}
+		if hasDirective(doc, directiveGuarded) {
+			return policyGuarded, true
+		}
+	}
+	return "", false
+}
+
+// tagPolicy returns the policy declared by the crit struct tag of the field.
+// the policy is returned as written, even if it is not a valid policy
+func tagPolicy(f *ast.Field) (string, bool) {
+	if !fieldTags || f.Tag == nil {
+		return "", false
+	}
+	tag, err := strconv.Unquote(f.Tag.Value)
+	if err != nil {
+		return "", false
+	}
+	v, ok := reflect.StructTag(tag).Lookup(fieldTagKey)
+	if !ok {
+		return "", false
+	}
+	if mu, ok := strings.CutPrefix(v, policyGuardedBy+"="); ok {
+		return fmt.Sprintf("%s %s", policyGuardedBy, mu), true
+	}
+	return v, true
+}
+
+// fieldPolicy returns the policy of the field. the directives take precedence
+// over the struct tag
+func fieldPolicy(f *ast.Field) (string, bool) {
+	if p, ok := commentPolicy(f); ok {
+		return p, true
+	}
+	return tagPolicy(f)
+}
+
+// validPolicy returns true if the policy is one of the known policies
+func validPolicy(p string) bool {
+	if p == policyGuarded || p == policyUnguarded {
+		return true
+	}
+	mu, ok := strings.CutPrefix(p, policyGuardedBy+" ")
+	return ok && mu != ""
+}
+
+// checkFieldPolicy reports fields of crit.Section derived types where the
+// struct tag and the directives declare different policies, and struct tags
+// that are not a known policy
+//
+// the fields that do not require the lease, because they are declared as
+// unguarded, are returned
+func checkFieldPolicy(pass *analysis.Pass, rep *reporter, inspect *inspector.Inspector) map[*types.Var]bool {
+	unguarded := make(map[*types.Var]bool)
+
+	inspect.Preorder([]ast.Node{(*ast.TypeSpec)(nil)}, func(n ast.Node) {
+		ts := n.(*ast.TypeSpec)
+		obj, ok := pass.TypesInfo.Defs[ts.Name].(*types.TypeName)
+		if !ok || !isCritDerived(obj.Type()) {
+			return
+		}
+		st, ok := ts.Type.(*ast.StructType)
+		if !ok {
+			return
+		}
+
+		for _, f := range st.Fields.List {
+			subj := subject{typ: qualifiedName(obj)}
+			if len(f.Names) > 0 {
+				subj.field = f.Names[0].Name
+			}
+
+			tag, hasTag := tagPolicy(f)
+			if hasTag && !validPolicy(tag) {
+				rep.reportDetail(f.Tag.Pos(), RuleFieldPolicy, subj,
+					fmt.Sprintf("unknown policy %q", tag))
+				continue
+			}
+			comment, hasComment := commentPolicy(f)
+			if hasTag && hasComment && tag != comment {
+				rep.reportDetail(f.Tag.Pos(), RuleFieldPolicy, subj,
+					fmt.Sprintf("struct tag is %q but directive is %q", tag, comment))
+			}
+
+			// the directive is used if there is a conflict
+			if p, _ := fieldPolicy(f); p == policyUnguarded {
+				for _, name := range f.Names {
+					if v, ok := pass.TypesInfo.Defs[name].(*types.Var); ok {
+						unguarded[v] = true
+					}
+				}
+			}
+		}
+	})
+
+	return unguarded
+}
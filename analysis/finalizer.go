@@ -0,0 +1,88 @@
+package analysis
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// the functions of the runtime package that register a function to be run
+// when an object is garbage collected. the registered function is the second
+// argument
+var finalizerFunctions = map[string]bool{
+	"SetFinalizer": true,
+	"AddCleanup":   true,
+}
+
+// finalizers records the functions registered with runtime.SetFinalizer() or
+// runtime.AddCleanup(). the functions are run by the runtime on a goroutine of
+// its own, so they are never called by anything in the callgraph
+type finalizers []token.Pos
+
+// findFinalizers looks for calls to runtime.SetFinalizer() and
+// runtime.AddCleanup(). the registered function must be a function literal or
+// a named function
+func findFinalizers(pass *analysis.Pass, inspect *inspector.Inspector) finalizers {
+	var fins finalizers
+
+	inspect.Preorder([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node) {
+		call := n.(*ast.CallExpr)
+		fn, ok := typeutil.Callee(pass.TypesInfo, call).(*types.Func)
+		if !ok || fn.Pkg() == nil || fn.Pkg().Path() != "runtime" {
+			return
+		}
+		if !finalizerFunctions[fn.Name()] || len(call.Args) < 2 {
+			return
+		}
+
+		var id *ast.Ident
+		switch f := ast.Unparen(call.Args[1]).(type) {
+		case *ast.FuncLit:
+			fins = append(fins, f.Pos())
+			return
+		case *ast.Ident:
+			id = f
+		case *ast.SelectorExpr:
+			id = f.Sel
+		default:
+			return
+		}
+		if obj, ok := pass.TypesInfo.ObjectOf(id).(*types.Func); ok {
+			fins = append(fins, obj.Pos())
+		}
+	})
+
+	return fins
+}
+
+// registered returns true if the function has been registered as a finalizer
+func (fins finalizers) registered(pass *analysis.Pass, nf ast.Node) bool {
+	for _, pos := range fins {
+		if positionCompare(pass, nf.Pos(), pos) {
+			return true
+		}
+	}
+	return false
+}
+
+// nodes returns the callgraph nodes for the registered functions
+func (fins finalizers) nodes(pass *analysis.Pass, graph *callgraph.Graph) []*callgraph.Node {
+	var nodes []*callgraph.Node
+	for f, n := range graph.Nodes {
+		if f == nil {
+			continue
+		}
+		for _, pos := range fins {
+			if positionCompare(pass, f.Pos(), pos) {
+				nodes = append(nodes, n)
+				break
+			}
+		}
+	}
+	return nodes
+}
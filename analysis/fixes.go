@@ -0,0 +1,77 @@
+package analysis
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// the messages of the suggested fixes for an unleased access. the message of
+// the requires fix is followed by " to " and the name of the function. the
+// messages are used by the driver to put together a remediation plan
+const (
+	FixWrapLease = "wrap in Lease"
+	FixRequires  = "add " + directivePrefix + directiveRequires
+)
+
+// leaseFixes returns the suggested fixes for an access that is not leased. the
+// section argument is the expression for the crit.Section derived instance
+// being accessed and the stack is the inspector stack for the access
+func leaseFixes(pass *analysis.Pass, section ast.Expr, stack []ast.Node, nf ast.Node) []analysis.SuggestedFix {
+	var fixes []analysis.SuggestedFix
+
+	if stmt, ok := enclosingStatement(stack); ok && section != nil {
+		var s, x bytes.Buffer
+		if printer.Fprint(&s, pass.Fset, stmt) == nil && printer.Fprint(&x, pass.Fset, section) == nil {
+			indent := strings.Repeat("\t", pass.Fset.Position(stmt.Pos()).Column-1)
+			body := strings.ReplaceAll(s.String(), "\n", "\n"+indent+"\t")
+			fixes = append(fixes, analysis.SuggestedFix{
+				Message: FixWrapLease,
+				TextEdits: []analysis.TextEdit{{
+					Pos: stmt.Pos(),
+					End: stmt.End(),
+					NewText: []byte(fmt.Sprintf("_ = %s.%s(func() error {\n%s\t%s\n%s\treturn nil\n%s})",
+						x.String(), leaseFunction, indent, body, indent, indent)),
+				}},
+			})
+		}
+	}
+
+	if f, ok := nf.(*ast.FuncDecl); ok && f.Name.Name != "main" && !requiresLease(f) {
+		fixes = append(fixes, analysis.SuggestedFix{
+			Message: fmt.Sprintf("%s to %s", FixRequires, f.Name.Name),
+			TextEdits: []analysis.TextEdit{{
+				Pos:     f.Pos(),
+				End:     f.Pos(),
+				NewText: []byte(fmt.Sprintf("%s%s\n", directivePrefix, directiveRequires)),
+			}},
+		})
+	}
+
+	return fixes
+}
+
+// enclosingStatement returns the innermost statement in the stack that can be
+// safely wrapped in a function literal. statements that declare variables or
+// change control flow cannot be wrapped
+func enclosingStatement(stack []ast.Node) (ast.Stmt, bool) {
+	for i := len(stack) - 1; i >= 0; i-- {
+		switch s := stack[i].(type) {
+		case *ast.AssignStmt:
+			if s.Tok == token.DEFINE {
+				return nil, false
+			}
+			return s, true
+		case *ast.ExprStmt, *ast.IncDecStmt, *ast.SendStmt:
+			return s.(ast.Stmt), true
+		case ast.Stmt, *ast.FuncLit, *ast.FuncDecl:
+			return nil, false
+		}
+	}
+	return nil, false
+}
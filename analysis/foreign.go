@@ -0,0 +1,112 @@
+package analysis
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// foreignCallee returns the name of the function if the call is to the syscall
+// package, to one of the golang.org/x/sys packages, or to a C function through
+// cgo. the name is qualified by the package path, or by C for cgo functions
+func foreignCallee(pass *analysis.Pass, call *ast.CallExpr) (string, bool) {
+	// C.name in the source. after cgo processing the call is to a function
+	// with the _Cfunc_ prefix
+	if sel, ok := call.Fun.(*ast.SelectorExpr); ok {
+		if x, ok := sel.X.(*ast.Ident); ok {
+			if pn, ok := pass.TypesInfo.ObjectOf(x).(*types.PkgName); ok && pn.Imported().Path() == "C" {
+				return fmt.Sprintf("C.%s", sel.Sel.Name), true
+			}
+		}
+	}
+
+	fn, ok := typeutil.Callee(pass.TypesInfo, call).(*types.Func)
+	if !ok || fn.Pkg() == nil {
+		return "", false
+	}
+	if name, ok := strings.CutPrefix(fn.Name(), "_Cfunc_"); ok {
+		return fmt.Sprintf("C.%s", name), true
+	}
+
+	path := trimVendor(fn.Pkg().Path())
+	if path == "syscall" || strings.HasPrefix(path, "golang.org/x/sys/") {
+		return fmt.Sprintf("%s.%s", path, fn.Name()), true
+	}
+	return "", false
+}
+
+// stripConversions removes type conversions from the expression. pointers are
+// usually passed to a system call as unsafe.Pointer or uintptr
+func stripConversions(pass *analysis.Pass, e ast.Expr) ast.Expr {
+	for {
+		e = ast.Unparen(e)
+		call, ok := e.(*ast.CallExpr)
+		if !ok || len(call.Args) != 1 {
+			return e
+		}
+		if tv, ok := pass.TypesInfo.Types[call.Fun]; !ok || !tv.IsType() {
+			return e
+		}
+		e = call.Args[0]
+	}
+}
+
+// checkForeign reports references to crit.Section derived instances, or to
+// their fields, that are passed to system calls or to C functions without the
+// lease. the kernel or the C code can use the memory at any time during the
+// call and the lease must be held for the duration
+//
+// functions in the retains list keep the reference after they return. a
+// reference passed to one of these functions is reported even if the lease is
+// held, because the lease is released long before the reference is finished
+// with
+func checkForeign(pass *analysis.Pass, rep *reporter, inspect *inspector.Inspector, graph *callgraph.Graph, chk *leaseChecker) {
+	retained := make(map[string]bool)
+	for _, name := range strings.Split(retains, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			retained[name] = true
+		}
+	}
+
+	inspect.WithStack([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+		call := n.(*ast.CallExpr)
+
+		callee, ok := foreignCallee(pass, call)
+		if !ok {
+			return true
+		}
+
+		for _, arg := range call.Args {
+			subj, ok := published(pass, stripConversions(pass, arg))
+			if !ok {
+				continue
+			}
+			subj.fn = functionName(stack)
+
+			if retained[callee] {
+				rep.reportDetail(arg.Pos(), RuleForeign, subj, fmt.Sprintf("retained by %s", callee))
+				continue
+			}
+
+			nf, ok := nearestFunction(stack)
+			if !ok || !isFunctionInGraph(pass, graph, nf) {
+				continue
+			}
+			if chk.checkLease(nf).leased() {
+				continue
+			}
+			rep.reportDetail(arg.Pos(), RuleForeign, subj, fmt.Sprintf("passed to %s", callee))
+		}
+
+		return true
+	})
+}
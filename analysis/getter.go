@@ -0,0 +1,241 @@
+package analysis
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/types"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// checkGetters reports methods of crit.Section derived types that return a
+// field of the type. a field returned by value must be read with the lease. a
+// reference to a field escapes the lease even if the method holds it, because
+// the reference is used after the method returns
+//
+// the lease is held for a return statement inside an Acquire() region of the
+// method. a return statement in the function literal passed to a lease
+// function returns from the function literal and is not a return from the
+// method. the formatting and serialisation methods are reported by
+// checkInterfaceMethods() instead
+//
+// a field can also be returned through a copy in a local variable or a named
+// result. the copy is read where it is made, so the lease must be held there.
+// a copy made in a function literal, such as the function passed to Lease(),
+// is assumed to be made with the lease
+func checkGetters(pass *analysis.Pass, rep *reporter, inspect *inspector.Inspector, chk *leaseChecker, exempt ...map[*types.Var]bool) {
+	isExempt := func(f *types.Var) bool {
+		if isMutexType(f.Type()) {
+			return true
+		}
+		for _, m := range exempt {
+			if m[f] {
+				return true
+			}
+		}
+		return false
+	}
+
+	inspect.Preorder([]ast.Node{(*ast.FuncDecl)(nil)}, func(n ast.Node) {
+		fd := n.(*ast.FuncDecl)
+		if fd.Recv == nil || len(fd.Recv.List) == 0 || fd.Body == nil || fd.Type.Results == nil {
+			return
+		}
+		if _, ok := interfaceMethods[fd.Name.Name]; ok || requiresLease(fd) {
+			return
+		}
+		recv := pass.TypesInfo.TypeOf(fd.Recv.List[0].Type)
+		if !isCritDerived(recv) {
+			return
+		}
+
+		// a method that is only called with the lease held is a helper of
+		// the lease rather than a getter
+		if isFunctionInGraph(pass, chk.graph, fd) && chk.checkLease(fd).leased() {
+			return
+		}
+
+		// the first return statement that returns a field
+		var detail string
+		var field string
+		var ret *ast.ReturnStmt
+		copies := findLocalCopies(pass, fd)
+		ast.Inspect(fd.Body, func(nd ast.Node) bool {
+			if ret != nil {
+				return false
+			}
+			if _, ok := nd.(*ast.FuncLit); ok {
+				return false
+			}
+			rs, ok := nd.(*ast.ReturnStmt)
+			if !ok {
+				return true
+			}
+
+			returned, _ := chk.regions.at(pass.TypesInfo, fd, rs.Pos())
+			for _, res := range returnedResults(fd.Type, rs) {
+				acquired := returned
+				sel := guardedField(pass, res, isExempt)
+
+				// a copy of the field in a local variable or a named result
+				// is read where the copy is made
+				var through string
+				if sel == nil {
+					cp, ok := copies.resolve(pass, res, rs.Pos())
+					if !ok {
+						continue
+					}
+					if sel = guardedField(pass, cp.value, isExempt); sel == nil {
+						continue
+					}
+					through = " through " + types.ExprString(res)
+					res = cp.value
+					acquired = cp.lit
+					if !acquired {
+						acquired, _ = chk.regions.at(pass.TypesInfo, fd, cp.pos)
+					}
+				}
+
+				if subj, ok := published(pass, res); ok && subj.field == sel.Sel.Name {
+					if acquired {
+						detail = fmt.Sprintf("%s returns a reference to %s%s, which escapes the lease", fd.Name.Name, types.ExprString(sel), through)
+					} else {
+						detail = fmt.Sprintf("%s returns a reference to %s%s without the lease", fd.Name.Name, types.ExprString(sel), through)
+					}
+				} else if !acquired {
+					detail = fmt.Sprintf("%s returns %s%s without the lease", fd.Name.Name, types.ExprString(sel), through)
+				} else {
+					continue
+				}
+
+				field = sel.Sel.Name
+				ret = rs
+				break
+			}
+			return ret == nil
+		})
+		if ret == nil {
+			return
+		}
+
+		subj := subject{
+			typ:   typeName(recv),
+			field: field,
+			fn:    fd.Name.Name,
+		}
+		var fixes []analysis.SuggestedFix
+		if fix, ok := snapshotGetterFix(pass, fd, ret); ok {
+			fixes = append(fixes, fix)
+		}
+		rep.reportDetail(fd.Name.Pos(), RuleGetter, subj, detail, fixes...)
+	})
+}
+
+// guardedField returns the first field of a crit.Section derived type in the
+// expression that requires the lease. returns nil if there is no such field
+func guardedField(pass *analysis.Pass, e ast.Expr, isExempt func(*types.Var) bool) *ast.SelectorExpr {
+	var first *ast.SelectorExpr
+	ast.Inspect(e, func(nd ast.Node) bool {
+		if first != nil {
+			return false
+		}
+		if _, ok := nd.(*ast.FuncLit); ok {
+			return false
+		}
+		sel, ok := nd.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if !isCritDerived(pass.TypesInfo.TypeOf(sel.X)) || isSectionMember(pass, sel) {
+			return true
+		}
+		f := selectedField(pass, sel)
+		if f == nil || isExempt(f) {
+			return true
+		}
+		first = sel
+		return false
+	})
+	return first
+}
+
+// snapshotGetterFix suggests replacing the body of a getter with a call to
+// crit.Snapshot(). the fix is only possible for a getter with a pointer
+// receiver where the body is the single return statement, returning a single
+// value. a slice is copied with append(). other references can't be copied
+// without knowing more about the type and no fix is suggested
+func snapshotGetterFix(pass *analysis.Pass, fd *ast.FuncDecl, ret *ast.ReturnStmt) (analysis.SuggestedFix, bool) {
+	if len(fd.Body.List) != 1 || fd.Body.List[0] != ret || len(ret.Results) != 1 {
+		return analysis.SuggestedFix{}, false
+	}
+	names := fd.Recv.List[0].Names
+	if len(names) != 1 || names[0].Name == "_" {
+		return analysis.SuggestedFix{}, false
+	}
+	if _, ok := types.Unalias(pass.TypesInfo.TypeOf(fd.Recv.List[0].Type)).(*types.Pointer); !ok {
+		return analysis.SuggestedFix{}, false
+	}
+	crit, ok := critImportName(pass, fd)
+	if !ok {
+		return analysis.SuggestedFix{}, false
+	}
+
+	res := ret.Results[0]
+	t := pass.TypesInfo.TypeOf(res)
+	if t == nil {
+		return analysis.SuggestedFix{}, false
+	}
+	typ := types.TypeString(t, types.RelativeTo(pass.Pkg))
+
+	var x bytes.Buffer
+	if printer.Fprint(&x, pass.Fset, res) != nil {
+		return analysis.SuggestedFix{}, false
+	}
+	value := x.String()
+
+	if _, ok := published(pass, res); ok {
+		if _, ok := t.Underlying().(*types.Slice); !ok {
+			return analysis.SuggestedFix{}, false
+		}
+		value = fmt.Sprintf("append(%s(nil), %s...)", typ, value)
+	}
+
+	indent := strings.Repeat("\t", pass.Fset.Position(fd.Pos()).Column-1)
+	body := fmt.Sprintf("{\n%s\treturn %s.Snapshot(%s, func() %s {\n%s\t\treturn %s\n%s\t})\n%s}",
+		indent, crit, names[0].Name, typ, indent, value, indent, indent)
+
+	return analysis.SuggestedFix{
+		Message: "return a snapshot taken with the lease",
+		TextEdits: []analysis.TextEdit{{
+			Pos:     fd.Body.Pos(),
+			End:     fd.Body.End(),
+			NewText: []byte(body),
+		}},
+	}, true
+}
+
+// critImportName returns the name the crit package is imported with in the
+// file containing the node. returns false if the file does not import it
+func critImportName(pass *analysis.Pass, n ast.Node) (string, bool) {
+	for _, f := range pass.Files {
+		if n.Pos() < f.Pos() || n.Pos() > f.End() {
+			continue
+		}
+		for _, imp := range f.Imports {
+			path, err := strconv.Unquote(imp.Path.Value)
+			if err != nil || !isCritPackage(path) {
+				continue
+			}
+			if imp.Name != nil {
+				return imp.Name.Name, imp.Name.Name != "_" && imp.Name.Name != "."
+			}
+			return path[strings.LastIndex(path, "/")+1:], true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,100 @@
+package analysis
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// leaseWriteGlobals returns the package-level variables declared with the
+// leasewrite directive
+func leaseWriteGlobals(pass *analysis.Pass) map[*types.Var]bool {
+	allowed := make(map[*types.Var]bool)
+	for _, f := range pass.Files {
+		for _, d := range f.Decls {
+			gd, ok := d.(*ast.GenDecl)
+			if !ok || gd.Tok != token.VAR {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				vs := spec.(*ast.ValueSpec)
+
+				// the doc comment of a declaration with a single spec belongs
+				// to the declaration rather than to the spec
+				doc := vs.Doc
+				if doc == nil && len(gd.Specs) == 1 {
+					doc = gd.Doc
+				}
+				if !hasDirective(doc, directiveLeaseWrite) && !hasDirective(vs.Comment, directiveLeaseWrite) {
+					continue
+				}
+				for _, name := range vs.Names {
+					if v, ok := pass.TypesInfo.Defs[name].(*types.Var); ok {
+						allowed[v] = true
+					}
+				}
+			}
+		}
+	}
+	return allowed
+}
+
+// checkGlobalWrites reports writes to package-level variables from inside a
+// lease body. the variables written to are unrelated to the leased section and
+// the write couples the critical section to the rest of the program. variables
+// of crit.Section derived types, and variables declared with the leasewrite
+// directive, are not reported
+//
+// writes inside function literals in the lease body are not reported because
+// the function literal may be called after the lease has ended
+func checkGlobalWrites(pass *analysis.Pass, rep *reporter, inspect *inspector.Inspector) {
+	allowed := leaseWriteGlobals(pass)
+
+	inspect.WithStack([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+
+		lc, ok := isLeaseCall(pass, n.(*ast.CallExpr))
+		if !ok || lc.lit == nil {
+			return true
+		}
+
+		write := func(e ast.Expr) {
+			v, ok := rootVar(pass, e)
+			if !ok || v.Pkg() == nil || v.Parent() != v.Pkg().Scope() {
+				return
+			}
+			if allowed[v] || isCritDerived(v.Type()) {
+				return
+			}
+			rep.reportDetail(e.Pos(), RuleGlobalWrite, subject{
+				typ:   typeName(pass.TypesInfo.TypeOf(lc.recv)),
+				field: qualifiedName(v),
+				fn:    functionName(stack),
+			}, v.Name())
+		}
+
+		ast.Inspect(lc.lit.Body, func(nd ast.Node) bool {
+			switch m := nd.(type) {
+			case *ast.FuncLit:
+				return false
+			case *ast.AssignStmt:
+				if m.Tok == token.DEFINE {
+					return true
+				}
+				for _, lhs := range m.Lhs {
+					write(lhs)
+				}
+			case *ast.IncDecStmt:
+				write(m.X)
+			}
+			return true
+		})
+
+		return true
+	})
+}
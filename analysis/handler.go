@@ -0,0 +1,211 @@
+package analysis
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// handlerFunction describes a function of the standard library that registers
+// a function to be run later on a goroutine of its own
+type handlerFunction struct {
+	// the argument that is the registered function
+	arg int
+
+	// when the registered function is run. used in the detail of the report
+	when string
+}
+
+// the functions that register a handler, by package and name
+var handlerFunctions = map[string]map[string]handlerFunction{
+	"net/http": {
+		"RegisterOnShutdown": {arg: 0, when: "when the server shuts down"},
+	},
+	"time": {
+		"AfterFunc": {arg: 1, when: "when the timer expires"},
+	},
+	"context": {
+		"AfterFunc": {arg: 1, when: "when the context is done"},
+	},
+}
+
+// handler is a function that is run by something other than the code that
+// registered it, at a time that can't be predicted
+type handler struct {
+	// the position of the function
+	pos token.Pos
+
+	// only accesses after this position are in the handler. used for the
+	// receive from a signal channel. accesses in the same function before
+	// the first signal is received are not part of the handler
+	after token.Pos
+
+	// how the function came to be a handler
+	detail string
+}
+
+// handlers records the functions registered with the functions in
+// handlerFunctions and the functions that receive from a channel passed to
+// signal.Notify()
+type handlers []handler
+
+// findHandlers looks for the registration of handlers. the registered function
+// must be a function literal or a named function. a signal handler is the
+// function containing a receive from a channel that is passed to
+// signal.Notify(). the channel must be a variable
+func findHandlers(pass *analysis.Pass, inspect *inspector.Inspector) handlers {
+	var hs handlers
+
+	// the channels passed to signal.Notify()
+	signals := make(map[types.Object]bool)
+
+	inspect.Preorder([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node) {
+		call := n.(*ast.CallExpr)
+		fn, ok := typeutil.Callee(pass.TypesInfo, call).(*types.Func)
+		if !ok || fn.Pkg() == nil {
+			return
+		}
+
+		if fn.Pkg().Path() == "os/signal" && fn.Name() == "Notify" && len(call.Args) > 0 {
+			if obj := variableOf(pass, call.Args[0]); obj != nil {
+				signals[obj] = true
+			}
+			return
+		}
+
+		hf, ok := handlerFunctions[fn.Pkg().Path()][fn.Name()]
+		if !ok || hf.arg >= len(call.Args) {
+			return
+		}
+		name := fn.Pkg().Name() + "." + fn.Name()
+		if recv := fn.Type().(*types.Signature).Recv(); recv != nil {
+			t := types.Unalias(recv.Type())
+			if p, ok := t.(*types.Pointer); ok {
+				t = types.Unalias(p.Elem())
+			}
+			if n, ok := t.(*types.Named); ok {
+				name = fn.Pkg().Name() + "." + n.Obj().Name() + "." + fn.Name()
+			}
+		}
+		detail := "registered with " + name + "() and run on a goroutine of its own " + hf.when
+
+		var id *ast.Ident
+		switch f := ast.Unparen(call.Args[hf.arg]).(type) {
+		case *ast.FuncLit:
+			hs = append(hs, handler{pos: f.Pos(), detail: detail})
+			return
+		case *ast.Ident:
+			id = f
+		case *ast.SelectorExpr:
+			id = f.Sel
+		default:
+			return
+		}
+		if obj, ok := pass.TypesInfo.ObjectOf(id).(*types.Func); ok {
+			hs = append(hs, handler{pos: obj.Pos(), detail: detail})
+		}
+	})
+
+	if len(signals) == 0 {
+		return hs
+	}
+
+	// the functions that receive from the signal channels. the first receive
+	// in each function is used
+	seen := make(map[ast.Node]bool)
+	nodes := []ast.Node{
+		(*ast.UnaryExpr)(nil),
+		(*ast.RangeStmt)(nil),
+	}
+	inspect.WithStack(nodes, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+
+		var ch ast.Expr
+		switch x := n.(type) {
+		case *ast.UnaryExpr:
+			if x.Op != token.ARROW {
+				return true
+			}
+			ch = x.X
+		case *ast.RangeStmt:
+			ch = x.X
+		}
+		if obj := variableOf(pass, ch); obj == nil || !signals[obj] {
+			return true
+		}
+
+		nf, ok := nearestFunction(stack)
+		if !ok || seen[nf] {
+			return true
+		}
+		seen[nf] = true
+		hs = append(hs, handler{
+			pos:    nf.Pos(),
+			after:  n.Pos(),
+			detail: "after receiving from a channel passed to signal.Notify(), which can happen at any time",
+		})
+
+		return true
+	})
+
+	return hs
+}
+
+// variableOf returns the variable for an expression that is an identifier or a
+// selector. returns nil otherwise
+func variableOf(pass *analysis.Pass, e ast.Expr) types.Object {
+	var id *ast.Ident
+	switch x := ast.Unparen(e).(type) {
+	case *ast.Ident:
+		id = x
+	case *ast.SelectorExpr:
+		id = x.Sel
+	default:
+		return nil
+	}
+	if v, ok := pass.TypesInfo.ObjectOf(id).(*types.Var); ok {
+		return v
+	}
+	return nil
+}
+
+// registered returns the handler if the access at the position in the function
+// is part of a handler
+func (hs handlers) registered(pass *analysis.Pass, nf ast.Node, pos token.Pos) (handler, bool) {
+	for _, h := range hs {
+		if h.after.IsValid() {
+			if nf.Pos() == h.pos && pos > h.after {
+				return h, true
+			}
+			continue
+		}
+		if positionCompare(pass, nf.Pos(), h.pos) {
+			return h, true
+		}
+	}
+	return handler{}, false
+}
+
+// nodes returns the callgraph nodes for the handlers
+func (hs handlers) nodes(pass *analysis.Pass, graph *callgraph.Graph) []*callgraph.Node {
+	var nodes []*callgraph.Node
+	for f, n := range graph.Nodes {
+		if f == nil {
+			continue
+		}
+		for _, h := range hs {
+			if positionCompare(pass, f.Pos(), h.pos) {
+				nodes = append(nodes, n)
+				break
+			}
+		}
+	}
+	return nodes
+}
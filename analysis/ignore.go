@@ -0,0 +1,161 @@
+package analysis
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// ignoreRange is a range of lines in a file where reports for the rules are
+// suppressed
+type ignoreRange struct {
+	filename string
+	start    int
+	end      int
+	rules    map[string]bool
+}
+
+// ignores are the ranges of source with the ignore directives. there are three
+// forms of the directive, each of which is followed by a comma-separated list
+// of rule IDs and the reason for ignoring them
+//
+// a directive on a line of code, or on the line before it, applies to that
+// line only
+//
+//	C.value = 1 //critsec:ignore CS002 written before the goroutines start
+//
+// a directive in the doc comment of a function applies to the whole function
+//
+//	//critsec:ignore CS001,CS002 test fixture
+//	func fixture() {
+//
+// and a block of lines can be ignored with begin and end directives
+//
+//	//critsec:ignore-begin CS001 generated tables
+//	...
+//	//critsec:ignore-end
+type ignores []ignoreRange
+
+// malformed is an ignore directive that could not be used
+type malformed struct {
+	pos    token.Pos
+	reason string
+}
+
+// findIgnores finds the ignore directives in the package. directives that are
+// missing the rule IDs or the reason, or that name a rule that doesn't exist,
+// are returned separately so that they can be reported
+func findIgnores(pass *analysis.Pass) (ignores, []malformed) {
+	var ig ignores
+	var bad []malformed
+
+	// parse the rule IDs and the reason for a directive
+	parse := func(c *ast.Comment, args []string) (map[string]bool, bool) {
+		if len(args) < 2 {
+			bad = append(bad, malformed{pos: c.Pos(), reason: "rule ID and reason are required"})
+			return nil, false
+		}
+		rules := make(map[string]bool)
+		for _, id := range strings.Split(args[0], ",") {
+			r, ok := LookupRule(id)
+			if !ok {
+				bad = append(bad, malformed{pos: c.Pos(), reason: fmt.Sprintf("unknown rule %s", id)})
+				return nil, false
+			}
+			rules[r.ID] = true
+		}
+		return rules, true
+	}
+
+	for _, f := range pass.Files {
+		code := codeLines(pass, f)
+		filename := pass.Fset.Position(f.Pos()).Filename
+
+		// the start of the current ignore-begin block
+		var begin *ignoreRange
+		var beginPos token.Pos
+
+		for _, cg := range f.Comments {
+			for _, c := range cg.List {
+				group := &ast.CommentGroup{List: []*ast.Comment{c}}
+				line := pass.Fset.Position(c.Pos()).Line
+
+				if args, ok := directiveArgs(group, directiveIgnore); ok {
+					if rules, ok := parse(c, args); ok {
+						l := directiveLine(code, line)
+						ig = append(ig, ignoreRange{filename: filename, start: l, end: l, rules: rules})
+					}
+				}
+
+				if args, ok := directiveArgs(group, directiveIgnoreBegin); ok {
+					if begin != nil {
+						bad = append(bad, malformed{pos: c.Pos(), reason: "nested ignore-begin"})
+						continue
+					}
+					if rules, ok := parse(c, args); ok {
+						begin = &ignoreRange{filename: filename, start: line, rules: rules}
+						beginPos = c.Pos()
+					}
+				}
+
+				if hasDirective(group, directiveIgnoreEnd) {
+					if begin == nil {
+						bad = append(bad, malformed{pos: c.Pos(), reason: "ignore-end without ignore-begin"})
+						continue
+					}
+					begin.end = line
+					ig = append(ig, *begin)
+					begin = nil
+				}
+			}
+		}
+
+		if begin != nil {
+			bad = append(bad, malformed{pos: beginPos, reason: "ignore-begin without ignore-end"})
+		}
+
+		// directives in the doc comment of a function apply to the whole
+		// function. the directive has already been parsed as a line directive
+		// so it is not parsed again
+		for _, d := range f.Decls {
+			fd, ok := d.(*ast.FuncDecl)
+			if !ok || fd.Doc == nil {
+				continue
+			}
+			for _, c := range fd.Doc.List {
+				args, ok := directiveArgs(&ast.CommentGroup{List: []*ast.Comment{c}}, directiveIgnore)
+				if !ok || len(args) < 2 {
+					continue
+				}
+				rules := make(map[string]bool)
+				for _, id := range strings.Split(args[0], ",") {
+					if r, ok := LookupRule(id); ok {
+						rules[r.ID] = true
+					}
+				}
+				ig = append(ig, ignoreRange{
+					filename: filename,
+					start:    pass.Fset.Position(fd.Pos()).Line,
+					end:      pass.Fset.Position(fd.End()).Line,
+					rules:    rules,
+				})
+			}
+		}
+	}
+
+	return ig, bad
+}
+
+// suppressed returns true if reports for the rule at the position are
+// suppressed by an ignore directive
+func (ig ignores) suppressed(pos token.Position, rule string) bool {
+	for _, r := range ig {
+		if r.filename == pos.Filename && pos.Line >= r.start && pos.Line <= r.end && r.rules[rule] {
+			return true
+		}
+	}
+	return false
+}
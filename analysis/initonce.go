@@ -0,0 +1,246 @@
+package analysis
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// the name of the one-time initialisation function of the crit section types
+const initOnceFunction = "InitOnce"
+
+// fieldWrites counts the different kinds of write to a field of a
+// crit.Section derived type
+type fieldWrites struct {
+	// writes in a function with the constructor directive
+	constructor int
+
+	// writes inside the function passed to sync.Once.Do(). writes inside a
+	// loop in the function are counted as other writes
+	once int
+
+	// writes inside the function passed to the InitOnce() function of a crit
+	// section. unlike sync.Once.Do(), writes inside a loop are allowed
+	initOnce int
+
+	// writes anywhere else, including taking the address of the field
+	other int
+}
+
+// findInitOnce returns the fields of crit.Section derived types that are only
+// written during initialisation. a field that is only written inside the
+// function passed to the InitOnce() function of a crit section is always
+// returned
+//
+// if relaxed is true then a field is also written during initialisation if
+// every write to it is in a function with the constructor directive, or if
+// there is exactly one write to it and that write is inside the function passed
+// to sync.Once.Do()
+//
+// fields that are never written are not returned
+func findInitOnce(pass *analysis.Pass, inspect *inspector.Inspector, relaxed bool) map[*types.Var]bool {
+	writes := make(map[*types.Var]*fieldWrites)
+
+	// types that have been assigned to as a whole. all fields of these types
+	// are disqualified
+	whole := make(map[*types.TypeName]bool)
+
+	record := func(e ast.Expr, stack []ast.Node, addr bool) {
+		for {
+			p, ok := e.(*ast.ParenExpr)
+			if !ok {
+				break
+			}
+			e = p.X
+		}
+
+		sel, ok := e.(*ast.SelectorExpr)
+		if !ok {
+			if !addr {
+				t := pass.TypesInfo.TypeOf(e)
+				if _, ok := types.Unalias(t).(*types.Pointer); !ok {
+					if id, ok := critDerived(t); ok && !inConstructor(stack) {
+						whole[id] = true
+					}
+				}
+			}
+			return
+		}
+		if !isCritDerived(pass.TypesInfo.TypeOf(sel.X)) {
+			return
+		}
+		field := selectedField(pass, sel)
+		if field == nil {
+			return
+		}
+
+		w, ok := writes[field]
+		if !ok {
+			w = &fieldWrites{}
+			writes[field] = w
+		}
+		switch {
+		case !addr && inInitOnce(pass, stack):
+			w.initOnce++
+		case inConstructor(stack):
+			w.constructor++
+		case !addr && inOnceDo(pass, stack):
+			w.once++
+		default:
+			w.other++
+		}
+	}
+
+	nodes := []ast.Node{
+		(*ast.AssignStmt)(nil),
+		(*ast.IncDecStmt)(nil),
+		(*ast.UnaryExpr)(nil),
+		(*ast.RangeStmt)(nil),
+	}
+
+	inspect.WithStack(nodes, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+		switch m := n.(type) {
+		case *ast.AssignStmt:
+			if m.Tok != token.DEFINE {
+				for _, lhs := range m.Lhs {
+					record(lhs, stack, false)
+				}
+			}
+		case *ast.IncDecStmt:
+			record(m.X, stack, false)
+		case *ast.UnaryExpr:
+			if m.Op == token.AND {
+				record(m.X, stack, true)
+			}
+		case *ast.RangeStmt:
+			if m.Tok != token.DEFINE {
+				if m.Key != nil {
+					record(m.Key, stack, false)
+				}
+				if m.Value != nil {
+					record(m.Value, stack, false)
+				}
+			}
+		}
+		return true
+	})
+
+	fields := make(map[*types.Var]bool)
+	for field, w := range writes {
+		if w.other > 0 {
+			continue
+		}
+		if w.initOnce > 0 {
+			if w.constructor == 0 && w.once == 0 {
+				fields[field] = true
+			}
+			continue
+		}
+		if !relaxed {
+			continue
+		}
+		if w.constructor > 0 && w.once > 0 {
+			continue
+		}
+		if w.once > 1 {
+			continue
+		}
+		fields[field] = true
+	}
+
+	// remove fields of types that have been assigned to as a whole
+	for field := range fields {
+		for id := range whole {
+			if s, ok := id.Type().Underlying().(*types.Struct); ok {
+				for i := 0; i < s.NumFields(); i++ {
+					if s.Field(i) == field {
+						delete(fields, field)
+					}
+				}
+			}
+		}
+	}
+
+	return fields
+}
+
+// inConstructor returns true if the stack is inside a function declaration
+// with the constructor directive
+func inConstructor(stack []ast.Node) bool {
+	for _, n := range stack {
+		if isConstructor(n) {
+			return true
+		}
+	}
+	return false
+}
+
+// inOnceDo returns true if the top of the stack is inside the function literal
+// passed to sync.Once.Do(). returns false if there is a loop between the
+// function literal and the top of the stack
+func inOnceDo(pass *analysis.Pass, stack []ast.Node) bool {
+	for i := len(stack) - 1; i > 0; i-- {
+		switch n := stack[i].(type) {
+		case *ast.ForStmt, *ast.RangeStmt:
+			return false
+		case *ast.FuncLit:
+			call, ok := stack[i-1].(*ast.CallExpr)
+			if !ok || len(call.Args) != 1 || call.Args[0] != n {
+				return false
+			}
+			return isOnceDo(pass, call)
+		}
+	}
+	return false
+}
+
+// inInitOnce returns true if the top of the stack is inside the function
+// literal passed to the InitOnce() function of a crit section
+func inInitOnce(pass *analysis.Pass, stack []ast.Node) bool {
+	for i := len(stack) - 1; i > 0; i-- {
+		lit, ok := stack[i].(*ast.FuncLit)
+		if !ok {
+			continue
+		}
+		call, ok := stack[i-1].(*ast.CallExpr)
+		if !ok || len(call.Args) != 1 || call.Args[0] != lit {
+			return false
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		return ok && sel.Sel.Name == initOnceFunction && isSectionMember(pass, sel)
+	}
+	return false
+}
+
+// isOnceDo returns true if the call is to the Do() method of sync.Once
+func isOnceDo(pass *analysis.Pass, call *ast.CallExpr) bool {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Do" {
+		return false
+	}
+	t := types.Unalias(pass.TypesInfo.TypeOf(sel.X))
+	if p, ok := t.(*types.Pointer); ok {
+		t = types.Unalias(p.Elem())
+	}
+	n, ok := t.(*types.Named)
+	if !ok || n.Obj().Pkg() == nil {
+		return false
+	}
+	return n.Obj().Pkg().Path() == "sync" && n.Obj().Name() == "Once"
+}
+
+// selectedField returns the field selected by the selector expression. returns
+// nil if the expression does not select a field
+func selectedField(pass *analysis.Pass, sel *ast.SelectorExpr) *types.Var {
+	s, ok := pass.TypesInfo.Selections[sel]
+	if !ok || s.Kind() != types.FieldVal {
+		return nil
+	}
+	return s.Obj().(*types.Var)
+}
@@ -0,0 +1,131 @@
+package analysis
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/ssa"
+)
+
+// the policies for accesses made during package initialisation
+const (
+	// accesses are checked in the same way as accesses anywhere else
+	initPhaseCheck = "check"
+
+	// accesses that can only be made during package initialisation are part
+	// of the setup of the section and do not need the lease. package
+	// initialisation runs on a single goroutine before main() is called
+	initPhaseSetup = "setup"
+)
+
+// initPhasePolicy is the value of the initphase flag
+type initPhasePolicy string
+
+func (p *initPhasePolicy) String() string {
+	if *p == "" {
+		return initPhaseCheck
+	}
+	return string(*p)
+}
+
+func (p *initPhasePolicy) Set(s string) error {
+	switch s {
+	case initPhaseCheck, initPhaseSetup:
+		*p = initPhasePolicy(s)
+		return nil
+	}
+	return fmt.Errorf("unknown init phase policy %q. should be %s or %s", s, initPhaseCheck, initPhaseSetup)
+}
+
+// the value of the Synthetic field of the ssa function that initialises a
+// package
+const packageInitializer = "package initializer"
+
+// packageVarInit returns the declaration of the package level variable if the
+// node at the top of the stack is part of the value it is initialised with.
+// there is no function containing the node in the syntax but it is run by the
+// package initializer
+//
+// function literals in the value are functions in their own right and are
+// found by nearestFunction()
+func packageVarInit(stack []ast.Node) (*ast.ValueSpec, bool) {
+	if len(stack) < 4 {
+		return nil, false
+	}
+	if gd, ok := stack[1].(*ast.GenDecl); !ok || gd.Tok != token.VAR {
+		return nil, false
+	}
+	vs, ok := stack[2].(*ast.ValueSpec)
+	if !ok {
+		return nil, false
+	}
+
+	// the names and the type of the declaration are not part of the value
+	for _, v := range vs.Values {
+		if v == stack[3] {
+			return vs, true
+		}
+	}
+	return nil, false
+}
+
+// initNodes returns the callgraph nodes for the initializer of the package
+// being analysed
+func (c *leaseChecker) initNodes() []*callgraph.Node {
+	var nodes []*callgraph.Node
+	for f, n := range c.graph.Nodes {
+		if f == nil || f.Synthetic != packageInitializer || f.Pkg == nil {
+			continue
+		}
+		if f.Pkg.Pkg.Path() == c.pass.Pkg.Path() {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// findInitOnly finds the functions that can only run during package
+// initialisation. these are reachable from the package initializers that have
+// no callers, but not from any other function with no callers, nor from a go
+// statement or a finalizer
+func (ph *phases) findInitOnly() {
+	var inits, others []*callgraph.Node
+	for f, n := range ph.graph.Nodes {
+		if f == nil || len(n.In) > 0 {
+			continue
+		}
+		if f.Synthetic == packageInitializer {
+			inits = append(inits, n)
+		} else {
+			others = append(others, n)
+		}
+	}
+
+	init := make(map[*ssa.Function]bool)
+	ph.reach(inits, init)
+	other := make(map[*ssa.Function]bool)
+	ph.reach(others, other)
+
+	ph.initOnly = make(map[*ssa.Function]bool)
+	for f := range init {
+		if !other[f] && !ph.concurrent[f] {
+			ph.initOnly[f] = true
+		}
+	}
+}
+
+// initialising returns true if every one of the callgraph nodes can only run
+// during package initialisation
+func (ph *phases) initialising(nodes []*callgraph.Node) bool {
+	if len(nodes) == 0 {
+		return false
+	}
+	for _, n := range nodes {
+		if !ph.initOnly[n.Func] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,214 @@
+package analysis
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// instancesOf returns the crit.Section derived types that are created when a
+// value of the type is created. this includes the type itself and any crit
+// types in the fields of a struct, or the elements of an array, that are held
+// by value. pointers are not followed because the zero value of a pointer is
+// not an instance of anything
+func instancesOf(t types.Type) []*types.TypeName {
+	t = types.Unalias(t)
+	if _, ok := t.(*types.Pointer); ok {
+		return nil
+	}
+	if id, ok := critDerived(t); ok {
+		return []*types.TypeName{id}
+	}
+
+	switch u := t.Underlying().(type) {
+	case *types.Struct:
+		var ids []*types.TypeName
+		for i := 0; i < u.NumFields(); i++ {
+			ids = append(ids, instancesOf(u.Field(i).Type())...)
+		}
+		return ids
+	case *types.Array:
+		// an array of two or more is already too many instances so there's no
+		// need to count every element
+		var ids []*types.TypeName
+		for i := int64(0); i < u.Len() && i < 2; i++ {
+			ids = append(ids, instancesOf(u.Elem())...)
+		}
+		return ids
+	}
+
+	return nil
+}
+
+// literalInstances returns the crit.Section derived types created by the
+// composite literal. fields of a struct literal that are given explicitly are
+// not included because the value for the field is visited separately. for
+// example, the literal in the following creates only one instance:
+//
+//	outer{inner: state{}}
+func literalInstances(pass *analysis.Pass, lit *ast.CompositeLit) []*types.TypeName {
+	t := pass.TypesInfo.TypeOf(lit)
+	if t == nil {
+		return nil
+	}
+	if id, ok := critDerived(t); ok {
+		if _, ok := types.Unalias(t).(*types.Pointer); ok {
+			// elided &T{} in a literal of type []*T
+			return []*types.TypeName{id}
+		}
+		return instancesOf(t)
+	}
+
+	s, ok := t.Underlying().(*types.Struct)
+	if !ok {
+		return nil
+	}
+
+	// positional literals give every field
+	given := make(map[*types.Var]bool)
+	for _, e := range lit.Elts {
+		kv, ok := e.(*ast.KeyValueExpr)
+		if !ok {
+			return nil
+		}
+		if key, ok := kv.Key.(*ast.Ident); ok {
+			if v, ok := pass.TypesInfo.ObjectOf(key).(*types.Var); ok {
+				given[v] = true
+			}
+		}
+	}
+
+	var ids []*types.TypeName
+	for i := 0; i < s.NumFields(); i++ {
+		if !given[s.Field(i)] {
+			ids = append(ids, instancesOf(s.Field(i).Type())...)
+		}
+	}
+	return ids
+}
+
+// newInstances returns the crit.Section derived types created by a call to
+// new(). the call expression must be a call to the new builtin
+func newInstances(pass *analysis.Pass, call *ast.CallExpr) []*types.TypeName {
+	id, ok := call.Fun.(*ast.Ident)
+	if !ok || len(call.Args) != 1 || id.Name != "new" {
+		return nil
+	}
+	if _, ok := pass.TypesInfo.ObjectOf(id).(*types.Builtin); !ok {
+		return nil
+	}
+	return instancesOf(pass.TypesInfo.TypeOf(call.Args[0]))
+}
+
+// findConstructors finds the functions that do nothing more than create and
+// return a new instance of a crit.Section derived type. for example:
+//
+//	func newState() *state {
+//		return &state{}
+//	}
+//
+// instances created in these functions are counted at the call site of the
+// function rather than in the function itself. the function must return the
+// instance directly, or return a local variable that was initialised with the
+// instance
+func findConstructors(pass *analysis.Pass) map[*types.Func]*types.TypeName {
+	constructors := make(map[*types.Func]*types.TypeName)
+
+	for _, f := range pass.Files {
+		for _, d := range f.Decls {
+			fd, ok := d.(*ast.FuncDecl)
+			if !ok || fd.Body == nil || fd.Recv != nil {
+				continue
+			}
+			fn, ok := pass.TypesInfo.Defs[fd.Name].(*types.Func)
+			if !ok {
+				continue
+			}
+			sig := fn.Type().(*types.Signature)
+			if sig.Results().Len() != 1 {
+				continue
+			}
+			id, ok := critDerived(sig.Results().At(0).Type())
+			if !ok {
+				continue
+			}
+			if constructs(pass, fd, id) {
+				constructors[fn] = id
+			}
+		}
+	}
+
+	return constructors
+}
+
+// constructs returns true if every return statement in the function returns a
+// new instance of the type
+func constructs(pass *analysis.Pass, fd *ast.FuncDecl, id *types.TypeName) bool {
+	// local variables initialised with a new instance
+	locals := make(map[types.Object]bool)
+	returns := 0
+	ok := true
+
+	ast.Inspect(fd.Body, func(n ast.Node) bool {
+		switch m := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.AssignStmt:
+			if len(m.Lhs) != len(m.Rhs) {
+				return true
+			}
+			for i, lhs := range m.Lhs {
+				if l, ok := lhs.(*ast.Ident); ok {
+					if n, ok := instanceType(pass, m.Rhs[i]); ok && n == id {
+						locals[pass.TypesInfo.ObjectOf(l)] = true
+					}
+				}
+			}
+		case *ast.ValueSpec:
+			for i, name := range m.Names {
+				if i < len(m.Values) {
+					if n, ok := instanceType(pass, m.Values[i]); ok && n == id {
+						locals[pass.TypesInfo.ObjectOf(name)] = true
+					}
+				} else if n, ok := critDerived(pass.TypesInfo.TypeOf(name)); ok && n == id {
+					if _, ok := pass.TypesInfo.TypeOf(name).(*types.Pointer); !ok {
+						locals[pass.TypesInfo.ObjectOf(name)] = true
+					}
+				}
+			}
+		case *ast.ReturnStmt:
+			returns++
+			if len(m.Results) != 1 {
+				ok = false
+				return false
+			}
+			r := ast.Unparen(m.Results[0])
+			if u, isUnary := r.(*ast.UnaryExpr); isUnary {
+				r = ast.Unparen(u.X)
+			}
+			if n, isInstance := instanceType(pass, r); isInstance && n == id {
+				return true
+			}
+			if l, isIdent := r.(*ast.Ident); isIdent && locals[pass.TypesInfo.ObjectOf(l)] {
+				return true
+			}
+			ok = false
+			return false
+		}
+		return true
+	})
+
+	return ok && returns > 0
+}
+
+// inConstructorOf returns true if the stack is inside a constructor for the type
+func inConstructorOf(pass *analysis.Pass, constructors map[*types.Func]*types.TypeName, id *types.TypeName, stack []ast.Node) bool {
+	for i := len(stack) - 1; i >= 0; i-- {
+		if fd, ok := stack[i].(*ast.FuncDecl); ok {
+			fn, _ := pass.TypesInfo.Defs[fd.Name].(*types.Func)
+			return fn != nil && constructors[fn] == id
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package analysis
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// gotoLoop is a part of a function that is repeated by a backward goto. the
+// loop starts at the label and ends at the goto statement
+type gotoLoop struct {
+	start token.Pos
+	end   token.Pos
+}
+
+// contains returns true if the position is inside the loop
+func (l gotoLoop) contains(pos token.Pos) bool {
+	return l.start <= pos && pos < l.end
+}
+
+// gotoLoops returns the loops made by backward goto statements in the function
+// declaration or function literal. a goto can't leave the function it is in so
+// function literals inside the function are not searched
+//
+// a loop made with goto has no ForStmt and is not found by looking at the AST
+// stack. labelled break and continue statements always refer to an enclosing
+// for, switch or select statement and so need no special treatment
+func gotoLoops(nf ast.Node) []gotoLoop {
+	var body *ast.BlockStmt
+	switch f := nf.(type) {
+	case *ast.FuncDecl:
+		body = f.Body
+	case *ast.FuncLit:
+		body = f.Body
+	}
+	if body == nil {
+		return nil
+	}
+
+	labels := make(map[string]token.Pos)
+	var gotos []*ast.BranchStmt
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch s := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.LabeledStmt:
+			labels[s.Label.Name] = s.Pos()
+		case *ast.BranchStmt:
+			if s.Tok == token.GOTO && s.Label != nil {
+				gotos = append(gotos, s)
+			}
+		}
+		return true
+	})
+
+	var loops []gotoLoop
+	for _, g := range gotos {
+		if pos, ok := labels[g.Label.Name]; ok && pos < g.Pos() {
+			loops = append(loops, gotoLoop{start: pos, end: g.End()})
+		}
+	}
+	return loops
+}
+
+// inGotoLoop returns true if all the positions are inside the same loop made
+// by a backward goto in the function
+func inGotoLoop(nf ast.Node, pos ...token.Pos) bool {
+	for _, l := range gotoLoops(nf) {
+		in := true
+		for _, p := range pos {
+			in = in && l.contains(p)
+		}
+		if in {
+			return true
+		}
+	}
+	return false
+}
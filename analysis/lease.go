@@ -0,0 +1,226 @@
+package analysis
+
+import (
+	"go/ast"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// leaseMethod describes a method of the crit section types that calls the
+// function passed to it while holding the lease
+type leaseMethod struct {
+	// the function is called with the read lease and must not change any
+	// fields of the section
+	read bool
+
+	// the function is not always called. for example, TryLease() does not
+	// call the function if the lease is held elsewhere
+	conditional bool
+
+	// the name of the method that does the same thing with the read lease.
+	// empty if there is no such method
+	readVariant string
+
+	// the sections that the lease is held for while the function is called
+	covers coverage
+}
+
+// coverage says which sections a lease method or lease function holds the lease
+// of while the function passed to it is called
+type coverage int
+
+const (
+	// the receiver of the method. this is the usual case
+	coversReceiver coverage = iota
+
+	// the arguments before the function, as well as the receiver of a method.
+	// a slice argument is expanded if it is a composite literal
+	coversArguments
+)
+
+// leaseMethods is the registry of lease methods in the crit package. a lease
+// method added to the crit package must be added here so that the function
+// passed to it is treated as being leased. the last argument of a lease
+// method is always the function that is called with the lease
+//
+// forks of the crit package can add to the registry with the lease-methods
+// flag
+var leaseMethods = map[string]leaseMethod{
+	"Lease":     {readVariant: "RLease"},
+	"RLease":    {read: true},
+	"TryLease":  {conditional: true, readVariant: "TryRLease"},
+	"TryRLease": {read: true, conditional: true},
+}
+
+// leaseFunctions is the registry of the functions in the crit package that
+// lease the sections passed to them. like the lease methods, the last argument
+// is always the function that is called with the lease
+var leaseFunctions = map[string]leaseMethod{
+	"Lease2":   {covers: coversArguments},
+	"LeaseAll": {covers: coversArguments},
+}
+
+// lookupLeaseMethod returns the description of the named lease method. methods
+// named by the lease-methods flag are found as well as the methods in the
+// registry
+func lookupLeaseMethod(name string) (leaseMethod, bool) {
+	if m, ok := leaseMethods[name]; ok {
+		return m, true
+	}
+	for _, s := range strings.Split(extraLeases, ",") {
+		n, opts, _ := strings.Cut(strings.TrimSpace(s), ":")
+		if n != name {
+			continue
+		}
+		var m leaseMethod
+		for _, o := range strings.Split(opts, ":") {
+			switch o {
+			case "read":
+				m.read = true
+			case "conditional":
+				m.conditional = true
+			case "args":
+				m.covers = coversArguments
+			}
+		}
+		return m, true
+	}
+	return leaseMethod{}, false
+}
+
+// lookupLeaseFunction returns the description of the named lease function.
+// methods named by the lease-methods flag with the args option can also be
+// functions
+func lookupLeaseFunction(name string) (leaseMethod, bool) {
+	if m, ok := leaseFunctions[name]; ok {
+		return m, true
+	}
+	if m, ok := lookupLeaseMethod(name); ok && m.covers == coversArguments {
+		return m, true
+	}
+	return leaseMethod{}, false
+}
+
+// leaseCall describes a call to the lease function
+type leaseCall struct {
+	call *ast.CallExpr
+
+	// the expression for the crit.Section (or crit.Section derived
+	// instance) that is being leased
+	recv ast.Expr
+
+	// the function literal passed to the lease function. will be nil if the
+	// argument is not a function literal
+	lit *ast.FuncLit
+
+	// the lease method being called
+	method leaseMethod
+
+	// the expressions for every section covered by the lease. for a lease
+	// method that covers its receiver this only contains recv
+	covered []ast.Expr
+}
+
+// isLeaseCall returns information about the call if it is a call to a lease
+// function (including the read lease function of crit.RWSection) of a
+// crit.Section, a crit.Section derived type or crit.Instrumented
+func isLeaseCall(pass *analysis.Pass, call *ast.CallExpr) (leaseCall, bool) {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return leaseCall{}, false
+	}
+	m, ok := lookupLeaseMethod(sel.Sel.Name)
+	if !ok {
+		return leaseCall{}, false
+	}
+
+	t := pass.TypesInfo.TypeOf(sel.X)
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	if !isCritDerived(t) && !isCritSectionType(t) && !isInstrumentedType(t) {
+		return leaseCall{}, false
+	}
+
+	lc := leaseCall{call: call, recv: sel.X, method: m}
+	if n := len(call.Args); n > 0 {
+		lc.lit, _ = call.Args[n-1].(*ast.FuncLit)
+	}
+	lc.covered = append([]ast.Expr{sel.X}, coveredArguments(pass, lc)...)
+	return lc, true
+}
+
+// isLeaseFunctionCall returns information about the call if it is a call to
+// one of the lease functions of the crit package, such as crit.Lease2(). the
+// recv field of the result is nil
+func isLeaseFunctionCall(pass *analysis.Pass, call *ast.CallExpr) (leaseCall, bool) {
+	fn, ok := typeutil.Callee(pass.TypesInfo, call).(*types.Func)
+	if !ok || fn.Pkg() == nil || !isCritPackage(fn.Pkg().Path()) {
+		return leaseCall{}, false
+	}
+	if fn.Type().(*types.Signature).Recv() != nil {
+		return leaseCall{}, false
+	}
+	m, ok := lookupLeaseFunction(fn.Name())
+	if !ok || len(call.Args) == 0 {
+		return leaseCall{}, false
+	}
+
+	lc := leaseCall{call: call, method: m}
+	lc.lit, _ = call.Args[len(call.Args)-1].(*ast.FuncLit)
+	lc.covered = coveredArguments(pass, lc)
+	return lc, true
+}
+
+// isCoveringCall returns information about the call if it is a call to a lease
+// method or a lease function. the covered field says which sections are leased
+func isCoveringCall(pass *analysis.Pass, call *ast.CallExpr) (leaseCall, bool) {
+	if lc, ok := isLeaseCall(pass, call); ok {
+		return lc, true
+	}
+	return isLeaseFunctionCall(pass, call)
+}
+
+// coveredArguments returns the arguments of the call that are covered by the
+// lease, not including the receiver. the elements of a slice composite literal
+// are returned instead of the literal. a slice that is not a composite literal
+// can't be resolved to the sections in it
+func coveredArguments(pass *analysis.Pass, lc leaseCall) []ast.Expr {
+	if lc.method.covers != coversArguments || len(lc.call.Args) == 0 {
+		return nil
+	}
+	var covered []ast.Expr
+	for _, a := range lc.call.Args[:len(lc.call.Args)-1] {
+		if cl, ok := ast.Unparen(a).(*ast.CompositeLit); ok {
+			switch pass.TypesInfo.TypeOf(cl).Underlying().(type) {
+			case *types.Slice, *types.Array:
+				covered = append(covered, cl.Elts...)
+				continue
+			}
+		}
+		covered = append(covered, a)
+	}
+	return covered
+}
+
+// countStatements returns the number of statements in the block, including
+// statements in nested blocks. block statements themselves are not counted and
+// statements inside function literals are not counted
+func countStatements(block *ast.BlockStmt) int {
+	var n int
+	ast.Inspect(block, func(nd ast.Node) bool {
+		switch nd.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.BlockStmt:
+			return true
+		case ast.Stmt:
+			n++
+		}
+		return true
+	})
+	return n
+}
@@ -0,0 +1,273 @@
+package analysis
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// checkLeaseFlow reports statements in a lease body that behave differently
+// to how they would behave in the enclosing function. these are the usual
+// mistakes when a Lock()/Unlock() region is converted to a lease by hand or
+// by critmigrate:
+//
+//   - an early return leaves the lease but not the enclosing function, so the
+//     code after the call to Lease() still runs. only a return of a value that
+//     the enclosing function could have returned is reported. an early return
+//     of nil is the normal way to skip the rest of a lease
+//   - a returned error is lost if the result of Lease() is discarded
+//   - a deferred call of something from the enclosing function runs when the
+//     lease ends and a deferred recover() only recovers panics from inside the
+//     lease
+//   - a panic that is recovered by the enclosing function releases the lease,
+//     possibly with the fields partly updated
+//   - the function passed to a conditional lease method, such as TryLease(),
+//     might not be called but the result that says whether it was is
+//     discarded
+func checkLeaseFlow(pass *analysis.Pass, rep *reporter, inspect *inspector.Inspector) {
+	inspect.WithStack([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+
+		lc, ok := isLeaseCall(pass, n.(*ast.CallExpr))
+		if !ok || lc.lit == nil {
+			return true
+		}
+
+		name := lc.call.Fun.(*ast.SelectorExpr).Sel.Name
+		subj := subject{
+			typ:   typeName(pass.TypesInfo.TypeOf(lc.recv)),
+			field: name,
+			fn:    functionName(stack),
+		}
+		discarded, acquired, followed := leaseResultUse(stack)
+
+		if lc.method.conditional && !acquired {
+			rep.reportDetail(lc.call.Pos(), RuleLeaseFlow, subj,
+				"the function passed to "+name+" might not be called but whether it was is discarded")
+		}
+		recovers := enclosingRecovers(pass, stack)
+		outer := enclosingFunction(stack)
+
+		body := lc.lit.Body.List
+		ast.Inspect(lc.lit.Body, func(nd ast.Node) bool {
+			switch s := nd.(type) {
+			case *ast.FuncLit:
+				return false
+
+			case *ast.ReturnStmt:
+				if !discarded || len(s.Results) != 1 || isNil(pass, s.Results[0]) {
+					return true
+				}
+				if followed && (len(body) == 0 || s != body[len(body)-1]) && returnsTo(pass, outer, s.Results[0]) {
+					rep.reportDetail(s.Pos(), RuleLeaseFlow, subj,
+						"return leaves the lease but the code after the call to "+name+" still runs")
+					return true
+				}
+				rep.reportDetail(s.Pos(), RuleLeaseFlow, subj,
+					"the error returned from the lease is discarded")
+
+			case *ast.DeferStmt:
+				if deferRecovers(pass, s) {
+					rep.reportDetail(s.Pos(), RuleLeaseFlow, subj,
+						"recover only recovers panics from inside the lease")
+				} else if usesLocals(pass, s, outer, lc.lit) {
+					rep.reportDetail(s.Pos(), RuleLeaseFlow, subj,
+						"deferred call runs when the lease ends, not when the enclosing function returns")
+				}
+				return false
+
+			case *ast.CallExpr:
+				if recovers && isBuiltin(pass, s, "panic") {
+					rep.reportDetail(s.Pos(), RuleLeaseFlow, subj,
+						"panic is recovered after the lease is released, possibly with the fields partly updated")
+				}
+			}
+			return true
+		})
+
+		return true
+	})
+}
+
+// leaseResultUse returns whether the error result of the call to the lease
+// method at the top of the stack is discarded and, if so, whether the
+// statement containing the call is followed by other statements in the same
+// block. conditional lease methods also return whether the lease was
+// acquired, before the error. acquired is false if that result is discarded
+func leaseResultUse(stack []ast.Node) (discarded bool, acquired bool, followed bool) {
+	if len(stack) < 3 {
+		return false, true, false
+	}
+	call := stack[len(stack)-1]
+	stmt, ok := stack[len(stack)-2].(ast.Stmt)
+	if !ok {
+		return false, true, false
+	}
+
+	blank := func(e ast.Expr) bool {
+		id, ok := e.(*ast.Ident)
+		return ok && id.Name == "_"
+	}
+
+	acquired = true
+	switch s := stmt.(type) {
+	case *ast.ExprStmt:
+		discarded = true
+		acquired = false
+	case *ast.AssignStmt:
+		if len(s.Rhs) == 1 && s.Rhs[0] == call {
+			discarded = blank(s.Lhs[len(s.Lhs)-1])
+			acquired = len(s.Lhs) == 1 || !blank(s.Lhs[0])
+		}
+	}
+	if !discarded {
+		return false, acquired, false
+	}
+
+	// a labelled statement is in the list rather than the statement itself
+	i := len(stack) - 3
+	for i > 0 {
+		l, ok := stack[i].(*ast.LabeledStmt)
+		if !ok {
+			break
+		}
+		stmt = l
+		i--
+	}
+
+	var list []ast.Stmt
+	switch b := stack[i].(type) {
+	case *ast.BlockStmt:
+		list = b.List
+	case *ast.CaseClause:
+		list = b.Body
+	case *ast.CommClause:
+		list = b.Body
+	}
+	for i, s := range list {
+		if s == stmt {
+			return true, acquired, i < len(list)-1
+		}
+	}
+	return true, acquired, false
+}
+
+// enclosingFunction returns the *ast.FuncDecl or *ast.FuncLit that contains
+// the top of the stack. nil if there isn't one
+func enclosingFunction(stack []ast.Node) ast.Node {
+	for i := len(stack) - 2; i >= 0; i-- {
+		switch stack[i].(type) {
+		case *ast.FuncDecl, *ast.FuncLit:
+			return stack[i]
+		}
+	}
+	return nil
+}
+
+// returnsTo returns true if the value returned from the lease could have been
+// returned by the enclosing function. this is the return that used to leave the
+// enclosing function before the region was converted to a lease
+func returnsTo(pass *analysis.Pass, fn ast.Node, e ast.Expr) bool {
+	var sig *types.Signature
+	switch f := fn.(type) {
+	case *ast.FuncDecl:
+		if obj, ok := pass.TypesInfo.Defs[f.Name].(*types.Func); ok {
+			sig, _ = obj.Type().(*types.Signature)
+		}
+	case *ast.FuncLit:
+		sig, _ = pass.TypesInfo.TypeOf(f).(*types.Signature)
+	}
+	if sig == nil || sig.Results().Len() == 0 {
+		return false
+	}
+	t := pass.TypesInfo.TypeOf(e)
+	return t != nil && types.AssignableTo(t, sig.Results().At(sig.Results().Len()-1).Type())
+}
+
+// usesLocals returns true if the deferred call uses a variable of the enclosing
+// function that is declared outside of the lease. for example, a file that is
+// opened before the lease and closed by a defer inside it. a deferred call
+// that only uses what is declared inside the lease is cleaning up after the
+// lease and runs at the right time
+func usesLocals(pass *analysis.Pass, s *ast.DeferStmt, fn ast.Node, lit *ast.FuncLit) bool {
+	if fn == nil {
+		return false
+	}
+	var uses bool
+	ast.Inspect(s.Call, func(nd ast.Node) bool {
+		id, ok := nd.(*ast.Ident)
+		if !ok {
+			return !uses
+		}
+		v, ok := pass.TypesInfo.Uses[id].(*types.Var)
+		if ok && !v.IsField() && v.Pos() >= fn.Pos() && v.Pos() < fn.End() && (v.Pos() < lit.Pos() || v.Pos() >= lit.End()) {
+			uses = true
+		}
+		return !uses
+	})
+	return uses
+}
+
+// enclosingRecovers returns true if the function that contains the top of the
+// stack defers a call to recover()
+func enclosingRecovers(pass *analysis.Pass, stack []ast.Node) bool {
+	var body *ast.BlockStmt
+	switch f := enclosingFunction(stack).(type) {
+	case *ast.FuncDecl:
+		body = f.Body
+	case *ast.FuncLit:
+		body = f.Body
+	}
+	if body == nil {
+		return false
+	}
+
+	var recovers bool
+	ast.Inspect(body, func(nd ast.Node) bool {
+		switch s := nd.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.DeferStmt:
+			if deferRecovers(pass, s) {
+				recovers = true
+			}
+			return false
+		}
+		return !recovers
+	})
+	return recovers
+}
+
+// deferRecovers returns true if the deferred function is a function literal
+// that calls recover()
+func deferRecovers(pass *analysis.Pass, s *ast.DeferStmt) bool {
+	lit, ok := s.Call.Fun.(*ast.FuncLit)
+	if !ok {
+		return false
+	}
+	var recovers bool
+	ast.Inspect(lit.Body, func(nd ast.Node) bool {
+		if call, ok := nd.(*ast.CallExpr); ok && isBuiltin(pass, call, "recover") {
+			recovers = true
+		}
+		return !recovers
+	})
+	return recovers
+}
+
+// isBuiltin returns true if the call is to the named builtin function
+func isBuiltin(pass *analysis.Pass, call *ast.CallExpr, name string) bool {
+	b, ok := typeutil.Callee(pass.TypesInfo, call).(*types.Builtin)
+	return ok && b.Name() == name
+}
+
+// isNil returns true if the expression is the predeclared nil
+func isNil(pass *analysis.Pass, e ast.Expr) bool {
+	tv, ok := pass.TypesInfo.Types[e]
+	return ok && tv.IsNil()
+}
@@ -0,0 +1,184 @@
+package analysis
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// checkLeaseLoops reports calls to the lease function made inside a loop where
+// the body of the lease is small. acquiring the lease on every iteration is
+// more expensive than acquiring it once for the entire loop
+func checkLeaseLoops(pass *analysis.Pass, rep *reporter, inspect *inspector.Inspector) {
+	inspect.WithStack([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+
+		lc, ok := isLeaseCall(pass, n.(*ast.CallExpr))
+		if !ok || lc.lit == nil {
+			return true
+		}
+
+		// a loop made with a backward goto is reported in the same way but
+		// the lease can't be hoisted automatically
+		loop, body := enclosingLoop(stack)
+		if loop == nil {
+			nf, ok := nearestFunction(stack)
+			if !ok || !inGotoLoop(nf, n.Pos()) {
+				return true
+			}
+		}
+
+		size := countStatements(lc.lit.Body)
+		if size > leaseLoopMax {
+			return true
+		}
+
+		var fixes []analysis.SuggestedFix
+		if loop != nil {
+			if fix, ok := hoistLease(pass, lc, loop, body, stack); ok {
+				fixes = append(fixes, fix)
+			}
+		}
+
+		rep.report(n.Pos(), RuleLeaseInLoop, subject{
+			typ:   typeName(pass.TypesInfo.TypeOf(lc.recv)),
+			field: leaseFunction,
+			fn:    functionName(stack),
+		}, fixes...)
+
+		return true
+	})
+}
+
+// enclosingLoop returns the innermost loop in the stack, along with the loop's
+// body. the search stops at the nearest function boundary
+func enclosingLoop(stack []ast.Node) (ast.Stmt, *ast.BlockStmt) {
+	for i := len(stack) - 1; i >= 0; i-- {
+		switch s := stack[i].(type) {
+		case *ast.FuncLit, *ast.FuncDecl:
+			return nil, nil
+		case *ast.ForStmt:
+			if i+1 < len(stack) && stack[i+1] == s.Body {
+				return s, s.Body
+			}
+		case *ast.RangeStmt:
+			if i+1 < len(stack) && stack[i+1] == s.Body {
+				return s, s.Body
+			}
+		}
+	}
+	return nil, nil
+}
+
+// hoistLease creates a suggested fix that moves the lease outside of the loop.
+// the fix is only possible if the lease call is a statement directly inside
+// the loop body and the function literal has no return statements other than
+// a final "return nil"
+func hoistLease(pass *analysis.Pass, lc leaseCall, loop ast.Stmt, body *ast.BlockStmt, stack []ast.Node) (analysis.SuggestedFix, bool) {
+	// find the statement in the loop body that contains the lease call
+	idx := -1
+	for i, s := range body.List {
+		switch s := s.(type) {
+		case *ast.ExprStmt:
+			if s.X == lc.call {
+				idx = i
+			}
+		case *ast.AssignStmt:
+			if len(s.Rhs) == 1 && s.Rhs[0] == lc.call {
+				if id, ok := s.Lhs[0].(*ast.Ident); ok && id.Name == "_" {
+					idx = i
+				}
+			}
+		}
+	}
+	if idx == -1 {
+		return analysis.SuggestedFix{}, false
+	}
+
+	// the lease body must end with "return nil" and have no other returns
+	list := lc.lit.Body.List
+	if len(list) == 0 || !isReturnNil(list[len(list)-1]) {
+		return analysis.SuggestedFix{}, false
+	}
+	var returns int
+	ast.Inspect(lc.lit.Body, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.FuncLit:
+			return n == lc.lit
+		case *ast.ReturnStmt:
+			returns++
+		}
+		return true
+	})
+	if returns != 1 {
+		return analysis.SuggestedFix{}, false
+	}
+
+	// new loop body with the lease call replaced by the body of the lease
+	var newList []ast.Stmt
+	newList = append(newList, body.List[:idx]...)
+	newList = append(newList, list[:len(list)-1]...)
+	newList = append(newList, body.List[idx+1:]...)
+
+	// the loop is printed with an empty body and the statements of the new
+	// body are printed separately. printing the statements as part of the loop
+	// would result in unwanted blank lines because the positions of the
+	// statements don't match their new location
+	var newLoop ast.Stmt
+	switch l := loop.(type) {
+	case *ast.ForStmt:
+		c := *l
+		c.Body = &ast.BlockStmt{}
+		newLoop = &c
+	case *ast.RangeStmt:
+		c := *l
+		c.Body = &ast.BlockStmt{}
+		newLoop = &c
+	}
+
+	var l, x bytes.Buffer
+	if printer.Fprint(&l, pass.Fset, newLoop) != nil || printer.Fprint(&x, pass.Fset, lc.recv) != nil {
+		return analysis.SuggestedFix{}, false
+	}
+	header := strings.TrimRight(strings.TrimSuffix(strings.TrimSpace(l.String()), "}"), " \n")
+
+	stmts := []string{header}
+	for _, s := range newList {
+		var b bytes.Buffer
+		if printer.Fprint(&b, pass.Fset, s) != nil {
+			return analysis.SuggestedFix{}, false
+		}
+		stmts = append(stmts, "\t"+strings.ReplaceAll(b.String(), "\n", "\n\t"))
+	}
+	stmts = append(stmts, "}")
+
+	indent := strings.Repeat("\t", pass.Fset.Position(loop.Pos()).Column-1)
+	text := strings.ReplaceAll(strings.Join(stmts, "\n"), "\n", "\n"+indent+"\t")
+
+	return analysis.SuggestedFix{
+		Message: "move Lease outside of the loop",
+		TextEdits: []analysis.TextEdit{{
+			Pos: loop.Pos(),
+			End: loop.End(),
+			NewText: []byte(fmt.Sprintf("_ = %s.%s(func() error {\n%s\t%s\n%s\treturn nil\n%s})",
+				x.String(), leaseFunction, indent, text, indent, indent)),
+		}},
+	}, true
+}
+
+// isReturnNil returns true if the statement is "return nil"
+func isReturnNil(s ast.Stmt) bool {
+	r, ok := s.(*ast.ReturnStmt)
+	if !ok || len(r.Results) != 1 {
+		return false
+	}
+	id, ok := r.Results[0].(*ast.Ident)
+	return ok && id.Name == "nil"
+}
@@ -0,0 +1,150 @@
+package analysis
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// the methods that are taken to acquire a lock when called on any type. this
+// includes sync.Mutex, sync.RWMutex, sync.Locker and semaphore.Weighted, as
+// well as the Acquire() methods of the crit package
+var lockMethods = map[string]bool{
+	"Lock":       true,
+	"RLock":      true,
+	"TryLock":    true,
+	"TryRLock":   true,
+	"Acquire":    true,
+	"RAcquire":   true,
+	"TryAcquire": true,
+}
+
+// checkLeaserImplementations reports lease methods declared outside of the
+// crit package that call the leased function without providing mutual
+// exclusion. this is most often a type written to implement crit.Leaser
+//
+// the analysis treats any method with the name of a lease method as a lease
+// function, so the function passed to it is assumed to be leased. a lease
+// method that only calls the function disables the checking of everything it
+// is used with
+//
+// the method provides mutual exclusion if it calls a lock method, calls a
+// lease method on something other than its own receiver, or sends or receives
+// on a channel. whether the lock is the right one is not checked
+//
+// the lease methods of a test double are not reported. a fake that calls the
+// function without locking is a normal thing to write in a test
+func checkLeaserImplementations(pass *analysis.Pass, rep *reporter, inspect *inspector.Inspector, tds testDoubles) {
+	if isCritPackage(pass.Pkg.Path()) {
+		return
+	}
+
+	inspect.Preorder([]ast.Node{(*ast.FuncDecl)(nil)}, func(n ast.Node) {
+		fd := n.(*ast.FuncDecl)
+		if fd.Recv == nil || fd.Body == nil {
+			return
+		}
+		if _, ok := lookupLeaseMethod(fd.Name.Name); !ok {
+			return
+		}
+
+		fn, ok := pass.TypesInfo.Defs[fd.Name].(*types.Func)
+		if !ok {
+			return
+		}
+		sig := fn.Type().(*types.Signature)
+		if sig.Params().Len() == 0 || tds.has(sig.Recv().Type()) {
+			return
+		}
+		f := sig.Params().At(sig.Params().Len() - 1)
+		if _, ok := f.Type().Underlying().(*types.Signature); !ok {
+			return
+		}
+
+		if !callsParameter(pass, fd.Body, f) || providesExclusion(pass, fd.Body, sig.Recv()) {
+			return
+		}
+
+		recv := types.Unalias(sig.Recv().Type())
+		if p, ok := recv.(*types.Pointer); ok {
+			recv = types.Unalias(p.Elem())
+		}
+		name := fd.Name.Name
+		if nt, ok := recv.(*types.Named); ok {
+			name = nt.Obj().Name() + "." + name
+		}
+
+		subj := subject{
+			typ:   typeName(sig.Recv().Type()),
+			field: fd.Name.Name,
+			fn:    name,
+		}
+		rep.reportDetail(fd.Name.Pos(), RuleLeaser, subj, name+"() calls "+f.Name()+"() without a lock")
+	})
+}
+
+// callsParameter returns true if the function parameter is called anywhere in
+// the block
+func callsParameter(pass *analysis.Pass, block *ast.BlockStmt, param *types.Var) bool {
+	var calls bool
+	ast.Inspect(block, func(nd ast.Node) bool {
+		if calls {
+			return false
+		}
+		if call, ok := nd.(*ast.CallExpr); ok {
+			if id, ok := ast.Unparen(call.Fun).(*ast.Ident); ok {
+				calls = pass.TypesInfo.Uses[id] == param
+			}
+		}
+		return !calls
+	})
+	return calls
+}
+
+// providesExclusion returns true if the block contains something that looks
+// like it provides mutual exclusion. see checkLeaserImplementations()
+func providesExclusion(pass *analysis.Pass, block *ast.BlockStmt, recv *types.Var) bool {
+	var excl bool
+	ast.Inspect(block, func(nd ast.Node) bool {
+		if excl {
+			return false
+		}
+		switch x := nd.(type) {
+		case *ast.SendStmt:
+			excl = true
+		case *ast.UnaryExpr:
+			excl = x.Op == token.ARROW
+		case *ast.CallExpr:
+			fn, ok := typeutil.Callee(pass.TypesInfo, x).(*types.Func)
+			if !ok {
+				return true
+			}
+			if lockMethods[fn.Name()] {
+				excl = true
+				break
+			}
+			if _, ok := isLeaseFunctionCall(pass, x); ok {
+				excl = true
+				break
+			}
+			if _, ok := lookupLeaseMethod(fn.Name()); !ok {
+				return true
+			}
+			// a lease method called on the receiver is a recursive call or
+			// another method of the same type, which doesn't provide the
+			// exclusion by itself
+			if sel, ok := ast.Unparen(x.Fun).(*ast.SelectorExpr); ok {
+				if id, ok := ast.Unparen(sel.X).(*ast.Ident); ok && pass.TypesInfo.Uses[id] == recv {
+					return true
+				}
+			}
+			excl = true
+		}
+		return !excl
+	})
+	return excl
+}
@@ -0,0 +1,71 @@
+package analysis
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// checkLeaseSize reports lease bodies that contain too many statements or that
+// call too many other functions. long critical sections block other goroutines
+// for longer than necessary
+func checkLeaseSize(pass *analysis.Pass, rep *reporter, inspect *inspector.Inspector) {
+	inspect.WithStack([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+
+		lc, ok := isLeaseCall(pass, n.(*ast.CallExpr))
+		if !ok || lc.lit == nil {
+			return true
+		}
+
+		statements := countStatements(lc.lit.Body)
+		calls := countCalls(pass, lc.lit.Body)
+		if statements <= leaseSizeStatements && calls <= leaseSizeCalls {
+			return true
+		}
+
+		rep.reportDetail(n.Pos(), RuleLeaseSize, subject{
+			typ:   typeName(pass.TypesInfo.TypeOf(lc.recv)),
+			field: leaseFunction,
+			fn:    functionName(stack),
+		}, fmt.Sprintf("%d statements, %d functions called", statements, calls))
+
+		return true
+	})
+}
+
+// countCalls returns the number of different functions called in the block.
+// calls to builtin functions and type conversions are not counted. calls that
+// cannot be resolved to a named function, such as calls to function values,
+// are each counted as a different function
+func countCalls(pass *analysis.Pass, block *ast.BlockStmt) int {
+	var n int
+	seen := make(map[types.Object]bool)
+	ast.Inspect(block, func(nd ast.Node) bool {
+		call, ok := nd.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		if tv, ok := pass.TypesInfo.Types[call.Fun]; ok && tv.IsType() {
+			return true
+		}
+		switch obj := typeutil.Callee(pass.TypesInfo, call).(type) {
+		case *types.Builtin:
+		case nil:
+			n++
+		default:
+			if !seen[obj] {
+				seen[obj] = true
+				n++
+			}
+		}
+		return true
+	})
+	return n
+}
@@ -0,0 +1,192 @@
+package analysis
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// localCopy is an assignment to a local variable of a function
+type localCopy struct {
+	pos token.Pos
+
+	// the expression assigned. nil if the value can't be traced to a single
+	// expression, for example the results of a call with more than one result
+	// or an assignment operator like +=
+	value ast.Expr
+
+	// the assignment is made in a function literal inside the function. this
+	// is usually the function passed to a lease function
+	lit bool
+}
+
+// localCopies records the assignments to the local variables of a function,
+// including its parameters and named results. it is a simple local dataflow
+// used to trace a value from where it is read to where it is used. for
+// example, after v = c.value the named result v is a copy of c.value
+//
+// the assignments are taken in source order rather than in the order they are
+// made, so the trace is only exact for code without loops. a variable that has
+// its address taken can be changed through the pointer and is not traced
+type localCopies map[*types.Var][]localCopy
+
+// findLocalCopies records the assignments to the local variables of the
+// function, which is a *ast.FuncDecl or a *ast.FuncLit
+func findLocalCopies(pass *analysis.Pass, fn ast.Node) localCopies {
+	var body *ast.BlockStmt
+	switch f := fn.(type) {
+	case *ast.FuncDecl:
+		body = f.Body
+	case *ast.FuncLit:
+		body = f.Body
+	}
+	lc := make(localCopies)
+	if body == nil {
+		return lc
+	}
+
+	local := func(e ast.Expr) *types.Var {
+		id, ok := ast.Unparen(e).(*ast.Ident)
+		if !ok {
+			return nil
+		}
+		v, ok := pass.TypesInfo.ObjectOf(id).(*types.Var)
+		if !ok || v.Pos() < fn.Pos() || v.Pos() >= fn.End() {
+			return nil
+		}
+		return v
+	}
+
+	addressed := make(map[*types.Var]bool)
+	var lits []*ast.FuncLit
+	record := func(lhs ast.Expr, rhs ast.Expr, pos token.Pos) {
+		if v := local(lhs); v != nil {
+			lc[v] = append(lc[v], localCopy{pos: pos, value: rhs, lit: len(lits) > 0})
+		}
+	}
+
+	ast.Inspect(body, func(n ast.Node) bool {
+		if n == nil {
+			return true
+		}
+		for len(lits) > 0 && n.Pos() >= lits[len(lits)-1].End() {
+			lits = lits[:len(lits)-1]
+		}
+		switch m := n.(type) {
+		case *ast.FuncLit:
+			lits = append(lits, m)
+		case *ast.AssignStmt:
+			if len(m.Lhs) != len(m.Rhs) || (m.Tok != token.ASSIGN && m.Tok != token.DEFINE) {
+				for _, lhs := range m.Lhs {
+					record(lhs, nil, m.Pos())
+				}
+				return true
+			}
+			for i := range m.Lhs {
+				record(m.Lhs[i], m.Rhs[i], m.Pos())
+			}
+		case *ast.IncDecStmt:
+			record(m.X, nil, m.Pos())
+		case *ast.ValueSpec:
+			for i, name := range m.Names {
+				if len(m.Names) == len(m.Values) {
+					record(name, m.Values[i], m.Pos())
+				} else {
+					record(name, nil, m.Pos())
+				}
+			}
+		case *ast.RangeStmt:
+			if m.Key != nil {
+				record(m.Key, nil, m.Pos())
+			}
+			if m.Value != nil {
+				record(m.Value, nil, m.Pos())
+			}
+		case *ast.UnaryExpr:
+			if m.Op == token.AND {
+				if v := local(m.X); v != nil {
+					addressed[v] = true
+				}
+			}
+		}
+		return true
+	})
+
+	for v := range addressed {
+		delete(lc, v)
+	}
+	return lc
+}
+
+// resolve follows the copies of the expression back to where the value was
+// first assigned, as it is at the position in the function. the expression can
+// be a local variable or, if the variable is a pointer, the variable
+// dereferenced. returns false if the expression isn't a copy that can be traced
+func (lc localCopies) resolve(pass *analysis.Pass, e ast.Expr, pos token.Pos) (localCopy, bool) {
+	e = ast.Unparen(e)
+	var deref bool
+	if s, ok := e.(*ast.StarExpr); ok {
+		deref = true
+		e = ast.Unparen(s.X)
+	}
+
+	for depth := 0; depth < maxAliasDepth; depth++ {
+		id, ok := e.(*ast.Ident)
+		if !ok {
+			return localCopy{}, false
+		}
+		v, ok := pass.TypesInfo.ObjectOf(id).(*types.Var)
+		if !ok {
+			return localCopy{}, false
+		}
+
+		// the last assignment before the position
+		var cp localCopy
+		for _, c := range lc[v] {
+			if c.pos >= pos {
+				break
+			}
+			cp = c
+		}
+		if cp.value == nil {
+			return localCopy{}, false
+		}
+
+		// a copy of another local variable is followed
+		e = ast.Unparen(cp.value)
+		if id, ok := e.(*ast.Ident); ok {
+			if v, ok := pass.TypesInfo.ObjectOf(id).(*types.Var); ok && len(lc[v]) > 0 {
+				pos = cp.pos
+				continue
+			}
+		}
+
+		if deref {
+			u, ok := e.(*ast.UnaryExpr)
+			if !ok || u.Op != token.AND {
+				return localCopy{}, false
+			}
+			cp.value = u.X
+		}
+		return cp, true
+	}
+	return localCopy{}, false
+}
+
+// returnedResults returns the expressions returned by the return statement. for
+// a return statement without results in a function with named results, the
+// names of the results are returned
+func returnedResults(ftype *ast.FuncType, rs *ast.ReturnStmt) []ast.Expr {
+	if len(rs.Results) > 0 || ftype.Results == nil {
+		return rs.Results
+	}
+	var res []ast.Expr
+	for _, f := range ftype.Results.List {
+		for _, name := range f.Names {
+			res = append(res, name)
+		}
+	}
+	return res
+}
@@ -0,0 +1,59 @@
+package analysis
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// the levels of the log flag
+const (
+	// nothing is logged
+	logOff = "off"
+
+	// the start and end of the analysis of each package, with the number of
+	// accesses and reports
+	logInfo = "info"
+
+	// the info events, the duration of each phase of the analysis, and the
+	// decision made for every access that is checked
+	logDebug = "debug"
+)
+
+// logLevel is the value of the log flag
+type logLevel string
+
+func (l *logLevel) String() string {
+	if *l == "" {
+		return logOff
+	}
+	return string(*l)
+}
+
+func (l *logLevel) Set(s string) error {
+	switch s {
+	case logOff, logInfo, logDebug:
+		*l = logLevel(s)
+		return nil
+	}
+	return fmt.Errorf("unknown log level %q. should be %s, %s or %s", s, logOff, logInfo, logDebug)
+}
+
+// newLogger returns a logger for the analysis of the package. the log is
+// written to stderr as text in the form used by log/slog, with one event per
+// line. every event includes the package path. events below the level of the log flag are
+// discarded without being formatted
+func newLogger(pkg string) *slog.Logger {
+	var level slog.Level
+	switch logEvents.String() {
+	case logInfo:
+		level = slog.LevelInfo
+	case logDebug:
+		level = slog.LevelDebug
+	default:
+		// higher than any level that is used
+		level = slog.LevelError + 1
+	}
+	h := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})
+	return slog.New(h).With("package", pkg)
+}
@@ -0,0 +1,115 @@
+package analysis
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// methods that are called by the standard library through an interface, often
+// using reflection. the packages that call them (fmt, encoding/json,
+// encoding/gob, database/sql, log/slog, etc.) do so from whatever goroutine
+// asked for the value to be formatted or serialised
+var interfaceMethods = map[string]string{
+	"String":          "fmt.Stringer",
+	"GoString":        "fmt.GoStringer",
+	"Format":          "fmt.Formatter",
+	"Error":           "error",
+	"MarshalJSON":     "json.Marshaler",
+	"UnmarshalJSON":   "json.Unmarshaler",
+	"MarshalText":     "encoding.TextMarshaler",
+	"UnmarshalText":   "encoding.TextUnmarshaler",
+	"MarshalBinary":   "encoding.BinaryMarshaler",
+	"UnmarshalBinary": "encoding.BinaryUnmarshaler",
+	"MarshalXML":      "xml.Marshaler",
+	"UnmarshalXML":    "xml.Unmarshaler",
+	"GobEncode":       "gob.GobEncoder",
+	"GobDecode":       "gob.GobDecoder",
+	"Value":           "driver.Valuer",
+	"Scan":            "sql.Scanner",
+	"LogValue":        "slog.LogValuer",
+}
+
+// checkInterfaceMethods reports methods of crit.Section derived types that
+// implement one of the interfaces used by the formatting and serialisation
+// packages but that access the fields of the type outside of a lease. the
+// packages call the methods from any goroutine and the callgraph usually can't
+// see the calls, so the main analysis doesn't find the accesses
+//
+// the check is lexical. a field accessed inside the function literal passed to
+// a lease function is leased. fields accessed in other functions called by the
+// method are not checked here
+func checkInterfaceMethods(pass *analysis.Pass, rep *reporter, inspect *inspector.Inspector, exempt ...map[*types.Var]bool) {
+	isExempt := func(f *types.Var) bool {
+		for _, m := range exempt {
+			if m[f] {
+				return true
+			}
+		}
+		return false
+	}
+
+	inspect.Preorder([]ast.Node{(*ast.FuncDecl)(nil)}, func(n ast.Node) {
+		fd := n.(*ast.FuncDecl)
+		if fd.Recv == nil || len(fd.Recv.List) == 0 || fd.Body == nil {
+			return
+		}
+		iface, ok := interfaceMethods[fd.Name.Name]
+		if !ok {
+			return
+		}
+		recv := pass.TypesInfo.TypeOf(fd.Recv.List[0].Type)
+		if !isCritDerived(recv) {
+			return
+		}
+
+		// the bodies of the leases in the method
+		var leases []*ast.FuncLit
+		ast.Inspect(fd.Body, func(nd ast.Node) bool {
+			if call, ok := nd.(*ast.CallExpr); ok {
+				if lc, ok := isCoveringCall(pass, call); ok && lc.lit != nil {
+					leases = append(leases, lc.lit)
+				}
+			}
+			return true
+		})
+		leased := func(sel *ast.SelectorExpr) bool {
+			for _, l := range leases {
+				if sel.Pos() >= l.Pos() && sel.End() <= l.End() {
+					return true
+				}
+			}
+			return false
+		}
+
+		// the first field accessed without the lease
+		var first *ast.SelectorExpr
+		ast.Inspect(fd.Body, func(nd ast.Node) bool {
+			sel, ok := nd.(*ast.SelectorExpr)
+			if !ok || first != nil {
+				return first == nil
+			}
+			if !isCritDerived(pass.TypesInfo.TypeOf(sel.X)) || isSectionMember(pass, sel) {
+				return true
+			}
+			f := selectedField(pass, sel)
+			if f == nil || isExempt(f) || leased(sel) {
+				return true
+			}
+			first = sel
+			return false
+		})
+		if first == nil {
+			return
+		}
+
+		rep.reportDetail(fd.Name.Pos(), RuleInterfaceMethod, subject{
+			typ:   typeName(recv),
+			field: fd.Name.Name,
+			fn:    fd.Name.Name,
+		}, fmt.Sprintf("%s implements %s and reads %s without the lease", fd.Name.Name, iface, types.ExprString(first)))
+	})
+}
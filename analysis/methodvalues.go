@@ -0,0 +1,156 @@
+package analysis
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/callgraph"
+)
+
+// methodValue is a method of a crit.Section derived type that is used as a
+// value rather than being called. for example, a bound method stored in a
+// table of handlers:
+//
+//	handlers["x"] = S.handleX
+//
+// or a method expression:
+//
+//	f := (*server).handleX
+//
+// the method is called later through the value. the callgraph follows the
+// value to the call so the accesses in the method are checked as normal, but
+// the call chain only shows the wrapper function created for the value. the
+// method value records where the value was created so that it can be added to
+// the reports
+type methodValue struct {
+	pos token.Pos
+
+	// the expression that creates the value and the function it is in
+	expr string
+	fn   string
+
+	// where the value is stored, if it is assigned to something
+	dest string
+
+	// the value is a method expression rather than a bound method
+	expression bool
+}
+
+// methodValues are the method values created in the package, by method, and
+// the selector expressions that create them
+type methodValues struct {
+	byMethod  map[*types.Func][]methodValue
+	selectors map[*ast.SelectorExpr]bool
+}
+
+// findMethodValues looks for methods of crit.Section derived types that are
+// used as values. bound methods with a value receiver are not included because
+// the receiver is copied when the value is created, which is an access
+func findMethodValues(pass *analysis.Pass, inspect *inspector.Inspector) methodValues {
+	mvs := methodValues{
+		byMethod:  make(map[*types.Func][]methodValue),
+		selectors: make(map[*ast.SelectorExpr]bool),
+	}
+
+	inspect.WithStack([]ast.Node{(*ast.SelectorExpr)(nil)}, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+		sel := n.(*ast.SelectorExpr)
+		s, ok := pass.TypesInfo.Selections[sel]
+		if !ok || (s.Kind() != types.MethodVal && s.Kind() != types.MethodExpr) {
+			return true
+		}
+		fn, ok := s.Obj().(*types.Func)
+		if !ok || !isCritDerived(s.Recv()) || isSectionMember(pass, sel) {
+			return true
+		}
+
+		// a method value that is called straight away is a method call
+		parent := ast.Node(nil)
+		if len(stack) > 1 {
+			parent = stack[len(stack)-2]
+		}
+		if call, ok := parent.(*ast.CallExpr); ok && ast.Unparen(call.Fun) == sel {
+			return true
+		}
+
+		if s.Kind() == types.MethodVal {
+			recv := fn.Type().(*types.Signature).Recv()
+			if _, ok := types.Unalias(recv.Type()).(*types.Pointer); !ok {
+				return true
+			}
+		}
+
+		mv := methodValue{
+			pos:        sel.Pos(),
+			expr:       types.ExprString(sel),
+			fn:         functionName(stack),
+			expression: s.Kind() == types.MethodExpr,
+		}
+		if as, ok := parent.(*ast.AssignStmt); ok && len(as.Lhs) == len(as.Rhs) {
+			for i, rhs := range as.Rhs {
+				if rhs == sel {
+					mv.dest = types.ExprString(as.Lhs[i])
+				}
+			}
+		}
+
+		mvs.byMethod[fn] = append(mvs.byMethod[fn], mv)
+		mvs.selectors[sel] = true
+		return true
+	})
+
+	return mvs
+}
+
+// related returns where the values of the method containing the access were
+// created, if the chain reaches the method through one of the wrapper functions
+// created for method values
+func (mvs methodValues) related(pass *analysis.Pass, nf ast.Node, chain []*callgraph.Edge) []analysis.RelatedInformation {
+	fd, ok := nf.(*ast.FuncDecl)
+	if !ok || len(chain) == 0 {
+		return nil
+	}
+	fn, ok := pass.TypesInfo.Defs[fd.Name].(*types.Func)
+	if !ok {
+		return nil
+	}
+	vals := mvs.byMethod[fn]
+	if len(vals) == 0 {
+		return nil
+	}
+
+	// the wrapper is the caller of the method in the first edge of the chain.
+	// bound methods have a wrapper named with the $bound suffix and method
+	// expressions have a wrapper named with the $thunk suffix
+	caller := chain[0].Caller.Func
+	if caller.Synthetic == "" {
+		return nil
+	}
+	var expression bool
+	switch caller.Name() {
+	case fn.Name() + "$bound":
+	case fn.Name() + "$thunk":
+		expression = true
+	default:
+		return nil
+	}
+
+	var related []analysis.RelatedInformation
+	for _, mv := range vals {
+		if mv.expression != expression {
+			continue
+		}
+		msg := fmt.Sprintf("%s used as a value by %s", mv.expr, mv.fn)
+		if mv.dest != "" {
+			msg = fmt.Sprintf("%s stored in %s by %s", mv.expr, mv.dest, mv.fn)
+		}
+		related = append(related, analysis.RelatedInformation{Pos: mv.pos, Message: msg})
+	}
+	return related
+}
@@ -0,0 +1,213 @@
+package analysis
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// Model describes the crit.Section derived types declared in the package, the
+// places where the package takes a lease, and the accesses of the fields of
+// crit.Section derived types that were checked. it is intended for tools that
+// want to show how the program uses its sections rather than for finding
+// problems
+type Model struct {
+	Sections []ModelSection
+	Leases   []ModelLease
+	Accesses []ModelAccess
+}
+
+// ModelSection is a crit.Section derived type declared in the package
+type ModelSection struct {
+	Pos  token.Pos
+	Name string
+
+	// the crit type that is embedded. one of Section, RWSection or
+	// ChanSection
+	Kind string
+
+	// the type is allowed more than one instance
+	Multi bool
+
+	Fields []ModelField
+}
+
+// the values for the Guard field of ModelField
+const (
+	GuardLease     = "lease"
+	GuardInitOnce  = "initonce"
+	GuardMutex     = "mutex"
+	GuardUnguarded = "unguarded"
+)
+
+// ModelField is a field of a crit.Section derived type. the embedded crit
+// type is not included
+type ModelField struct {
+	Pos  token.Pos
+	Name string
+	Type string
+
+	// what guards the field. GuardLease unless the field is exempt from the
+	// lease
+	Guard string
+}
+
+// ModelLease is a call to a lease method, including Acquire() and
+// RAcquire()
+type ModelLease struct {
+	Pos token.Pos
+
+	// the crit.Section derived type being leased. empty if the call is on a
+	// crit type directly
+	Section string
+
+	Method   string
+	Function string
+}
+
+// the values for the Status field of ModelAccess
+const (
+	AccessLeased      = "leased"
+	AccessUnleased    = "unleased"
+	AccessConditional = "conditional"
+
+	// the access is part of the setup of the section. either it is made
+	// before the section is started or, with the setup initphase policy,
+	// during package initialisation
+	AccessSetup = "setup"
+)
+
+// ModelAccess is an access of a field of a crit.Section derived type
+type ModelAccess struct {
+	Pos      token.Pos
+	Section  string
+	Field    string
+	Function string
+	Write    bool
+	Status   string
+}
+
+// findModel finds the sections declared in the package and the lease calls
+// made by it. the accesses are added by run() as they are checked
+func findModel(pass *analysis.Pass, inspect *inspector.Inspector, dirs *directives, initFields, guardedFields, unguardedFields map[*types.Var]bool) Model {
+	var m Model
+
+	inspect.Preorder([]ast.Node{(*ast.TypeSpec)(nil)}, func(n ast.Node) {
+		ts := n.(*ast.TypeSpec)
+		obj, ok := pass.TypesInfo.Defs[ts.Name].(*types.TypeName)
+		if !ok || !isCritDerived(obj.Type()) || !inScope(qualifiedName(obj)) {
+			return
+		}
+
+		sec := ModelSection{
+			Pos:   ts.Name.Pos(),
+			Name:  qualifiedName(obj),
+			Multi: dirs.multi[obj],
+		}
+
+		s := obj.Type().Underlying().(*types.Struct)
+		for i := 0; i < s.NumFields(); i++ {
+			f := s.Field(i)
+			if f.Embedded() && isCritSectionType(embeddedSection(f.Type())) {
+				sec.Kind = types.Unalias(embeddedSection(f.Type())).(*types.Named).Obj().Name()
+				continue
+			}
+
+			mf := ModelField{
+				Pos:   f.Pos(),
+				Name:  f.Name(),
+				Type:  types.TypeString(f.Type(), types.RelativeTo(pass.Pkg)),
+				Guard: GuardLease,
+			}
+			switch {
+			case isMutexType(f.Type()) || guardedFields[f]:
+				mf.Guard = GuardMutex
+			case initFields[f]:
+				mf.Guard = GuardInitOnce
+			case unguardedFields[f]:
+				mf.Guard = GuardUnguarded
+			}
+			sec.Fields = append(sec.Fields, mf)
+		}
+
+		m.Sections = append(m.Sections, sec)
+	})
+
+	inspect.WithStack([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+		call := n.(*ast.CallExpr)
+
+		// a lease function such as crit.Lease2() is a lease of every section
+		// it covers
+		if lc, ok := isLeaseFunctionCall(pass, call); ok {
+			name := typeutil.Callee(pass.TypesInfo, call).Name()
+			for _, recv := range lc.covered {
+				typ := typeName(pass.TypesInfo.TypeOf(recv))
+				if typ == "" || !inScope(typ) {
+					continue
+				}
+				m.Leases = append(m.Leases, ModelLease{
+					Pos:      call.Pos(),
+					Section:  typ,
+					Method:   name,
+					Function: functionName(stack),
+				})
+			}
+			return true
+		}
+
+		sel, ok := ast.Unparen(call.Fun).(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if _, ok := isLeaseCall(pass, call); !ok {
+			if _, ok := isAcquireCall(pass.TypesInfo, call); !ok {
+				return true
+			}
+		}
+
+		typ := typeName(pass.TypesInfo.TypeOf(sel.X))
+		if !inScope(typ) {
+			return true
+		}
+		m.Leases = append(m.Leases, ModelLease{
+			Pos:      call.Pos(),
+			Section:  typ,
+			Method:   sel.Sel.Name,
+			Function: functionName(stack),
+		})
+		return true
+	})
+
+	return m
+}
+
+// model adds an access to the model in the result. only accesses of fields are
+// added. calls to functions with the requires directive are not
+func (r *reporter) model(pos token.Pos, rule Rule, subj subject, stack []ast.Node, mutation string, status string) {
+	if rule.ID != RuleAccess.ID && rule.ID != RuleAssignment.ID {
+		return
+	}
+
+	// the value of a package level variable is initialised by the package
+	// initializer
+	fn := functionName(stack)
+	if fn == "" {
+		fn = "init"
+	}
+
+	r.result.Model.Accesses = append(r.result.Model.Accesses, ModelAccess{
+		Pos:      pos,
+		Section:  subj.typ,
+		Field:    subj.field,
+		Function: fn,
+		Write:    rule.ID == RuleAssignment.ID || mutation != "",
+		Status:   status,
+	})
+}
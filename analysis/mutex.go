@@ -0,0 +1,124 @@
+package analysis
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// isMutexType returns true if the type is sync.Mutex or sync.RWMutex, or a
+// pointer to either
+func isMutexType(t types.Type) bool {
+	t = types.Unalias(t)
+	if p, ok := t.(*types.Pointer); ok {
+		t = types.Unalias(p.Elem())
+	}
+	n, ok := t.(*types.Named)
+	if !ok || n.Obj().Pkg() == nil || n.Obj().Pkg().Path() != "sync" {
+		return false
+	}
+	return n.Obj().Name() == "Mutex" || n.Obj().Name() == "RWMutex"
+}
+
+// guardedBy returns the name of the mutex field named by the guardedby
+// directive for the field. the directive can be in the doc comment or in the
+// line comment of the field, or be given by the struct tag (see fieldPolicy)
+func guardedBy(f *ast.Field) (string, bool) {
+	p, ok := fieldPolicy(f)
+	if !ok {
+		return "", false
+	}
+	return strings.CutPrefix(p, policyGuardedBy+" ")
+}
+
+// checkMixedLocks reports crit.Section derived types that also contain a
+// sync.Mutex or sync.RWMutex field. a type is not reported if at least one of
+// its fields declares that it is guarded by the mutex
+//
+// the fields that are guarded by a mutex are returned, along with the mutex
+// fields themselves. these fields do not require the lease
+func checkMixedLocks(pass *analysis.Pass, rep *reporter, inspect *inspector.Inspector) map[*types.Var]bool {
+	guarded := make(map[*types.Var]bool)
+
+	inspect.Preorder([]ast.Node{(*ast.TypeSpec)(nil)}, func(n ast.Node) {
+		ts := n.(*ast.TypeSpec)
+		obj, ok := pass.TypesInfo.Defs[ts.Name].(*types.TypeName)
+		if !ok || !isCritDerived(obj.Type()) {
+			return
+		}
+		st, ok := ts.Type.(*ast.StructType)
+		if !ok {
+			return
+		}
+
+		// the mutex fields in the struct, by name
+		mutexes := make(map[string]*ast.Field)
+		for _, f := range st.Fields.List {
+			if !isMutexType(pass.TypesInfo.TypeOf(f.Type)) {
+				continue
+			}
+			if len(f.Names) == 0 {
+				mutexes[types.ExprString(f.Type)] = f
+				if sel, ok := f.Type.(*ast.SelectorExpr); ok {
+					mutexes[sel.Sel.Name] = f
+				}
+			}
+			for _, name := range f.Names {
+				mutexes[name.Name] = f
+			}
+		}
+
+		// the mutex fields themselves are safe to use without the lease
+		if s, ok := obj.Type().Underlying().(*types.Struct); ok {
+			for i := 0; i < s.NumFields(); i++ {
+				if isMutexType(s.Field(i).Type()) {
+					guarded[s.Field(i)] = true
+				}
+			}
+		}
+
+		// fields with the guardedby directive
+		var declared bool
+		for _, f := range st.Fields.List {
+			mu, ok := guardedBy(f)
+			if !ok {
+				continue
+			}
+			if _, ok := mutexes[mu]; !ok {
+				rep.reportDetail(f.Pos(), RuleMixedLocks, subject{
+					typ:   qualifiedName(obj),
+					field: mu,
+				}, fmt.Sprintf("%s is not a mutex field of %s", mu, obj.Name()))
+				continue
+			}
+			declared = true
+			for _, name := range f.Names {
+				if v, ok := pass.TypesInfo.Defs[name].(*types.Var); ok {
+					guarded[v] = true
+				}
+			}
+		}
+
+		if declared || len(mutexes) == 0 {
+			return
+		}
+
+		// report the first mutex field in declaration order
+		for _, f := range st.Fields.List {
+			if !isMutexType(pass.TypesInfo.TypeOf(f.Type)) {
+				continue
+			}
+			rep.reportDetail(f.Pos(), RuleMixedLocks, subject{
+				typ:   qualifiedName(obj),
+				field: types.ExprString(f.Type),
+			}, fmt.Sprintf("%s contains %s", obj.Name(), types.ExprString(f.Type)))
+			break
+		}
+	})
+
+	return guarded
+}
@@ -0,0 +1,178 @@
+package analysis
+
+import (
+	"fmt"
+	"go/token"
+	"sort"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/ssa"
+)
+
+// origin is the start of a goroutine that a function can be reached from.
+// this is either a go statement or a function with no callers, such as main()
+type origin struct {
+	pos token.Pos
+
+	// the name of the function containing the go statement, or the name of
+	// the function with no callers
+	fn string
+
+	// the origin is a go statement
+	goroutine bool
+}
+
+// origins finds the goroutines that a function can be reached from. the
+// result for each callgraph node is cached
+type origins struct {
+	graph   *callgraph.Graph
+	wrapped wrappedCalls
+	memo    map[*callgraph.Node][]origin
+}
+
+func newOrigins(graph *callgraph.Graph, wrapped wrappedCalls) *origins {
+	return &origins{
+		graph:   graph,
+		wrapped: wrapped,
+		memo:    make(map[*callgraph.Node][]origin),
+	}
+}
+
+// of returns the origins of all the callgraph nodes, sorted by position
+func (o *origins) of(nodes []*callgraph.Node) []origin {
+	var all []origin
+	seen := make(map[token.Pos]bool)
+	for _, n := range nodes {
+		for _, or := range o.node(n) {
+			if !seen[or.pos] {
+				seen[or.pos] = true
+				all = append(all, or)
+			}
+		}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].pos < all[j].pos
+	})
+	return all
+}
+
+// node walks the callers of the node until the start of a goroutine or a
+// function with no callers is found
+func (o *origins) node(n *callgraph.Node) []origin {
+	if r, ok := o.memo[n]; ok {
+		return r
+	}
+
+	var r []origin
+	visited := make(map[*callgraph.Node]bool)
+	queue := []*callgraph.Node{n}
+	for len(queue) > 0 {
+		m := queue[0]
+		queue = queue[1:]
+		if visited[m] {
+			continue
+		}
+		visited[m] = true
+
+		// functions passed to sync.Once.Do() and similar are called by the
+		// eventual callers of the wrapper
+		in := m.In
+		if w, ok := o.wrapped[m.Func]; ok {
+			in = w
+		}
+
+		if len(in) == 0 && m.Func != nil {
+			r = append(r, origin{pos: m.Func.Pos(), fn: m.Func.Name()})
+			continue
+		}
+
+		// the lease function calls every function literal passed to it, from
+		// wherever the lease is taken. a function literal that is only called
+		// by lease functions is reached from the function that contains it
+		if p := leasedBy(m); p != nil {
+			if pn := o.graph.Nodes[p]; pn != nil {
+				queue = append(queue, pn)
+				continue
+			}
+		}
+
+		for _, e := range in {
+			if isGoroutineStart(e) {
+				r = append(r, origin{pos: edgePos(e), fn: e.Caller.Func.Name(), goroutine: true})
+				continue
+			}
+			queue = append(queue, e.Caller)
+		}
+	}
+
+	o.memo[n] = r
+	return r
+}
+
+// leasedBy returns the function containing the function literal for the node
+// if the function literal is only called by lease functions. returns nil
+// otherwise
+func leasedBy(n *callgraph.Node) *ssa.Function {
+	if n.Func == nil || n.Func.Parent() == nil || len(n.In) == 0 {
+		return nil
+	}
+	for _, e := range n.In {
+		if !isLeaseFunction(e.Caller.Func.Name()) {
+			return nil
+		}
+	}
+	return n.Func.Parent()
+}
+
+// relatedOrigins returns the origins as related information for a diagnostic
+func relatedOrigins(origins []origin) []analysis.RelatedInformation {
+	var related []analysis.RelatedInformation
+	for _, or := range origins {
+		msg := fmt.Sprintf("reachable from %s", or.fn)
+		if or.goroutine {
+			msg = fmt.Sprintf("reachable from goroutine started in %s", or.fn)
+		}
+		related = append(related, analysis.RelatedInformation{
+			Pos:     or.pos,
+			Message: msg,
+		})
+	}
+	return related
+}
+
+// goroutines records the origins of the accesses to each crit.Section derived
+// type. the value for each origin is true if the origin is a go statement
+type goroutines map[string]map[token.Pos]bool
+
+// add the origins of an access to the type
+func (g goroutines) add(typ string, origins []origin) {
+	if g[typ] == nil {
+		g[typ] = make(map[token.Pos]bool)
+	}
+	for _, or := range origins {
+		g[typ][or.pos] = or.goroutine
+	}
+}
+
+// single returns true if every access to the type is reached from the same
+// function with no callers. a go statement is never a single origin because
+// it might be executed more than once
+func (g goroutines) single(typ string) bool {
+	if len(g[typ]) != 1 {
+		return false
+	}
+	for _, goroutine := range g[typ] {
+		return !goroutine
+	}
+	return false
+}
+
+// pendingReport is a report that cannot be made until every access has been
+// seen
+type pendingReport struct {
+	pos  token.Pos
+	rule Rule
+	subj subject
+	ex   extra
+}
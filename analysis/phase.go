@@ -0,0 +1,181 @@
+package analysis
+
+import (
+	"go/token"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/ssa"
+)
+
+// phases decides whether a function can run after a crit.Section derived type
+// has been started. a function that can only run before the section is started
+// is part of the setup of the section and does not need the lease
+type phases struct {
+	graph *callgraph.Graph
+
+	// functions reachable from a go statement or from a finalizer. these
+	// functions can run at the same time as any other function
+	concurrent map[*ssa.Function]bool
+
+	// functions reachable from a call made after Start() has been called, for
+	// each crit.Section derived type
+	after map[string]map[*ssa.Function]bool
+
+	// functions that can only run during package initialisation. only found
+	// if the initphase flag is set to setup
+	initOnly map[*ssa.Function]bool
+}
+
+func newPhases(fset *token.FileSet, graph *callgraph.Graph, starts startCalls, fins []*callgraph.Node) *phases {
+	ph := &phases{
+		graph:      graph,
+		concurrent: make(map[*ssa.Function]bool),
+		after:      make(map[string]map[*ssa.Function]bool),
+	}
+
+	// functions started by a go statement, finalizers, and everything they
+	// call
+	roots := append([]*callgraph.Node{}, fins...)
+	for _, n := range graph.Nodes {
+		for _, e := range n.Out {
+			if _, ok := e.Site.(*ssa.Go); ok {
+				roots = append(roots, e.Callee)
+			}
+		}
+	}
+	ph.reach(roots, ph.concurrent)
+
+	// the call instructions for Start(), for each type
+	sites := make(map[string][]ssa.CallInstruction)
+	for f := range graph.Nodes {
+		if f == nil {
+			continue
+		}
+		for _, b := range f.Blocks {
+			for _, instr := range b.Instrs {
+				c, ok := instr.(ssa.CallInstruction)
+				if !ok {
+					continue
+				}
+				if typ, ok := starts.sites[fset.Position(c.Pos())]; ok {
+					sites[typ] = append(sites[typ], c)
+				}
+			}
+		}
+	}
+
+	for typ, s := range sites {
+		ph.after[typ] = make(map[*ssa.Function]bool)
+		ph.reach(ph.callsAfter(s), ph.after[typ])
+	}
+
+	return ph
+}
+
+// reach adds the roots and every function reachable from them to the set
+func (ph *phases) reach(roots []*callgraph.Node, set map[*ssa.Function]bool) {
+	for len(roots) > 0 {
+		n := roots[0]
+		roots = roots[1:]
+		if n.Func == nil || set[n.Func] {
+			continue
+		}
+		set[n.Func] = true
+		for _, e := range n.Out {
+			roots = append(roots, e.Callee)
+		}
+	}
+}
+
+// callsAfter returns the callees of every call that can be made after one of
+// the call sites. this includes calls made after the function containing the
+// site returns to its caller
+func (ph *phases) callsAfter(sites []ssa.CallInstruction) []*callgraph.Node {
+	var callees []*callgraph.Node
+
+	seen := make(map[ssa.CallInstruction]bool)
+	for len(sites) > 0 {
+		site := sites[0]
+		sites = sites[1:]
+		if seen[site] {
+			continue
+		}
+		seen[site] = true
+
+		fn := site.Parent()
+		n, ok := ph.graph.Nodes[fn]
+		if !ok {
+			continue
+		}
+
+		// the calls that come after the site in the function
+		later := make(map[ssa.CallInstruction]bool)
+		for _, c := range instructionsAfter(site) {
+			later[c] = true
+		}
+		for _, e := range n.Out {
+			if later[e.Site] {
+				callees = append(callees, e.Callee)
+			}
+		}
+
+		// the function returns to its callers after the site. the calls
+		// made by the callers after that point are also after the site
+		for _, e := range n.In {
+			if e.Site != nil {
+				sites = append(sites, e.Site)
+			}
+		}
+	}
+
+	return callees
+}
+
+// instructionsAfter returns the call instructions that can be executed after
+// the instruction. the instruction itself is included if it is in a loop
+func instructionsAfter(instr ssa.Instruction) []ssa.CallInstruction {
+	var calls []ssa.CallInstruction
+	add := func(instrs []ssa.Instruction) {
+		for _, i := range instrs {
+			if c, ok := i.(ssa.CallInstruction); ok {
+				calls = append(calls, c)
+			}
+		}
+	}
+
+	// the rest of the block containing the instruction
+	b := instr.Block()
+	for i, in := range b.Instrs {
+		if in == instr {
+			add(b.Instrs[i+1:])
+			break
+		}
+	}
+
+	// every block reachable from the block containing the instruction
+	seen := make(map[*ssa.BasicBlock]bool)
+	queue := append([]*ssa.BasicBlock{}, b.Succs...)
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+		add(s.Instrs)
+		queue = append(queue, s.Succs...)
+	}
+
+	return calls
+}
+
+// running returns true if any of the callgraph nodes can run after the
+// crit.Section derived type has been started
+func (ph *phases) running(typ string, nodes []*callgraph.Node) bool {
+	for _, n := range nodes {
+		if ph.concurrent[n.Func] || ph.after[typ][n.Func] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package analysis
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// isPluginPackage returns true if the package is named by the plugins flag. a
+// name ending in /... matches the package and every package below it
+func isPluginPackage(path string) bool {
+	for _, p := range strings.Split(plugins, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if prefix, ok := strings.CutSuffix(p, "/..."); ok {
+			if path == prefix || strings.HasPrefix(path, prefix+"/") {
+				return true
+			}
+			continue
+		}
+		if path == p {
+			return true
+		}
+	}
+	return false
+}
+
+// isPluginEntry returns true if the function is an entry point of a plugin
+// package. the host binary finds the exported functions and variables of a
+// plugin with plugin.Lookup() and calls them from any goroutine. the
+// callgraph can't see the calls so the entry points are roots of the
+// callgraph in the same way as main()
+//
+// the entry points are the exported functions of the package, the function
+// literals in the values of exported variables, and the exported methods of
+// the types of exported variables, which the host calls through an interface
+func isPluginEntry(pass *analysis.Pass, nf ast.Node) bool {
+	if plugins == "" || pass.Pkg.Name() != "main" || !isPluginPackage(pass.Pkg.Path()) {
+		return false
+	}
+
+	switch f := nf.(type) {
+	case *ast.FuncDecl:
+		if !f.Name.IsExported() {
+			return false
+		}
+		if f.Recv == nil || len(f.Recv.List) == 0 {
+			return true
+		}
+		recv := pass.TypesInfo.TypeOf(f.Recv.List[0].Type)
+		return recv != nil && exportedVarOfType(pass, recv)
+
+	case *ast.FuncLit:
+		return inExportedValue(pass, f.Pos())
+	}
+
+	return false
+}
+
+// exportedVarOfType returns true if there is an exported package level
+// variable with the type, or with a pointer to the type, or with the type the
+// pointer points to
+func exportedVarOfType(pass *analysis.Pass, t types.Type) bool {
+	base := t
+	if p, ok := types.Unalias(t).(*types.Pointer); ok {
+		base = p.Elem()
+	}
+	scope := pass.Pkg.Scope()
+	for _, name := range scope.Names() {
+		v, ok := scope.Lookup(name).(*types.Var)
+		if !ok || !v.Exported() {
+			continue
+		}
+		vt := v.Type()
+		if p, ok := types.Unalias(vt).(*types.Pointer); ok {
+			vt = p.Elem()
+		}
+		if types.Identical(vt, base) {
+			return true
+		}
+	}
+	return false
+}
+
+// inExportedValue returns true if the position is inside the value of an
+// exported package level variable
+func inExportedValue(pass *analysis.Pass, pos token.Pos) bool {
+	for _, f := range pass.Files {
+		if pos < f.Pos() || pos > f.End() {
+			continue
+		}
+		for _, d := range f.Decls {
+			gd, ok := d.(*ast.GenDecl)
+			if !ok || gd.Tok != token.VAR || pos < gd.Pos() || pos > gd.End() {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				vs := spec.(*ast.ValueSpec)
+				for i, v := range vs.Values {
+					if pos < v.Pos() || pos > v.End() {
+						continue
+					}
+					// a single value can initialise more than one name
+					if len(vs.Names) != len(vs.Values) {
+						for _, n := range vs.Names {
+							if n.IsExported() {
+								return true
+							}
+						}
+						return false
+					}
+					return vs.Names[i].IsExported()
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package analysis
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// the packages with functions that format or serialise their arguments using
+// reflection, and the functions that are used instead of reflection if the
+// argument has them
+var printPackages = map[string][]string{
+	"fmt":           {"String", "Error"},
+	"log":           {"String", "Error"},
+	"encoding/json": {"MarshalJSON", "MarshalText"},
+}
+
+// the functions of the encoding/json package that serialise their first
+// argument
+var jsonFunctions = map[string]bool{
+	"Marshal":       true,
+	"MarshalIndent": true,
+	"Encode":        true,
+}
+
+// checkPrint reports crit.Section derived instances passed to the print
+// functions of the fmt and log packages, and to the functions of the
+// encoding/json package that serialise a value. an instance passed by value is
+// copied, and the fields are read without the lease unless the type has a
+// suitable function (String() for fmt, MarshalJSON() for encoding/json). an
+// instance passed by pointer is only reported if the type has no suitable
+// function
+//
+// a crit.Section derived type normally has the String() function promoted
+// from the embedded section, so passing a pointer to fmt is safe. functions
+// generated by critgen take the lease and are also safe
+func checkPrint(pass *analysis.Pass, rep *reporter, inspect *inspector.Inspector) {
+	inspect.WithStack([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+		call := n.(*ast.CallExpr)
+
+		fn, ok := typeutil.Callee(pass.TypesInfo, call).(*types.Func)
+		if !ok || fn.Pkg() == nil {
+			return true
+		}
+		methods, ok := printPackages[fn.Pkg().Path()]
+		if !ok {
+			return true
+		}
+
+		var args []ast.Expr
+		if fn.Pkg().Path() == "encoding/json" {
+			if !jsonFunctions[fn.Name()] || len(call.Args) == 0 {
+				return true
+			}
+			args = call.Args[:1]
+		} else {
+			// only the arguments passed to the variadic parameter are
+			// formatted
+			sig := fn.Type().(*types.Signature)
+			if !sig.Variadic() || call.Ellipsis.IsValid() {
+				return true
+			}
+			args = call.Args[sig.Params().Len()-1:]
+		}
+
+		for _, arg := range args {
+			t := pass.TypesInfo.TypeOf(arg)
+			id, ok := critDerived(t)
+			if !ok {
+				continue
+			}
+
+			subj := subject{
+				typ: qualifiedName(id),
+				fn:  functionName(stack),
+			}
+
+			if _, ok := types.Unalias(t).(*types.Pointer); !ok {
+				rep.reportDetail(arg.Pos(), RulePrint, subj,
+					fmt.Sprintf("%s is copied by %s", types.ExprString(arg), fn.Name()))
+				continue
+			}
+
+			if !hasMethod(t, methods) {
+				rep.reportDetail(arg.Pos(), RulePrint, subj,
+					fmt.Sprintf("the fields of %s are read by %s", types.ExprString(arg), fn.Name()))
+			}
+		}
+
+		return true
+	})
+}
+
+// hasMethod returns true if the method set of the type includes any of the
+// named functions
+func hasMethod(t types.Type, names []string) bool {
+	ms := types.NewMethodSet(t)
+	for _, name := range names {
+		if ms.Lookup(nil, name) != nil {
+			return true
+		}
+	}
+	return false
+}
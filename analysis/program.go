@@ -0,0 +1,308 @@
+package analysis
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/callgraph/cha"
+	"golang.org/x/tools/go/callgraph/vta"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// Program loads the whole program containing the package and builds its
+// callgraph. building the callgraph is the most expensive part of the analysis
+// and the result is cached for the life of the process. a driver that analyses
+// the same package more than once, such as gopls, or that analyses a package
+// and its external test package, only builds the program once
+var Program = &analysis.Analyzer{
+	Name:       "CritProgram",
+	Doc:        "build the callgraph of the program containing the package",
+	Run:        runProgram,
+	ResultType: reflect.TypeOf((*program)(nil)),
+}
+
+// program is the result of the Program analyzer. it is shared between passes
+// and must not be changed once it has been built
+type program struct {
+	initial []*packages.Package
+	graph   *callgraph.Graph
+
+	// how long each phase of building the program took. empty if the program
+	// was taken from the cache
+	phases []phase
+}
+
+// the number of programs that are kept in the cache. the oldest program is
+// removed when a new one is added to a full cache
+const maxCachedPrograms = 4
+
+// programKey identifies a program in the cache. the positions in a program are
+// only meaningful with the file set it was loaded with, so the file set is part
+// of the key
+type programKey struct {
+	fset     *token.FileSet
+	patterns string
+	config   string
+
+	// the forks of the crit package change which functions are kept when the
+	// graph is pruned
+	critModules string
+}
+
+// cachedProgram is an entry in the cache. the program is ready once the ready
+// channel is closed
+type cachedProgram struct {
+	key   programKey
+	ready chan struct{}
+	prog  *program
+	err   error
+
+	// the size and modification time of every file in the program when it
+	// was loaded. the program is built again if any of them change
+	stamps map[string]fileStamp
+}
+
+// fileStamp is the size and modification time of a file
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// the cache of programs for the process
+var programs struct {
+	sync.Mutex
+	entries []*cachedProgram
+}
+
+func runProgram(pass *analysis.Pass) (any, error) {
+	key := programKey{
+		fset:   pass.Fset,
+		config: configKey(LoadConfig),
+
+		critModules: critModules,
+	}
+
+	// the program loaded from the patterns given to the driver is shared by
+	// every package in it. a package that isn't in it, or a pass run by a
+	// driver that doesn't set the patterns, loads the program from its own
+	// package
+	//
+	// the program isn't shared if the patterns include more than one main
+	// package. the binaries are separate processes and the call paths of one
+	// must not be mixed with the call paths of another
+	if len(ProgramPatterns) > 0 {
+		key.patterns = strings.Join(ProgramPatterns, " ")
+		prog, err := cachedBuild(pass, key, ProgramPatterns)
+		if err == nil && prog.mains() <= 1 && prog.contains(pass.Pkg.Path()) {
+			return prog, nil
+		}
+	}
+	patterns := loadPatterns(pass)
+	key.patterns = strings.Join(patterns, " ")
+	return cachedBuild(pass, key, patterns)
+}
+
+// cachedBuild returns the program for the key from the cache, or builds it from
+// the patterns. the lookup and the insertion are made with the cache locked so
+// that passes running at the same time build each program only once. a pass
+// that finds a program that is still being built waits for it
+func cachedBuild(pass *analysis.Pass, key programKey, patterns []string) (*program, error) {
+	programs.Lock()
+	var e *cachedProgram
+	for i, c := range programs.entries {
+		if c.key == key {
+			e = c
+			programs.entries = append(programs.entries[:i], programs.entries[i+1:]...)
+			break
+		}
+	}
+
+	// a program that is in the cache is used if none of its files have changed
+	// since it was loaded. the program is built again otherwise. a program
+	// that is still being built is waited for
+	if e != nil {
+		select {
+		case <-e.ready:
+			if e.stamps == nil || !e.fresh(pass) {
+				e = nil
+			}
+		default:
+		}
+	}
+
+	if e != nil {
+		programs.entries = append(programs.entries, e)
+		programs.Unlock()
+		<-e.ready
+		if e.err != nil {
+			return nil, e.err
+		}
+		newLogger(pass.Pkg.Path()).Debug("program taken from the cache", "patterns", key.patterns)
+		return &program{initial: e.prog.initial, graph: e.prog.graph}, nil
+	}
+
+	e = &cachedProgram{key: key, ready: make(chan struct{})}
+	if len(programs.entries) >= maxCachedPrograms {
+		programs.entries = programs.entries[1:]
+	}
+	programs.entries = append(programs.entries, e)
+	programs.Unlock()
+
+	// a program that can't be built because of errors in its packages is kept
+	// until the files change, so that it isn't built again for every pass. a
+	// program that can't be loaded is not kept
+	e.prog, e.err = buildProgram(pass, patterns)
+	if e.prog != nil {
+		e.stamps = stampFiles(e.prog.initial)
+	}
+	close(e.ready)
+
+	if e.err != nil {
+		return nil, e.err
+	}
+	return e.prog, nil
+}
+
+// contains returns true if the package is one of the packages in the program
+func (p *program) contains(path string) bool {
+	var found bool
+	packages.Visit(p.initial, func(q *packages.Package) bool {
+		found = found || q.PkgPath == path
+		return !found
+	}, nil)
+	return found
+}
+
+// mains returns the number of main packages loaded from the patterns
+func (p *program) mains() int {
+	var n int
+	for _, q := range p.initial {
+		if q.Name == "main" {
+			n++
+		}
+	}
+	return n
+}
+
+// buildProgram loads the program containing the package and builds its
+// callgraph
+func buildProgram(pass *analysis.Pass, patterns []string) (*program, error) {
+	var tm timings
+	lg := newLogger(pass.Pkg.Path())
+	tm.log = lg
+
+	pcfg := LoadConfig
+	pcfg.Mode = packages.LoadAllSyntax | packages.NeedModule
+	pcfg.Fset = pass.Fset
+	done := tm.start("loading")
+	initial, err := packages.Load(&pcfg, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	done()
+
+	// the program can't be built if a package in it has type errors. the
+	// error is returned so that the driver can carry on with other packages
+	if bad := illTyped(initial); len(bad) > 0 {
+		return &program{initial: initial}, fmt.Errorf("cannot build the program: packages with errors: %s", strings.Join(bad, ", "))
+	}
+
+	// create VTA graph. the construct of the graph is important for the
+	// checkLease() function, particularly the recursive status() function
+	done = tm.start("ssa")
+	prog, _ := ssautil.AllPackages(initial, ssa.InstantiateGenerics)
+	prog.Build()
+	funcs := ssautil.AllFunctions(prog)
+	done()
+
+	done = tm.start("vta")
+	graph := vta.CallGraph(funcs, cha.CallGraph(prog))
+	done()
+
+	// every query on the graph is made on the part of the graph that can
+	// affect the analysis. the part that is kept doesn't depend on the package
+	// being analysed so the pruned graph can be shared
+	done = tm.start("prune")
+	before, after := pruneGraph(graph)
+	lg.Debug("callgraph pruned", "nodes", before, "kept", after)
+	done()
+
+	return &program{initial: initial, graph: graph, phases: tm.phases}, nil
+}
+
+// configKey returns a string that identifies the parts of the load
+// configuration that change the program that is loaded
+func configKey(cfg packages.Config) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%t\x00%q\x00%q\x00", cfg.Dir, cfg.Tests, cfg.Env, cfg.BuildFlags)
+
+	var names []string
+	for name := range cfg.Overlay {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(h, "%s\x00%s\x00", name, cfg.Overlay[name])
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// stampFiles returns the stamps of every file in the packages and the packages
+// they import. the directories containing the files are included so that
+// files that are added or removed are noticed
+//
+// the packages of the standard library are not in a module and are left out.
+// they are most of the files of a program and only change when Go is updated,
+// which also changes the go command that loaded them
+func stampFiles(pkgs []*packages.Package) map[string]fileStamp {
+	stamps := make(map[string]fileStamp)
+	packages.Visit(pkgs, nil, func(p *packages.Package) {
+		if p.Module == nil && p.PkgPath != "command-line-arguments" {
+			return
+		}
+		for _, f := range p.CompiledGoFiles {
+			stamps[f] = stampFile(f)
+			if d := filepath.Dir(f); stamps[d] == (fileStamp{}) {
+				stamps[d] = stampFile(d)
+			}
+		}
+	})
+	return stamps
+}
+
+// stampFile returns the stamp of the file or directory. the stamp of a file
+// that can't be read is the zero value
+func stampFile(filename string) fileStamp {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{size: fi.Size(), modTime: fi.ModTime()}
+}
+
+// fresh returns true if none of the files in the cached program have changed
+func (c *cachedProgram) fresh(pass *analysis.Pass) bool {
+	start := time.Now()
+	defer func() {
+		newLogger(pass.Pkg.Path()).Debug("program files checked", "files", len(c.stamps), "duration", time.Since(start))
+	}()
+	for f, s := range c.stamps {
+		if stampFile(f) != s {
+			return false
+		}
+	}
+	return true
+}
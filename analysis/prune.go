@@ -0,0 +1,126 @@
+package analysis
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/ssa"
+)
+
+// pruneGraph removes the functions that can't affect the analysis from the
+// callgraph. the callgraph of a large program is mostly functions that have
+// nothing to do with crit.Section, and every query on the graph is slower for
+// them. returns the number of nodes before and after pruning
+//
+// a function is kept if it uses a value of a crit type, if it has the requires
+// directive, or if it can call one of those functions, directly or
+// indirectly. the lease check follows callers from the function containing an
+// access to a lease function or to a function with no callers, and every
+// function on the way is kept. the callers of a function that is kept are
+// always kept too, so a function that has no callers in the pruned graph had
+// no callers before pruning
+func pruneGraph(graph *callgraph.Graph) (int, int) {
+	before := len(graph.Nodes)
+
+	keep := make(map[*callgraph.Node]bool)
+	var queue []*callgraph.Node
+	for f, n := range graph.Nodes {
+		if f == nil {
+			continue
+		}
+		if usesCritTypes(f) || hasRequiresDirective(f) {
+			keep[n] = true
+			queue = append(queue, n)
+		}
+	}
+
+	// the callers of every function that is kept
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, e := range n.In {
+			if !keep[e.Caller] {
+				keep[e.Caller] = true
+				queue = append(queue, e.Caller)
+			}
+		}
+	}
+
+	// the root node has no function and is never removed
+	if graph.Root != nil {
+		keep[graph.Root] = true
+	}
+
+	for f, n := range graph.Nodes {
+		if !keep[n] {
+			delete(graph.Nodes, f)
+			continue
+		}
+		out := n.Out[:0]
+		for _, e := range n.Out {
+			if keep[e.Callee] {
+				out = append(out, e)
+			}
+		}
+		n.Out = out
+	}
+
+	return before, len(graph.Nodes)
+}
+
+// usesCritTypes returns true if the function has a parameter, a free
+// variable, or an instruction that uses a value whose type is a crit type, a
+// crit.Section derived type, or a pointer to either
+func usesCritTypes(f *ssa.Function) bool {
+	for _, p := range f.Params {
+		if isCritRelevant(p.Type()) {
+			return true
+		}
+	}
+	for _, fv := range f.FreeVars {
+		if isCritRelevant(fv.Type()) {
+			return true
+		}
+	}
+
+	var ops []*ssa.Value
+	for _, b := range f.Blocks {
+		for _, instr := range b.Instrs {
+			if v, ok := instr.(ssa.Value); ok && isCritRelevant(v.Type()) {
+				return true
+			}
+			ops = instr.Operands(ops[:0])
+			for _, op := range ops {
+				if *op != nil && isCritRelevant((*op).Type()) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// isCritRelevant returns true if the type is a crit type or a crit.Section
+// derived type. pointers to pointers are followed, so that the address of a
+// variable holding a pointer to a section is included
+func isCritRelevant(t types.Type) bool {
+	for {
+		if isCritDerived(t) || isCritSectionType(t) || isInstrumentedType(t) {
+			return true
+		}
+		p, ok := types.Unalias(t).(*types.Pointer)
+		if !ok {
+			return false
+		}
+		t = p.Elem()
+	}
+}
+
+// hasRequiresDirective returns true if the function was declared with the
+// requires directive. calls to the function are checked in the same way as
+// accesses so the callers of the function must be kept
+func hasRequiresDirective(f *ssa.Function) bool {
+	fd, ok := f.Syntax().(*ast.FuncDecl)
+	return ok && requiresLease(fd)
+}
@@ -0,0 +1,175 @@
+package analysis
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// checkPublish reports crit.Section derived instances, or references to their
+// fields, that are stored in package-level variables. once a reference has
+// been stored in a global it can be used from anywhere without the lease
+func checkPublish(pass *analysis.Pass, rep *reporter, inspect *inspector.Inspector) {
+	nodes := []ast.Node{
+		(*ast.AssignStmt)(nil),
+		(*ast.ValueSpec)(nil),
+	}
+
+	inspect.WithStack(nodes, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+
+		var lhs, rhs []ast.Expr
+		switch m := n.(type) {
+		case *ast.AssignStmt:
+			if len(m.Lhs) != len(m.Rhs) {
+				return true
+			}
+			lhs, rhs = m.Lhs, m.Rhs
+		case *ast.ValueSpec:
+			if len(m.Names) != len(m.Values) {
+				return true
+			}
+			for _, name := range m.Names {
+				lhs = append(lhs, name)
+			}
+			rhs = m.Values
+		}
+
+		for i := range lhs {
+			global, ok := packageVar(pass, lhs[i])
+			if !ok {
+				continue
+			}
+
+			subj, ok := published(pass, rhs[i])
+			if !ok {
+				continue
+			}
+			subj.fn = functionName(stack)
+
+			rep.reportDetail(rhs[i].Pos(), RulePublish, subj,
+				fmt.Sprintf("%s stored in %s", types.ExprString(rhs[i]), global.Name()))
+		}
+
+		return true
+	})
+}
+
+// packageVar returns the package-level variable for the expression. returns
+// false if the expression is not a package-level variable, which can be in
+// the current package or in another package
+func packageVar(pass *analysis.Pass, e ast.Expr) (*types.Var, bool) {
+	var id *ast.Ident
+	switch x := e.(type) {
+	case *ast.Ident:
+		id = x
+	case *ast.SelectorExpr:
+		if _, ok := pass.TypesInfo.Selections[x]; ok {
+			return nil, false
+		}
+		id = x.Sel
+	default:
+		return nil, false
+	}
+
+	v, ok := pass.TypesInfo.ObjectOf(id).(*types.Var)
+	if !ok || v.Pkg() == nil || v.Parent() != v.Pkg().Scope() {
+		return nil, false
+	}
+	return v, true
+}
+
+// published returns the subject if the expression is a reference to a
+// crit.Section derived instance or to one of its fields. a reference is the
+// address of the instance or field, or a field with a type that shares its
+// storage when copied (a slice, map or pointer)
+func published(pass *analysis.Pass, e ast.Expr) (subject, bool) {
+	e = unwrapExpr(pass, e)
+
+	var addr bool
+	if u, ok := e.(*ast.UnaryExpr); ok && u.Op.String() == "&" {
+		addr = true
+		e = unwrapExpr(pass, u.X)
+	}
+
+	// the address of the instance itself. a pointer to the instance copied
+	// from another pointer is tracked as an alias and is not reported
+	if addr {
+		if id, ok := critDerived(pass.TypesInfo.TypeOf(e)); ok {
+			if _, ok := types.Unalias(pass.TypesInfo.TypeOf(e)).(*types.Pointer); !ok {
+				return subject{typ: qualifiedName(id)}, true
+			}
+		}
+	}
+
+	// a slice of a field shares the storage of the field
+	if sl, ok := e.(*ast.SliceExpr); ok {
+		addr = true
+		e = sl.X
+	}
+
+	// the address of an element of a field, or of a field of a field, is
+	// also a reference to the field. for example, &C.buf[0] or &C.pos.x
+	if addr {
+		e = fieldRoot(pass, e)
+	}
+
+	sel, ok := e.(*ast.SelectorExpr)
+	if !ok || !isCritDerived(pass.TypesInfo.TypeOf(sel.X)) {
+		return subject{}, false
+	}
+	if s, ok := pass.TypesInfo.Selections[sel]; !ok || s.Kind() != types.FieldVal {
+		return subject{}, false
+	}
+
+	subj := subject{
+		typ:   typeName(pass.TypesInfo.TypeOf(sel.X)),
+		field: sel.Sel.Name,
+	}
+	if addr {
+		return subj, true
+	}
+
+	switch pass.TypesInfo.TypeOf(sel).Underlying().(type) {
+	case *types.Slice, *types.Map, *types.Pointer:
+		return subj, true
+	}
+
+	return subject{}, false
+}
+
+// fieldRoot removes index expressions and field selectors from the expression
+// until it is a field of a crit.Section derived type. the expression is
+// returned unchanged if there is no such field. map elements are not
+// addressable and are not removed
+func fieldRoot(pass *analysis.Pass, e ast.Expr) ast.Expr {
+	r := e
+	for {
+		switch x := r.(type) {
+		case *ast.ParenExpr:
+			r = x.X
+			continue
+		case *ast.IndexExpr:
+			switch pass.TypesInfo.TypeOf(x.X).Underlying().(type) {
+			case *types.Array, *types.Slice:
+				r = x.X
+				continue
+			}
+			return e
+		case *ast.SelectorExpr:
+			if isCritDerived(pass.TypesInfo.TypeOf(x.X)) {
+				return x
+			}
+			if s, ok := pass.TypesInfo.Selections[x]; ok && s.Kind() == types.FieldVal {
+				r = x.X
+				continue
+			}
+		}
+		return e
+	}
+}
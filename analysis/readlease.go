@@ -0,0 +1,250 @@
+package analysis
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// isRWDerived returns true if the type is a crit.Section derived type that
+// embeds crit.RWSection, or a pointer to one
+func isRWDerived(t types.Type) bool {
+	obj, ok := critDerived(t)
+	if !ok {
+		return false
+	}
+	s := obj.Type().Underlying().(*types.Struct)
+	for i := 0; i < s.NumFields(); i++ {
+		f := s.Field(i)
+		if !f.Embedded() {
+			continue
+		}
+		if n, ok := types.Unalias(embeddedSection(f.Type())).(*types.Named); ok && n.Obj().Name() == critRWType && isCritSectionType(n) {
+			return true
+		}
+	}
+	return false
+}
+
+// guardedRoot returns true if the expression is a field of a crit.Section
+// derived type, or an element or field of one. for example, C.values[0]
+func guardedRoot(pass *analysis.Pass, e ast.Expr) bool {
+	for {
+		switch x := e.(type) {
+		case *ast.ParenExpr:
+			e = x.X
+		case *ast.StarExpr:
+			e = x.X
+		case *ast.IndexExpr:
+			e = x.X
+		case *ast.SelectorExpr:
+			if _, ok := sectionField(pass, x); ok {
+				return true
+			}
+			e = x.X
+		default:
+			return false
+		}
+	}
+}
+
+// fieldMutation returns a description of the change if the field selected by
+// the expression at the top of the stack is changed without being assigned to.
+// for example, writing to an element of a map or slice field, deleting from a
+// map field, or appending to a slice field. the empty string is returned if the
+// field is not changed or if it is assigned to
+//
+// appending to a slice writes to the backing array of the slice if it has the
+// capacity, even though the field itself is unchanged
+func fieldMutation(pass *analysis.Pass, sel *ast.SelectorExpr, stack []ast.Node) string {
+	field := types.ExprString(sel)
+
+	// the element or field of the field that is being used
+	var child ast.Node = sel
+	i := len(stack) - 2
+climb:
+	for ; i >= 0; i-- {
+		switch p := stack[i].(type) {
+		case *ast.ParenExpr:
+		case *ast.IndexExpr:
+			if p.X != child {
+				return ""
+			}
+		case *ast.StarExpr:
+			if p.X != child {
+				return ""
+			}
+		case *ast.SelectorExpr:
+			if s, ok := pass.TypesInfo.Selections[p]; !ok || s.Kind() != types.FieldVal || p.X != child {
+				return ""
+			}
+		default:
+			break climb
+		}
+		child = stack[i]
+	}
+	if i < 0 {
+		return ""
+	}
+
+	elem := child != ast.Node(sel)
+	kind := "an element of"
+	if _, ok := pass.TypesInfo.TypeOf(sel).Underlying().(*types.Map); ok {
+		kind = "the map"
+	}
+
+	switch p := stack[i].(type) {
+	case *ast.AssignStmt:
+		if !elem || p.Tok == token.DEFINE {
+			return ""
+		}
+		for _, lhs := range p.Lhs {
+			if lhs == child {
+				return "write to " + kind + " " + field
+			}
+		}
+	case *ast.IncDecStmt:
+		if elem && p.X == child {
+			return "write to " + kind + " " + field
+		}
+	case *ast.RangeStmt:
+		if elem && p.Tok == token.ASSIGN && (p.Key == child || p.Value == child) {
+			return "write to " + kind + " " + field
+		}
+	case *ast.CallExpr:
+		fn, ok := typeutil.Callee(pass.TypesInfo, p).(*types.Builtin)
+		if !ok || len(p.Args) == 0 || p.Args[0] != child {
+			return ""
+		}
+		switch fn.Name() {
+		case "delete":
+			return "delete from " + types.ExprString(child.(ast.Expr))
+		case "clear":
+			return "clear of " + types.ExprString(child.(ast.Expr))
+		case "copy":
+			return "copy into " + types.ExprString(child.(ast.Expr))
+		case "append":
+			return "append to " + types.ExprString(child.(ast.Expr)) + ", which can write to its backing array"
+		}
+	}
+	return ""
+}
+
+// leaseWrites returns true if the block might write to a field of a
+// crit.Section derived type. calls to functions in the same package, and calls
+// to function values, are assumed to write because the analysis does not follow
+// them
+func leaseWrites(pass *analysis.Pass, block *ast.BlockStmt) bool {
+	var writes bool
+	ast.Inspect(block, func(nd ast.Node) bool {
+		if writes {
+			return false
+		}
+		switch m := nd.(type) {
+		case *ast.AssignStmt:
+			if m.Tok != token.DEFINE {
+				for _, lhs := range m.Lhs {
+					writes = writes || guardedRoot(pass, lhs)
+				}
+			}
+		case *ast.IncDecStmt:
+			writes = guardedRoot(pass, m.X)
+		case *ast.UnaryExpr:
+			writes = m.Op == token.AND && guardedRoot(pass, m.X)
+		case *ast.CallExpr:
+			writes = callWrites(pass, m)
+		}
+		return !writes
+	})
+	return writes
+}
+
+// callWrites returns true if the call might write to a field of a
+// crit.Section derived type
+func callWrites(pass *analysis.Pass, call *ast.CallExpr) bool {
+	if tv, ok := pass.TypesInfo.Types[call.Fun]; ok && tv.IsType() {
+		return false
+	}
+
+	switch fn := typeutil.Callee(pass.TypesInfo, call).(type) {
+	case *types.Builtin:
+		switch fn.Name() {
+		case "delete", "clear", "copy", "append":
+			return len(call.Args) > 0 && guardedRoot(pass, call.Args[0])
+		}
+		return false
+
+	case *types.Func:
+		if fn.Pkg() == pass.Pkg {
+			return true
+		}
+
+		// a method with a pointer receiver called on a field
+		sig := fn.Type().(*types.Signature)
+		if sel, ok := call.Fun.(*ast.SelectorExpr); ok && sig.Recv() != nil {
+			if _, ok := sig.Recv().Type().(*types.Pointer); ok && guardedRoot(pass, sel.X) {
+				return true
+			}
+		}
+
+		// a field that shares its storage passed to a function in another
+		// package
+		for _, a := range call.Args {
+			if !guardedRoot(pass, a) {
+				continue
+			}
+			switch pass.TypesInfo.TypeOf(a).Underlying().(type) {
+			case *types.Pointer, *types.Map, *types.Slice:
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// checkReadOnlyLeases reports calls to Lease() for crit.RWSection derived
+// types where the lease body does not write to any field. the read lease can
+// be used instead, which allows other readers to hold the lease at the same
+// time. the suggested fix changes the call to the read variant of the lease
+// method. for example, RLease() instead of Lease()
+func checkReadOnlyLeases(pass *analysis.Pass, rep *reporter, inspect *inspector.Inspector) {
+	inspect.WithStack([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+
+		lc, ok := isLeaseCall(pass, n.(*ast.CallExpr))
+		if !ok || lc.lit == nil {
+			return true
+		}
+		sel := lc.call.Fun.(*ast.SelectorExpr)
+		rlease := lc.method.readVariant
+		if rlease == "" || !isRWDerived(pass.TypesInfo.TypeOf(lc.recv)) {
+			return true
+		}
+		if leaseWrites(pass, lc.lit.Body) {
+			return true
+		}
+
+		rep.report(n.Pos(), RuleReadOnlyLease, subject{
+			typ:   typeName(pass.TypesInfo.TypeOf(lc.recv)),
+			field: sel.Sel.Name,
+			fn:    functionName(stack),
+		}, analysis.SuggestedFix{
+			Message: "use " + rlease,
+			TextEdits: []analysis.TextEdit{{
+				Pos:     sel.Sel.Pos(),
+				End:     sel.Sel.End(),
+				NewText: []byte(rlease),
+			}},
+		})
+
+		return true
+	})
+}
@@ -0,0 +1,188 @@
+package analysis
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// the names of the crit.ChanSection functions that hand out and take back the
+// token
+const (
+	acquireCFunction = "AcquireC"
+	releaseFunction  = "Release"
+)
+
+// isReleaseType returns true if the type is crit.Release
+func isReleaseType(t types.Type) bool {
+	n, ok := types.Unalias(t).(*types.Named)
+	if !ok || n.Obj().Pkg() == nil {
+		return false
+	}
+	return n.Obj().Name() == "Release" && isCritPackage(n.Obj().Pkg().Path())
+}
+
+// isLocalVar returns true if the expression is a variable declared inside a
+// function or is the blank identifier
+func isLocalVar(pass *analysis.Pass, e ast.Expr) bool {
+	id, ok := ast.Unparen(e).(*ast.Ident)
+	if !ok {
+		return false
+	}
+	if id.Name == "_" {
+		return true
+	}
+	v, ok := pass.TypesInfo.ObjectOf(id).(*types.Var)
+	return ok && v.Pkg() != nil && v.Parent() != v.Pkg().Scope()
+}
+
+// tokenSection returns the expression for the section if the expression
+// receives a token from the channel returned by AcquireC(). for example,
+// <-C.AcquireC()
+func tokenSection(pass *analysis.Pass, e ast.Expr) (ast.Expr, bool) {
+	u, ok := ast.Unparen(e).(*ast.UnaryExpr)
+	if !ok || u.Op != token.ARROW {
+		return nil, false
+	}
+	call, ok := ast.Unparen(u.X).(*ast.CallExpr)
+	if !ok {
+		return nil, false
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != acquireCFunction || !isCritDerived(pass.TypesInfo.TypeOf(sel.X)) {
+		return nil, false
+	}
+	return sel.X, true
+}
+
+// checkReleaseMisuse reports the ways that a lease acquired without a function
+// literal can be given back wrongly:
+//
+//   - a crit.Release that might already have been called is called again
+//   - a crit.Release is stored somewhere that outlives the function, where it
+//     can't be followed by the analysis
+//   - a crit.ChanSection token is given back to a different section to the
+//     one it was received from
+func checkReleaseMisuse(pass *analysis.Pass, rep *reporter, inspect *inspector.Inspector, ar *acquireRegions) {
+	// tokens received from AcquireC() and the section they were received
+	// from
+	tokens := make(map[types.Object]string)
+
+	inspect.WithStack([]ast.Node{
+		(*ast.FuncDecl)(nil),
+		(*ast.FuncLit)(nil),
+		(*ast.AssignStmt)(nil),
+		(*ast.SendStmt)(nil),
+		(*ast.CallExpr)(nil),
+	}, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+
+		switch x := n.(type) {
+		case *ast.FuncDecl, *ast.FuncLit:
+			rf := ar.flow(pass.TypesInfo, n)
+			if rf == nil {
+				return true
+			}
+			for _, id := range rf.releasedTwice() {
+				var typ string
+				if a, ok := rf.byRelease[pass.TypesInfo.Uses[id]]; ok {
+					typ = acquiredSection(pass, a.call)
+				}
+				rep.reportDetail(id.Pos(), RuleReleaseMisuse, subject{
+					typ:   typ,
+					field: id.Name,
+					fn:    functionName(stack),
+				}, "might already have been released")
+			}
+
+		case *ast.AssignStmt:
+			for i, rhs := range x.Rhs {
+				if len(x.Lhs) != len(x.Rhs) {
+					break
+				}
+				if sec, ok := tokenSection(pass, rhs); ok {
+					if obj := pass.TypesInfo.ObjectOf(identOf(x.Lhs[i])); obj != nil {
+						tokens[obj] = types.ExprString(sec)
+					}
+					continue
+				}
+				if storesRelease(pass, rhs) && !isLocalVar(pass, x.Lhs[i]) {
+					rep.reportDetail(x.Lhs[i].Pos(), RuleReleaseMisuse, subject{
+						typ:   acquiredSection(pass, rhs),
+						field: types.ExprString(x.Lhs[i]),
+						fn:    functionName(stack),
+					}, "stored in "+types.ExprString(x.Lhs[i]))
+				}
+			}
+
+		case *ast.SendStmt:
+			if storesRelease(pass, x.Value) {
+				rep.reportDetail(x.Value.Pos(), RuleReleaseMisuse, subject{
+					typ:   acquiredSection(pass, x.Value),
+					field: types.ExprString(x.Chan),
+					fn:    functionName(stack),
+				}, "sent on "+types.ExprString(x.Chan))
+			}
+
+		case *ast.CallExpr:
+			sel, ok := x.Fun.(*ast.SelectorExpr)
+			if !ok || sel.Sel.Name != releaseFunction || len(x.Args) != 1 {
+				return true
+			}
+			if !isCritDerived(pass.TypesInfo.TypeOf(sel.X)) {
+				return true
+			}
+			from, ok := tokens[pass.TypesInfo.ObjectOf(identOf(x.Args[0]))]
+			if !ok || from == types.ExprString(sel.X) {
+				return true
+			}
+			rep.reportDetail(x.Pos(), RuleReleaseMisuse, subject{
+				typ: typeName(pass.TypesInfo.TypeOf(sel.X)),
+				fn:  functionName(stack),
+			}, "token from "+from+" released to "+types.ExprString(sel.X))
+		}
+
+		return true
+	})
+}
+
+// storesRelease returns true if the value being stored is a crit.Release or is
+// a call to append() with a crit.Release argument
+func storesRelease(pass *analysis.Pass, e ast.Expr) bool {
+	if isReleaseType(pass.TypesInfo.TypeOf(e)) {
+		return true
+	}
+	call, ok := ast.Unparen(e).(*ast.CallExpr)
+	if !ok || !isBuiltin(pass, call, "append") {
+		return false
+	}
+	for _, a := range call.Args[1:] {
+		if isReleaseType(pass.TypesInfo.TypeOf(a)) {
+			return true
+		}
+	}
+	return false
+}
+
+// acquiredSection returns the name of the crit.Section derived type if the
+// expression is a call to one of the acquire methods. the empty string is
+// returned otherwise
+func acquiredSection(pass *analysis.Pass, e ast.Expr) string {
+	call, ok := ast.Unparen(e).(*ast.CallExpr)
+	if !ok {
+		return ""
+	}
+	if _, ok := isAcquireCall(pass.TypesInfo, call); !ok {
+		return ""
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return ""
+	}
+	return typeName(pass.TypesInfo.TypeOf(sel.X))
+}
@@ -0,0 +1,294 @@
+package analysis
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// Finding is additional information about a diagnostic reported by the
+// CritSection analyzer
+type Finding struct {
+	Pos      token.Pos
+	Rule     string
+	Severity Severity
+
+	// the fingerprint identifies the diagnostic without reference to its
+	// position in the source. it will remain the same if the code containing
+	// the violation is moved, making it suitable for baselines and
+	// suppression lists
+	Fingerprint string
+
+	// the root cause of an unleased access. accesses with the same cause are
+	// fixed by the same lease. nil if the report is not for an unleased access
+	Cause *Cause
+}
+
+// Cause is the outermost call on the unleased call chain leading to an
+// access. if the function containing the access has no callers then the cause
+// is the function itself
+type Cause struct {
+	Pos     token.Pos
+	Message string
+}
+
+// Result is the result of the CritSection analyzer
+type Result struct {
+	Findings []Finding
+
+	// the number of accesses of crit.Section derived types that were checked,
+	// and the number of those that are leased on every call path
+	Accesses int
+	Leased   int
+
+	// the sections, leases and accesses found in the package
+	Model Model
+
+	// how long each phase of the analysis took
+	Timings []Timing
+}
+
+// Timing is the duration of one phase of the analysis
+type Timing struct {
+	Phase    string
+	Duration time.Duration
+}
+
+// Finding returns the finding for the diagnostic reported at the position for
+// the rule. returns false if there is no such diagnostic
+func (r *Result) Finding(pos token.Pos, rule string) (Finding, bool) {
+	for _, f := range r.Findings {
+		if f.Pos == pos && f.Rule == rule {
+			return f, true
+		}
+	}
+	return Finding{}, false
+}
+
+// subject describes what a diagnostic is about. it is used to create the
+// fingerprint for the diagnostic
+type subject struct {
+	// the crit.Section derived type
+	typ string
+
+	// the field, method or function involved
+	field string
+
+	// the normalised name of the enclosing function
+	fn string
+
+	// the crit type embedded by the type, such as crit.RWSection. it is used
+	// in place of crit.Section in the message and is not part of the
+	// fingerprint
+	section string
+}
+
+// reporter reports diagnostics and records the findings for the result of
+// the analysis
+type reporter struct {
+	pass   *analysis.Pass
+	cfg    Config
+	result *Result
+
+	// the number of times each fingerprint has been seen. used to
+	// distinguish identical subjects in the same function
+	seen map[string]int
+
+	// reports in these ranges are not made
+	ignores ignores
+
+	// the diagnostics are held back until flush() so that they can be
+	// reported in a deterministic order
+	diags []analysis.Diagnostic
+}
+
+func newReporter(pass *analysis.Pass, cfg Config) *reporter {
+	return &reporter{
+		pass:   pass,
+		cfg:    cfg,
+		result: &Result{},
+		seen:   make(map[string]int),
+	}
+}
+
+// report a violation of the rule at the specified position. the rule ID is
+// added to the end of the message so that it can be used with the critcheck
+// explain command. any suggested fixes are attached to the diagnostic
+//
+// rules with a severity of off are not reported, and neither are reports
+// suppressed by an ignore directive or reports about a type that is not
+// selected with the section flag
+func (r *reporter) report(pos token.Pos, rule Rule, subj subject, fixes ...analysis.SuggestedFix) {
+	r.reportDetail(pos, rule, subj, "", fixes...)
+}
+
+// reportDetail is the same as report() but with additional detail added to
+// the message. the detail should not be used for information that is already
+// part of the subject
+func (r *reporter) reportDetail(pos token.Pos, rule Rule, subj subject, detail string, fixes ...analysis.SuggestedFix) {
+	r.reportExtra(pos, rule, subj, extra{detail: detail, fixes: fixes})
+}
+
+// extra is the optional information that can be attached to a report
+type extra struct {
+	// added to the message in brackets
+	detail string
+
+	// related positions. for example, the call chains leading to the
+	// violation
+	related []analysis.RelatedInformation
+
+	fixes []analysis.SuggestedFix
+
+	// the root cause of an unleased access
+	cause *Cause
+}
+
+// reportExtra is the most general form of report(). it returns false if the
+// report was not made
+func (r *reporter) reportExtra(pos token.Pos, rule Rule, subj subject, ex extra) bool {
+	severity := r.cfg.Severity(rule)
+	if severity == SeverityOff {
+		return false
+	}
+	if !inScope(subj.typ) {
+		return false
+	}
+	if r.ignores.suppressed(r.pass.Fset.Position(pos), rule.ID) {
+		return false
+	}
+
+	msg := rule.Message
+	if ex.detail != "" {
+		msg = fmt.Sprintf("%s (%s)", msg, ex.detail)
+	}
+	if subj.section != "" {
+		msg = strings.ReplaceAll(msg, "crit.Section", subj.section)
+	}
+
+	r.diags = append(r.diags, analysis.Diagnostic{
+		Pos:            pos,
+		Category:       rule.ID,
+		Message:        fmt.Sprintf("%s [%s]", msg, rule.ID),
+		SuggestedFixes: ex.fixes,
+		Related:        ex.related,
+	})
+
+	r.result.Findings = append(r.result.Findings, Finding{
+		Pos:         pos,
+		Rule:        rule.ID,
+		Severity:    severity,
+		Fingerprint: r.fingerprint(rule, subj),
+		Cause:       ex.cause,
+	})
+
+	return true
+}
+
+// flush reports the diagnostics that have been held back, sorted by position
+// and then by rule. the order the reports are made in depends on the order of
+// map iteration and of the callgraph, and sorting them makes the output the
+// same from run to run
+func (r *reporter) flush() {
+	sortDiagnostics(r.pass.Fset, r.diags)
+	for _, d := range r.diags {
+		r.pass.Report(d)
+	}
+	r.diags = nil
+}
+
+// sortDiagnostics sorts the diagnostics by file, line, column, rule ID and
+// message
+func sortDiagnostics(fset *token.FileSet, diags []analysis.Diagnostic) {
+	sort.SliceStable(diags, func(i, j int) bool {
+		a, b := fset.Position(diags[i].Pos), fset.Position(diags[j].Pos)
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+		if diags[i].Category != diags[j].Category {
+			return diags[i].Category < diags[j].Category
+		}
+		return diags[i].Message < diags[j].Message
+	})
+}
+
+// fingerprint is a hash of the package path, the rule and the subject. the
+// number of times the same combination has been seen is also included
+func (r *reporter) fingerprint(rule Rule, subj subject) string {
+	s := strings.Join([]string{r.pass.Pkg.Path(), rule.ID, subj.typ, subj.field, subj.fn}, "|")
+	n := r.seen[s]
+	r.seen[s]++
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s|%d", s, n)))
+	return hex.EncodeToString(h[:8])
+}
+
+// typeName returns the qualified name of the crit.Section derived type or the
+// empty string if the type is not a crit.Section derived type
+func typeName(t types.Type) string {
+	if obj, ok := critDerived(t); ok {
+		return qualifiedName(obj)
+	}
+	return ""
+}
+
+// qualifiedName returns the name of the object qualified by its package path
+func qualifiedName(obj types.Object) string {
+	if obj.Pkg() == nil {
+		return obj.Name()
+	}
+	return fmt.Sprintf("%s.%s", obj.Pkg().Path(), obj.Name())
+}
+
+// functionName returns a normalised name for the function enclosing the top of
+// the stack. the name does not depend on the position of the function. methods
+// are named with the receiver type and function literals are named after the
+// function declaration that contains them
+func functionName(stack []ast.Node) string {
+	var name string
+	var lit bool
+	for _, n := range stack {
+		switch f := n.(type) {
+		case *ast.FuncDecl:
+			name = f.Name.Name
+			if f.Recv != nil && len(f.Recv.List) > 0 {
+				name = fmt.Sprintf("%s.%s", receiverName(f.Recv.List[0].Type), name)
+			}
+		case *ast.FuncLit:
+			lit = true
+		}
+	}
+	if lit {
+		name = fmt.Sprintf("%s$func", name)
+	}
+	return name
+}
+
+// receiverName returns the name of the receiver type without any pointer or
+// type parameters
+func receiverName(e ast.Expr) string {
+	switch r := e.(type) {
+	case *ast.StarExpr:
+		return receiverName(r.X)
+	case *ast.IndexExpr:
+		return receiverName(r.X)
+	case *ast.IndexListExpr:
+		return receiverName(r.X)
+	case *ast.Ident:
+		return r.Name
+	}
+	return ""
+}
@@ -0,0 +1,1206 @@
+package analysis
+
+import (
+	"strings"
+)
+
+// Rule describes one of the checks made by the CritSection analyzer. every
+// diagnostic reported by the analyzer is associated with a rule and the rule
+// ID is used as the diagnostic category
+type Rule struct {
+	// short identifier for the rule. for example, CS001
+	ID string
+
+	// the name of the rule in lower case words separated by hyphens. for
+	// example, multiple-instance. the name is for tools that prefer a
+	// descriptive identifier to the ID
+	Name string
+
+	// the message used in the diagnostic
+	Message string
+
+	// the default severity of the rule. this can be changed by the
+	// configuration file
+	Severity Severity
+
+	// longer form descriptions of the rule. used by the critcheck explain
+	// command
+	Description    string
+	Rationale      string
+	FalsePositives string
+	Remediation    string
+}
+
+// list of rules known to the analyzer
+var (
+	RuleAccess = Rule{
+		ID:       "CS001",
+		Name:     "access",
+		Message:  "access of crit.Section without Lease",
+		Severity: SeverityError,
+		Description: `A field of a crit.Section derived type has been read from a function
+that is not called, directly or indirectly, from the function passed to Lease().`,
+		Rationale: `The crit.Section embedded in the type exists to say that the other
+fields of the type are shared between goroutines. Reading a field without
+holding the lease means that the value read might be in the process of being
+changed by another goroutine.`,
+		FalsePositives: `The analysis uses a callgraph to decide whether an access is protected
+by a lease. If the function containing the access is called through an
+interface or a function value that the callgraph cannot resolve, the access
+may be reported even though it is leased at runtime.
+
+Accesses that happen before any goroutines have been started (for example,
+setting up the type in main) will also be reported.`,
+		Remediation: `Wrap the access in a call to Lease():
+
+	_ = C.Lease(func() error {
+		v = C.value
+		return nil
+	})
+
+Or move the access into an accessor function that is only ever called from
+inside a lease.
+
+If the containing function is only ever called by code that holds the lease,
+but the analysis cannot see that, annotate the function with the requires
+directive. Calls to the function will then be checked instead (see CS005).
+
+	//critsec:requires
+	func update() {
+		C.value = 10
+	}`,
+	}
+
+	RuleAssignment = Rule{
+		ID:       "CS002",
+		Name:     "assignment",
+		Message:  "assignment to crit.Section without Lease",
+		Severity: SeverityError,
+		Description: `A field of a crit.Section derived type has been assigned to from a
+function that is not called, directly or indirectly, from the function passed
+to Lease().`,
+		Rationale: `Writing to a shared field without holding the lease is a data race.
+Other goroutines reading or writing the same field may see a partially updated
+value or may have their own writes lost.`,
+		FalsePositives: `As with CS001, calls through interfaces or function values that the
+callgraph cannot resolve can cause a protected assignment to be reported.`,
+		Remediation: `Wrap the assignment in a call to Lease():
+
+	_ = C.Lease(func() error {
+		C.value = 10
+		return nil
+	})
+
+If several fields are assigned to one after the other, put them all inside the
+same lease so that other goroutines never see a partial update.`,
+	}
+
+	RuleParameter = Rule{
+		ID:       "CS003",
+		Name:     "parameter",
+		Message:  "crit.Section types cannot be passed to a function",
+		Severity: SeverityError,
+		Description: `A function accepts a crit.Section derived type (or a pointer to one) as a
+parameter.`,
+		Rationale: `The analysis matches accesses to leases by the type of the critical
+section. Allowing the section to be passed around would mean that an access
+inside the function could refer to any instance of the type, which the
+analysis cannot currently reason about.`,
+		FalsePositives: `Functions that are never called are not reported. A function that is
+only reached through code that the callgraph cannot see may be missed rather
+than wrongly reported.`,
+		Remediation: `Access the section directly from the function that declares it, or
+move the work into a method on the crit.Section derived type that takes the
+lease itself.`,
+	}
+
+	RuleMultipleInstance = Rule{
+		ID:       "CS004",
+		Name:     "multiple-instance",
+		Message:  "multiple instance of a crit.Section derived type",
+		Severity: SeverityError,
+		Description: `More than one instance of the same crit.Section derived type has been
+created. An instance is created by declaring a variable of the type, with a
+composite literal (including the address of a composite literal) or with
+new().
+
+Taking a pointer to an existing instance does not create a new instance.`,
+		Rationale: `Leases are matched to accesses by type. With more than one instance of
+the type, a lease on one instance would appear to protect accesses to the
+other.`,
+		FalsePositives: `Declarations in functions that are never called are not reported.`,
+		Remediation: `Declare a single instance of the type and share it, or declare a new
+crit.Section derived type for each independent piece of shared state.`,
+	}
+
+	RuleRequiresCall = Rule{
+		ID:       "CS005",
+		Name:     "requires-call",
+		Message:  "call to function that requires Lease without Lease",
+		Severity: SeverityError,
+		Description: `A function annotated with the //critsec:requires directive has been
+called from a function that is not called, directly or indirectly, from the
+function passed to Lease().`,
+		Rationale: `Accesses inside a function annotated with //critsec:requires are not
+checked because the annotation promises that the function is only ever called
+while the lease is held. Calling the function without the lease breaks that
+promise and every access inside the function becomes a potential data race.`,
+		FalsePositives: `As with CS001, calls through interfaces or function values that the
+callgraph cannot resolve can cause a protected call to be reported.
+
+Only functions declared in the package being analysed are checked.`,
+		Remediation: `Call the function from inside a lease:
+
+	_ = C.Lease(func() error {
+		update()
+		return nil
+	})
+
+Or annotate the calling function with //critsec:requires so that the
+requirement is passed on to its callers.`,
+	}
+
+	RuleLeaseInLoop = Rule{
+		ID:       "CS006",
+		Name:     "lease-in-loop",
+		Message:  "Lease called inside a loop with a small lease body",
+		Severity: SeverityWarning,
+		Description: `Lease() is called on every iteration of a loop and the function passed
+to Lease() is small. A loop made with a backward goto is also a loop, but the
+report has no suggested fix in that case.`,
+		Rationale: `Acquiring the lease has a cost and acquiring it on every iteration of a
+loop multiplies that cost. When the work done inside the lease is small, the
+cost of acquiring the lease dominates. Leasing once for the whole loop is
+usually faster.
+
+Note that leasing for the whole loop means that other goroutines are blocked
+for longer. If the loop runs for a long time it might be better to keep the
+lease inside the loop.`,
+		FalsePositives: `A lease inside a loop is sometimes deliberate, so that other goroutines
+have the opportunity to acquire the lease between iterations. In that case the
+severity of the rule can be lowered in the configuration file.`,
+		Remediation: `Move the call to Lease() outside of the loop:
+
+	_ = C.Lease(func() error {
+		for i := 0; i < 1000; i++ {
+			C.value++
+		}
+		return nil
+	})
+
+The size of a lease body that is considered small is set with the
+-leaseloop.max flag.`,
+	}
+
+	RuleLeaseSize = Rule{
+		ID:       "CS007",
+		Name:     "lease-size",
+		Message:  "lease body is too large",
+		Severity: SeverityOff,
+		Description: `The function passed to Lease() contains more statements, or calls more
+functions, than the configured limits. The measured size is included in the
+report.
+
+This rule is off by default. Enable it by setting a severity for CS007 in the
+configuration file.`,
+		Rationale: `Other goroutines are blocked for as long as the lease is held. Short
+critical sections that do the minimum amount of work are easier to reason about
+and reduce contention. Calling other functions while holding the lease also
+makes it harder to see what the lease is protecting.`,
+		FalsePositives: `Some critical sections are necessarily large. Statements inside nested
+function literals are not counted but calls to the function literals are.`,
+		Remediation: `Move work that does not touch the fields of the crit.Section derived type
+outside of the lease. For example, prepare values before taking the lease and
+process results after the lease has been released.
+
+The limits are set with the -leasesize.statements and -leasesize.calls flags.`,
+	}
+
+	RuleConditional = Rule{
+		ID:       "CS008",
+		Name:     "conditional",
+		Message:  "crit.Section is leased on some call paths but not others",
+		Severity: SeverityWarning,
+		Description: `An access, assignment or call that would otherwise be reported by CS001,
+CS002 or CS005 is protected by a lease on some of the call paths leading to it
+but not on others. The rule that would have been reported is included in the
+report.
+
+The report includes one call chain that is leased and one call chain that is
+not leased. Both chains start at the function containing the violation.`,
+		Rationale: `A function that is sometimes called with the lease held and sometimes
+without is usually a mistake in one of the callers rather than in the function
+itself. Reporting the two chains side by side shows where the callers differ.`,
+		FalsePositives: `The unprotected chain may pass through a function that is only ever
+called before any goroutines have been started. The callgraph cannot tell that
+such a path is safe.`,
+		Remediation: `Follow the unprotected chain and add a lease at the appropriate point.
+If every caller of the function should hold the lease, annotate the function
+with //critsec:requires so that the callers are checked instead (see CS005).`,
+	}
+
+	RuleWrongLease = Rule{
+		ID:       "CS009",
+		Name:     "wrong-lease",
+		Message:  "crit.Section accessed inside the Lease of a different instance",
+		Severity: SeverityError,
+		Description: `A field of a crit.Section derived type has been accessed inside the
+function passed to the Lease() of a different instance. The instances are told
+apart by the variable and the fields used to reach them, so two fields of the
+same struct are different instances even if they have the same type.
+
+	_ = s.stateA.Lease(func() error {
+		s.stateB.value = 10
+		return nil
+	})`,
+		Rationale: `Each crit.Section protects only the fields of the type that embeds it.
+Holding the lease of one instance does nothing to protect the fields of another
+instance, even when the two instances have the same type.`,
+		FalsePositives: `Pointers to an instance are followed if the pointer is only ever
+assigned from one expression (for example, p := &C). Accesses through a
+pointer that could point to more than one instance are not checked.
+
+Only accesses made directly inside the function literal are checked. Accesses
+in functions called from the lease are not.`,
+		Remediation: `Lease the instance that is being accessed:
+
+	_ = s.stateB.Lease(func() error {
+		s.stateB.value = 10
+		return nil
+	})
+
+Leases can be nested if both instances need to be accessed together. Take
+care to always nest the leases in the same order.
+
+Accesses to a sub-section (created with crit.Section.Sub()) inside the lease
+of its parent are not reported, because leasing the parent implies the lease
+of the sub-section. The sub-section must be reached through a field of the
+parent for this to be recognised.`,
+	}
+
+	RulePublish = Rule{
+		ID:       "CS010",
+		Name:     "publish",
+		Message:  "reference to crit.Section stored in package-level variable",
+		Severity: SeverityError,
+		Description: `The address of a crit.Section derived instance, the address of one of its
+fields, or a field that shares its storage when copied (a slice, map or
+pointer), has been stored in a package-level variable.`,
+		Rationale: `A package-level variable can be used from anywhere in the program. Any
+access through the variable bypasses the relationship between the
+crit.Section and the fields it protects, so the analysis can no longer tell
+whether the access is leased.`,
+		FalsePositives: `Storing a reference during initialisation, before any goroutines have
+been started, is safe if the variable is never used after the goroutines have
+started. The analysis cannot tell that this is the case.`,
+		Remediation: `Store a copy of the value instead of a reference to it. For slices and
+maps, copy the contents while holding the lease:
+
+	_ = C.Lease(func() error {
+		snapshot = slices.Clone(C.values)
+		return nil
+	})
+
+Alternatively, provide an accessor function that takes the lease and returns
+the value, and store the accessor instead.`,
+	}
+
+	RuleChanReplace = Rule{
+		ID:       "CS011",
+		Name:     "chan-replace",
+		Message:  "channel field replaced while it is used without Lease",
+		Severity: SeverityError,
+		Description: `A channel field of a crit.Section derived type has been replaced inside a
+lease, but elsewhere the same field is used without the lease.
+
+Channels are safe to use from more than one goroutine, so sending to,
+receiving from, closing and ranging over a channel field does not require the
+lease. Reading the field in order to do so is not reported as CS001. Replacing
+the channel is an assignment to the field and still requires the lease (see
+CS002).`,
+		Rationale: `Replacing the channel while other goroutines are using it without the
+lease is a data race on the field. The lease held while replacing the channel
+does nothing because the other goroutines never take it.`,
+		FalsePositives: `Uses of the channel that only happen before the channel is replaced,
+or after all replacements have finished, are safe but will be reported.`,
+		Remediation: `Either never replace the channel after it has been created, or use the
+channel only while holding the lease. If the channel must be replaced, take a
+copy of the channel inside the lease and use the copy:
+
+	var ch chan int
+	_ = C.Lease(func() error {
+		ch = C.ch
+		return nil
+	})
+	ch <- 1`,
+	}
+
+	RuleMixedLocks = Rule{
+		ID:       "CS012",
+		Name:     "mixed-locks",
+		Message:  "crit.Section derived type also contains a mutex",
+		Severity: SeverityWarning,
+		Description: `A crit.Section derived type has a sync.Mutex or sync.RWMutex field, and
+none of the fields declare that they are guarded by the mutex.
+
+Also reported when a guardedby directive names a field that is not a mutex
+field of the type.`,
+		Rationale: `With two locking regimes in the same type it is unclear which lock
+protects which field. Some fields might be protected by the lease, some by the
+mutex and some by neither.`,
+		FalsePositives: `The mutex might protect something outside of the type, in which case
+the type is better split in two.`,
+		Remediation: `Remove the mutex and protect every field with the lease. If the mix is
+intentional, declare which fields are guarded by the mutex with the guardedby
+directive. Guarded fields do not require the lease.
+
+	type state struct {
+		crit.Section
+		mu    sync.Mutex
+		value int
+
+		//critsec:guardedby mu
+		cache map[string]int
+	}`,
+	}
+
+	RuleSnapshotLeak = Rule{
+		ID:       "CS013",
+		Name:     "snapshot-leak",
+		Message:  "snapshot returns a reference to crit.Section",
+		Severity: SeverityError,
+		Description: `The copy function passed to crit.Snapshot() returns the address of a
+crit.Section derived instance, the address of one of its fields, or a field
+that shares its storage when copied (a slice, map or pointer).`,
+		Rationale: `The value returned by crit.Snapshot() is used after the lease has ended.
+If the value shares memory with the section then it is not a snapshot at all
+and any use of it is unprotected.`,
+		FalsePositives: `A field that is never changed after it has been created can be shared
+safely, but the analysis cannot tell that this is the case.
+
+Values passed to a function call are assumed to be copied by the function.`,
+		Remediation: `Copy the contents of the field:
+
+	values := crit.Snapshot(&C, func() []int {
+		return slices.Clone(C.values)
+	})`,
+	}
+
+	RuleAfterStart = Rule{
+		ID:       "CS014",
+		Name:     "after-start",
+		Message:  "access to crit.Section after Start() without lease",
+		Severity: SeverityError,
+		Description: `A field of a crit.Section derived type that has been started is accessed
+without the lease, in code that can run after Start() has been called. Code
+that can run after Start() is code that follows the call to Start() and
+everything it calls, and everything called from a go statement.
+
+Unleased accesses to a started type in code that can only run before Start()
+are part of the setup of the section and are not reported.`,
+		Rationale: `Start() marks the point where the section is shared with other goroutines.
+After that point any access without the lease can race with another goroutine.`,
+		FalsePositives: `The callgraph does not know the order in which functions are called
+beyond the function calling Start() and its callers. A function that is
+called before Start() and also after it is treated as running after Start().`,
+		Remediation: `Access the field inside the lease, or move the access before the call to
+Start():
+
+	C.cache = make(map[string]int)
+	C.Start()
+	go worker(&C)`,
+	}
+
+	RuleSelfAlias = Rule{
+		ID:       "CS015",
+		Name:     "self-alias",
+		Message:  "reference to crit.Section field escapes Lease",
+		Severity: SeverityError,
+		Description: `A reference to a field of a crit.Section derived type is created inside a
+lease and stored in a field that does not require the lease (a field guarded
+by a mutex, or a field only written during initialisation), or in a variable
+declared outside the lease. A reference is the address of the field or of one
+of its elements, a slice of the field, a field that shares its storage when
+copied (a slice, map or pointer), or an iterator over the field.
+
+References held in local variables of the lease body are followed to the
+place they are stored.`,
+		Rationale: `The reference can be used after the lease has ended. Reading through the
+reference is an access of the protected field that the analysis cannot see.`,
+		FalsePositives: `Values passed to a function call are assumed to be copied by the function,
+unless the function returns an iterator. A reference that is never used after
+the lease has ended is safe, but the analysis cannot tell that this is the
+case.`,
+		Remediation: `Copy the value instead of storing a reference to it:
+
+	_ = C.Lease(func() error {
+		values = slices.Clone(C.values)
+		return nil
+	})`,
+	}
+
+	RuleValueUse = Rule{
+		ID:       "CS016",
+		Name:     "value-use",
+		Message:  "crit.Section used by value",
+		Severity: SeverityError,
+		Description: `A crit.Section derived type, or one of the crit section types, is used as
+a map key, a map value or an array element, or is compared with == or !=.`,
+		Rationale: `Map keys and values, and array elements, are copied when they are stored
+and when they are read. Copying a section copies its lock, and the copy
+protects nothing. Comparing two sections compares their locks, which is never
+meaningful.`,
+		FalsePositives: `An array of sections that is only ever used in place, and never copied, is
+safe, but the analysis cannot tell that this is the case.`,
+		Remediation: `Store and compare pointers instead:
+
+	sections := make(map[string]*state)
+
+	if a == b { // a and b are *state
+	}`,
+	}
+
+	RulePrint = Rule{
+		ID:       "CS017",
+		Name:     "print",
+		Message:  "crit.Section passed to print function",
+		Severity: SeverityError,
+		Description: `A crit.Section derived instance is passed to one of the print functions of
+the fmt or log packages, for example fmt.Printf() or log.Println(), or is
+serialised with encoding/json. Instances passed by value are always reported.
+Instances passed by pointer are reported if the type has no String() function
+(for fmt and log) or MarshalJSON() function (for encoding/json).`,
+		Rationale: `Passing the instance by value copies it, including the lock. The print
+and serialisation functions then read the fields using reflection, without the
+lease.`,
+		FalsePositives: `Printing an instance before it is shared with other goroutines is safe, but
+the copy is still reported.`,
+		Remediation: `Print a snapshot taken with the lease:
+
+	v := crit.Snapshot(&C, func() int { return C.value })
+	fmt.Println(v)
+
+Alternatively, generate String() and MarshalJSON() functions that take the
+lease with critgen, and pass a pointer to the instance.`,
+	}
+
+	RuleFinalizer = Rule{
+		ID:       "CS018",
+		Name:     "finalizer",
+		Message:  "access of crit.Section in finalizer without Lease",
+		Severity: SeverityError,
+		Description: `A field of a crit.Section derived type is accessed without the lease in a
+function registered with runtime.SetFinalizer() or runtime.AddCleanup().
+Functions called by the finalizer are checked in the usual way, with the
+finalizer treated as a function with no callers.`,
+		Rationale: `Finalizers are run by the runtime on a goroutine of its own, at a time that
+cannot be predicted. The finalizer can run while another goroutine holds the
+lease.`,
+		FalsePositives: `An object that has become unreachable cannot be reached by any other
+goroutine, so the fields of the object itself are safe to read if nothing else
+refers to them. The analysis cannot tell that this is the case.`,
+		Remediation: `Take the lease in the finalizer:
+
+	runtime.SetFinalizer(s, func(s *state) {
+		_ = s.Lease(func() error {
+			s.close()
+			return nil
+		})
+	})`,
+	}
+
+	RuleConfined = Rule{
+		ID:       "CS019",
+		Name:     "confined",
+		Message:  "section is goroutine-confined; lease unnecessary",
+		Severity: SeverityInfo,
+		Description: `Every access to the crit.Section derived type, leased or not, can only be
+reached from the same function with no callers, usually main(). This rule is
+only used when the singlegoroutine flag is set, in which case the unleased
+accesses to the type are not reported with CS001 or CS002. Instead, the type is
+reported once with this rule, at the first instance of the type.`,
+		Rationale: `A section that is only used on one goroutine cannot race with another
+goroutine. Embedding crit.Section in a type before it is shared is common and
+the lease is not needed until the type is used by a second goroutine.`,
+		FalsePositives: `Goroutines started by other packages, or by functions the callgraph cannot
+see, are not known to the analysis and the section might not be confined.`,
+		Remediation: `None is needed while the section is confined. To keep the code safe when a
+goroutine is added later, take the lease anyway:
+
+	_ = C.Lease(func() error {
+		C.value++
+		return nil
+	})`,
+	}
+
+	RuleForeign = Rule{
+		ID:       "CS020",
+		Name:     "foreign",
+		Message:  "reference to crit.Section passed to system call or cgo",
+		Severity: SeverityError,
+		Description: `The address of a crit.Section derived instance, the address of one of its
+fields, or a field that shares its storage (a slice, map or pointer), is passed
+to a function in the syscall package, a golang.org/x/sys package, or to a C
+function through cgo, without the lease. Conversions to unsafe.Pointer and
+uintptr are followed.
+
+Functions named in the retains flag keep the reference after they return and
+the reference is reported even when the lease is held.`,
+		Rationale: `The kernel or the C code reads and writes the memory directly, outside of
+anything the race detector or the analysis can see. If another goroutine uses
+the field during the call, or after the call for a function that retains the
+reference, the corruption is almost impossible to debug after the fact.`,
+		FalsePositives: `A function in the retains list that only keeps the reference until a
+later call, made while the same lease is held, is safe.`,
+		Remediation: `Make the call while holding the lease:
+
+	_ = C.Lease(func() error {
+		n, err = syscall.Read(fd, C.buf)
+		return err
+	})
+
+For functions that retain the reference, pass memory that is not part of the
+section, for example a buffer allocated for the call, and copy the result into
+the section with the lease.`,
+	}
+
+	RuleReadLeaseWrite = Rule{
+		ID:       "CS021",
+		Name:     "read-lease-write",
+		Message:  "assignment to crit.RWSection under read lease",
+		Severity: SeverityError,
+		Description: `A field of a crit.RWSection derived type is assigned to while the read
+lease is held. The assignment can be in the function passed to RLease() or in
+any function called from it. Reads of the field are allowed under either
+lease.
+
+Changing the contents of a map or slice field is also reported, even though
+the field itself is only read. This is a write to an element of the field, a
+call to delete() or clear(), a copy() into the field, or an append() to the
+field.`,
+		Rationale: `Any number of read leases can be held at the same time. An assignment made
+under a read lease can race with other goroutines holding the read lease.
+
+Concurrent writes to a map can crash the program. An append() to a slice that
+has spare capacity writes to the backing array shared with the field, so two
+goroutines appending under the read lease write to the same memory.`,
+		FalsePositives: `A function that is called under both the read lease and the write lease,
+and only assigns to the field when the write lease is held, is reported because
+the analysis does not know which lease is held at the time of the assignment.`,
+		Remediation: `Use the write lease for functions that change the section:
+
+	_ = C.Lease(func() error {
+		C.value++
+		return nil
+	})`,
+	}
+
+	RuleAfterTransfer = Rule{
+		ID:       "CS022",
+		Name:     "after-transfer",
+		Message:  "access of crit.Section after ownership transfer",
+		Severity: SeverityError,
+		Description: `A crit.Section derived instance is accessed through a variable after the
+instance has been sent on a channel, or passed to a function, with the transfer
+directive. Ownership of the instance moved to the receiver with the transfer.`,
+		Rationale: `The transfer directive tells the analysis that the receiver can use the
+instance without the lease because nothing else is using it. An access after
+the transfer breaks that promise.`,
+		FalsePositives: `An access after the instance has been handed back, for example on a
+reply channel, is reported because only the first transfer is followed. Assign
+the returned instance to a new variable.`,
+		Remediation: `Finish with the instance before transferring it:
+
+	j.result = 0
+	jobs <- j //critsec:transfer`,
+	}
+
+	RuleEmbedding = Rule{
+		ID:       "CS023",
+		Name:     "embedding",
+		Message:  "crit.Section derived type from another package is embedded",
+		Severity: SeverityOff,
+		Description: `A struct type embeds a crit.Section derived type that is declared in another
+package. The fields of the embedded type are promoted to the struct type.
+
+Accesses to the promoted fields are always checked in the same way as accesses
+to the embedded type. This rule reports the embedding itself and is off by
+default. Enable it by setting a severity for CS023 in the configuration file.`,
+		Rationale: `Promoted fields look like fields of the struct type and it is easy to reach
+into the protected state of the embedded type without realising that the lease
+is needed. The package that declares the type is also unable to see how its
+fields are used.`,
+		FalsePositives: `Embedding is sometimes the clearest way to extend a type and the accesses
+to the promoted fields might all be leased.`,
+		Remediation: `Use a named field, and the functions provided by the other package, rather
+than embedding the type:
+
+	type wrapper struct {
+		state *other.State
+	}`,
+	}
+
+	RuleIgnoreDirective = Rule{
+		ID:       "CS024",
+		Name:     "ignore-directive",
+		Message:  "ignore directive cannot be used",
+		Severity: SeverityWarning,
+		Description: `An ignore directive is missing the rule IDs or the reason, names a rule that
+does not exist, or is an ignore-begin without a matching ignore-end (or the
+other way around). The problem is included in the report. The directive has no
+effect.`,
+		Rationale: `A directive that has no effect gives the impression that reports are being
+suppressed deliberately when they are not, or the other way around for an
+ignore-begin that is never ended.`,
+		FalsePositives: `None.`,
+		Remediation: `Give the rule IDs, separated by commas, and a reason:
+
+	//critsec:ignore CS001,CS002 test fixture
+
+and end every ignore-begin with an ignore-end.`,
+	}
+
+	RuleFieldPolicy = Rule{
+		ID:       "CS025",
+		Name:     "field-policy",
+		Message:  "conflicting field policy",
+		Severity: SeverityError,
+		Description: `The crit struct tag of a field declares a different policy to the field
+directives, or is not one of the known policies. Struct tags are only read when
+the fieldtags flag is set. The known policies are guarded, unguarded and
+guardedby=<mutex>.`,
+		Rationale: `The directives take precedence over the struct tag. A conflict means that
+the policy the code generator intended is not the one being checked.`,
+		FalsePositives: `None.`,
+		Remediation: `Remove either the struct tag or the directive, or make them agree:
+
+	cache map[string]int ` + "`crit:\"guardedby=mu\"`" + ` //critsec:guardedby mu`,
+	}
+
+	RuleAdoptAccess = Rule{
+		ID:       "CS026",
+		Name:     "adopt-access",
+		Message:  "access of mutex guarded field outside of Lock",
+		Severity: SeverityWarning,
+		Description: `A field of a struct that contains a sync.Mutex or sync.RWMutex field named
+mu or lock is accessed outside of a Lock()/Unlock() window. This rule is only
+used when the adopt flag is set, which treats such structs as if they were
+crit.Section derived types.
+
+The windows are found in source order inside each function. Functions with
+names ending in Locked, and constructors with names beginning with new or New,
+are assumed to be called with the mutex held. Fields with a type from the sync
+or sync/atomic packages, and channel fields, are not reported.`,
+		Rationale: `The naming convention is a common way of showing that a mutex protects the
+other fields of a struct. The reports give a preview of what the analysis would
+find if the struct used crit.Section instead.`,
+		FalsePositives: `The windows are found lexically and do not follow the callgraph. An access
+in a function that is only ever called with the mutex held is reported unless
+the function name ends in Locked.`,
+		Remediation: `Hold the mutex for the access:
+
+	s.mu.Lock()
+	s.count++
+	s.mu.Unlock()
+
+or convert the struct to a crit.Section derived type.`,
+	}
+	RuleLeaseFlow = Rule{
+		ID:       "CS027",
+		Name:     "lease-flow",
+		Message:  "lease function changes the control flow of the enclosing function",
+		Severity: SeverityWarning,
+		Description: `A statement in a function literal passed to Lease() behaves differently to
+how it would behave if it were written directly in the enclosing function. The
+statements that are reported are:
+
+	- a return before the end of the lease, when the result of Lease() is
+	  discarded and there is code after the call to Lease(), and the value
+	  returned could have been returned by the enclosing function
+	- a return of a non-nil error when the result of Lease() is discarded
+	- a defer of a call that uses a variable of the enclosing function, which
+	  runs when the lease ends rather than when the function returns
+	- a panic, when the enclosing function defers a call to recover()
+	- a call to TryLease() or TryRLease() where the result that says whether
+	  the function was called is discarded`,
+		Rationale: `These are the usual mistakes when a Lock()/Unlock() region is converted to
+a lease, by hand or by critmigrate. A return that used to leave the function now
+only leaves the lease, and the code after the call to Lease() runs when it
+didn't before.`,
+		FalsePositives: `An early return of an error that is intended to skip only the rest of the
+lease is reported if the result of Lease() is discarded. An early return of nil
+is not reported. A deferred call that uses a variable declared before the lease
+is reported even if it is meant to run when the lease ends.`,
+		Remediation: `Return an error from the lease and check it in the enclosing function:
+
+	if err := C.Lease(func() error {
+		if C.value == 0 {
+			return errEmpty
+		}
+		C.value--
+		return nil
+	}); err != nil {
+		return err
+	}`,
+	}
+	RuleGlobalWrite = Rule{
+		ID:       "CS028",
+		Name:     "global-write",
+		Message:  "package-level variable written inside lease",
+		Severity: SeverityOff,
+		Description: `A package-level variable that is not a crit.Section derived type is written
+from inside the function passed to Lease().
+
+This rule is off by default. Enable it by setting a severity for CS028 in the
+configuration file.`,
+		Rationale: `The variable is unrelated to the leased section. Writing to it inside the
+lease hides a dependency between the critical section and the rest of the
+program and makes the lease longer than it needs to be. If the variable is
+shared between goroutines, the lease gives it no protection from code that
+writes to it without the lease.`,
+		FalsePositives: `Variables that are only ever written inside leases of the same section are
+protected by the lease but are still reported.`,
+		Remediation: `Move the write outside of the lease, or move the variable into the
+crit.Section derived type.
+
+If the variable is intended to be written inside the lease, declare it with the
+leasewrite directive:
+
+	//critsec:leasewrite
+	var lastUpdate time.Time`,
+	}
+	RuleReadOnlyLease = Rule{
+		ID:       "CS029",
+		Name:     "read-only-lease",
+		Message:  "lease only reads; use the read lease",
+		Severity: SeverityInfo,
+		Description: `Lease() is called for a crit.RWSection derived type but the function passed
+to it never writes to a field of a crit.Section derived type. The read lease,
+RLease(), can be used instead. The same is true of TryLease() and TryRLease().
+The report includes a suggested fix that changes the call.`,
+		Rationale: `Any number of read leases can be held at the same time. Using Lease() for
+code that only reads makes other readers wait for no reason.`,
+		FalsePositives: `Calls to functions in the same package and calls to function values are
+assumed to write, so a lease that only reads through such calls is not
+reported. A write through a local variable that points into the section is not
+seen and the lease may be reported even though it writes.`,
+		Remediation: `Use the read lease:
+
+	_ = C.RLease(func() error {
+		v = C.value
+		return nil
+	})`,
+	}
+	RuleBinaryMismatch = Rule{
+		ID:       "CS030",
+		Name:     "binary-mismatch",
+		Message:  "crit.Section leased in one binary but not in another",
+		Severity: SeverityError,
+		Description: `A field of a crit.Section derived type is accessed in a function that is
+leased on every call path in some of the binaries that use the package, but not
+in others. This rule is only used when the binaries flag names the main packages
+to check. Each binary is checked with a callgraph that only contains the
+functions that the binary can reach.`,
+		Rationale: `A package that is shared between programs can be used correctly by one
+program and incorrectly by another. When the package is analysed on its own, or
+with every program at once, the call paths of one program can hide the call
+paths of another.`,
+		FalsePositives: `The same as CS001. The related information lists the binaries where the
+access is, and is not, leased.`,
+		Remediation: `Take the lease in the binary where the access is not leased, or move the
+lease into the package so that every binary gets it.`,
+	}
+	RuleInterfaceMethod = Rule{
+		ID:       "CS031",
+		Name:     "interface-method",
+		Message:  "formatting or serialisation method accesses crit.Section without Lease",
+		Severity: SeverityError,
+		Description: `A crit.Section derived type has a method that implements one of the
+interfaces used by the formatting and serialisation packages of the standard
+library (fmt.Stringer, json.Marshaler, gob.GobEncoder, sql.Scanner and others),
+and the method accesses a field of the type outside of a lease.`,
+		Rationale: `The packages that call these methods do so from whatever goroutine asked
+for the value to be formatted or serialised, and usually through reflection.
+The callgraph can't see the calls, so the accesses in the method are not found
+by the CS001 and CS002 rules.`,
+		FalsePositives: `The check is lexical. A field accessed in the method is only treated as
+leased if it is inside the function literal passed to a lease function. A
+method that is only ever called with the lease held is still reported.`,
+		Remediation: `Take the lease inside the method:
+
+	func (c *counter) String() string {
+		var s string
+		_ = c.Lease(func() error {
+			s = fmt.Sprintf("%d", c.value)
+			return nil
+		})
+		return s
+	}
+
+The critgen command generates String() and MarshalJSON() methods that take the
+lease.`,
+	}
+
+	RuleUnusedSection = Rule{
+		ID:       "CS032",
+		Name:     "unused-section",
+		Message:  "section is unnecessary and can be removed",
+		Severity: SeverityInfo,
+		Description: `A crit.Section derived type where the section does nothing. The type is
+reported if it has no fields other than the embedded section, or if it is
+declared in a main package and every access to its fields can only be reached
+from the same function with no callers, usually main(). The unleased accesses
+of the fields are not reported in the second case. The second case is not
+reported when the singlegoroutine flag is set because it is reported by the
+CS019 rule instead.`,
+		Rationale: `A section that protects nothing, or that is never shared between
+goroutines, adds the cost of the lease and suggests a concurrency that isn't
+there.`,
+		FalsePositives: `A section with no fields can be used to serialise access to something
+outside of the type, such as a global variable or a file. Goroutines started by
+functions the callgraph cannot see are not known to the analysis.`,
+		Remediation: `Remove the embedded section and the leases, or leave it in place if the type
+is going to be shared between goroutines:
+
+	type counter struct {
+		value int
+	}`,
+	}
+
+	RuleAcquireRelease = Rule{
+		ID:       "CS033",
+		Name:     "acquire-release",
+		Message:  "Acquire without a matching release",
+		Severity: SeverityError,
+		Description: `Acquire() or RAcquire() is called but the crit.Release returned by it is
+discarded, or there is a path through the function from the call to a return
+statement, or to the end of the function, that does not use the release. A
+deferred call to the release, or any other use of it, counts as a release.`,
+		Rationale: `A lease that is never released blocks every other goroutine that tries to
+lease the section. The usual cause is an early return that was added after the
+call to the release was written.`,
+		FalsePositives: `The release can be called by a function that it is passed to. This counts as
+a use so the acquisition is not reported, but the accesses after the call are
+not treated as leased.`,
+		Remediation: `Defer the release immediately after the call to Acquire():
+
+	release := C.Acquire()
+	defer release()`,
+	}
+
+	RuleReleaseMisuse = Rule{
+		ID:       "CS034",
+		Name:     "release-misuse",
+		Message:  "misuse of a release handle",
+		Severity: SeverityError,
+		Description: `A crit.Release returned by Acquire() or RAcquire() is called when it might
+already have been called, or it is stored in a field, a package variable, a
+slice element or a map, or it is sent on a channel. A crit.ChanSection token
+received from one section is given back with Release() of another section.`,
+		Rationale: `Calling a release twice unlocks a lease that might now belong to another
+goroutine. A release that is stored somewhere that outlives the function can't
+be followed by the analysis, so the accesses it protects and the paths that
+forget to call it are not checked. A token given back to the wrong section
+leaves the first section held forever and lets two goroutines into the second.
+
+In critdebug builds the same mistakes panic at runtime: a release called a
+second time and a token released to a section it did not come from.`,
+		FalsePositives: `A release that is called on two paths that the analysis can't tell apart, for
+example in two if statements with the same condition, is reported as released
+twice. The token check compares the expressions for the two sections, so the
+same section reached through two different expressions is reported.`,
+		Remediation: `Call the release exactly once, preferably with defer immediately after the
+call to Acquire(). If a lease must outlive the function then use Lease() with a
+function literal that contains all of the work instead.`,
+	}
+
+	RuleGetter = Rule{
+		ID:       "CS035",
+		Name:     "getter",
+		Message:  "getter returns crit.Section field",
+		Severity: SeverityError,
+		Description: `A method of a crit.Section derived type returns one of the fields of the
+type without taking the lease, or returns a reference to a field whether or
+not it holds the lease. A reference is the address of the field or of one of
+its elements, a slice of the field, or a field that shares its storage when
+copied (a slice, map or pointer).
+
+Methods with the requires directive, and methods that are only called while
+the lease is held, are not reported.`,
+		Rationale: `A getter is usually part of the API of the type and is called from places
+the analysis can't see, such as other packages. A getter that reads a field
+without the lease races with every goroutine that holds it. A reference
+returned by a getter is used after the getter returns, when the lease is no
+longer held, even if the getter took the lease itself.`,
+		FalsePositives: `The lease is only recognised if the return statement is inside an Acquire()
+region of the method. A getter that returns a field that is never changed after
+it is created is safe, but the analysis cannot tell that this is the case.`,
+		Remediation: `Return a snapshot of the field, copying slices and maps:
+
+	func (c *counter) Values() []int {
+		return crit.Snapshot(c, func() []int {
+			return slices.Clone(c.values)
+		})
+	}
+
+The suggested fix does this for a getter with a single return statement.`,
+	}
+
+	RuleEmptyLease = Rule{
+		ID:       "CS036",
+		Name:     "empty-lease",
+		Message:  "lease does nothing with the section",
+		Severity: SeverityInfo,
+		Description: `A lease function is called with a function literal that is empty, that only
+returns constants or nil, or that never uses a crit.Section derived value. For
+example:
+
+	_ = C.Lease(func() error { return nil })
+
+Calls to functions in the same package, and calls of function values, are
+assumed to use the section.`,
+		Rationale: `A lease that protects nothing is usually left over from a refactor that moved
+the accesses somewhere else, or comes from a misunderstanding of what the lease
+is for. It still blocks every other goroutine that wants the section.`,
+		FalsePositives: `A lease can be taken on purpose to wait for other goroutines to finish with
+the section. A field reached through a pointer that was taken outside of the
+function literal is not recognised as a use of the section.`,
+		Remediation: `Remove the lease, or move the accesses it was meant to protect into the
+function literal. The suggested fix removes a lease that is empty or only
+returns nil.`,
+	}
+	RuleSharedStore = Rule{
+		ID:       "CS037",
+		Name:     "shared-store",
+		Message:  "reference to crit.Section stored in sync.Map or atomic value",
+		Severity: SeverityError,
+		Description: `A crit.Section derived instance, a pointer to one, or a reference to one of
+its fields, has been stored in a sync.Map, an atomic.Value or an
+atomic.Pointer[T]. A reference is the address of a field or of one of its
+elements, a slice of a field, or a field that shares its storage when copied
+(a slice, map or pointer).`,
+		Rationale: `These types exist to publish a value to readers on any goroutine. A reader
+that loads the value gets a reference to the section, or to the data it
+protects, with no relationship to the lease. The analysis can't follow the
+value through the store and the load, so the accesses made by the readers are
+not checked.`,
+		FalsePositives: `A section that is stored so that it can be found by another goroutine, which
+always takes the lease before using it, is safe. The analysis cannot tell that
+this is the case.`,
+		Remediation: `Publish an immutable snapshot of the data instead of a reference to it,
+taking the snapshot while holding the lease:
+
+	snapshot := crit.Snapshot(&C, func() []int {
+		return slices.Clone(C.values)
+	})
+	latest.Store(snapshot)
+
+Readers then load the snapshot without needing the lease. A new snapshot is
+stored whenever the data changes.`,
+	}
+	RuleHandler = Rule{
+		ID:       "CS038",
+		Name:     "handler",
+		Message:  "access of crit.Section in handler without Lease",
+		Severity: SeverityError,
+		Description: `A field of a crit.Section derived type is accessed without the lease in a
+handler. A handler is a function registered with http.Server.RegisterOnShutdown(),
+time.AfterFunc() or context.AfterFunc(), or the code in a function after it
+receives from a channel passed to signal.Notify(). The detail of the report
+says which. Functions called by the handler are checked in the usual way.`,
+		Rationale: `Handlers are run at a time that can't be predicted, usually on a goroutine of
+their own. A shutdown handler or a signal handler runs while the rest of the
+program is still running, and can run while another goroutine holds the lease.
+The callgraph often can't see how the handler is called, so the access is
+reported with a rule of its own that explains the context.`,
+		FalsePositives: `A signal handler that only runs after every other goroutine has stopped is
+safe, but the analysis cannot tell that this is the case. Only the channel
+variable passed to signal.Notify() is followed. A channel that is copied to
+another variable, or passed to a function, is not.`,
+		Remediation: `Take the lease in the handler:
+
+	srv.RegisterOnShutdown(func() {
+		_ = S.Lease(func() error {
+			S.closing = true
+			return nil
+		})
+	})`,
+	}
+	RuleLeaser = Rule{
+		ID:       "CS039",
+		Name:     "leaser",
+		Message:  "lease method does not provide mutual exclusion",
+		Severity: SeverityError,
+		Description: `A method with the name of a lease method, such as Lease(), is declared outside
+of the crit package and calls the function it is given without locking. This is
+usually a type written to implement crit.Leaser:
+
+	func (w *wrapper) Lease(f func() error) error {
+		return f()
+	}
+
+The method is taken to lock if it calls a Lock(), RLock() or Acquire() method
+of any type, calls a lease method on something other than its own receiver, or
+sends or receives on a channel.`,
+		Rationale: `The analysis treats every method with the name of a lease method as a lease,
+so the function passed to it is assumed to hold the lease. A lease method that
+doesn't lock silently disables the checking of everything that uses it.`,
+		FalsePositives: `A lease method that locks in a function it calls, rather than in its own body,
+is reported. Whether the lock is the right one is not checked.`,
+		Remediation: `Delegate to the section being wrapped:
+
+	func (w *wrapper) Lease(f func() error) error {
+		return w.section.Lease(f)
+	}
+
+or lock a mutex for the duration of the call.`,
+	}
+	RuleCritVersion = Rule{
+		ID:       "CS040",
+		Name:     "crit-version",
+		Message:  "crit package is not compatible with the analysis",
+		Severity: SeverityWarning,
+		Description: `The package imports a version of the crit package that the analysis doesn't
+fully understand. The report is made at the import and the detail says why:
+
+  - crit.APIVersion is newer than the version known to the analysis
+  - crit.APIVersion is lower than the -min-crit-version option
+  - the crit package has methods or functions that take a func() error, like
+    the lease methods, that the analysis doesn't know`,
+		Rationale: `The analysis recognises lease methods by name. A lease method added to a newer
+crit package is not recognised, so every access made with it is reported as
+unleased, or worse, the function passed to it is not treated as being leased at
+all. The results are wrong without anything to say so.`,
+		FalsePositives: `A method of a fork of the crit package that takes a func() error but that is
+not a lease method is reported as unknown.`,
+		Remediation: `Use the version of critcheck that matches the crit package:
+
+	go install github.com/jetsetilly/critsec/analysis/cmd/critcheck@<version>
+
+For a fork of the crit package, name its lease methods with the -lease-methods
+option.`,
+	}
+	RuleDoubleChecked = Rule{
+		ID:       "CS041",
+		Name:     "double-checked",
+		Message:  "double-checked locking of crit.Section",
+		Severity: SeverityError,
+		Description: `A field of a crit.Section derived type is read without the lease in the
+condition of an if statement, and read again with the lease before it is
+assigned to:
+
+	if C.x == nil {
+		_ = C.Lease(func() error {
+			if C.x == nil {
+				C.x = newX()
+			}
+			return nil
+		})
+	}
+
+The second check can be in the function passed to a lease method or after a
+call to Acquire(). The report is made at the first read, which is the one
+without the lease. The detail gives the line of the second check.`,
+		Rationale: `Double-checked locking is meant to avoid taking the lease once the field has
+been set. The first read races with the assignment in another goroutine. In Go
+there is no guarantee that a goroutine that sees the new value of the field
+also sees the writes that were made to create it, so the value can be used
+before it is fully initialised.`,
+		FalsePositives: `The field is matched by the expression used to access it, so a field accessed
+through two different variables that point to the same instance is not
+recognised as a double check. The unleased read is then reported with the
+CS001 rule instead.`,
+		Remediation: `Use InitOnce(), which runs the function with the lease the first time it is
+called. A field that is only written in the function passed to InitOnce() can
+be read without the lease afterwards:
+
+	_ = C.InitOnce(func() error {
+		C.x = newX()
+		return nil
+	})
+
+The suggested fix makes this change when the if statements contain nothing
+else. Alternatively, publish the value with an atomic.Pointer[T] and load it
+without the lease.`,
+	}
+	RuleTestDouble = Rule{
+		ID:       "CS042",
+		Name:     "test-double",
+		Message:  "testdouble directive outside of a test file",
+		Severity: SeverityWarning,
+		Description: `A type declared in a file that is not a test file has the testdouble
+directive. The directive is only recognised in test files and has no effect.`,
+		Rationale: `A test double is allowed to break the rules that protect a crit.Section
+derived type. It can have any number of instances, it can be passed by value
+and its lease methods don't have to lock. Outside of tests the same type would
+hide real problems, so the directive is limited to the types that only the
+tests can use.`,
+		FalsePositives: `None.`,
+		Remediation: `Move the type to a _test.go file, or remove the directive. A type that must
+have more than one instance in the program itself can use the multi directive
+instead:
+
+	//critsec:multi
+	type worker struct {
+		crit.Section
+		jobs []job
+	}`,
+	}
+)
+
+// Rules is the list of all rules in ID order
+var Rules = []Rule{
+	RuleAccess,
+	RuleAssignment,
+	RuleParameter,
+	RuleMultipleInstance,
+	RuleRequiresCall,
+	RuleLeaseInLoop,
+	RuleLeaseSize,
+	RuleConditional,
+	RuleWrongLease,
+	RulePublish,
+	RuleChanReplace,
+	RuleMixedLocks,
+	RuleSnapshotLeak,
+	RuleAfterStart,
+	RuleSelfAlias,
+	RuleValueUse,
+	RulePrint,
+	RuleFinalizer,
+	RuleConfined,
+	RuleForeign,
+	RuleReadLeaseWrite,
+	RuleAfterTransfer,
+	RuleEmbedding,
+	RuleIgnoreDirective,
+	RuleFieldPolicy,
+	RuleAdoptAccess,
+	RuleLeaseFlow,
+	RuleGlobalWrite,
+	RuleReadOnlyLease,
+	RuleBinaryMismatch,
+	RuleInterfaceMethod,
+	RuleUnusedSection,
+	RuleAcquireRelease,
+	RuleReleaseMisuse,
+	RuleGetter,
+	RuleEmptyLease,
+	RuleSharedStore,
+	RuleHandler,
+	RuleLeaser,
+	RuleCritVersion,
+	RuleDoubleChecked,
+	RuleTestDouble,
+}
+
+// LookupRule returns the rule with the specified ID or name. neither is case
+// sensitive
+func LookupRule(id string) (Rule, bool) {
+	for _, r := range Rules {
+		if strings.EqualFold(r.ID, id) || strings.EqualFold(r.Name, id) {
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
@@ -0,0 +1,49 @@
+package analysis
+
+import (
+	"strings"
+)
+
+// sectionList is the value of the section flag. the flag can be given more
+// than once and each value can be a comma-separated list. an empty value clears
+// the list, which returns the flag to its default value
+type sectionList []string
+
+func (l *sectionList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *sectionList) Set(s string) error {
+	if strings.TrimSpace(s) == "" {
+		*l = nil
+		return nil
+	}
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			*l = append(*l, name)
+		}
+	}
+	return nil
+}
+
+// inScope returns true if the crit.Section derived type, given by its
+// qualified name, is one of the types selected with the section flag. every
+// type is in scope if the flag is not given. reports that are not about a
+// particular type have an empty type name and are always in scope
+//
+// a type can be selected by its name, by the last element of its package path
+// and its name (eg. pool.conn) or by its qualified name
+func inScope(typ string) bool {
+	if len(sections) == 0 || typ == "" {
+		return true
+	}
+	for _, s := range sections {
+		if s == typ || strings.HasSuffix(typ, "/"+s) {
+			return true
+		}
+		if i := strings.LastIndex(typ, "."); i >= 0 && s == typ[i+1:] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+package analysis
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// checkSelfAlias reports references to the fields of a crit.Section derived
+// type that are created inside a lease and then stored somewhere that can be
+// read without the lease. the places checked are fields that do not require
+// the lease (the exempt fields) and variables declared outside the lease
+//
+// references stored in local variables of the lease body are followed, so
+// that the following is reported:
+//
+//	_ = C.Lease(func() error {
+//		p := &C.buf[0]
+//		C.cache = p
+//		return nil
+//	})
+//
+// package-level variables are not checked because they are reported by
+// checkPublish()
+func checkSelfAlias(pass *analysis.Pass, rep *reporter, inspect *inspector.Inspector, exempt ...map[*types.Var]bool) {
+	isExempt := func(f *types.Var) bool {
+		for _, m := range exempt {
+			if m[f] {
+				return true
+			}
+		}
+		return false
+	}
+
+	inspect.WithStack([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+
+		lc, ok := isLeaseCall(pass, n.(*ast.CallExpr))
+		if !ok || lc.lit == nil {
+			return true
+		}
+
+		// local variables of the lease body that hold a reference
+		local := make(map[types.Object]ast.Expr)
+
+		inside := func(obj types.Object) bool {
+			return obj.Pos() >= lc.lit.Pos() && obj.Pos() < lc.lit.End()
+		}
+
+		// references returns the parts of the expression that are references
+		// to a field, including local variables holding a reference
+		references := func(e ast.Expr) []ast.Expr {
+			var refs []ast.Expr
+			for _, r := range leakedReferences(pass, e) {
+				if subj, _ := published(pass, r); subj.field != "" {
+					refs = append(refs, r)
+				}
+			}
+			ast.Inspect(e, func(nd ast.Node) bool {
+				if id, ok := nd.(*ast.Ident); ok {
+					if r, ok := local[pass.TypesInfo.ObjectOf(id)]; ok {
+						refs = append(refs, r)
+					}
+				}
+				return true
+			})
+			return refs
+		}
+
+		store := func(lhs ast.Expr, rhs ast.Expr) {
+			refs := references(rhs)
+			if len(refs) == 0 {
+				return
+			}
+
+			var dest string
+			if f, ok := sectionField(pass, lhs); ok {
+				if !isExempt(f) {
+					return
+				}
+				dest = fmt.Sprintf("stored in %s, which does not require the lease", types.ExprString(lhs))
+			} else {
+				root, ok := rootVar(pass, lhs)
+				if !ok || isCritDerived(root.Type()) {
+					return
+				}
+
+				// a local variable (or a field or element of one) holds the
+				// reference until it is stored somewhere else
+				if inside(root) {
+					local[root] = refs[0]
+					return
+				}
+
+				if root.Pkg() == nil || root.Parent() == root.Pkg().Scope() {
+					return
+				}
+				dest = fmt.Sprintf("stored in %s, which is declared outside the lease", types.ExprString(lhs))
+			}
+
+			for _, r := range refs {
+				subj, _ := published(pass, r)
+				subj.fn = functionName(stack)
+				rep.reportDetail(r.Pos(), RuleSelfAlias, subj,
+					fmt.Sprintf("%s %s", types.ExprString(r), dest))
+			}
+		}
+
+		ast.Inspect(lc.lit.Body, func(nd ast.Node) bool {
+			switch m := nd.(type) {
+			case *ast.FuncLit:
+				return false
+			case *ast.AssignStmt:
+				if len(m.Lhs) == len(m.Rhs) {
+					for i := range m.Lhs {
+						store(m.Lhs[i], m.Rhs[i])
+					}
+				}
+			case *ast.ValueSpec:
+				if len(m.Names) == len(m.Values) {
+					for i := range m.Names {
+						store(m.Names[i], m.Values[i])
+					}
+				}
+			}
+			return true
+		})
+
+		return true
+	})
+}
+
+// sectionField returns the field if the expression selects a field of a
+// crit.Section derived type
+func sectionField(pass *analysis.Pass, e ast.Expr) (*types.Var, bool) {
+	for {
+		p, ok := e.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		e = p.X
+	}
+	sel, ok := e.(*ast.SelectorExpr)
+	if !ok || !isCritDerived(pass.TypesInfo.TypeOf(sel.X)) {
+		return nil, false
+	}
+	f := selectedField(pass, sel)
+	return f, f != nil
+}
+
+// rootVar returns the variable that the expression is rooted in. for example,
+// the variable for r in the expression r.values[0]
+func rootVar(pass *analysis.Pass, e ast.Expr) (*types.Var, bool) {
+	for {
+		switch x := e.(type) {
+		case *ast.ParenExpr:
+			e = x.X
+		case *ast.StarExpr:
+			e = x.X
+		case *ast.IndexExpr:
+			e = x.X
+		case *ast.SelectorExpr:
+			if _, ok := pass.TypesInfo.Selections[x]; !ok {
+				// a qualified identifier
+				v, ok := pass.TypesInfo.ObjectOf(x.Sel).(*types.Var)
+				return v, ok
+			}
+			e = x.X
+		case *ast.Ident:
+			v, ok := pass.TypesInfo.ObjectOf(x).(*types.Var)
+			return v, ok
+		default:
+			return nil, false
+		}
+	}
+}
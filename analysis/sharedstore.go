@@ -0,0 +1,117 @@
+package analysis
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// the methods of sync.Map, atomic.Value and atomic.Pointer[T] that store a
+// value, and the arguments that are stored. the old value given to
+// CompareAndSwap() is only compared and is not stored
+var sharedStores = map[string]map[string][]int{
+	"sync.Map": {
+		"Store":          {0, 1},
+		"LoadOrStore":    {0, 1},
+		"Swap":           {0, 1},
+		"CompareAndSwap": {0, 2},
+	},
+	"sync/atomic.Value": {
+		"Store":          {0},
+		"Swap":           {0},
+		"CompareAndSwap": {1},
+	},
+	"sync/atomic.Pointer": {
+		"Store":          {0},
+		"Swap":           {0},
+		"CompareAndSwap": {1},
+	},
+}
+
+// checkSharedStores reports crit.Section derived instances, or references to
+// their fields, that are stored in a sync.Map, an atomic.Value or an
+// atomic.Pointer[T]. these types exist to publish values to readers on any
+// goroutine, and the readers have no relationship with the lease
+func checkSharedStores(pass *analysis.Pass, rep *reporter, inspect *inspector.Inspector) {
+	inspect.WithStack([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+
+		call := n.(*ast.CallExpr)
+		store, args, ok := sharedStore(pass, call)
+		if !ok {
+			return true
+		}
+
+		for _, i := range args {
+			if i >= len(call.Args) {
+				continue
+			}
+			arg := call.Args[i]
+
+			subj, ok := storedReference(pass, arg)
+			if !ok {
+				continue
+			}
+			subj.fn = functionName(stack)
+
+			rep.reportDetail(arg.Pos(), RuleSharedStore, subj,
+				fmt.Sprintf("%s stored in %s", types.ExprString(arg), store))
+		}
+
+		return true
+	})
+}
+
+// sharedStore returns the name of the type and the stored arguments if the
+// call is to one of the methods in sharedStores
+func sharedStore(pass *analysis.Pass, call *ast.CallExpr) (string, []int, bool) {
+	fn, ok := typeutil.Callee(pass.TypesInfo, call).(*types.Func)
+	if !ok {
+		return "", nil, false
+	}
+	recv := fn.Type().(*types.Signature).Recv()
+	if recv == nil {
+		return "", nil, false
+	}
+
+	t := types.Unalias(recv.Type())
+	if p, ok := t.(*types.Pointer); ok {
+		t = types.Unalias(p.Elem())
+	}
+	named, ok := t.(*types.Named)
+	if !ok || named.Obj().Pkg() == nil {
+		return "", nil, false
+	}
+	obj := named.Origin().Obj()
+
+	methods, ok := sharedStores[obj.Pkg().Path()+"."+obj.Name()]
+	if !ok {
+		return "", nil, false
+	}
+	args, ok := methods[fn.Name()]
+	if !ok {
+		return "", nil, false
+	}
+
+	return obj.Pkg().Name() + "." + obj.Name(), args, true
+}
+
+// storedReference returns the subject if the expression is a crit.Section
+// derived instance, a pointer to one, or a reference to one of its fields in
+// the sense of published()
+func storedReference(pass *analysis.Pass, e ast.Expr) (subject, bool) {
+	u := unwrapExpr(pass, e)
+	if x, ok := u.(*ast.UnaryExpr); ok && x.Op.String() == "&" {
+		u = unwrapExpr(pass, x.X)
+	}
+	if id, ok := critDerived(pass.TypesInfo.TypeOf(u)); ok {
+		return subject{typ: qualifiedName(id)}, true
+	}
+	return published(pass, e)
+}
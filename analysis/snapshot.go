@@ -0,0 +1,123 @@
+package analysis
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// the name of the snapshot function in the crit package
+const snapshotFunction = "Snapshot"
+
+// isSnapshotCall returns the copy function if the call is to crit.Snapshot()
+// and the copy function is a function literal
+func isSnapshotCall(pass *analysis.Pass, call *ast.CallExpr) (*ast.FuncLit, bool) {
+	fn, ok := typeutil.Callee(pass.TypesInfo, call).(*types.Func)
+	if !ok || fn.Name() != snapshotFunction || fn.Pkg() == nil {
+		return nil, false
+	}
+	if !isCritPackage(fn.Pkg().Path()) || len(call.Args) != 2 {
+		return nil, false
+	}
+	lit, ok := call.Args[1].(*ast.FuncLit)
+	return lit, ok
+}
+
+// checkSnapshots reports copy functions passed to crit.Snapshot() that return
+// a reference to a field of a crit.Section derived type. the reference would
+// be used after the lease has ended. a reference copied to a local variable or
+// a named result before it is returned is reported where it is copied
+func checkSnapshots(pass *analysis.Pass, rep *reporter, inspect *inspector.Inspector) {
+	inspect.WithStack([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+
+		lit, ok := isSnapshotCall(pass, n.(*ast.CallExpr))
+		if !ok {
+			return true
+		}
+
+		copies := findLocalCopies(pass, lit)
+		ast.Inspect(lit.Body, func(nd ast.Node) bool {
+			switch r := nd.(type) {
+			case *ast.FuncLit:
+				return false
+			case *ast.ReturnStmt:
+				for _, res := range returnedResults(lit.Type, r) {
+					if cp, ok := copies.resolve(pass, res, r.Pos()); ok {
+						res = cp.value
+					}
+					for _, e := range leakedReferences(pass, res) {
+						subj, _ := published(pass, e)
+						subj.fn = functionName(stack)
+						rep.report(e.Pos(), RuleSnapshotLeak, subj)
+					}
+				}
+			}
+			return true
+		})
+
+		return true
+	})
+}
+
+// leakedReferences returns the parts of the expression that are references to
+// a crit.Section derived instance or to one of its fields. function calls are
+// assumed to make a copy of their arguments and are not looked into, except
+// for calls that return an iterator
+func leakedReferences(pass *analysis.Pass, e ast.Expr) []ast.Expr {
+	var leaked []ast.Expr
+	ast.Inspect(e, func(nd ast.Node) bool {
+		switch x := nd.(type) {
+		case *ast.CallExpr:
+			// type conversions do not copy
+			if tv, ok := pass.TypesInfo.Types[x.Fun]; ok && tv.IsType() {
+				return true
+			}
+			// an iterator refers to the value it iterates over
+			if isIterator(pass.TypesInfo.TypeOf(x)) {
+				return true
+			}
+			return false
+		case *ast.FuncLit:
+			return false
+		case *ast.IndexExpr:
+			if _, ok := published(pass, x); ok {
+				leaked = append(leaked, x)
+				return false
+			}
+			// an element is a copy of the value in the field
+			leaked = append(leaked, leakedReferences(pass, x.Index)...)
+			return false
+		case *ast.SelectorExpr:
+			if _, ok := published(pass, x); ok {
+				leaked = append(leaked, x)
+				return false
+			}
+			// a field of a field is a copy of the value in the field
+			if s, ok := pass.TypesInfo.Selections[x]; ok && s.Kind() == types.FieldVal {
+				return false
+			}
+		case ast.Expr:
+			if _, ok := published(pass, x); ok {
+				leaked = append(leaked, x)
+				return false
+			}
+		}
+		return true
+	})
+	return leaked
+}
+
+// isIterator returns true if the type is iter.Seq or iter.Seq2
+func isIterator(t types.Type) bool {
+	n, ok := types.Unalias(t).(*types.Named)
+	if !ok || n.Obj().Pkg() == nil {
+		return false
+	}
+	return n.Obj().Pkg().Path() == "iter"
+}
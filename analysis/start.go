@@ -0,0 +1,100 @@
+package analysis
+
+import (
+	"go/ast"
+	"go/token"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// the name of the function that marks the end of the setup of a section
+const startFunction = "Start"
+
+// startCalls records the calls to the Start() function of the crit.Section
+// derived types
+type startCalls struct {
+	// the earliest call for each type, for each function that calls Start().
+	// the function is the function declaration or function literal that
+	// contains the call
+	earliest map[ast.Node]map[string]token.Pos
+
+	// every call, indexed by the position of the opening parenthesis of the
+	// call. this is the same position as used by the SSA call instruction.
+	// the SSA program is built from a separate load of the packages so the
+	// token.Pos values are different and the position must be resolved
+	sites map[token.Position]string
+}
+
+// findStarts looks for calls to the Start() function of the crit section types
+func findStarts(pass *analysis.Pass, inspect *inspector.Inspector) startCalls {
+	starts := startCalls{
+		earliest: make(map[ast.Node]map[string]token.Pos),
+		sites:    make(map[token.Position]string),
+	}
+
+	inspect.WithStack([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+
+		sel, ok := n.(*ast.CallExpr).Fun.(*ast.SelectorExpr)
+		if !ok || sel.Sel.Name != startFunction || !isSectionMember(pass, sel) {
+			return true
+		}
+
+		// the section can be started through the embedded field. for
+		// example, C.Section.Start()
+		x := sel.X
+		if s, ok := x.(*ast.SelectorExpr); ok && isSectionMember(pass, s) {
+			x = s.X
+		}
+		typ := typeName(pass.TypesInfo.TypeOf(x))
+		if typ == "" {
+			return true
+		}
+
+		nf, ok := nearestFunction(stack)
+		if !ok {
+			return true
+		}
+
+		if starts.earliest[nf] == nil {
+			starts.earliest[nf] = make(map[string]token.Pos)
+		}
+		if pos, ok := starts.earliest[nf][typ]; !ok || n.Pos() < pos {
+			starts.earliest[nf][typ] = n.Pos()
+		}
+		starts.sites[pass.Fset.Position(n.(*ast.CallExpr).Lparen)] = typ
+
+		return true
+	})
+
+	return starts
+}
+
+// before returns true if the position is before the call to Start() for the
+// crit.Section derived type in the same function. a position before the call
+// is not before it if a backward goto can run it again after the call
+func (s startCalls) before(nf ast.Node, typ string, pos token.Pos) bool {
+	start, ok := s.earliest[nf][typ]
+	return ok && pos < start && !inGotoLoop(nf, pos, start)
+}
+
+// after returns true if the position is after the call to Start() for the
+// crit.Section derived type in the same function
+func (s startCalls) after(nf ast.Node, typ string, pos token.Pos) bool {
+	start, ok := s.earliest[nf][typ]
+	return ok && pos > start
+}
+
+// started returns true if there is a call to Start() for the crit.Section
+// derived type anywhere in the package
+func (s startCalls) started(typ string) bool {
+	for _, t := range s.sites {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package analysis
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// the prefixes of the functions run by the go test command, and the type of
+// the parameter each function takes
+var testPrefixes = map[string]string{
+	"Test":      "T",
+	"Benchmark": "B",
+	"Fuzz":      "F",
+}
+
+// isTestRoot returns true if the function declaration is a test, benchmark or
+// fuzz function, or TestMain(), in a test file. these functions are called by
+// the go test command and are roots of the callgraph in the same way as main()
+func isTestRoot(pass *analysis.Pass, nf ast.Node) bool {
+	fd, ok := nf.(*ast.FuncDecl)
+	if !ok || fd.Recv != nil {
+		return false
+	}
+	if !isTestFile(pass, fd.Pos()) {
+		return false
+	}
+
+	fn, ok := pass.TypesInfo.Defs[fd.Name].(*types.Func)
+	if !ok {
+		return false
+	}
+	sig := fn.Type().(*types.Signature)
+	if sig.Params().Len() != 1 || sig.Results().Len() != 0 {
+		return false
+	}
+	param := sig.Params().At(0).Type()
+
+	name := fd.Name.Name
+	if name == "TestMain" {
+		return isTestingType(param, "M")
+	}
+	for prefix, typ := range testPrefixes {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		// the character after the prefix must not be lower case. for
+		// example, Testing() is not a test
+		r, _ := utf8.DecodeRuneInString(name[len(prefix):])
+		if unicode.IsLower(r) {
+			return false
+		}
+		return isTestingType(param, typ)
+	}
+	return false
+}
+
+// isTestingType returns true if the type is a pointer to the named type in the
+// testing package
+func isTestingType(t types.Type, name string) bool {
+	p, ok := types.Unalias(t).(*types.Pointer)
+	if !ok {
+		return false
+	}
+	n, ok := types.Unalias(p.Elem()).(*types.Named)
+	if !ok || n.Obj().Pkg() == nil {
+		return false
+	}
+	return n.Obj().Pkg().Path() == "testing" && n.Obj().Name() == name
+}
+
+// enclosingTest returns the test function containing the top of the stack.
+// returns nil if the stack is not inside a test function
+func enclosingTest(pass *analysis.Pass, stack []ast.Node) ast.Node {
+	for _, n := range stack {
+		if fd, ok := n.(*ast.FuncDecl); ok {
+			if isTestRoot(pass, fd) {
+				return fd
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// isTestFile returns true if the position is in a test file
+func isTestFile(pass *analysis.Pass, pos token.Pos) bool {
+	return strings.HasSuffix(pass.Fset.Position(pos).Filename, "_test.go")
+}
+
+// testDoubles is the set of types declared in test files with the testdouble
+// directive. a test double is usually a struct that embeds a crit.Section
+// derived type, or a type that implements crit.Leaser, and there is often
+// more than one of them in a test
+type testDoubles map[*types.TypeName]bool
+
+// findTestDoubles returns the types declared with the testdouble directive.
+// directives outside of test files have no effect and are reported
+func findTestDoubles(pass *analysis.Pass, rep *reporter) testDoubles {
+	tds := make(testDoubles)
+	for _, f := range pass.Files {
+		for _, d := range f.Decls {
+			gd, ok := d.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				ts := spec.(*ast.TypeSpec)
+
+				// the doc comment of a type declaration with a single spec
+				// belongs to the declaration rather than to the spec
+				doc := ts.Doc
+				if doc == nil && len(gd.Specs) == 1 {
+					doc = gd.Doc
+				}
+				if !hasDirective(doc, directiveTestDouble) {
+					continue
+				}
+				if !isTestFile(pass, ts.Pos()) {
+					rep.report(ts.Name.Pos(), RuleTestDouble, subject{field: ts.Name.Name})
+					continue
+				}
+				if id, ok := pass.TypesInfo.Defs[ts.Name].(*types.TypeName); ok {
+					tds[id] = true
+				}
+			}
+		}
+	}
+	return tds
+}
+
+// has returns true if the type is a test double, or a pointer to, an array of
+// or a slice of test doubles
+func (tds testDoubles) has(t types.Type) bool {
+	for t != nil {
+		switch x := types.Unalias(t).(type) {
+		case *types.Pointer:
+			t = x.Elem()
+		case *types.Array:
+			t = x.Elem()
+		case *types.Slice:
+			t = x.Elem()
+		case *types.Named:
+			return tds[x.Origin().Obj()]
+		default:
+			return false
+		}
+	}
+	return false
+}
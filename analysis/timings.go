@@ -0,0 +1,71 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// phase is a single measured phase of the analysis
+type phase struct {
+	name     string
+	duration time.Duration
+}
+
+// timings records how long each phase of the analysis takes. it is used by the
+// -debug.timings flag
+type timings struct {
+	phases []phase
+
+	// each phase is logged at the debug level when it ends. nil if the phases
+	// are not logged
+	log *slog.Logger
+}
+
+// start measuring the named phase. the returned function should be called when
+// the phase ends. if the same phase is measured more than once the durations
+// are added together
+func (t *timings) start(name string) func() {
+	begin := time.Now()
+	return func() {
+		d := time.Since(begin)
+		if t.log != nil {
+			t.log.Debug("phase", "phase", name, "duration", d)
+		}
+		for i := range t.phases {
+			if t.phases[i].name == name {
+				t.phases[i].duration += d
+				return
+			}
+		}
+		t.phases = append(t.phases, phase{name: name, duration: d})
+	}
+}
+
+// total returns the duration of every phase added together
+func (t *timings) total() time.Duration {
+	var total time.Duration
+	for _, p := range t.phases {
+		total += p.duration
+	}
+	return total
+}
+
+// print a summary of the timings for the named package
+func (t *timings) print(w io.Writer, pkg string) {
+	fmt.Fprintf(w, "timings for %s\n", pkg)
+	for _, p := range t.phases {
+		fmt.Fprintf(w, "\t%-12s %v\n", p.name, p.duration.Round(time.Microsecond))
+	}
+	fmt.Fprintf(w, "\t%-12s %v\n", "total", t.total().Round(time.Microsecond))
+}
+
+// result returns the timings in the form used by the result of the analysis
+func (t *timings) result() []Timing {
+	var r []Timing
+	for _, p := range t.phases {
+		r = append(r, Timing{Phase: p.name, Duration: p.duration})
+	}
+	return r
+}
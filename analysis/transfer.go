@@ -0,0 +1,239 @@
+package analysis
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// transfers records the instances of crit.Section derived types that are
+// handed from one goroutine to another with the transfer directive. the
+// directive is written on the channel send or function call that transfers the
+// instance, or on the line before it
+//
+//	ch <- j //critsec:transfer
+//
+// the variable holding the instance is owned by the function that created it
+// until the transfer and must not be used after it. the variable that receives
+// the instance owns it from then on. an owner does not need the lease
+type transfers struct {
+	// variables holding an instance that has been transferred and the end of
+	// the statement that transferred it
+	sent map[*types.Var]token.Pos
+
+	// variables that were initialised with a new instance, either directly or
+	// with a constructor. the function that created the instance owns it until
+	// it is transferred
+	created map[*types.Var]bool
+
+	// variables that receive a transferred instance
+	owned map[*types.Var]bool
+}
+
+// directiveLines returns the lines with the directive, keyed by filename and
+// line number. a directive on a line of its own applies to the line after it
+func directiveLines(pass *analysis.Pass, name string) map[token.Position]bool {
+	lines := make(map[token.Position]bool)
+	for _, f := range pass.Files {
+		var code map[int]bool
+		for _, cg := range f.Comments {
+			for _, c := range cg.List {
+				if !hasDirective(&ast.CommentGroup{List: []*ast.Comment{c}}, name) {
+					continue
+				}
+				if code == nil {
+					code = codeLines(pass, f)
+				}
+				p := pass.Fset.Position(c.Pos())
+				lines[token.Position{Filename: p.Filename, Line: directiveLine(code, p.Line)}] = true
+			}
+		}
+	}
+	return lines
+}
+
+// codeLines returns the lines of the file where a node starts or ends. a
+// comment on any other line is on a line of its own
+func codeLines(pass *analysis.Pass, f *ast.File) map[int]bool {
+	code := make(map[int]bool)
+	ast.Inspect(f, func(n ast.Node) bool {
+		if n != nil {
+			code[pass.Fset.Position(n.Pos()).Line] = true
+			code[pass.Fset.Position(n.End()).Line] = true
+		}
+		return true
+	})
+	return code
+}
+
+// directiveLine returns the line that a directive on the line applies to. a
+// directive on a line of its own applies to the line after it
+func directiveLine(code map[int]bool, line int) int {
+	if code[line] {
+		return line
+	}
+	return line + 1
+}
+
+func findTransfers(pass *analysis.Pass, inspect *inspector.Inspector, constructors map[*types.Func]*types.TypeName) *transfers {
+	t := &transfers{
+		sent:    make(map[*types.Var]token.Pos),
+		created: make(map[*types.Var]bool),
+		owned:   make(map[*types.Var]bool),
+	}
+
+	lines := directiveLines(pass, directiveTransfer)
+	if len(lines) == 0 {
+		return t
+	}
+	isTransfer := func(n ast.Node) bool {
+		p := pass.Fset.Position(n.Pos())
+		return lines[token.Position{Filename: p.Filename, Line: p.Line}]
+	}
+
+	// the types of the channels that instances are sent on, and the functions
+	// (and the parameter index) that instances are passed to. channels are
+	// identified by their type because the same channel is usually held in
+	// different variables by the sender and the receiver
+	chans := make(map[string]bool)
+	params := make(map[*types.Func]map[int]bool)
+
+	send := func(e ast.Expr, end token.Pos) bool {
+		if !isCritDerived(pass.TypesInfo.TypeOf(e)) {
+			return false
+		}
+		v, ok := rootVar(pass, e)
+		if !ok {
+			return false
+		}
+		t.sent[v] = end
+		return true
+	}
+
+	inspect.Preorder([]ast.Node{(*ast.SendStmt)(nil), (*ast.ExprStmt)(nil)}, func(n ast.Node) {
+		if !isTransfer(n) {
+			return
+		}
+		switch m := n.(type) {
+		case *ast.SendStmt:
+			if send(m.Value, m.End()) {
+				chans[chanKey(pass, m.Chan)] = true
+			}
+		case *ast.ExprStmt:
+			call, ok := m.X.(*ast.CallExpr)
+			if !ok {
+				return
+			}
+			fn := typeutil.StaticCallee(pass.TypesInfo, call)
+			for i, arg := range call.Args {
+				if send(arg, m.End()) && fn != nil {
+					if params[fn] == nil {
+						params[fn] = make(map[int]bool)
+					}
+					params[fn][i] = true
+				}
+			}
+		}
+	})
+
+	// variables initialised with a new instance, the variables receiving from
+	// a channel that is used for transfers, and the parameters of functions
+	// that receive a transfer
+	inspect.Preorder([]ast.Node{(*ast.AssignStmt)(nil), (*ast.RangeStmt)(nil), (*ast.FuncDecl)(nil)}, func(n ast.Node) {
+		switch m := n.(type) {
+		case *ast.AssignStmt:
+			for i, lhs := range m.Lhs {
+				v, ok := rootVar(pass, lhs)
+				if !ok {
+					continue
+				}
+				if len(m.Lhs) == len(m.Rhs) {
+					if _, ok := instanceType(pass, m.Rhs[i]); ok {
+						t.created[v] = true
+					}
+					if call, ok := ast.Unparen(m.Rhs[i]).(*ast.CallExpr); ok {
+						if fn := typeutil.StaticCallee(pass.TypesInfo, call); fn != nil && constructors[fn] != nil {
+							t.created[v] = true
+						}
+					}
+				}
+				if i == 0 && len(m.Rhs) == 1 {
+					if u, ok := ast.Unparen(m.Rhs[0]).(*ast.UnaryExpr); ok && u.Op == token.ARROW {
+						if chans[chanKey(pass, u.X)] {
+							t.owned[v] = true
+						}
+					}
+				}
+			}
+		case *ast.RangeStmt:
+			if chans[chanKey(pass, m.X)] && m.Key != nil {
+				if v, ok := rootVar(pass, m.Key); ok {
+					t.owned[v] = true
+				}
+			}
+		case *ast.FuncDecl:
+			fn, ok := pass.TypesInfo.Defs[m.Name].(*types.Func)
+			if !ok || params[fn] == nil {
+				return
+			}
+			sig := fn.Type().(*types.Signature)
+			for i := 0; i < sig.Params().Len(); i++ {
+				if params[fn][i] {
+					t.owned[sig.Params().At(i)] = true
+				}
+			}
+		}
+	})
+
+	return t
+}
+
+// chanKey returns the element type of the channel expression as a string.
+// returns the empty string if the expression is not a channel
+func chanKey(pass *analysis.Pass, e ast.Expr) string {
+	t := pass.TypesInfo.TypeOf(e)
+	if t == nil {
+		return ""
+	}
+	if c, ok := t.Underlying().(*types.Chan); ok {
+		return types.TypeString(c.Elem(), nil)
+	}
+	return ""
+}
+
+// afterTransfer returns true if the section expression is rooted in a variable
+// that has been transferred before the position
+func (t *transfers) afterTransfer(pass *analysis.Pass, section ast.Expr, pos token.Pos) bool {
+	v, ok := rootVar(pass, section)
+	if !ok {
+		return false
+	}
+	end, ok := t.sent[v]
+	return ok && pos >= end
+}
+
+// ownedVar returns true if the identifier is a variable that receives a
+// transferred instance
+func (t *transfers) ownedVar(pass *analysis.Pass, id *ast.Ident) bool {
+	v, ok := pass.TypesInfo.ObjectOf(id).(*types.Var)
+	return ok && t.owned[v]
+}
+
+// owns returns true if the section expression is rooted in a variable that
+// owns the instance at the position. the variable receives ownership from a
+// transfer, or created the instance and has not yet transferred it
+func (t *transfers) owns(pass *analysis.Pass, section ast.Expr, pos token.Pos) bool {
+	v, ok := rootVar(pass, section)
+	if !ok {
+		return false
+	}
+	if t.owned[v] {
+		return true
+	}
+	end, ok := t.sent[v]
+	return ok && t.created[v] && pos < end
+}
@@ -0,0 +1,236 @@
+package analysis
+
+import (
+	"go/ast"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// information about the crit package
+const (
+	critPackage = "github.com/jetsetilly/critsec/crit"
+	critType    = "Section"
+
+	// alternative implementations of crit.Section. they are treated the same
+	// as crit.Section by the analysis
+	critChanType = "ChanSection"
+	critRWType   = "RWSection"
+)
+
+// isCritSectionType returns true if the type is crit.Section, crit.ChanSection
+// or crit.RWSection. the type is identified by the package path and the type
+// name. any vendor prefix is removed from the package path before comparison
+func isCritSectionType(t types.Type) bool {
+	n, ok := types.Unalias(t).(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := n.Obj()
+	if obj.Pkg() == nil {
+		return false
+	}
+	switch obj.Name() {
+	case critType, critChanType, critRWType:
+	default:
+		return false
+	}
+	return isCritPackage(obj.Pkg().Path())
+}
+
+// isCritPackage returns true if the package path is the crit package. any
+// vendor prefix is removed before comparison. forks of the crit package under
+// a different module path can be added with the crit-module flag, either as
+// the path of the module or the path of the package
+func isCritPackage(path string) bool {
+	path = trimVendor(path)
+	if path == critPackage {
+		return true
+	}
+	for _, m := range strings.Split(critModules, ",") {
+		m = strings.TrimSuffix(strings.TrimSpace(m), "/")
+		if m != "" && (path == m || path == m+"/crit") {
+			return true
+		}
+	}
+	return false
+}
+
+// critDerived returns the type name of the crit.Section derived type. the type
+// argument can be the derived type or a pointer to the derived type
+//
+// a crit.Section derived type is a named struct type that embeds crit.Section,
+// or a pointer to crit.Section. the type can be declared in any package, not
+// just the package being analysed
+func critDerived(t types.Type) (*types.TypeName, bool) {
+	if t == nil {
+		return nil, false
+	}
+	t = types.Unalias(t)
+	if p, ok := t.(*types.Pointer); ok {
+		t = types.Unalias(p.Elem())
+	}
+
+	n, ok := t.(*types.Named)
+	if !ok {
+		return nil, false
+	}
+	s, ok := n.Underlying().(*types.Struct)
+	if !ok {
+		return nil, false
+	}
+
+	for i := 0; i < s.NumFields(); i++ {
+		f := s.Field(i)
+		if f.Embedded() && isCritSectionType(embeddedSection(f.Type())) {
+			return n.Obj(), true
+		}
+	}
+
+	return nil, false
+}
+
+// sectionName returns the name of the crit type embedded by the crit.Section
+// derived type, for use in messages. for example, crit.RWSection
+func sectionName(obj *types.TypeName) string {
+	s, ok := obj.Type().Underlying().(*types.Struct)
+	if !ok {
+		return ""
+	}
+	for i := 0; i < s.NumFields(); i++ {
+		f := s.Field(i)
+		if t := embeddedSection(f.Type()); f.Embedded() && isCritSectionType(t) {
+			return "crit." + types.Unalias(t).(*types.Named).Obj().Name()
+		}
+	}
+	return ""
+}
+
+// embeddedSection removes the pointer from the type of an embedded field. a
+// sub-section (see crit.Section.Sub()) is embedded as a pointer
+func embeddedSection(t types.Type) types.Type {
+	if p, ok := types.Unalias(t).(*types.Pointer); ok {
+		return p.Elem()
+	}
+	return t
+}
+
+// isSubSection returns true if the type is a crit.Section derived type that
+// embeds a pointer to the crit section type. the pointer is expected to be
+// a sub-section of another section
+func isSubSection(t types.Type) bool {
+	if _, ok := critDerived(t); !ok {
+		return false
+	}
+	t = types.Unalias(t)
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	s := t.Underlying().(*types.Struct)
+	for i := 0; i < s.NumFields(); i++ {
+		f := s.Field(i)
+		if _, ok := types.Unalias(f.Type()).(*types.Pointer); ok && f.Embedded() && isCritSectionType(embeddedSection(f.Type())) {
+			return true
+		}
+	}
+	return false
+}
+
+// isCritDerived returns true if the type is a crit.Section derived type or a
+// pointer to one
+func isCritDerived(t types.Type) bool {
+	_, ok := critDerived(t)
+	return ok
+}
+
+// trimVendor removes everything up to and including the last vendor directory
+// in a package path
+func trimVendor(path string) string {
+	if i := strings.LastIndex(path, "/vendor/"); i >= 0 {
+		return path[i+len("/vendor/"):]
+	}
+	return strings.TrimPrefix(path, "vendor/")
+}
+
+// unwrapExpr removes the parentheses and the type conversions around the
+// expression. only conversions to a pointer or an interface are removed because
+// the result refers to the same instance as the operand. for example,
+// (*T)(&C) refers to C but T(C) is a copy of C
+func unwrapExpr(pass *analysis.Pass, e ast.Expr) ast.Expr {
+	for {
+		switch x := e.(type) {
+		case *ast.ParenExpr:
+			e = x.X
+			continue
+		case *ast.CallExpr:
+			tv, ok := pass.TypesInfo.Types[x.Fun]
+			if !ok || !tv.IsType() || len(x.Args) != 1 {
+				return e
+			}
+			switch tv.Type.Underlying().(type) {
+			case *types.Pointer, *types.Interface:
+				e = x.Args[0]
+				continue
+			}
+		}
+		return e
+	}
+}
+
+// isSectionMember returns true if the selector expression selects a method
+// declared by one of the crit section types, or selects the embedded crit
+// section itself. for example, the Lease() function promoted from the
+// embedded crit.Section, or the expression C.Section
+//
+// these selections are not accesses of the fields protected by the section
+func isSectionMember(pass *analysis.Pass, sel *ast.SelectorExpr) bool {
+	s, ok := pass.TypesInfo.Selections[sel]
+	if !ok {
+		return false
+	}
+
+	switch s.Kind() {
+	case types.FieldVal:
+		return isCritSectionType(embeddedSection(s.Obj().Type()))
+	case types.MethodVal:
+		recv := s.Obj().(*types.Func).Type().(*types.Signature).Recv()
+		if recv == nil {
+			return false
+		}
+		t := types.Unalias(recv.Type())
+		if p, ok := t.(*types.Pointer); ok {
+			t = p.Elem()
+		}
+		return isCritSectionType(t)
+	}
+
+	return false
+}
+
+// isNestedSection returns true if the selector expression at the top of the
+// stack selects a field that is itself a crit.Section derived type, and the
+// field is only used to select something from it. for example, the expression
+// S.cache in S.cache.entries
+//
+// the nested section protects its own fields and so selecting it is not an
+// access of the outer section
+func isNestedSection(pass *analysis.Pass, sel *ast.SelectorExpr, stack []ast.Node) bool {
+	if !isCritDerived(pass.TypesInfo.TypeOf(sel)) {
+		return false
+	}
+
+	// the nested section can be in parentheses. for example, (S.cache).entries
+	var child ast.Node = sel
+	for i := len(stack) - 2; i >= 0; i-- {
+		switch p := stack[i].(type) {
+		case *ast.ParenExpr:
+			child = p
+			continue
+		case *ast.SelectorExpr:
+			return p.X == child
+		}
+		return false
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package analysis
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// checkUnusedSections reports crit.Section derived types declared in the
+// package where the section does nothing. that is, types with no fields other
+// than the embedded section, and types in a main package where every access to
+// a field is reached from the same function with no callers
+//
+// the second case is the same test as for the confined rule and is not
+// reported if the singlegoroutine flag is set. it is limited to main packages
+// because the goroutines that call into a library are not known. the types
+// reported in the second case are returned so that the unleased accesses of
+// their fields are not also reported
+func checkUnusedSections(pass *analysis.Pass, rep *reporter, inspect *inspector.Inspector, used goroutines) map[string]bool {
+	unnecessary := make(map[string]bool)
+	inspect.Preorder([]ast.Node{(*ast.TypeSpec)(nil)}, func(n ast.Node) {
+		ts := n.(*ast.TypeSpec)
+		obj, ok := pass.TypesInfo.Defs[ts.Name].(*types.TypeName)
+		if !ok {
+			return
+		}
+		id, ok := critDerived(obj.Type())
+		if !ok || id != obj {
+			return
+		}
+		subj := subject{typ: qualifiedName(obj)}
+
+		if obj.Type().Underlying().(*types.Struct).NumFields() == 1 {
+			rep.reportDetail(ts.Pos(), RuleUnusedSection, subj, "no fields other than the section")
+			return
+		}
+
+		// a sub-section is part of a tree of sections and leasing it does
+		// more than protect its own fields
+		if isSubSection(obj.Type()) {
+			return
+		}
+
+		if singleRoutine || pass.Pkg.Name() != "main" || !used.single(subj.typ) {
+			return
+		}
+		if rep.reportExtra(ts.Pos(), RuleUnusedSection, subj, extra{detail: "fields are only used by one goroutine"}) {
+			unnecessary[subj.typ] = true
+		}
+	})
+	return unnecessary
+}
@@ -0,0 +1,89 @@
+package analysis
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// checkValueUse reports crit.Section derived types, and the crit section types
+// themselves, that are used as map keys, map values or array elements, or
+// that are compared with == or !=. all of these copy or compare the lock in
+// the section
+//
+// the crit section types are not currently comparable so map keys and
+// comparisons are also rejected by the compiler. they are checked here so that
+// the rule does not depend on the contents of the section types
+func checkValueUse(pass *analysis.Pass, rep *reporter, inspect *inspector.Inspector) {
+	nodes := []ast.Node{
+		(*ast.MapType)(nil),
+		(*ast.ArrayType)(nil),
+		(*ast.BinaryExpr)(nil),
+	}
+
+	inspect.WithStack(nodes, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+
+		report := func(e ast.Expr, use string) {
+			name, ok := critValue(pass.TypesInfo.TypeOf(e))
+			if !ok {
+				return
+			}
+
+			var detail string
+			if use == "" {
+				detail = fmt.Sprintf("%s compared by value, compare pointers instead", types.ExprString(e))
+			} else {
+				detail = fmt.Sprintf("%s used as %s, use *%s instead", types.ExprString(e), use, types.ExprString(e))
+			}
+
+			rep.reportDetail(e.Pos(), RuleValueUse, subject{
+				typ: name,
+				fn:  functionName(stack),
+			}, detail)
+		}
+
+		switch m := n.(type) {
+		case *ast.MapType:
+			report(m.Key, "map key")
+			report(m.Value, "map value")
+		case *ast.ArrayType:
+			// the elements of a slice are not copied when they are used
+			if m.Len != nil {
+				report(m.Elt, "array element")
+			}
+		case *ast.BinaryExpr:
+			if m.Op == token.EQL || m.Op == token.NEQ {
+				report(m.X, "")
+			}
+		}
+
+		return true
+	})
+}
+
+// critValue returns the qualified name of the type if it is a crit.Section
+// derived type or one of the crit section types, and is not a pointer
+func critValue(t types.Type) (string, bool) {
+	if t == nil {
+		return "", false
+	}
+	if _, ok := types.Unalias(t).(*types.Pointer); ok {
+		return "", false
+	}
+	if id, ok := critDerived(t); ok {
+		return qualifiedName(id), true
+	}
+	if isCritSectionType(t) {
+		if n, ok := types.Unalias(t).(*types.Named); ok {
+			return qualifiedName(n.Obj()), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,282 @@
+package analysis
+
+import (
+	"go/token"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/ssa"
+)
+
+// the functions of the sync package that return a function that calls the
+// function passed to them at most once
+var onceWrappers = map[string]bool{
+	"OnceFunc":   true,
+	"OnceValue":  true,
+	"OnceValues": true,
+}
+
+// the functions of the standard library that call the function passed to them
+// before they return, by package. for example, the comparison function passed
+// to sort.Slice() or slices.SortFunc()
+var callbackFunctions = map[string]map[string]bool{
+	"sort": {
+		"Slice":         true,
+		"SliceStable":   true,
+		"SliceIsSorted": true,
+		"Search":        true,
+		"Find":          true,
+	},
+	"slices": {
+		"SortFunc":         true,
+		"SortStableFunc":   true,
+		"IsSortedFunc":     true,
+		"BinarySearchFunc": true,
+		"ContainsFunc":     true,
+		"IndexFunc":        true,
+		"DeleteFunc":       true,
+		"EqualFunc":        true,
+		"CompareFunc":      true,
+		"CompactFunc":      true,
+		"MinFunc":          true,
+		"MaxFunc":          true,
+	},
+	"maps": {
+		"DeleteFunc": true,
+		"EqualFunc":  true,
+	},
+}
+
+// the functions of the standard library and golang.org/x/sync that run the
+// function passed to them on a new goroutine, by package. for example,
+// errgroup.Group.Go() and sync.WaitGroup.Go()
+var goroutineFunctions = map[string]map[string]bool{
+	"sync": {
+		"Go": true,
+	},
+	"golang.org/x/sync/errgroup": {
+		"Go":    true,
+		"TryGo": true,
+	},
+}
+
+// wrappedCalls records the eventual callers of functions passed to
+// sync.Once.Do(), to the wrappers in onceWrappers, to the functions in
+// callbackFunctions or goroutineFunctions, or to an iterator
+//
+// the callgraph sees these functions as being called from inside the sync
+// package. every function passed to sync.Once.Do() appears to be called by
+// every caller of sync.Once.Do(), which makes the lease check meaningless. the
+// same is true of the functions passed to sort.Slice() and the like. the edges
+// recorded here replace the callers found in the callgraph
+type wrappedCalls map[*ssa.Function][]*callgraph.Edge
+
+// findWrappedCalls looks for calls to sync.Once.Do(), to the wrappers in
+// onceWrappers, to the functions in callbackFunctions and goroutineFunctions,
+// and to iterators. a function passed to
+// a wrapper is only recorded if every call to the function returned by the
+// wrapper can be found. the returned function must be called directly or
+// through a package-level variable
+func findWrappedCalls(graph *callgraph.Graph) wrappedCalls {
+	w := make(wrappedCalls)
+
+	// calls through package-level variables. the call is to the value loaded
+	// from the variable
+	globals := make(map[*ssa.Global][]ssa.CallInstruction)
+
+	type wrapper struct {
+		fn   *ssa.Function
+		call *ssa.Call
+	}
+	var wrappers []wrapper
+
+	// functions passed to the functions in callbackFunctions
+	callbacks := make(map[*ssa.Function]bool)
+
+	for f := range graph.Nodes {
+		if f == nil {
+			continue
+		}
+		for _, b := range f.Blocks {
+			for _, instr := range b.Instrs {
+				c, ok := instr.(ssa.CallInstruction)
+				if !ok {
+					continue
+				}
+				com := c.Common()
+
+				if ld, ok := com.Value.(*ssa.UnOp); ok && ld.Op == token.MUL {
+					if g, ok := ld.X.(*ssa.Global); ok {
+						globals[g] = append(globals[g], c)
+					}
+				}
+
+				// the function passed to an iterator is called by the
+				// function calling the iterator, rather than by every
+				// caller of the iterator. this is the yield function of a
+				// range over a function as well as a function literal
+				// passed to an iter.Seq directly
+				if !com.IsInvoke() && isIterator(com.Value.Type()) {
+					for _, a := range com.Args {
+						if fn := staticFunction(a); fn != nil && fn.Parent() != nil {
+							w.add(graph, fn, c)
+						}
+					}
+					continue
+				}
+
+				// generic instantiations have no package of their own
+				callee := com.StaticCallee()
+				if callee != nil && callee.Origin() != nil {
+					callee = callee.Origin()
+				}
+				if callee == nil || callee.Pkg == nil {
+					continue
+				}
+
+				// the callback is called by the function calling the
+				// standard library function
+				if callbackFunctions[callee.Pkg.Pkg.Path()][callee.Name()] {
+					for _, a := range com.Args {
+						if fn := staticFunction(a); fn != nil {
+							w.add(graph, fn, c)
+							callbacks[fn] = true
+						}
+					}
+					continue
+				}
+
+				// the function is run on a new goroutine by the function
+				// calling the standard library function. the edge is the
+				// start of a goroutine, see isGoroutineStart()
+				if goroutineFunctions[callee.Pkg.Pkg.Path()][callee.Name()] {
+					for _, a := range com.Args {
+						if fn := staticFunction(a); fn != nil {
+							w.add(graph, fn, c)
+							callbacks[fn] = true
+						}
+					}
+					continue
+				}
+
+				if callee.Pkg.Pkg.Path() != "sync" {
+					continue
+				}
+
+				switch {
+				case callee.Name() == "Do" && callee.Signature.Recv() != nil && len(com.Args) == 2:
+					// the function is called by the function calling Do()
+					if fn := staticFunction(com.Args[1]); fn != nil {
+						w.add(graph, fn, c)
+					}
+				case onceWrappers[callee.Name()] && len(com.Args) == 1:
+					call, ok := c.(*ssa.Call)
+					if !ok {
+						continue
+					}
+					if fn := staticFunction(com.Args[0]); fn != nil {
+						wrappers = append(wrappers, wrapper{fn: fn, call: call})
+					}
+				}
+			}
+		}
+	}
+
+	// the calls to the function returned by each wrapper
+	for _, wr := range wrappers {
+		var sites []ssa.CallInstruction
+		complete := true
+		for _, ref := range *wr.call.Referrers() {
+			switch r := ref.(type) {
+			case *ssa.Store:
+				g, ok := r.Addr.(*ssa.Global)
+				if !ok {
+					complete = false
+					break
+				}
+				sites = append(sites, globals[g]...)
+			case ssa.CallInstruction:
+				if r.Common().Value != wr.call {
+					complete = false
+					break
+				}
+				sites = append(sites, r)
+			case *ssa.DebugRef:
+			default:
+				complete = false
+			}
+		}
+		if !complete {
+			continue
+		}
+		for _, c := range sites {
+			w.add(graph, wr.fn, c)
+		}
+	}
+
+	// a named function can be passed as a callback and also be called
+	// directly. the direct calls are kept
+	for fn := range callbacks {
+		n, ok := graph.Nodes[fn]
+		if !ok {
+			continue
+		}
+		for _, e := range n.In {
+			caller := e.Caller.Func
+			if caller.Origin() != nil {
+				caller = caller.Origin()
+			}
+			if caller.Pkg == nil || (callbackFunctions[caller.Pkg.Pkg.Path()] == nil && goroutineFunctions[caller.Pkg.Pkg.Path()] == nil) {
+				w[fn] = append(w[fn], e)
+			}
+		}
+	}
+
+	return w
+}
+
+// add an edge from the function containing the call instruction to the
+// function
+func (w wrappedCalls) add(graph *callgraph.Graph, fn *ssa.Function, site ssa.CallInstruction) {
+	callee, ok := graph.Nodes[fn]
+	if !ok {
+		return
+	}
+	caller, ok := graph.Nodes[site.Parent()]
+	if !ok {
+		return
+	}
+	w[fn] = append(w[fn], &callgraph.Edge{Caller: caller, Site: site, Callee: callee})
+}
+
+// isGoroutineStart returns true if the callee of the edge is run on a new
+// goroutine. the callee is either started by a go statement or passed to one
+// of the functions in goroutineFunctions
+func isGoroutineStart(e *callgraph.Edge) bool {
+	if _, ok := e.Site.(*ssa.Go); ok {
+		return true
+	}
+	if e.Site == nil {
+		return false
+	}
+	callee := e.Site.Common().StaticCallee()
+	if callee != nil && callee.Origin() != nil {
+		callee = callee.Origin()
+	}
+	if callee == nil || callee.Pkg == nil {
+		return false
+	}
+	return goroutineFunctions[callee.Pkg.Pkg.Path()][callee.Name()]
+}
+
+// staticFunction returns the function for the value if the value is a function
+// or a closure. returns nil otherwise
+func staticFunction(v ssa.Value) *ssa.Function {
+	switch f := v.(type) {
+	case *ssa.Function:
+		return f
+	case *ssa.MakeClosure:
+		fn, _ := f.Fn.(*ssa.Function)
+		return fn
+	}
+	return nil
+}
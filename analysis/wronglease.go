@@ -0,0 +1,235 @@
+package analysis
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// sectionPath identifies an instance of a crit.Section derived type by the
+// variable it is rooted in and the fields selected from that variable. for
+// example, the expression s.stateA is identified by the objects for s and
+// stateA
+//
+// two expressions with the same type but a different path refer to different
+// instances of the crit.Section derived type
+type sectionPath []types.Object
+
+// resolveSectionPath returns the path for the expression. returns false if the
+// expression cannot be resolved to a variable and a list of fields, for
+// example, if the expression is a function call or an index expression
+//
+// pointers to crit.Section derived types, and crit.Instrumented wrappers, are
+// resolved to the instance they point to using the aliases. a pointer that could point to more than one
+// instance cannot be resolved. pointers to structs that contain the instance
+// are resolved in the same way where possible, so that the path is the whole
+// chain of fields from the variable that owns the instance
+func resolveSectionPath(pass *analysis.Pass, al aliases, e ast.Expr) (sectionPath, bool) {
+	return resolveSectionPathDepth(pass, al, e, 0)
+}
+
+func resolveSectionPathDepth(pass *analysis.Pass, al aliases, e ast.Expr, depth int) (sectionPath, bool) {
+	if depth > maxAliasDepth {
+		return nil, false
+	}
+
+	switch x := e.(type) {
+	case *ast.ParenExpr:
+		return resolveSectionPathDepth(pass, al, x.X, depth)
+	case *ast.StarExpr:
+		return resolveSectionPathDepth(pass, al, x.X, depth)
+	case *ast.UnaryExpr:
+		return resolveSectionPathDepth(pass, al, x.X, depth)
+	case *ast.CallExpr:
+		// a conversion of a pointer to the instance
+		if u := unwrapExpr(pass, x); u != ast.Expr(x) {
+			return resolveSectionPathDepth(pass, al, u, depth)
+		}
+	case *ast.Ident:
+		obj := pass.TypesInfo.ObjectOf(x)
+		if _, ok := obj.(*types.Var); !ok {
+			return nil, false
+		}
+		if isCritPointer(obj.Type()) || isSectionPointer(obj.Type()) || isInstrumentedType(obj.Type()) {
+			target, ok := al[obj]
+			if !ok || target == nil {
+				return nil, false
+			}
+			return resolveSectionPathDepth(pass, al, target, depth+1)
+		}
+
+		// a pointer to a struct containing the instance is followed if
+		// possible. otherwise the pointer is the root of the path, but
+		// it can't be compared with a path rooted in another variable
+		if isOwnerPointer(obj.Type()) {
+			if target := al[obj]; target != nil {
+				return resolveSectionPathDepth(pass, al, target, depth+1)
+			}
+		}
+		return sectionPath{obj}, true
+	case *ast.SelectorExpr:
+		sel, ok := pass.TypesInfo.Selections[x]
+		if !ok {
+			// a qualified identifier. a variable declared in another package
+			obj := pass.TypesInfo.ObjectOf(x.Sel)
+			if _, ok := obj.(*types.Var); !ok {
+				return nil, false
+			}
+			return sectionPath{obj}, true
+		}
+		if sel.Kind() != types.FieldVal {
+			return nil, false
+		}
+		p, ok := resolveSectionPathDepth(pass, al, x.X, depth)
+		if !ok {
+			return nil, false
+		}
+		return append(p[:len(p):len(p)], sel.Obj()), true
+	}
+	return nil, false
+}
+
+// resolveLeaseReceiver returns the path of the instance that is leased by a
+// call to a lease function with the receiver. this is the same as the path of
+// the receiver, except that leasing the embedded section of an instance leases
+// the instance itself. for example, C.Lease(), C.Section.Lease() and
+// (&C.Section).Lease() all lease C
+func resolveLeaseReceiver(pass *analysis.Pass, al aliases, recv ast.Expr) (sectionPath, bool) {
+	p, ok := resolveSectionPath(pass, al, recv)
+	if !ok || len(p) < 2 {
+		return p, ok
+	}
+	if f, ok := p[len(p)-1].(*types.Var); ok && f.Embedded() && isCritSectionType(embeddedSection(f.Type())) {
+		return p[:len(p)-1], true
+	}
+	return p, true
+}
+
+// comparable returns true if it can be known whether both paths refer to the
+// same instance. a path rooted in a pointer that could not be resolved can
+// only be compared with a path that has the same root
+func (p sectionPath) comparable(q sectionPath) bool {
+	if len(p) == 0 || len(q) == 0 || p[0] == q[0] {
+		return true
+	}
+	return !isOwnerPointer(p[0].Type()) && !isOwnerPointer(q[0].Type())
+}
+
+// equal returns true if both paths refer to the same instance
+func (p sectionPath) equal(q sectionPath) bool {
+	if len(p) != len(q) {
+		return false
+	}
+	for i := range p {
+		if p[i] != q[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// prefixOf returns true if the path is a prefix of q. for example, the path
+// for s is a prefix of the path for s.cache
+func (p sectionPath) prefixOf(q sectionPath) bool {
+	return len(p) < len(q) && p.equal(q[:len(p)])
+}
+
+// checkWrongLease reports accesses to a crit.Section derived type made inside
+// the lease of a different instance. for example, if a struct contains two
+// crit.Section derived fields then leasing one of the fields does not protect
+// the other
+//
+// only accesses made directly inside the function literal passed to a lease
+// method or lease function are checked. accesses in functions called
+// from the lease are not checked
+func checkWrongLease(pass *analysis.Pass, rep *reporter, inspect *inspector.Inspector, al aliases) {
+	inspect.WithStack([]ast.Node{(*ast.SelectorExpr)(nil)}, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+
+		m := n.(*ast.SelectorExpr)
+		if isSectionMember(pass, m) || isNestedSection(pass, m, stack) || !isCritDerived(pass.TypesInfo.TypeOf(m.X)) {
+			return true
+		}
+
+		accessed, ok := resolveSectionPath(pass, al, m.X)
+		if !ok {
+			return true
+		}
+
+		// find every lease that lexically contains the access. the access is
+		// fine if any of them is a lease of the same instance. a lease can
+		// cover more than one instance. for example, crit.Lease2() leases two
+		var leased []ast.Expr
+		for i := 0; i < len(stack)-1; i++ {
+			call, ok := stack[i].(*ast.CallExpr)
+			if !ok {
+				continue
+			}
+
+			lc, ok := isCoveringCall(pass, call)
+			if !ok || lc.lit == nil || stack[i+1] != lc.lit {
+				continue
+			}
+			if len(lc.covered) == 0 {
+				return true
+			}
+
+			for _, recv := range lc.covered {
+				// a slice or an interface could hold any section
+				switch pass.TypesInfo.TypeOf(recv).Underlying().(type) {
+				case *types.Slice, *types.Interface:
+					return true
+				}
+
+				p, ok := resolveLeaseReceiver(pass, al, recv)
+				if !ok || !p.comparable(accessed) || p.equal(accessed) {
+					return true
+				}
+
+				// leasing a section implies the lease of its sub-sections
+				if isSubSection(pass.TypesInfo.TypeOf(m.X)) && p.prefixOf(accessed) {
+					return true
+				}
+			}
+
+			// the innermost lease is used in the report
+			leased = lc.covered
+		}
+
+		if leased == nil {
+			return true
+		}
+
+		var names []string
+		for _, l := range leased {
+			names = append(names, types.ExprString(ast.Unparen(l)))
+		}
+		verb := "is"
+		if len(names) > 1 {
+			verb = "are"
+		}
+		detail := fmt.Sprintf("%s %s leased but %s is accessed", joinNames(names), verb, types.ExprString(ast.Unparen(m.X)))
+
+		rep.reportDetail(m.Pos(), RuleWrongLease, subject{
+			typ:   typeName(pass.TypesInfo.TypeOf(m.X)),
+			field: m.Sel.Name,
+			fn:    functionName(stack),
+		}, detail)
+
+		return true
+	})
+}
+
+// joinNames joins the names in the form "A", "A and B" or "A, B and C"
+func joinNames(names []string) string {
+	if len(names) < 2 {
+		return strings.Join(names, "")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
@@ -0,0 +1,145 @@
+package crit
+
+import (
+	"sync"
+)
+
+// Token represents ownership of a ChanSection. it is received from the channel
+// returned by AcquireC() and must be given back with Release() of the same
+// section
+type Token struct {
+	// the section the token belongs to. used to check the call to Release()
+	// when built with the critdebug build tag
+	owner *ChanSection
+}
+
+// ChanSection is an alternative to Section that uses a channel rather than a
+// mutex. it can be embedded in a struct in exactly the same way as Section
+//
+// in addition to Lease(), the section can be acquired by receiving from the
+// channel returned by AcquireC(). this means that acquisition can be part of a
+// select statement, which is useful in event loops
+//
+// the zero value is ready to use
+type ChanSection struct {
+	// the name of the section. see SetName()
+	name string
+
+	once  sync.Once
+	token chan Token
+
+	// one-time initialisation. see InitOnce()
+	setup initOnce
+
+	// see Start()
+	life lifecycle
+}
+
+// init creates the token channel and puts the only token in it
+func (crit *ChanSection) init() {
+	crit.once.Do(func() {
+		crit.token = make(chan Token, 1)
+		crit.token <- Token{owner: crit}
+	})
+}
+
+// Lease acquires the critical section for the entire duration of the supplied
+// function
+func (crit *ChanSection) Lease(f func() error) error {
+	crit.life.reenter(crit.String)
+	ob := observe(crit, false)
+	var t Token
+	if ob == nil {
+		t = <-crit.AcquireC()
+	} else {
+		ob.lock(func() bool {
+			select {
+			case t = <-crit.AcquireC():
+				return true
+			default:
+				return false
+			}
+		}, func() {
+			t = <-crit.AcquireC()
+		})
+	}
+	defer crit.Release(t)
+
+	ob.acquired()
+	defer ob.released()
+
+	crit.life.enter(crit.String, false)
+	defer crit.life.leave()
+
+	return f()
+}
+
+// TryLease is the same as Lease except that it does not wait for the section.
+// if the section is held elsewhere then f is not called and TryLease returns
+// false. otherwise it returns true and the error returned by f
+func (crit *ChanSection) TryLease(f func() error) (bool, error) {
+	ob := observe(crit, false)
+	var t Token
+	select {
+	case t = <-crit.AcquireC():
+	default:
+		return false, nil
+	}
+	defer crit.Release(t)
+
+	ob.acquired()
+	defer ob.released()
+
+	crit.life.enter(crit.String, false)
+	defer crit.life.leave()
+
+	return true, f()
+}
+
+// AcquireC returns a channel from which the token for the critical section can
+// be received. the critical section is held from the moment the token is
+// received until it is given back with Release()
+//
+//	select {
+//	case t := <-C.AcquireC():
+//		C.value++
+//		C.Release(t)
+//	case <-done:
+//	}
+//
+// note that the analysis does not understand AcquireC(). accesses made while
+// holding the token will be reported unless they are in a function with the
+// requires directive
+func (crit *ChanSection) AcquireC() <-chan Token {
+	crit.init()
+	return crit.token
+}
+
+// Release gives the token back to the critical section. it panics if the
+// critical section is not currently held. when built with the critdebug build
+// tag it also panics if the token belongs to a different section
+func (crit *ChanSection) Release(t Token) {
+	crit.init()
+	if debug && t.owner != crit {
+		from := "a token not received from AcquireC()"
+		if t.owner != nil {
+			from = "a token from " + t.owner.String()
+		}
+		panic(violation("crit: Release of "+crit.String()+" with "+from, &crit.life))
+	}
+	select {
+	case crit.token <- t:
+	default:
+		panic(violation("crit: Release of "+crit.String()+" that is not held", &crit.life))
+	}
+}
+
+// InitOnce calls f while holding the lease, but only the first time InitOnce
+// is called. f is never called again, even if it returned an error. the error
+// returned by f is returned by every call to InitOnce
+//
+// the analysis allows fields that are only ever written inside f to be read
+// without the lease
+func (crit *ChanSection) InitOnce(f func() error) error {
+	return crit.setup.do(crit, f)
+}
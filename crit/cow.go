@@ -0,0 +1,69 @@
+package crit
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// COW holds a value that is read often and written rarely. readers never
+// block and always see a complete value. writers take a copy of the current
+// value, change the copy and then publish it
+//
+// values returned by Load() must be treated as immutable. if the value
+// contains slices, maps or pointers then a clone function should be set with
+// SetClone() so that writers do not change memory that readers can see
+//
+// the zero value holds the zero value of T and is ready to use
+type COW[T any] struct {
+	// serialises writers
+	lock sync.Mutex
+
+	value atomic.Pointer[T]
+	clone func(T) T
+}
+
+// SetClone sets the function used to copy the value before it is changed by
+// Update(). by default the value is copied with a simple assignment. it must
+// be called before the first call to Update()
+func (c *COW[T]) SetClone(clone func(T) T) {
+	c.clone = clone
+}
+
+// Load returns the current value. it does not block and can be called without
+// a lease
+func (c *COW[T]) Load() T {
+	if v := c.value.Load(); v != nil {
+		return *v
+	}
+	var zero T
+	return zero
+}
+
+// Store replaces the current value
+func (c *COW[T]) Store(v T) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.value.Store(&v)
+}
+
+// Update calls f with a copy of the current value. if f returns nil then the
+// changed copy is published and will be returned by subsequent calls to
+// Load(). if f returns an error then the copy is discarded and the error is
+// returned
+//
+// calls to Update() are serialised with each other and with Store() but never
+// block calls to Load()
+func (c *COW[T]) Update(f func(v *T) error) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	next := c.Load()
+	if c.clone != nil {
+		next = c.clone(next)
+	}
+	if err := f(&next); err != nil {
+		return err
+	}
+	c.value.Store(&next)
+	return nil
+}
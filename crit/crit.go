@@ -1,19 +1,232 @@
 package crit
 
 import (
+	"fmt"
 	"sync"
+	"sync/atomic"
 )
 
 // Section can be embedded in a struct to indicate that the fields in that
 // struct are being accessed in a critical section
 type Section struct {
 	lock sync.Mutex
+
+	// the name of the section. see SetName()
+	name string
+
+	// used instead of lock if the section has been configured with an option
+	// that requires it
+	fair *fairLock
+
+	// one-time initialisation. see InitOnce()
+	setup initOnce
+
+	// the parent and sub-sections of the section. see Sub()
+	tree *tree
+
+	// see Start()
+	life lifecycle
+}
+
+// Configure changes the behaviour of the critical section. it must be called
+// before the section is first leased and must not be called while the
+// section is in use
+//
+//	var C exampleCritSectioning
+//	C.Configure(crit.WithFIFO())
+func (crit *Section) Configure(opts ...Option) {
+	o := makeOptions(opts)
+	if o.fifo {
+		crit.fair = newFairLock(o)
+	} else {
+		crit.fair = nil
+	}
 }
 
 // Lease locks a critical section for the entire duration of the supplied
 // function
 func (crit *Section) Lease(f func() error) error {
-	crit.lock.Lock()
-	defer crit.lock.Unlock()
+	// a section in a tree is checked by acquireTree()
+	if crit.tree == nil {
+		crit.life.reenter(crit.String)
+	}
+	ob := observe(crit, false)
+	switch {
+	case crit.tree != nil:
+		var release func()
+		if ob == nil {
+			release, _ = crit.acquireTree(false)
+		} else {
+			ob.lock(func() bool {
+				var ok bool
+				release, ok = crit.acquireTree(true)
+				return ok
+			}, func() {
+				release, _ = crit.acquireTree(false)
+			})
+		}
+		defer release()
+	case crit.fair != nil:
+		if ob == nil {
+			crit.fair.lock()
+		} else {
+			ob.lock(crit.fair.tryLock, crit.fair.lock)
+		}
+		defer crit.fair.unlock()
+	default:
+		if ob == nil {
+			crit.lock.Lock()
+		} else {
+			ob.lock(crit.lock.TryLock, crit.lock.Lock)
+		}
+		defer crit.lock.Unlock()
+	}
+
+	ob.acquired()
+	defer ob.released()
+
+	crit.life.enter(crit.String, false)
+	defer crit.life.leave()
+
 	return f()
 }
+
+// TryLease is the same as Lease except that it does not wait for the lease. if
+// the lease is held elsewhere then f is not called and TryLease returns false.
+// otherwise it returns true and the error returned by f
+//
+//	if ok, err := C.TryLease(func() error {
+//		C.value++
+//		return nil
+//	}); !ok {
+//		// the section is busy
+//	}
+func (crit *Section) TryLease(f func() error) (bool, error) {
+	ob := observe(crit, false)
+	switch {
+	case crit.tree != nil:
+		release, ok := crit.acquireTree(true)
+		if !ok {
+			return false, nil
+		}
+		defer release()
+	case crit.fair != nil:
+		if !crit.fair.tryLock() {
+			return false, nil
+		}
+		defer crit.fair.unlock()
+	default:
+		if !crit.lock.TryLock() {
+			return false, nil
+		}
+		defer crit.lock.Unlock()
+	}
+
+	ob.acquired()
+	defer ob.released()
+
+	crit.life.enter(crit.String, false)
+	defer crit.life.leave()
+
+	return true, f()
+}
+
+// Release ends a lease started with Acquire() or RAcquire(). it must be called
+// exactly once, by the goroutine that acquired the lease. when built with the
+// critdebug build tag a second call, or a call from another goroutine, panics
+type Release func()
+
+// newRelease returns the Release for a lease of the named section. the unlock
+// function releases the lock that was acquired. the observation can be nil
+func newRelease(name func() string, life *lifecycle, ob *observation, unlock func()) Release {
+	var released atomic.Bool
+
+	// the goroutine that acquired the lease and where it was acquired. only
+	// used in debug mode
+	var id int64
+	var acquired []uintptr
+	if debug {
+		id = goid()
+		acquired = callers()
+	}
+
+	return func() {
+		if debug && released.Swap(true) {
+			panic(violation("crit: release of "+name()+" called twice", nil) +
+				"\nacquired at:\n" + formatStack(acquired))
+		}
+		if debug && goid() != id {
+			msg := fmt.Sprintf("crit: release of %s on goroutine %d but acquired on goroutine %d", name(), goid(), id)
+			panic(violation(msg, nil) + "\nacquired at:\n" + formatStack(acquired))
+		}
+		life.leave()
+		ob.released()
+		unlock()
+	}
+}
+
+// Acquire locks the critical section until the returned Release is called. it
+// is an alternative to Lease() for code where a function literal is awkward,
+// such as code that returns early
+//
+//	release := C.Acquire()
+//	defer release()
+//	if C.value == 0 {
+//		return errEmpty
+//	}
+//	C.value--
+//
+// the analysis treats accesses between the call to Acquire() and the call to
+// the release as leased, and reports an Acquire() that is not released on
+// every path through the function
+func (crit *Section) Acquire() Release {
+	// a section in a tree is checked by acquireTree()
+	if crit.tree == nil {
+		crit.life.reenter(crit.String)
+	}
+	ob := observe(crit, false)
+	var release func()
+	switch {
+	case crit.tree != nil:
+		if ob == nil {
+			release, _ = crit.acquireTree(false)
+		} else {
+			ob.lock(func() bool {
+				var ok bool
+				release, ok = crit.acquireTree(true)
+				return ok
+			}, func() {
+				release, _ = crit.acquireTree(false)
+			})
+		}
+	case crit.fair != nil:
+		if ob == nil {
+			crit.fair.lock()
+		} else {
+			ob.lock(crit.fair.tryLock, crit.fair.lock)
+		}
+		release = crit.fair.unlock
+	default:
+		if ob == nil {
+			crit.lock.Lock()
+		} else {
+			ob.lock(crit.lock.TryLock, crit.lock.Lock)
+		}
+		release = crit.lock.Unlock
+	}
+
+	ob.acquired()
+	crit.life.enter(crit.String, false)
+
+	return newRelease(crit.String, &crit.life, ob, release)
+}
+
+// InitOnce calls f while holding the lease, but only the first time InitOnce
+// is called. f is never called again, even if it returned an error. the error
+// returned by f is returned by every call to InitOnce
+//
+// the analysis allows fields that are only ever written inside f to be read
+// without the lease
+func (crit *Section) InitOnce(f func() error) error {
+	return crit.setup.do(crit, f)
+}
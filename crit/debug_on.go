@@ -0,0 +1,8 @@
+//go:build critdebug
+
+package crit
+
+// debug is true when the package is built with the critdebug build tag. in
+// debug mode the goroutines holding each lease are tracked so that
+// AssertLeased() can check them
+const debug = true
@@ -0,0 +1,131 @@
+package crit
+
+import (
+	"sync"
+)
+
+// fairLock is a reader/writer lock that can grant leases in request order or
+// with priority given to writers. it is slower than sync.Mutex and
+// sync.RWMutex and is only used when a section is configured with an option
+// that requires it
+type fairLock struct {
+	opts options
+
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	// number of active readers and whether there is an active writer
+	readers int
+	writer  bool
+
+	// number of writers waiting for the lock. used for writer priority
+	waitingWriters int
+
+	// ticket numbers used for FIFO ordering. next is the ticket that will be
+	// given to the next request and serving is the ticket of the request at
+	// the front of the queue
+	next    uint64
+	serving uint64
+}
+
+func newFairLock(opts options) *fairLock {
+	l := &fairLock{opts: opts}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+func (l *fairLock) lock() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.opts.fifo {
+		ticket := l.next
+		l.next++
+		for ticket != l.serving || l.writer || l.readers > 0 {
+			l.cond.Wait()
+		}
+		l.serving++
+		l.writer = true
+		l.cond.Broadcast()
+		return
+	}
+
+	l.waitingWriters++
+	for l.writer || l.readers > 0 {
+		l.cond.Wait()
+	}
+	l.waitingWriters--
+	l.writer = true
+}
+
+func (l *fairLock) unlock() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.writer = false
+	l.cond.Broadcast()
+}
+
+func (l *fairLock) rlock() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.opts.fifo {
+		ticket := l.next
+		l.next++
+		for ticket != l.serving || l.writer {
+			l.cond.Wait()
+		}
+		l.serving++
+		l.readers++
+		l.cond.Broadcast()
+		return
+	}
+
+	for l.writer || (l.opts.writerPriority && l.waitingWriters > 0) {
+		l.cond.Wait()
+	}
+	l.readers++
+}
+
+func (l *fairLock) runlock() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.readers--
+	if l.readers == 0 {
+		l.cond.Broadcast()
+	}
+}
+
+// tryLock acquires the write lock only if it can be acquired without waiting.
+// a request that is granted immediately is always at the front of the queue so
+// FIFO ordering is not affected
+func (l *fairLock) tryLock() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.writer || l.readers > 0 || l.next != l.serving {
+		return false
+	}
+	if l.opts.fifo {
+		l.next++
+		l.serving++
+	}
+	l.writer = true
+	return true
+}
+
+// tryRLock acquires the read lock only if it can be acquired without waiting
+func (l *fairLock) tryRLock() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.writer || l.next != l.serving || (l.opts.writerPriority && l.waitingWriters > 0) {
+		return false
+	}
+	if l.opts.fifo {
+		l.next++
+		l.serving++
+	}
+	l.readers++
+	return true
+}
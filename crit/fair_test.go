@@ -0,0 +1,294 @@
+package crit
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitFor waits until the condition is true of the state of the lock. the
+// condition is checked with the lock's mutex held
+func waitFor(t *testing.T, l *fairLock, cond func(l *fairLock) bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		l.mu.Lock()
+		ok := cond(l)
+		l.mu.Unlock()
+		if ok {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the state of the lock")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// queued returns a condition that is true once n tickets have been given out
+func queued(n uint64) func(l *fairLock) bool {
+	return func(l *fairLock) bool {
+		return l.next == n
+	}
+}
+
+// waitGroup waits for the goroutines of a test. a lease that is never granted
+// fails the test rather than leaving it to hang
+func waitGroup(t *testing.T, wg *sync.WaitGroup) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the leases to be granted")
+	}
+}
+
+// recorder records the order in which leases are granted
+type recorder struct {
+	mu    sync.Mutex
+	order []string
+}
+
+func (r *recorder) record(s string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.order = append(r.order, s)
+}
+
+func TestFIFOSection(t *testing.T) {
+	var s Section
+	s.Configure(WithFIFO())
+
+	// the test holds the lock so that every lease has to queue
+	s.fair.lock()
+
+	var r recorder
+	var wg sync.WaitGroup
+	want := []string{"a", "b", "c", "d", "e"}
+	for i, name := range want {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = s.Lease(func() error {
+				r.record(name)
+				return nil
+			})
+		}()
+
+		// the next lease is only requested once this one has its ticket
+		waitFor(t, s.fair, queued(uint64(i+2)))
+	}
+
+	s.fair.unlock()
+	waitGroup(t, &wg)
+
+	if !slices.Equal(r.order, want) {
+		t.Errorf("leases granted in the order %v, want %v", r.order, want)
+	}
+}
+
+func TestFIFORWSection(t *testing.T) {
+	var s RWSection
+	s.Configure(WithFIFO())
+
+	s.fair.lock()
+
+	type request struct {
+		name string
+		read bool
+	}
+	requests := []request{
+		{"w1", false},
+		{"r1", true},
+		{"w2", false},
+		{"w3", false},
+		{"r2", true},
+		{"w4", false},
+	}
+
+	var r recorder
+	var wg sync.WaitGroup
+	for i, req := range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f := func() error {
+				r.record(req.name)
+				return nil
+			}
+			if req.read {
+				_ = s.RLease(f)
+			} else {
+				_ = s.Lease(f)
+			}
+		}()
+		waitFor(t, s.fair, queued(uint64(i+2)))
+	}
+
+	s.fair.unlock()
+	waitGroup(t, &wg)
+
+	want := []string{"w1", "r1", "w2", "w3", "r2", "w4"}
+	if !slices.Equal(r.order, want) {
+		t.Errorf("leases granted in the order %v, want %v", r.order, want)
+	}
+}
+
+// read leases that are next to each other in the queue are granted together.
+// the write lease queued behind them waits until both have ended
+func TestFIFOAdjacentReaders(t *testing.T) {
+	var s RWSection
+	s.Configure(WithFIFO())
+
+	s.fair.lock()
+
+	var r recorder
+	var wg sync.WaitGroup
+	held := make(chan string)
+	release := make(chan struct{})
+
+	for i, name := range []string{"r1", "r2"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = s.RLease(func() error {
+				held <- name
+				<-release
+				r.record(name)
+				return nil
+			})
+		}()
+		waitFor(t, s.fair, queued(uint64(i+2)))
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_ = s.Lease(func() error {
+			r.record("w")
+			return nil
+		})
+	}()
+	waitFor(t, s.fair, queued(4))
+
+	s.fair.unlock()
+
+	for range 2 {
+		select {
+		case <-held:
+		case <-time.After(5 * time.Second):
+			t.Fatal("adjacent read leases were not granted together")
+		}
+	}
+
+	// both readers hold the lease and the writer has the next ticket
+	s.fair.mu.Lock()
+	readers, writer, serving := s.fair.readers, s.fair.writer, s.fair.serving
+	s.fair.mu.Unlock()
+	if readers != 2 || writer || serving != 3 {
+		t.Errorf("readers=%d writer=%v serving=%d while the read leases are held, want readers=2 writer=false serving=3",
+			readers, writer, serving)
+	}
+
+	close(release)
+	waitGroup(t, &wg)
+
+	if len(r.order) != 3 || r.order[2] != "w" {
+		t.Errorf("leases granted in the order %v, want the write lease last", r.order)
+	}
+}
+
+// a try lease does not jump the queue. a queued write lease is waiting for the
+// read lease held by the test, so a read lease could be granted if it weren't
+// for the queue
+func TestFIFOTryLease(t *testing.T) {
+	var s RWSection
+	s.Configure(WithFIFO())
+
+	s.fair.rlock()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_ = s.Lease(func() error {
+			return nil
+		})
+	}()
+	waitFor(t, s.fair, queued(2))
+
+	if ok, _ := s.TryRLease(func() error { return nil }); ok {
+		t.Error("TryRLease() succeeded while a write lease was queued")
+	}
+	if ok, _ := s.TryLease(func() error { return nil }); ok {
+		t.Error("TryLease() succeeded while a write lease was queued")
+	}
+
+	s.fair.runlock()
+	waitGroup(t, &wg)
+
+	if ok, _ := s.TryRLease(func() error { return nil }); !ok {
+		t.Error("TryRLease() failed with an empty queue")
+	}
+	if ok, _ := s.TryLease(func() error { return nil }); !ok {
+		t.Error("TryLease() failed with an empty queue")
+	}
+}
+
+// a waiting write lease blocks new read leases, even though the section is
+// only held for reading
+func TestWriterPriority(t *testing.T) {
+	var s RWSection
+	s.Configure(WithWriterPriority())
+
+	s.fair.rlock()
+
+	var r recorder
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_ = s.Lease(func() error {
+			r.record("w")
+			return nil
+		})
+	}()
+	waitFor(t, s.fair, func(l *fairLock) bool {
+		return l.waitingWriters == 1
+	})
+
+	if ok, _ := s.TryRLease(func() error { return nil }); ok {
+		t.Error("TryRLease() succeeded while a write lease was waiting")
+	}
+
+	acquired := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_ = s.RLease(func() error {
+			r.record("r")
+			close(acquired)
+			return nil
+		})
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("read lease granted while a write lease was waiting")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	s.fair.runlock()
+	waitGroup(t, &wg)
+
+	want := []string{"w", "r"}
+	if !slices.Equal(r.order, want) {
+		t.Errorf("leases granted in the order %v, want %v", r.order, want)
+	}
+}
@@ -0,0 +1,85 @@
+package crit
+
+import (
+	"sync"
+)
+
+// SectionInfo describes a section held by a goroutine. see Held()
+type SectionInfo struct {
+	// the name of the section, as returned by String()
+	Name string
+
+	// the section is held with the read lease of a crit.RWSection
+	Read bool
+}
+
+// the sections held by each goroutine, in the order they were leased. the
+// value for a goroutine is only ever changed or read by that goroutine. only
+// used in debug mode
+var heldSections sync.Map
+
+// heldList is the list of sections held by a goroutine. the life field
+// identifies the section so that the right entry is removed when it is
+// released
+type heldList []heldEntry
+
+type heldEntry struct {
+	life *lifecycle
+	info SectionInfo
+}
+
+// Held returns the sections held by the current goroutine, in the order they
+// were leased. a section leased more than once, for example a sub-section
+// leased while its parent is held, appears once for each lease
+//
+// Held is only useful when built with the critdebug build tag. it always
+// returns nil otherwise. it can be used to make assertions in library code
+// about the leases held by the caller
+//
+//	if len(crit.Held()) != 1 {
+//		panic("exactly one section should be held")
+//	}
+//
+// a token received from ChanSection.AcquireC() is not associated with a
+// goroutine and is not included
+func Held() []SectionInfo {
+	if !debug {
+		return nil
+	}
+	l, ok := heldSections.Load(goid())
+	if !ok {
+		return nil
+	}
+	var info []SectionInfo
+	for _, e := range *l.(*heldList) {
+		info = append(info, e.info)
+	}
+	return info
+}
+
+// pushHeld adds the section to the list of sections held by the goroutine
+func pushHeld(id int64, life *lifecycle, info SectionInfo) {
+	l, _ := heldSections.LoadOrStore(id, &heldList{})
+	hl := l.(*heldList)
+	*hl = append(*hl, heldEntry{life: life, info: info})
+}
+
+// popHeld removes the most recent lease of the section from the list of
+// sections held by the goroutine. the list is removed once it is empty so
+// that the map doesn't grow with every goroutine that has ever held a lease
+func popHeld(id int64, life *lifecycle) {
+	l, ok := heldSections.Load(id)
+	if !ok {
+		return
+	}
+	hl := l.(*heldList)
+	for i := len(*hl) - 1; i >= 0; i-- {
+		if (*hl)[i].life == life {
+			*hl = append((*hl)[:i], (*hl)[i+1:]...)
+			break
+		}
+	}
+	if len(*hl) == 0 {
+		heldSections.Delete(id)
+	}
+}
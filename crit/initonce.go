@@ -0,0 +1,29 @@
+package crit
+
+import (
+	"sync/atomic"
+)
+
+// initOnce records whether the one-time initialisation of a section has
+// happened and the result of it
+type initOnce struct {
+	done atomic.Bool
+	err  error
+}
+
+// do calls f under the lease if it has not been called before. the error
+// returned by f is returned by this and every subsequent call
+func (o *initOnce) do(l Leaser, f func() error) error {
+	if o.done.Load() {
+		return o.err
+	}
+	_ = l.Lease(func() error {
+		if o.done.Load() {
+			return nil
+		}
+		o.err = f()
+		o.done.Store(true)
+		return nil
+	})
+	return o.err
+}
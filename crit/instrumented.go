@@ -0,0 +1,72 @@
+package crit
+
+import (
+	"time"
+)
+
+// Hooks are the functions called by Instrumented. any of the functions can be
+// nil
+type Hooks struct {
+	// called before the lease is requested
+	Before func()
+
+	// called when the lease has been acquired. wait is how long it took to
+	// acquire the lease
+	Acquired func(wait time.Duration)
+
+	// called when the lease has been released. hold is how long the lease was
+	// held for and err is the error returned by the leased function
+	After func(hold time.Duration, err error)
+}
+
+// Instrumented wraps a Leaser and calls the hooks around every lease. it can be
+// used to add logging, tracing or metrics to a section without changing the
+// section itself
+//
+//	ins := crit.NewInstrumented(&C, crit.Hooks{
+//		After: func(hold time.Duration, err error) {
+//			log.Printf("lease held for %v", hold)
+//		},
+//	})
+//
+//	_ = ins.Lease(func() error {
+//		C.value++
+//		return nil
+//	})
+//
+// the analysis treats the Lease() function of Instrumented the same as the
+// Lease() function of the wrapped section
+type Instrumented struct {
+	Leaser Leaser
+	Hooks  Hooks
+}
+
+// NewInstrumented returns an Instrumented wrapping the Leaser
+func NewInstrumented(l Leaser, hooks Hooks) *Instrumented {
+	return &Instrumented{Leaser: l, Hooks: hooks}
+}
+
+// Lease calls the Lease() function of the wrapped Leaser and calls the hooks
+// at the appropriate times
+func (ins *Instrumented) Lease(f func() error) error {
+	if ins.Hooks.Before != nil {
+		ins.Hooks.Before()
+	}
+
+	requested := time.Now()
+	var acquired time.Time
+
+	err := ins.Leaser.Lease(func() error {
+		acquired = time.Now()
+		if ins.Hooks.Acquired != nil {
+			ins.Hooks.Acquired(acquired.Sub(requested))
+		}
+		return f()
+	})
+
+	if ins.Hooks.After != nil {
+		ins.Hooks.After(time.Since(acquired), err)
+	}
+
+	return err
+}
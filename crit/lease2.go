@@ -0,0 +1,97 @@
+package crit
+
+import (
+	"reflect"
+	"sort"
+)
+
+// Lease2 leases two sections and calls f while holding both leases. the
+// sections are always leased in the same order, whatever the order of the
+// arguments, so two goroutines calling Lease2 with the same sections can't
+// deadlock. this is the usual way of moving something from one section to
+// another
+//
+//	_ = crit.Lease2(&From, &To, func() error {
+//		To.items = append(To.items, From.items[0])
+//		From.items = From.items[1:]
+//		return nil
+//	})
+//
+// if both arguments are the same section then it is only leased once. the
+// order is the order of the addresses of the sections, so a section must
+// always be passed in the same form. passing a crit.Instrumented wrapper in
+// one place and the section it wraps in another does not give the same order
+//
+// sections in the same tree (see Sub()) must be leased from the root down.
+// lease the common parent instead of using Lease2 for them
+//
+// the analysis treats accesses to either section inside f as leased
+func Lease2(a, b Leaser, f func() error) error {
+	pa, pb := leaserAddr(a), leaserAddr(b)
+	if pa != 0 && pa == pb {
+		return a.Lease(f)
+	}
+	if pb < pa {
+		a, b = b, a
+	}
+	return a.Lease(func() error {
+		return b.Lease(f)
+	})
+}
+
+// leaserAddr returns the address of the section. returns zero if the leaser is
+// not a pointer, in which case the order of the arguments is used
+func leaserAddr(l Leaser) uintptr {
+	v := reflect.ValueOf(l)
+	if v.Kind() != reflect.Pointer {
+		return 0
+	}
+	return v.Pointer()
+}
+
+// LeaseAll leases every section in the list and calls f while holding all of
+// the leases. like Lease2, the sections are always leased in the same order,
+// whatever their order in the list, and a section that appears more than once
+// is only leased once
+//
+//	_ = crit.LeaseAll([]crit.Leaser{&A, &B, &C}, func() error {
+//		C.total = A.count + B.count
+//		return nil
+//	})
+//
+// an empty list calls f without a lease
+//
+// the analysis treats accesses to any of the sections inside f as leased, but
+// only when the list is a composite literal
+func LeaseAll(sections []Leaser, f func() error) error {
+	if len(sections) == 0 {
+		return f()
+	}
+
+	ordered := make([]Leaser, 0, len(sections))
+	for _, s := range sections {
+		addr := leaserAddr(s)
+		i := sort.Search(len(ordered), func(i int) bool {
+			return leaserAddr(ordered[i]) > addr
+		})
+		if addr != 0 && i > 0 && leaserAddr(ordered[i-1]) == addr {
+			continue
+		}
+		ordered = append(ordered, nil)
+		copy(ordered[i+1:], ordered[i:])
+		ordered[i] = s
+	}
+
+	return leaseAll(ordered, f)
+}
+
+// leaseAll leases the first section in the list and then the rest of the list
+// inside that lease
+func leaseAll(sections []Leaser, f func() error) error {
+	if len(sections) == 1 {
+		return sections[0].Lease(f)
+	}
+	return sections[0].Lease(func() error {
+		return leaseAll(sections[1:], f)
+	})
+}
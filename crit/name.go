@@ -0,0 +1,55 @@
+package crit
+
+import (
+	"fmt"
+)
+
+// the name of a section is used in panic messages and anywhere else that a
+// section needs to be identified. sections without a name are identified by
+// their type and address
+//
+// names should be set before the section is first used
+//
+// note that the String() function is promoted to types that embed a section.
+// printing such a type with the fmt package will print the name of the section
+// rather than the fields of the type, unless the type has its own String()
+// function
+
+// SetName sets the name of the section
+func (crit *Section) SetName(name string) {
+	crit.name = name
+}
+
+// String returns the name of the section
+func (crit *Section) String() string {
+	if crit.name == "" {
+		return fmt.Sprintf("crit.Section(%p)", crit)
+	}
+	return crit.name
+}
+
+// SetName sets the name of the section
+func (crit *RWSection) SetName(name string) {
+	crit.name = name
+}
+
+// String returns the name of the section
+func (crit *RWSection) String() string {
+	if crit.name == "" {
+		return fmt.Sprintf("crit.RWSection(%p)", crit)
+	}
+	return crit.name
+}
+
+// SetName sets the name of the section
+func (crit *ChanSection) SetName(name string) {
+	crit.name = name
+}
+
+// String returns the name of the section
+func (crit *ChanSection) String() string {
+	if crit.name == "" {
+		return fmt.Sprintf("crit.ChanSection(%p)", crit)
+	}
+	return crit.name
+}
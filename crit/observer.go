@@ -0,0 +1,191 @@
+package crit
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// EventKind is the kind of an Event
+type EventKind int
+
+// the kinds of event sent to the observer
+const (
+	// the lease was requested but is held elsewhere, so the goroutine is about
+	// to wait for it
+	EventBlocked EventKind = iota
+
+	// the lease has been acquired
+	EventAcquired
+
+	// the lease has been released
+	EventReleased
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventBlocked:
+		return "blocked"
+	case EventAcquired:
+		return "acquired"
+	case EventReleased:
+		return "released"
+	}
+	return "unknown"
+}
+
+// Event is sent to the observer when a lease is blocked, acquired or released
+type Event struct {
+	Kind EventKind
+
+	// the name of the section, as returned by String()
+	Name string
+
+	// identifies the section. sections that have not been given a name, or
+	// that have been given the same name, have different IDs. the ID is only
+	// meaningful while the section exists
+	ID uintptr
+
+	// the lease is the read lease of a crit.RWSection
+	Read bool
+
+	// when the event happened
+	Time time.Time
+
+	// how long it took to acquire the lease. set for acquired and released
+	// events
+	Wait time.Duration
+
+	// how long the lease was held for. set for released events
+	Hold time.Duration
+}
+
+// Observer receives the events for every lease of every section. it can be used
+// to bridge to a tracing or metrics package, such as OpenTelemetry, without
+// this package depending on it
+//
+// the observer is called on the goroutine taking the lease. the acquired and
+// released events are sent while the lease is held, so the observer must not
+// lease any section itself and should return quickly
+type Observer interface {
+	Observe(e Event)
+}
+
+// ObserverFunc is a function that can be used as an Observer
+type ObserverFunc func(e Event)
+
+// Observe calls the function
+func (f ObserverFunc) Observe(e Event) {
+	f(e)
+}
+
+// the observer set with SetObserver(). wrapped in a struct because an
+// atomic.Pointer can't hold an interface
+type observerHolder struct {
+	o Observer
+}
+
+var observer atomic.Pointer[observerHolder]
+
+// SetObserver sets the observer that receives the events for every lease. a nil
+// observer stops the events. when there is no observer the cost to each lease
+// is a single atomic load
+//
+//	crit.SetObserver(crit.ObserverFunc(func(e crit.Event) {
+//		if e.Kind == crit.EventReleased {
+//			holdTime.Record(ctx, e.Hold.Seconds(), metric.WithAttributes(
+//				attribute.String("section", e.Name)))
+//		}
+//	}))
+//
+// note that a blocked event is only sent when the lease is not immediately
+// available. leases taken with TryLease() and TryRLease() never block and
+// don't send an event if the lease is not taken
+func SetObserver(o Observer) {
+	if o == nil {
+		observer.Store(nil)
+		return
+	}
+	observer.Store(&observerHolder{o: o})
+}
+
+// observed is a section that can be observed. all the section types are
+type observed interface {
+	Leaser
+	String() string
+}
+
+// observation follows a single lease for the observer. a nil observation
+// does nothing, which is the case when there is no observer
+type observation struct {
+	o    Observer
+	s    observed
+	read bool
+
+	requestedAt time.Time
+	acquiredAt  time.Time
+}
+
+// observe returns the observation for a lease of the section. returns nil if
+// there is no observer
+//
+// the no observer case must not allocate. the section is passed as an interface
+// rather than as method values such as crit.String, which are allocated on the
+// heap before the observer is loaded. for the same reason callers only pass the
+// lock functions to lock() when the observation is not nil
+func observe(s observed, read bool) *observation {
+	h := observer.Load()
+	if h == nil {
+		return nil
+	}
+	return &observation{
+		o:           h.o,
+		s:           s,
+		read:        read,
+		requestedAt: time.Now(),
+	}
+}
+
+// lock acquires the lease with the lock function. the try function is called
+// first, and the blocked event is sent if the lease isn't immediately
+// available. the observation must not be nil
+func (ob *observation) lock(try func() bool, lock func()) {
+	if try() {
+		return
+	}
+	ob.send(EventBlocked, time.Now())
+	lock()
+}
+
+// acquired sends the acquired event
+func (ob *observation) acquired() {
+	if ob == nil {
+		return
+	}
+	ob.acquiredAt = time.Now()
+	ob.send(EventAcquired, ob.acquiredAt)
+}
+
+// released sends the released event
+func (ob *observation) released() {
+	if ob == nil {
+		return
+	}
+	ob.send(EventReleased, time.Now())
+}
+
+func (ob *observation) send(kind EventKind, t time.Time) {
+	e := Event{
+		Kind: kind,
+		Name: ob.s.String(),
+		ID:   leaserAddr(ob.s),
+		Read: ob.read,
+		Time: t,
+	}
+	if !ob.acquiredAt.IsZero() {
+		e.Wait = ob.acquiredAt.Sub(ob.requestedAt)
+	}
+	if kind == EventReleased {
+		e.Hold = t.Sub(ob.acquiredAt)
+	}
+	ob.o.Observe(e)
+}
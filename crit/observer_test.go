@@ -0,0 +1,62 @@
+package crit
+
+import (
+	"testing"
+)
+
+// a lease allocates nothing when there is no observer
+func TestNoObserverAllocs(t *testing.T) {
+	if debug {
+		t.Skip("the holders of leases are tracked with the critdebug build tag")
+	}
+	SetObserver(nil)
+
+	var s Section
+	var rw RWSection
+	var ch ChanSection
+	f := func() error {
+		return nil
+	}
+
+	leases := []struct {
+		name  string
+		lease func()
+	}{
+		{"Section.Lease", func() { _ = s.Lease(f) }},
+		{"Section.TryLease", func() { _, _ = s.TryLease(f) }},
+		{"RWSection.Lease", func() { _ = rw.Lease(f) }},
+		{"RWSection.RLease", func() { _ = rw.RLease(f) }},
+		{"RWSection.TryLease", func() { _, _ = rw.TryLease(f) }},
+		{"RWSection.TryRLease", func() { _, _ = rw.TryRLease(f) }},
+		{"ChanSection.Lease", func() { _ = ch.Lease(f) }},
+		{"ChanSection.TryLease", func() { _, _ = ch.TryLease(f) }},
+	}
+	for _, l := range leases {
+		if n := testing.AllocsPerRun(100, l.lease); n != 0 {
+			t.Errorf("%s makes %v allocations with no observer, want 0", l.name, n)
+		}
+	}
+}
+
+// the observer receives the events of a lease in order
+func TestObserverEvents(t *testing.T) {
+	var events []Event
+	SetObserver(ObserverFunc(func(e Event) {
+		events = append(events, e)
+	}))
+	defer SetObserver(nil)
+
+	var s Section
+	s.SetName("observed")
+	_ = s.Lease(func() error {
+		return nil
+	})
+
+	if len(events) != 2 || events[0].Kind != EventAcquired || events[1].Kind != EventReleased {
+		t.Fatalf("events are %v, want an acquired and a released event", events)
+	}
+	if events[0].Name != "observed" || events[0].ID != events[1].ID {
+		t.Errorf("events have name %q and IDs %d and %d, want name \"observed\" and the same ID",
+			events[0].Name, events[0].ID, events[1].ID)
+	}
+}
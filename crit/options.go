@@ -0,0 +1,46 @@
+package crit
+
+// Option changes the behaviour of a critical section. options are applied with
+// the Configure() function of the section
+type Option func(*options)
+
+type options struct {
+	fifo           bool
+	writerPriority bool
+}
+
+// WithFIFO makes sure that leases are granted in the order in which they were
+// requested. without this option a goroutine that has only just asked for the
+// lease can be given it ahead of a goroutine that has been waiting for longer
+//
+// for RWSection, read leases that are next to each other in the queue are
+// granted together. a write lease waits for all earlier read leases to end
+// and all later leases wait for the write lease to end
+//
+// WithFIFO takes precedence over WithWriterPriority
+func WithFIFO() Option {
+	return func(o *options) {
+		o.fifo = true
+	}
+}
+
+// WithWriterPriority makes sure that a waiting write lease is always granted
+// before any waiting read lease. this prevents a writer that leases
+// infrequently from being starved by a constant stream of readers. however,
+// readers can be starved by a constant stream of writers
+//
+// the option only has an effect on RWSection
+func WithWriterPriority() Option {
+	return func(o *options) {
+		o.writerPriority = true
+	}
+}
+
+// makeOptions applies the options and returns the result
+func makeOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
@@ -0,0 +1,219 @@
+package crit
+
+import (
+	"sync"
+)
+
+// RWSection is the same as Section except that it also has a read lease. any
+// number of read leases can be held at the same time but a write lease (ie.
+// the Lease() function) is exclusive
+//
+// by default the ordering of leases is the same as sync.RWMutex. this can be
+// changed with the WithFIFO() and WithWriterPriority() options
+type RWSection struct {
+	lock sync.RWMutex
+
+	// the name of the section. see SetName()
+	name string
+
+	// used instead of lock if the section has been configured with an option
+	// that requires it
+	fair *fairLock
+
+	// one-time initialisation. see InitOnce()
+	setup initOnce
+
+	// see Start()
+	life lifecycle
+}
+
+// Configure changes the behaviour of the critical section. it must be called
+// before the section is first leased and must not be called while the
+// section is in use
+func (crit *RWSection) Configure(opts ...Option) {
+	o := makeOptions(opts)
+	if o.fifo || o.writerPriority {
+		crit.fair = newFairLock(o)
+	} else {
+		crit.fair = nil
+	}
+}
+
+// Lease locks a critical section for writing for the entire duration of the
+// supplied function
+func (crit *RWSection) Lease(f func() error) error {
+	crit.life.reenter(crit.String)
+	ob := observe(crit, false)
+	if crit.fair != nil {
+		if ob == nil {
+			crit.fair.lock()
+		} else {
+			ob.lock(crit.fair.tryLock, crit.fair.lock)
+		}
+		defer crit.fair.unlock()
+	} else {
+		if ob == nil {
+			crit.lock.Lock()
+		} else {
+			ob.lock(crit.lock.TryLock, crit.lock.Lock)
+		}
+		defer crit.lock.Unlock()
+	}
+
+	ob.acquired()
+	defer ob.released()
+
+	crit.life.enter(crit.String, false)
+	defer crit.life.leave()
+
+	return f()
+}
+
+// RLease locks a critical section for reading for the entire duration of the
+// supplied function. fields of the section must not be changed by the
+// supplied function
+func (crit *RWSection) RLease(f func() error) error {
+	crit.life.reenter(crit.String)
+	ob := observe(crit, true)
+	if crit.fair != nil {
+		if ob == nil {
+			crit.fair.rlock()
+		} else {
+			ob.lock(crit.fair.tryRLock, crit.fair.rlock)
+		}
+		defer crit.fair.runlock()
+	} else {
+		if ob == nil {
+			crit.lock.RLock()
+		} else {
+			ob.lock(crit.lock.TryRLock, crit.lock.RLock)
+		}
+		defer crit.lock.RUnlock()
+	}
+
+	ob.acquired()
+	defer ob.released()
+
+	crit.life.enter(crit.String, true)
+	defer crit.life.leave()
+
+	return f()
+}
+
+// TryLease is the same as Lease except that it does not wait for the lease. if
+// the lease is held elsewhere then f is not called and TryLease returns false.
+// otherwise it returns true and the error returned by f
+func (crit *RWSection) TryLease(f func() error) (bool, error) {
+	ob := observe(crit, false)
+	if crit.fair != nil {
+		if !crit.fair.tryLock() {
+			return false, nil
+		}
+		defer crit.fair.unlock()
+	} else {
+		if !crit.lock.TryLock() {
+			return false, nil
+		}
+		defer crit.lock.Unlock()
+	}
+
+	ob.acquired()
+	defer ob.released()
+
+	crit.life.enter(crit.String, false)
+	defer crit.life.leave()
+
+	return true, f()
+}
+
+// TryRLease is the same as RLease except that it does not wait for the read
+// lease. if the section is leased for writing then f is not called and
+// TryRLease returns false
+func (crit *RWSection) TryRLease(f func() error) (bool, error) {
+	ob := observe(crit, true)
+	if crit.fair != nil {
+		if !crit.fair.tryRLock() {
+			return false, nil
+		}
+		defer crit.fair.runlock()
+	} else {
+		if !crit.lock.TryRLock() {
+			return false, nil
+		}
+		defer crit.lock.RUnlock()
+	}
+
+	ob.acquired()
+	defer ob.released()
+
+	crit.life.enter(crit.String, true)
+	defer crit.life.leave()
+
+	return true, f()
+}
+
+// Acquire locks the critical section for writing until the returned Release
+// is called. see Section.Acquire()
+func (crit *RWSection) Acquire() Release {
+	crit.life.reenter(crit.String)
+	ob := observe(crit, false)
+	var release func()
+	if crit.fair != nil {
+		if ob == nil {
+			crit.fair.lock()
+		} else {
+			ob.lock(crit.fair.tryLock, crit.fair.lock)
+		}
+		release = crit.fair.unlock
+	} else {
+		if ob == nil {
+			crit.lock.Lock()
+		} else {
+			ob.lock(crit.lock.TryLock, crit.lock.Lock)
+		}
+		release = crit.lock.Unlock
+	}
+
+	ob.acquired()
+	crit.life.enter(crit.String, false)
+
+	return newRelease(crit.String, &crit.life, ob, release)
+}
+
+// RAcquire locks the critical section for reading until the returned Release
+// is called. fields of the section must not be changed before then
+func (crit *RWSection) RAcquire() Release {
+	crit.life.reenter(crit.String)
+	ob := observe(crit, true)
+	var release func()
+	if crit.fair != nil {
+		if ob == nil {
+			crit.fair.rlock()
+		} else {
+			ob.lock(crit.fair.tryRLock, crit.fair.rlock)
+		}
+		release = crit.fair.runlock
+	} else {
+		if ob == nil {
+			crit.lock.RLock()
+		} else {
+			ob.lock(crit.lock.TryRLock, crit.lock.RLock)
+		}
+		release = crit.lock.RUnlock
+	}
+
+	ob.acquired()
+	crit.life.enter(crit.String, true)
+
+	return newRelease(crit.String, &crit.life, ob, release)
+}
+
+// InitOnce calls f while holding the lease, but only the first time InitOnce
+// is called. f is never called again, even if it returned an error. the error
+// returned by f is returned by every call to InitOnce
+//
+// the analysis allows fields that are only ever written inside f to be read
+// without the lease
+func (crit *RWSection) InitOnce(f func() error) error {
+	return crit.setup.do(crit, f)
+}
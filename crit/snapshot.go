@@ -0,0 +1,37 @@
+package crit
+
+// Leaser is implemented by all the critical section types in this package.
+// it can be used to write functions that work with any type of section
+type Leaser interface {
+	Lease(f func() error) error
+}
+
+// rleaser is implemented by sections that have a read lease
+type rleaser interface {
+	RLease(f func() error) error
+}
+
+// Snapshot leases the section and returns the value created by the copy
+// function. the read lease is used if the section has one
+//
+// the copy function should return a value that does not share any memory with
+// the fields of the section. slices and maps in particular must be copied and
+// not just assigned. the analysis reports copy functions that return a
+// reference to a field of the section
+//
+//	values := crit.Snapshot(&C, func() []int {
+//		return slices.Clone(C.values)
+//	})
+func Snapshot[T any](s Leaser, copyFn func() T) T {
+	var v T
+	f := func() error {
+		v = copyFn()
+		return nil
+	}
+	if r, ok := s.(rleaser); ok {
+		_ = r.RLease(f)
+	} else {
+		_ = s.Lease(f)
+	}
+	return v
+}
@@ -0,0 +1,169 @@
+package crit
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// lifecycle records whether a section has been started and, in debug mode,
+// which goroutines currently hold the lease
+//
+// a section is built by a single goroutine and then shared with others. the
+// call to Start() marks the point at which the section is shared. accesses
+// before Start() do not need the lease
+type lifecycle struct {
+	started atomic.Bool
+
+	// the number of leases held by each goroutine. only used in debug mode
+	holders sync.Map
+
+	// the stack of the first lease held by each goroutine that holds the
+	// lease. used in panic messages. only used in debug mode
+	stacks sync.Map
+}
+
+// enter records that the current goroutine has acquired the lease. the name
+// of the section and whether the lease is a read lease are recorded for
+// Held(). it does nothing unless in debug mode
+func (l *lifecycle) enter(name func() string, read bool) {
+	if !debug {
+		return
+	}
+	id := goid()
+	n, _ := l.holders.LoadOrStore(id, new(atomic.Int64))
+	if n.(*atomic.Int64).Add(1) == 1 {
+		l.stacks.Store(id, callers())
+	}
+	pushHeld(id, l, SectionInfo{Name: name(), Read: read})
+}
+
+// leave records that the current goroutine has released the lease. it does
+// nothing unless in debug mode
+func (l *lifecycle) leave() {
+	if !debug {
+		return
+	}
+	id := goid()
+	if n, ok := l.holders.Load(id); ok {
+		if n.(*atomic.Int64).Add(-1) == 0 {
+			l.stacks.Delete(id)
+		}
+	}
+	popHeld(id, l)
+}
+
+// reenter panics if the current goroutine already holds the lease. leasing a
+// section that is already held by the same goroutine deadlocks, so in debug
+// mode it panics instead. it does nothing unless in debug mode
+func (l *lifecycle) reenter(name func() string) {
+	if debug && l.held() {
+		panic(violation("crit: lease of "+name()+" while already holding it", l))
+	}
+}
+
+// held returns true if the current goroutine holds the lease
+func (l *lifecycle) held() bool {
+	n, ok := l.holders.Load(goid())
+	return ok && n.(*atomic.Int64).Load() > 0
+}
+
+// goid returns the ID of the current goroutine. the ID is taken from the first
+// line of the goroutine's stack trace, which is of the form
+//
+//	goroutine 123 [running]:
+//
+// it is slow and is only used in debug mode
+func goid() int64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseInt(string(b), 10, 64)
+	return id
+}
+
+// Start marks the end of the single-threaded setup of the section. it should
+// be called before the section is shared with another goroutine
+//
+// the analysis does not report accesses that come before the call to Start()
+// in the same function. when built with the critdebug build tag,
+// AssertLeased() panics if it is called without the lease after Start()
+func (crit *Section) Start() {
+	crit.life.started.Store(true)
+}
+
+// Started returns true if Start() has been called
+func (crit *Section) Started() bool {
+	return crit.life.started.Load()
+}
+
+// AssertLeased panics if the section has been started and the current
+// goroutine does not hold the lease. the lease of a parent section counts as
+// the lease of its sub-sections
+//
+// the assertion is only made when built with the critdebug build tag. it does
+// nothing otherwise
+func (crit *Section) AssertLeased() {
+	if !debug || !crit.Started() {
+		return
+	}
+	for s := crit; s != nil; {
+		if s.life.held() {
+			return
+		}
+		if s.tree == nil {
+			break
+		}
+		s = s.tree.parent
+	}
+	panic(violation("crit: unleased access of "+crit.String()+" after Start", &crit.life))
+}
+
+// Start marks the end of the single-threaded setup of the section. see
+// Section.Start()
+func (crit *RWSection) Start() {
+	crit.life.started.Store(true)
+}
+
+// Started returns true if Start() has been called
+func (crit *RWSection) Started() bool {
+	return crit.life.started.Load()
+}
+
+// AssertLeased panics if the section has been started and the current
+// goroutine does not hold either the read or write lease. see
+// Section.AssertLeased()
+func (crit *RWSection) AssertLeased() {
+	if !debug || !crit.Started() || crit.life.held() {
+		return
+	}
+	panic(violation("crit: unleased access of "+crit.String()+" after Start", &crit.life))
+}
+
+// Start marks the end of the single-threaded setup of the section. see
+// Section.Start()
+func (crit *ChanSection) Start() {
+	crit.life.started.Store(true)
+}
+
+// Started returns true if Start() has been called
+func (crit *ChanSection) Started() bool {
+	return crit.life.started.Load()
+}
+
+// AssertLeased panics if the section has been started and the current
+// goroutine does not hold the lease. see Section.AssertLeased()
+//
+// only leases acquired with Lease() are seen. a token acquired with
+// AcquireC() is not associated with a goroutine
+func (crit *ChanSection) AssertLeased() {
+	if !debug || !crit.Started() || crit.life.held() {
+		return
+	}
+	panic(violation("crit: unleased access of "+crit.String()+" after Start", &crit.life))
+}
@@ -0,0 +1,161 @@
+package crit
+
+import (
+	"sync"
+)
+
+// tree links a section to its parent and to its sub-sections. a section that
+// is not part of a tree has a nil tree
+type tree struct {
+	parent *Section
+
+	// protects subs
+	lock sync.Mutex
+	subs map[string]*Section
+
+	// the lease of a section in a tree is a write lock of family. leasing a
+	// sub-section takes a read lock of the family of every ancestor, so that
+	// sub-sections can be leased at the same time as each other but not at
+	// the same time as an ancestor
+	family sync.RWMutex
+}
+
+// Sub returns the named sub-section. the same sub-section is returned every
+// time Sub() is called with the same name. the full name of the sub-section
+// (as returned by String()) is the name of the parent and the name of the
+// sub-section separated by a dot. sub-sections are created the first
+// time they are asked for and must be created before the section is first
+// leased
+//
+// a sub-section is normally embedded as a pointer in the type it protects
+//
+//	type cache struct {
+//		*crit.Section
+//		entries map[string]int
+//	}
+//
+//	type state struct {
+//		crit.Section
+//		cache cache
+//	}
+//
+//	S.cache.Section = S.Sub("cache")
+//
+// sub-sections can be leased at the same time as each other. leasing the
+// parent implies the lease of all its sub-sections. the sub-sections must not
+// be leased again inside the lease of the parent, in the same way that a
+// section must not be leased twice
+//
+// leases in a tree must be acquired from the root down. when built with the
+// critdebug build tag, leasing a section while holding the lease of one of its
+// ancestors, a sibling or a descendant panics. otherwise it may deadlock
+//
+// options set with Configure() are ignored for sections in a tree
+func (crit *Section) Sub(name string) *Section {
+	if crit.tree == nil {
+		crit.tree = &tree{}
+	}
+
+	crit.tree.lock.Lock()
+	defer crit.tree.lock.Unlock()
+
+	if crit.tree.subs == nil {
+		crit.tree.subs = make(map[string]*Section)
+	}
+	if s, ok := crit.tree.subs[name]; ok {
+		return s
+	}
+
+	s := &Section{
+		name: crit.String() + "." + name,
+		tree: &tree{parent: crit},
+	}
+	crit.tree.subs[name] = s
+	return s
+}
+
+// acquireTree acquires the lease for a section that is part of a tree. the
+// returned function releases the lease. if try is true then acquireTree does
+// not wait for the lease and returns false if it is held elsewhere
+//
+// the function passed to Lease() is not called here because the analysis
+// expects it to be called directly by Lease()
+func (crit *Section) acquireTree(try bool) (func(), bool) {
+	if debug {
+		crit.checkTree()
+	}
+
+	var ancestors []*Section
+	for a := crit.tree.parent; a != nil; a = a.tree.parent {
+		ancestors = append(ancestors, a)
+	}
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		if !try {
+			ancestors[i].tree.family.RLock()
+		} else if !ancestors[i].tree.family.TryRLock() {
+			for _, a := range ancestors[i+1:] {
+				a.tree.family.RUnlock()
+			}
+			return nil, false
+		}
+	}
+
+	if !try {
+		crit.tree.family.Lock()
+	} else if !crit.tree.family.TryLock() {
+		for _, a := range ancestors {
+			a.tree.family.RUnlock()
+		}
+		return nil, false
+	}
+
+	return func() {
+		crit.tree.family.Unlock()
+		for _, a := range ancestors {
+			a.tree.family.RUnlock()
+		}
+	}, true
+}
+
+// checkTree panics if the current goroutine holds a lease in the same tree as
+// the section. the goroutines holding each lease are only known in debug mode
+func (crit *Section) checkTree() {
+	if crit.life.held() {
+		panic(violation("crit: lease of "+crit.String()+" while already holding it", &crit.life))
+	}
+
+	// the lease of an ancestor implies the lease of this section
+	for a := crit.tree.parent; a != nil; a = a.tree.parent {
+		if a.life.held() {
+			panic(violation("crit: lease of "+crit.String()+" while holding "+a.String()+", which implies it", &a.life))
+		}
+	}
+
+	// any other lease in the tree held by this goroutine means that the leases
+	// are being acquired out of order
+	root := crit
+	for root.tree.parent != nil {
+		root = root.tree.parent
+	}
+	if h := root.heldBy(); h != nil {
+		panic(violation("crit: lease of "+crit.String()+" while holding "+h.String(), &h.life))
+	}
+}
+
+// heldBy returns the section in the tree rooted at this section that is held
+// by the current goroutine. returns nil if the goroutine holds no section in
+// the tree
+func (crit *Section) heldBy() *Section {
+	if crit.life.held() {
+		return crit
+	}
+
+	crit.tree.lock.Lock()
+	defer crit.tree.lock.Unlock()
+	for _, s := range crit.tree.subs {
+		if h := s.heldBy(); h != nil {
+			return h
+		}
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package crit
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// hold leases the section on another goroutine and keeps the lease until the
+// returned function is called
+func hold(t *testing.T, s *Section) func() {
+	t.Helper()
+	held := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = s.Lease(func() error {
+			close(held)
+			<-release
+			return nil
+		})
+	}()
+	select {
+	case <-held:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for the lease of %s", s)
+	}
+	return func() {
+		close(release)
+		<-done
+	}
+}
+
+// panics returns the message of the panic caused by f. it returns the empty
+// string if f doesn't panic
+func panics(f func()) (msg string) {
+	defer func() {
+		if r := recover(); r != nil {
+			msg = r.(string)
+		}
+	}()
+	f()
+	return ""
+}
+
+// leases with no body, to make the tests shorter
+func nothing() error {
+	return nil
+}
+
+// a section with a sub-section that has a sub-section of its own, and a sibling
+type family struct {
+	root       Section
+	child      *Section
+	grandchild *Section
+	sibling    *Section
+}
+
+func newFamily() *family {
+	f := &family{}
+	f.root.name = "root"
+	f.child = f.root.Sub("child")
+	f.grandchild = f.child.Sub("grandchild")
+	f.sibling = f.root.Sub("sibling")
+	return f
+}
+
+func TestSubName(t *testing.T) {
+	f := newFamily()
+	if s := f.grandchild.String(); s != "root.child.grandchild" {
+		t.Errorf("name of the grandchild is %q, want %q", s, "root.child.grandchild")
+	}
+	if f.root.Sub("child") != f.child {
+		t.Error("Sub() returned a different section for the same name")
+	}
+}
+
+func TestSubSiblings(t *testing.T) {
+	f := newFamily()
+
+	release := hold(t, f.child)
+	defer release()
+
+	// the lease of the sibling is granted while the child is held elsewhere
+	done := make(chan struct{})
+	go func() {
+		_ = f.sibling.Lease(func() error {
+			close(done)
+			return nil
+		})
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sibling lease was not granted while the child was leased")
+	}
+}
+
+// the lease of the parent excludes the leases of its sub-sections, and the
+// lease of a sub-section excludes the lease of its parent
+func TestSubParentImpliesChildren(t *testing.T) {
+	f := newFamily()
+
+	release := hold(t, &f.root)
+	for _, s := range []*Section{f.child, f.grandchild, f.sibling} {
+		if ok, _ := s.TryLease(nothing); ok {
+			t.Errorf("TryLease() of %s succeeded while the parent was leased", s)
+		}
+	}
+	release()
+
+	release = hold(t, f.grandchild)
+	for _, s := range []*Section{&f.root, f.child} {
+		if ok, _ := s.TryLease(nothing); ok {
+			t.Errorf("TryLease() of %s succeeded while a sub-section was leased", s)
+		}
+	}
+	if ok, _ := f.sibling.TryLease(nothing); !ok {
+		t.Error("TryLease() of the sibling failed while the grandchild was leased")
+	}
+	release()
+
+	// the grandchild waits for the parent's lease to end
+	release = hold(t, &f.root)
+	acquired := make(chan struct{})
+	go func() {
+		_ = f.grandchild.Lease(func() error {
+			close(acquired)
+			return nil
+		})
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("sub-section leased while the parent was leased")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sub-section lease was not granted after the parent's lease ended")
+	}
+}
+
+// a TryLease() that fails must release the read locks it took on the ancestors
+// before it failed
+func TestSubTryLeaseUndo(t *testing.T) {
+	f := newFamily()
+
+	// fails on the child, after the read lock of the root has been taken
+	release := hold(t, f.child)
+	if ok, _ := f.grandchild.TryLease(nothing); ok {
+		t.Error("TryLease() of the grandchild succeeded while the child was leased")
+	}
+	release()
+	if ok, _ := f.root.TryLease(nothing); !ok {
+		t.Error("TryLease() of the root failed after a failed TryLease() of the grandchild")
+	}
+
+	// fails on the grandchild itself, after the read locks of the root and the
+	// child have been taken
+	release = hold(t, f.grandchild)
+	if ok, _ := f.grandchild.TryLease(nothing); ok {
+		t.Error("TryLease() of the grandchild succeeded while it was leased")
+	}
+	release()
+	for _, s := range []*Section{&f.root, f.child} {
+		if ok, _ := s.TryLease(nothing); !ok {
+			t.Errorf("TryLease() of %s failed after a failed TryLease() of the grandchild", s)
+		}
+	}
+}
+
+func TestSubOrder(t *testing.T) {
+	if !debug {
+		t.Skip("the order of leases in a tree is checked with the critdebug build tag")
+	}
+
+	// the outer lease is held while the inner lease is taken
+	tests := []struct {
+		name         string
+		outer, inner func(f *family) *Section
+		want         string
+	}{
+		{"ancestor",
+			func(f *family) *Section { return &f.root },
+			func(f *family) *Section { return f.grandchild },
+			"while holding root, which implies it"},
+		{"descendant",
+			func(f *family) *Section { return f.grandchild },
+			func(f *family) *Section { return &f.root },
+			"while holding root.child.grandchild"},
+		{"sibling",
+			func(f *family) *Section { return f.child },
+			func(f *family) *Section { return f.sibling },
+			"while holding root.child"},
+		{"twice",
+			func(f *family) *Section { return f.child },
+			func(f *family) *Section { return f.child },
+			"while already holding it"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFamily()
+			msg := panics(func() {
+				_ = tt.outer(f).Lease(func() error {
+					return tt.inner(f).Lease(nothing)
+				})
+			})
+			if !strings.Contains(msg, tt.want) {
+				t.Errorf("panic message is %q, want it to contain %q", msg, tt.want)
+			}
+
+			// the leases are released by the panic
+			if ok, _ := f.root.TryLease(nothing); !ok {
+				t.Error("TryLease() of the root failed after the panic")
+			}
+		})
+	}
+}
+
+// the lease of a parent counts as the lease of its sub-sections
+func TestSubAssertLeased(t *testing.T) {
+	if !debug {
+		t.Skip("AssertLeased() only checks with the critdebug build tag")
+	}
+
+	f := newFamily()
+	f.grandchild.Start()
+	if msg := panics(f.grandchild.AssertLeased); msg == "" {
+		t.Error("AssertLeased() did not panic without the lease")
+	}
+	_ = f.root.Lease(func() error {
+		if msg := panics(f.grandchild.AssertLeased); msg != "" {
+			t.Errorf("AssertLeased() panicked inside the lease of the root: %s", msg)
+		}
+		return nil
+	})
+	_ = f.sibling.Lease(func() error {
+		if msg := panics(f.grandchild.AssertLeased); msg == "" {
+			t.Error("AssertLeased() did not panic inside the lease of the sibling")
+		}
+		return nil
+	})
+}
+
+// the cost of leasing a sub-section compared to leasing a section that is not
+// part of a tree
+func BenchmarkLease(b *testing.B) {
+	var s Section
+	for i := 0; i < b.N; i++ {
+		_ = s.Lease(func() error {
+			return nil
+		})
+	}
+}
+
+func BenchmarkSubLease(b *testing.B) {
+	var s Section
+	sub := s.Sub("sub")
+	for i := 0; i < b.N; i++ {
+		_ = sub.Lease(func() error {
+			return nil
+		})
+	}
+}
@@ -0,0 +1,10 @@
+package crit
+
+// APIVersion is the version of the API of this package as it is understood by
+// the static analysis. it is increased whenever a method or function is added
+// that the analysis must know about, such as a new lease method
+//
+// the analysis compares the version with the version it knows and reports a
+// package that uses a newer version, rather than silently missing the accesses
+// made with the new methods
+const APIVersion = 1
@@ -0,0 +1,86 @@
+package crit
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// the maximum number of frames recorded for a stack
+const maxStackDepth = 32
+
+// the prefix of the names of the functions in this package. frames in this
+// package are left out of stacks because they are the same for every lease
+var critPrefix = func() string {
+	pc, _, _, _ := runtime.Caller(0)
+	name := runtime.FuncForPC(pc).Name()
+	i := strings.LastIndex(name, "/")
+	return name[:i+strings.Index(name[i+1:], ".")+2]
+}()
+
+// callers returns the stack of the current goroutine
+func callers() []uintptr {
+	pcs := make([]uintptr, maxStackDepth)
+	return pcs[:runtime.Callers(2, pcs)]
+}
+
+// formatStack formats the stack in the same way as a goroutine in a panic,
+// leaving out the frames in this package
+func formatStack(pcs []uintptr) string {
+	var b strings.Builder
+	frames := runtime.CallersFrames(pcs)
+	for {
+		f, more := frames.Next()
+		if f.Function != "" && !strings.HasPrefix(f.Function, critPrefix) {
+			fmt.Fprintf(&b, "%s()\n\t%s:%d\n", f.Function, f.File, f.Line)
+		}
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
+
+// violation returns the message for a panic caused by a misuse of a section. in
+// debug mode the message is followed by the location of the violation and, if
+// the lifecycle is not nil, by the goroutines that hold the lease and where they
+// acquired it. the message is returned unchanged otherwise
+//
+// a bare panic in a large program says what went wrong but not where the lease
+// was taken, which is usually the more useful thing to know
+func violation(msg string, l *lifecycle) string {
+	if !debug {
+		return msg
+	}
+
+	var b strings.Builder
+	b.WriteString(msg)
+	fmt.Fprintf(&b, "\n\nat:\n%s", formatStack(callers()))
+
+	if l == nil {
+		return b.String()
+	}
+
+	type holder struct {
+		id    int64
+		stack []uintptr
+	}
+	var holders []holder
+	l.stacks.Range(func(k, v any) bool {
+		holders = append(holders, holder{id: k.(int64), stack: v.([]uintptr)})
+		return true
+	})
+	sort.Slice(holders, func(i, j int) bool {
+		return holders[i].id < holders[j].id
+	})
+
+	if len(holders) == 0 {
+		b.WriteString("\nnot held by any goroutine\n")
+	}
+	for _, h := range holders {
+		fmt.Fprintf(&b, "\nheld by goroutine %d, acquired at:\n%s", h.id, formatStack(h.stack))
+	}
+
+	return b.String()
+}
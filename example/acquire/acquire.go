@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/jetsetilly/critsec/crit"
+)
+
+// leases made with Acquire() rather than Lease(). accesses between the call to
+// Acquire() and the call to the release are leased, as are accesses in
+// functions called from there. the following should be reported:
+//
+//   - the access after the release in released()
+//   - the Acquire() in early(), which is not released on the early return
+//   - the Acquire() in discarded()
+//   - the write under the read lease in readOnly()
+//   - the access in conditional(), which is only leased on one path
+type queue struct {
+	crit.RWSection
+	items []int
+}
+
+var Q queue
+
+var errEmpty = errors.New("empty")
+
+func deferred() (int, error) {
+	release := Q.Acquire()
+	defer release()
+	if len(Q.items) == 0 {
+		return 0, errEmpty
+	}
+	v := Q.items[0]
+	Q.items = Q.items[1:]
+	return v, nil
+}
+
+func deferredCall() {
+	defer Q.Acquire()()
+	Q.items = append(Q.items, 0)
+}
+
+func released() int {
+	release := Q.Acquire()
+	n := len(Q.items)
+	push(n)
+	release()
+	return n + len(Q.items)
+}
+
+func push(v int) {
+	Q.items = append(Q.items, v)
+}
+
+func early() error {
+	release := Q.Acquire()
+	if len(Q.items) == 0 {
+		return errEmpty
+	}
+	Q.items = nil
+	release()
+	return nil
+}
+
+func discarded() {
+	_ = Q.Acquire()
+}
+
+func readOnly() int {
+	release := Q.RAcquire()
+	defer release()
+	Q.items = nil
+	return len(Q.items)
+}
+
+func conditional(lock bool) {
+	var release crit.Release = func() {}
+	if lock {
+		release = Q.Acquire()
+	}
+	Q.items = nil
+	release()
+}
+
+func main() {
+	done := make(chan bool)
+	go func() {
+		_, _ = deferred()
+		deferredCall()
+		done <- true
+	}()
+	_ = released()
+	_ = early()
+	discarded()
+	_ = readOnly()
+	conditional(true)
+	<-done
+}
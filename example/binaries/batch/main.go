@@ -0,0 +1,11 @@
+package main
+
+import (
+	"github.com/jetsetilly/critsec/example/binaries/lib"
+)
+
+func main() {
+	for i := range 10 {
+		lib.Add(i)
+	}
+}
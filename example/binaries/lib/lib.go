@@ -0,0 +1,28 @@
+package lib
+
+import (
+	"github.com/jetsetilly/critsec/crit"
+)
+
+// a section shared by two binaries. the server only calls Add() from inside
+// Update(), which holds the lease. the batch tool calls Add() directly, so the
+// access in Add() is leased in one binary but not in the other
+type counter struct {
+	crit.Section
+	total int
+}
+
+var C counter
+
+// Update calls Add() with the lease
+func Update(n int) {
+	_ = C.Lease(func() error {
+		Add(n)
+		return nil
+	})
+}
+
+// Add must be called with the lease
+func Add(n int) {
+	C.total += n
+}
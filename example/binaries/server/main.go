@@ -0,0 +1,15 @@
+package main
+
+import (
+	"github.com/jetsetilly/critsec/example/binaries/lib"
+)
+
+func main() {
+	done := make(chan bool)
+	go func() {
+		lib.Update(1)
+		done <- true
+	}()
+	lib.Update(2)
+	<-done
+}
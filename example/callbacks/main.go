@@ -0,0 +1,69 @@
+package main
+
+import (
+	"slices"
+	"sort"
+
+	"github.com/jetsetilly/critsec/crit"
+)
+
+// functions passed to the sort, slices and maps packages are called before the
+// function they are passed to returns. the callbacks are checked as though they
+// were called where they are passed. the following should be reported:
+//
+//   - the access of values passed to sort.Slice() in sortUnleased(), and the
+//     accesses in the comparison function
+//   - the access of names in keys()
+//   - the access in compare(), which is passed to slices.SortFunc() with the
+//     lease and called directly without it
+//
+// the comparison function in sortLeased() is not reported even though
+// slices.SortFunc() is also called without the lease by unrelated()
+type table struct {
+	crit.Section
+	values []int
+	names  map[string]int
+	weight int
+}
+
+var T table
+
+func sortUnleased() {
+	sort.Slice(T.values, func(i, j int) bool {
+		return T.values[i]*T.weight < T.values[j]
+	})
+}
+
+func compare(a, b int) int {
+	return a*T.weight - b
+}
+
+func sortLeased() {
+	_ = T.Lease(func() error {
+		slices.SortFunc(T.values, func(a, b int) int {
+			return a*T.weight - b
+		})
+		slices.SortFunc(T.values, compare)
+		return nil
+	})
+}
+
+func keys() {
+	for k := range T.names {
+		_ = k
+	}
+}
+
+func unrelated(v []int) {
+	slices.SortFunc(v, func(a, b int) int {
+		return a - b
+	})
+}
+
+func main() {
+	go sortUnleased()
+	go sortLeased()
+	go keys()
+	go unrelated([]int{3, 2, 1})
+	go compare(1, 2)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"github.com/jetsetilly/critsec/crit"
+)
+
+// sections reached through chains of fields and through pointers to the
+// structs that contain them. the following should be reported with the
+// wrong-lease rule:
+//
+//   - the accesses of spare in handle(), where state is leased
+//   - the access of app.server.spare in viaPointer(), where state is leased
+//     through srv
+//
+// the accesses of state in handle(), viaPointer() and viaRoot() are leased by
+// the same instance, reached in a different way. the access in Exported() is
+// not reported because the receiver could be any server
+//
+//critsec:multi
+type state struct {
+	crit.Section
+	value int
+}
+
+type server struct {
+	name  string
+	state state
+	spare state
+}
+
+type application struct {
+	server server
+}
+
+var app application
+
+func (s *server) handle() {
+	_ = s.state.Lease(func() error {
+		app.server.state.value++
+		app.server.spare.value++
+		s.spare.value++
+		return nil
+	})
+}
+
+func (s *server) Exported() {
+	_ = s.state.Lease(func() error {
+		app.server.state.value++
+		return nil
+	})
+}
+
+func viaPointer() {
+	srv := &app.server
+	_ = srv.state.Lease(func() error {
+		app.server.state.value++
+		app.server.spare.value++
+		return nil
+	})
+}
+
+func viaRoot() {
+	a := &app
+	_ = app.server.state.Lease(func() error {
+		a.server.state.value++
+		return nil
+	})
+}
+
+func main() {
+	go app.server.handle()
+	go app.server.Exported()
+	go viaPointer()
+	go viaRoot()
+}
@@ -0,0 +1,88 @@
+// getters and snapshots that return a field through a copy in a local variable
+// or a named result. the following should be reported with the getter rule:
+//
+//   - Get(), which copies value to the named result without the lease
+//   - Values(), which returns a reference to values through a local variable
+//   - Names(), which copies the reference to names in the lease. the reference
+//     escapes the lease when the named result is returned. the assignment to
+//     names is also reported with the escape rule
+//   - Last(), which reads value through a pointer to the field
+//
+// and with the snapshot rule:
+//
+//   - the copy function in main(), which returns a reference to values
+//     through a named result
+//
+// the following are not reported:
+//
+//   - Count(), which copies value to the named result in the lease
+//   - Label(), which copies label with the lease acquired
+//   - Reset(), which overwrites the copy before returning it
+package main
+
+import (
+	"github.com/jetsetilly/critsec/crit"
+)
+
+type counter struct {
+	crit.Section
+	value  int
+	values []int
+	names  map[string]int
+	label  string
+}
+
+var C counter
+
+func (c *counter) Get() (v int) {
+	v = c.value
+	return
+}
+
+func (c *counter) Values() []int {
+	vs := c.values
+	out := vs
+	return out
+}
+
+func (c *counter) Names() (names map[string]int) {
+	_ = c.Lease(func() error {
+		names = c.names
+		return nil
+	})
+	return
+}
+
+func (c *counter) Last() int {
+	p := &c.value
+	return *p
+}
+
+func (c *counter) Count() (n int) {
+	_ = c.Lease(func() error {
+		n = c.value
+		return nil
+	})
+	return
+}
+
+func (c *counter) Label() string {
+	release := c.Acquire()
+	l := c.label
+	release()
+	return l
+}
+
+func (c *counter) Reset() (v int) {
+	v = c.value
+	v = 0
+	return v
+}
+
+func main() {
+	values := crit.Snapshot(&C, func() (vs []int) {
+		vs = C.values
+		return
+	})
+	_ = values
+}
@@ -0,0 +1,35 @@
+// the crit package imported here is a fork with a newer API version than the
+// analysis knows, and with a lease method that the analysis doesn't recognise.
+// the import should be reported with the crit-version rule when the fork is
+// named with the crit-module flag
+//
+// the access made with LeaseContext() is reported as unleased, because the
+// analysis doesn't know that LeaseContext() is a lease method. the report for
+// the import explains why
+package main
+
+import (
+	"context"
+
+	"github.com/jetsetilly/critsec/example/critversion/crit"
+)
+
+type counter struct {
+	crit.Section
+	n int
+}
+
+var C counter
+
+func main() {
+	go func() {
+		_ = C.Lease(func() error {
+			C.n++
+			return nil
+		})
+	}()
+	_ = C.LeaseContext(context.Background(), func() error {
+		C.n++
+		return nil
+	})
+}
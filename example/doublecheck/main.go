@@ -0,0 +1,101 @@
+// double-checked locking of a crit.Section derived type. the following should
+// be reported with the double-checked rule:
+//
+//   - the first check of cfg in name(). the suggested fix replaces the if
+//     statements with a call to InitOnce()
+//   - the first check of cache in lookup(), where the second check is made
+//     after Acquire(). there is no suggested fix
+//
+// the following are not reported with the double-checked rule:
+//
+//   - the check of conns in connect(), which is made with the lease held
+//   - the check of hits in count(), which isn't checked again in the lease. it
+//     is reported with the access rule
+package main
+
+import (
+	"sync"
+
+	"github.com/jetsetilly/critsec/crit"
+)
+
+type config struct {
+	name string
+}
+
+type state struct {
+	crit.Section
+	cfg   *config
+	cache map[string]int
+	conns int
+	hits  int
+}
+
+var S state
+
+func loadConfig() *config {
+	return &config{name: "default"}
+}
+
+func name() string {
+	if S.cfg == nil {
+		_ = S.Lease(func() error {
+			if S.cfg == nil {
+				S.cfg = loadConfig()
+			}
+			return nil
+		})
+	}
+	var n string
+	_ = S.Lease(func() error {
+		n = S.cfg.name
+		return nil
+	})
+	return n
+}
+
+func lookup(key string) int {
+	if S.cache == nil {
+		release := S.Acquire()
+		if S.cache == nil {
+			S.cache = make(map[string]int)
+		}
+		release()
+	}
+	release := S.Acquire()
+	defer release()
+	return S.cache[key]
+}
+
+func connect() {
+	_ = S.Lease(func() error {
+		if S.conns == 0 {
+			S.conns = 1
+		}
+		return nil
+	})
+}
+
+func count() {
+	if S.hits > 10 {
+		_ = S.Lease(func() error {
+			S.hits = 0
+			return nil
+		})
+	}
+}
+
+func main() {
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = name()
+			_ = lookup("x")
+			connect()
+			count()
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jetsetilly/critsec/crit"
+)
+
+// leases that do nothing with the section. the following should be reported
+// with the empty-lease rule:
+//
+//   - the two leases in tidy(), which only return nil
+//   - the lease that only prints a message in report()
+//
+// the leases in update() are not reported. the first uses a field and the
+// second calls a function in the same package, which is assumed to use the
+// section
+type counter struct {
+	crit.Section
+	value int
+}
+
+var C counter
+
+func tidy() {
+	_ = C.Lease(func() error {
+		return nil
+	})
+	C.Lease(func() error {
+		return nil
+	})
+}
+
+func report() {
+	_ = C.Lease(func() error {
+		fmt.Println("reporting")
+		return nil
+	})
+}
+
+func update() {
+	_ = C.Lease(func() error {
+		C.value++
+		return nil
+	})
+	_ = C.Lease(func() error {
+		increment()
+		return nil
+	})
+}
+
+func increment() {
+	C.value++
+}
+
+func main() {
+	go tidy()
+	go report()
+	go update()
+}
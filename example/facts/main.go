@@ -0,0 +1,38 @@
+package main
+
+import (
+	"github.com/jetsetilly/critsec/example/facts/store"
+)
+
+// the store.Cache type is declared in another package. the analysis of that
+// package exports its directives as facts, which are used when this package is
+// analysed. the following should be reported:
+//
+//   - the call to Put() without the lease in worker()
+//   - the access of the Entries field of B in worker()
+//
+// the second instance, the fields guarded by the mutex, the mutex itself and
+// the unguarded field are not reported
+var A store.Cache
+var B store.Cache
+
+func worker() {
+	A.Mu.Lock()
+	A.Hits++
+	A.Mu.Unlock()
+
+	_ = A.Name
+
+	_ = A.Lease(func() error {
+		A.Put("a", "b")
+		return nil
+	})
+	A.Put("c", "d")
+
+	B.Entries["e"] = "f"
+}
+
+func main() {
+	go worker()
+	go worker()
+}
@@ -0,0 +1,33 @@
+package store
+
+import (
+	"sync"
+
+	"github.com/jetsetilly/critsec/crit"
+)
+
+// Cache is used by the main package. the directives on the type, its fields
+// and its methods apply to the accesses in the main package as well as to the
+// accesses in this package
+//
+//critsec:multi
+type Cache struct {
+	crit.Section
+
+	Mu sync.Mutex
+
+	//critsec:guardedby Mu
+	Hits int
+
+	//critsec:unguarded
+	Name string
+
+	Entries map[string]string
+}
+
+// Put must be called with the lease
+//
+//critsec:requires
+func (c *Cache) Put(k string, v string) {
+	c.Entries[k] = v
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/jetsetilly/critsec/crit"
+)
+
+// getters of a crit.Section derived type. the following should be reported
+// with the getter rule:
+//
+//   - Count(), which returns value without the lease. the suggested fix returns
+//     a snapshot
+//   - Values(), which returns a reference to values without the lease. the
+//     suggested fix returns a snapshot of a copy of the slice
+//   - Names(), which returns a reference to names even though the lease is
+//     held
+//   - Label(), which returns label on one path without the lease
+//
+// the following are not reported:
+//
+//   - Total(), which takes the lease and returns a copy
+//   - Hits(), which returns a field guarded by a mutex
+//   - double(), which is only called with the lease held
+//   - peek(), which has the requires directive
+type counter struct {
+	crit.Section
+	value  int
+	values []int
+	names  map[string]int
+	label  string
+
+	mu sync.Mutex
+
+	//critsec:guardedby mu
+	hits int
+}
+
+var C counter
+
+func (c *counter) Count() int {
+	return c.value
+}
+
+func (c *counter) Values() []int {
+	return c.values
+}
+
+func (c *counter) Names() map[string]int {
+	release := c.Acquire()
+	defer release()
+	return c.names
+}
+
+func (c *counter) Label(fallback bool) string {
+	if fallback {
+		return "none"
+	}
+	return c.label
+}
+
+func (c *counter) Total() int {
+	return crit.Snapshot(c, func() int {
+		return c.value + len(c.values)
+	})
+}
+
+func (c *counter) Hits() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits
+}
+
+func (c *counter) double() int {
+	return c.value * 2
+}
+
+//critsec:requires
+func (c *counter) peek() int {
+	return c.value
+}
+
+func main() {
+	_ = C.Lease(func() error {
+		C.value = C.double() + C.peek()
+		return nil
+	})
+}
@@ -0,0 +1,61 @@
+// handlers are run at a time that can't be predicted, usually on a goroutine
+// of their own. the following should be reported with the handler rule:
+//
+//   - the access in the function registered with RegisterOnShutdown()
+//   - the access in the function registered with time.AfterFunc()
+//   - the access after the signal is received in watch()
+//
+// the access in watch() before the first signal is received is part of the
+// setup of the function and is reported in the usual way. the handler that
+// takes the lease is not reported
+package main
+
+import (
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/jetsetilly/critsec/crit"
+)
+
+type state struct {
+	crit.Section
+	closing  bool
+	reloads  int
+	timeouts int
+}
+
+var S state
+
+func serve(srv *http.Server) {
+	srv.RegisterOnShutdown(func() {
+		S.closing = true
+	})
+	srv.RegisterOnShutdown(func() {
+		_ = S.Lease(func() error {
+			S.closing = true
+			return nil
+		})
+	})
+	_ = srv.ListenAndServe()
+}
+
+func expire() {
+	S.timeouts++
+}
+
+func watch() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	S.reloads = 0
+	for range sig {
+		S.reloads++
+	}
+}
+
+func main() {
+	go watch()
+	time.AfterFunc(time.Second, expire)
+	serve(&http.Server{Addr: ":8080"})
+}
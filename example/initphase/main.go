@@ -0,0 +1,53 @@
+package main
+
+import (
+	"github.com/jetsetilly/critsec/crit"
+)
+
+// accesses made during package initialisation, in the values of package level
+// variables and in init() functions. with the default policy for the
+// initphase flag, the following should be reported:
+//
+//   - the access in the value of total
+//   - the access in the function literal that is the value of count
+//   - the access in size(), which is called by the value of double
+//   - the assignment in the first init() function
+//   - the assignment in the goroutine started by the second init() function
+//
+// with the setup policy only the assignment in the goroutine is reported. the
+// other accesses can only be made while the package is being initialised,
+// which happens on a single goroutine before main() is called
+type counter struct {
+	crit.Section
+	value int
+	names []string
+}
+
+var C counter
+
+var total = C.value + 1
+
+var count = func() int { return len(C.names) }()
+
+var double = size()
+
+func size() int {
+	return C.value * 2
+}
+
+func init() {
+	C.value = 10
+}
+
+func init() {
+	go func() {
+		C.value++
+	}()
+}
+
+func main() {
+	_ = C.Lease(func() error {
+		C.value += total + count + double
+		return nil
+	})
+}
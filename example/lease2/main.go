@@ -0,0 +1,51 @@
+// crit.Lease2() leases two sections in the same order whatever the order of
+// the arguments. the function passed to it holds both leases so the accesses
+// to Inbox and Outbox are not reported, in either order. the following should
+// be reported:
+//
+//   - the access to Archive inside the Lease2() of Inbox and Outbox, which is
+//     the wrong lease
+//   - the access to Outbox after the call to Lease2()
+package main
+
+import (
+	"github.com/jetsetilly/critsec/crit"
+)
+
+type queue struct {
+	crit.Section
+	items []string
+}
+
+var Inbox queue
+var Outbox queue
+var Archive queue
+
+func send() {
+	_ = crit.Lease2(&Inbox, &Outbox, func() error {
+		if len(Inbox.items) == 0 {
+			return nil
+		}
+		Outbox.items = append(Outbox.items, Inbox.items[0])
+		Inbox.items = Inbox.items[1:]
+		return nil
+	})
+}
+
+func recall() {
+	_ = crit.Lease2(&Outbox, &Inbox, func() error {
+		if len(Outbox.items) == 0 {
+			return nil
+		}
+		Inbox.items = append(Inbox.items, Outbox.items[len(Outbox.items)-1])
+		Outbox.items = Outbox.items[:len(Outbox.items)-1]
+		Archive.items = nil
+		return nil
+	})
+	Outbox.items = nil
+}
+
+func main() {
+	go send()
+	go recall()
+}
@@ -0,0 +1,47 @@
+// crit.LeaseAll() leases every section in a list. the accesses to the sections
+// in the list are not reported. the following should be reported:
+//
+//   - the access to Archive inside the LeaseAll() of the three shards, which is
+//     the wrong lease
+//
+// the list in total() is not a composite literal, so the sections it covers
+// are not known. the access to Archive in total() is not reported as the
+// wrong lease, but it is still checked in the usual way
+package main
+
+import (
+	"github.com/jetsetilly/critsec/crit"
+)
+
+type shard struct {
+	crit.Section
+	count int
+}
+
+var A, B, C shard
+var Archive shard
+
+func rebalance() {
+	_ = crit.LeaseAll([]crit.Leaser{&A, &B, &C}, func() error {
+		n := A.count + B.count + C.count
+		A.count = n / 3
+		B.count = n / 3
+		C.count = n - A.count - B.count
+		Archive.count = n
+		return nil
+	})
+}
+
+func total(shards []crit.Leaser) int {
+	var n int
+	_ = crit.LeaseAll(shards, func() error {
+		n = A.count + B.count + C.count + Archive.count
+		return nil
+	})
+	return n
+}
+
+func main() {
+	go rebalance()
+	go total([]crit.Leaser{&A, &B, &C, &Archive})
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"os"
+
+	"github.com/jetsetilly/critsec/crit"
+)
+
+// statements in a lease that behave differently to how they would behave in
+// the enclosing function. the following should be reported:
+//
+//   - the early return of errEmpty in take(), which used to leave take()
+//   - the return of errEmpty in drain(), which is lost because the result of
+//     Lease() is discarded
+//   - the deferred close of the file in save(), which is opened before the
+//     lease and is closed when the lease ends
+//
+// the early return of nil in skip() and the deferred call in scratch(), which
+// only uses what is declared inside the lease, should not be reported
+type queue struct {
+	crit.Section
+	items []int
+}
+
+var Q queue
+
+var errEmpty = errors.New("empty")
+
+func take() error {
+	_ = Q.Lease(func() error {
+		if len(Q.items) == 0 {
+			return errEmpty
+		}
+		Q.items = Q.items[1:]
+		return nil
+	})
+	return nil
+}
+
+func drain() {
+	_ = Q.Lease(func() error {
+		if len(Q.items) == 0 {
+			return errEmpty
+		}
+		Q.items = nil
+		return nil
+	})
+}
+
+func skip() {
+	_ = Q.Lease(func() error {
+		if len(Q.items) == 0 {
+			return nil
+		}
+		Q.items = Q.items[1:]
+		return nil
+	})
+	drain()
+}
+
+func save(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	_ = Q.Lease(func() error {
+		defer f.Close()
+		for _, i := range Q.items {
+			_, _ = f.Write([]byte{byte(i)})
+		}
+		return nil
+	})
+	return nil
+}
+
+func scratch() {
+	_ = Q.Lease(func() error {
+		buf := make([]int, len(Q.items))
+		done := make(chan bool, 1)
+		defer close(done)
+		copy(buf, Q.items)
+		return nil
+	})
+}
+
+func main() {
+	go func() {
+		_ = take()
+	}()
+	go drain()
+	go skip()
+	go func() {
+		_ = save("queue")
+	}()
+	go scratch()
+}
@@ -0,0 +1,98 @@
+// types that implement crit.Leaser outside of the crit package must provide
+// mutual exclusion themselves. the following should be reported with the
+// leaser rule:
+//
+//   - logged.Lease(), which calls the function without leasing the section it
+//     wraps
+//   - counted.TryLease(), which locks in Lease() but not in TryLease()
+//
+// the other implementations lock a mutex, delegate to the section, or use a
+// channel as a semaphore, and are not reported
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/jetsetilly/critsec/crit"
+)
+
+type state struct {
+	crit.Section
+	count int
+}
+
+var S state
+
+// logged is meant to log each lease of the section but forgets to lease it
+type logged struct {
+	s *state
+}
+
+func (l logged) Lease(f func() error) error {
+	fmt.Println("lease of", l.s)
+	return f()
+}
+
+// delegated logs each lease of the section and leases it
+type delegated struct {
+	s *state
+}
+
+func (d delegated) Lease(f func() error) error {
+	fmt.Println("lease of", d.s)
+	return d.s.Lease(f)
+}
+
+// counted is protected by a mutex of its own
+type counted struct {
+	mu     sync.Mutex
+	leases int
+}
+
+func (c *counted) Lease(f func() error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.leases++
+	return f()
+}
+
+func (c *counted) TryLease(f func() error) (bool, error) {
+	c.leases++
+	return true, f()
+}
+
+// token is protected by a channel used as a semaphore
+type token struct {
+	sem chan struct{}
+}
+
+func (t token) Lease(f func() error) error {
+	t.sem <- struct{}{}
+	defer func() { <-t.sem }()
+	return f()
+}
+
+func use(l crit.Leaser) {
+	_ = l.Lease(func() error {
+		return nil
+	})
+}
+
+func main() {
+	go use(logged{s: &S})
+	go use(delegated{s: &S})
+	go use(&counted{})
+	use(token{sem: make(chan struct{}, 1)})
+
+	go func() {
+		_ = logged{s: &S}.Lease(func() error {
+			S.count++
+			return nil
+		})
+	}()
+	_ = delegated{s: &S}.Lease(func() error {
+		S.count++
+		return nil
+	})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/jetsetilly/critsec/crit"
+)
+
+// methods of a crit.Section derived type that are called by the formatting and
+// serialisation packages. String() and GobEncode() read the fields without the
+// lease and should be reported. MarshalJSON() takes the lease and should not
+// be reported
+type settings struct {
+	crit.Section
+	name  string
+	count int
+}
+
+var S settings
+
+func (s *settings) String() string {
+	return fmt.Sprintf("%s: %d", s.name, s.count)
+}
+
+func (s *settings) MarshalJSON() ([]byte, error) {
+	var data []byte
+	err := s.Lease(func() error {
+		var err error
+		data, err = json.Marshal(map[string]any{"name": s.name, "count": s.count})
+		return err
+	})
+	return data, err
+}
+
+func (s *settings) GobEncode() ([]byte, error) {
+	var name string
+	_ = s.Lease(func() error {
+		name = s.name
+		return nil
+	})
+	return []byte(fmt.Sprintf("%s:%d", name, s.count)), nil
+}
+
+func main() {
+	_ = S.Lease(func() error {
+		S.name = "example"
+		return nil
+	})
+}
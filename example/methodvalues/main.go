@@ -0,0 +1,56 @@
+package main
+
+import (
+	"github.com/jetsetilly/critsec/crit"
+)
+
+// methods used as values in a table of handlers and as a method expression.
+// creating the values is not an access of the section. the accesses in the
+// methods are checked where the values are called, and the reports show where
+// the values were created. the following should be reported:
+//
+//   - the access in handleX(), which is called through the table with and
+//     without the lease
+//   - the access in handleY(), which is called through the table with the
+//     lease and through the method expression without it
+type server struct {
+	crit.Section
+	hits int
+}
+
+var S server
+
+func (s *server) handleX() {
+	s.hits++
+}
+
+func (s *server) handleY() {
+	s.hits--
+}
+
+var handlers = map[string]func(){}
+
+func register() {
+	handlers["x"] = S.handleX
+	handlers["y"] = S.handleY
+}
+
+func dispatch(name string) {
+	handlers[name]()
+}
+
+func dispatchLeased(name string) {
+	_ = S.Lease(func() error {
+		handlers[name]()
+		return nil
+	})
+}
+
+func main() {
+	register()
+	go dispatch("x")
+	go dispatchLeased("y")
+
+	f := (*server).handleY
+	go f(&S)
+}
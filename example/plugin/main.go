@@ -0,0 +1,59 @@
+// a plugin, built with -buildmode=plugin. the host binary finds the exported
+// functions and variables with plugin.Lookup() and calls them from any of its
+// goroutines. with the plugins flag the following should be reported:
+//
+//   - the access in Count(), which is an entry point
+//   - the assignment in bump(), which is called by the entry point Bump()
+//   - the assignment in the function stored in Reset
+//   - the assignment in the Run() method of the type of Handler
+//
+// the access in Total() is leased and is not reported. without the plugins
+// flag the functions with no callers are not checked and only the assignment
+// in bump() is reported
+package main
+
+import (
+	"github.com/jetsetilly/critsec/crit"
+)
+
+type registry struct {
+	crit.Section
+	count int
+}
+
+var R registry
+
+func Count() int {
+	return R.count
+}
+
+func Total() int {
+	var n int
+	_ = R.Lease(func() error {
+		n = R.count
+		return nil
+	})
+	return n
+}
+
+func bump() {
+	R.count++
+}
+
+func Bump() {
+	bump()
+}
+
+var Reset = func() {
+	R.count = 0
+}
+
+type handler struct{}
+
+func (handler) Run() {
+	R.count = -1
+}
+
+var Handler handler
+
+func main() {}
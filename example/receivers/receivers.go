@@ -0,0 +1,72 @@
+package main
+
+import (
+	"github.com/jetsetilly/critsec/crit"
+)
+
+// the different ways of leasing an instance through its embedded section. the
+// accesses in leaseA() are all leased and should not be reported. the accesses
+// in leaseB() are made while leasing a different instance and should all be
+// reported
+type receiversA struct {
+	crit.Section
+	value int
+}
+
+type receiversB struct {
+	crit.Section
+	value int
+}
+
+var A receiversA
+var B receiversB
+
+func leaseA() {
+	_ = A.Lease(func() error {
+		A.value = 1
+		return nil
+	})
+	_ = A.Section.Lease(func() error {
+		A.value = 2
+		return nil
+	})
+	_ = (&A.Section).Lease(func() error {
+		A.value = 3
+		return nil
+	})
+	s := &A.Section
+	_ = s.Lease(func() error {
+		A.value = 4
+		return nil
+	})
+	p := &A
+	_ = p.Section.Lease(func() error {
+		A.value = 5
+		return nil
+	})
+}
+
+func leaseB() {
+	_ = B.Lease(func() error {
+		A.value = 1
+		return nil
+	})
+	_ = B.Section.Lease(func() error {
+		A.value = 2
+		return nil
+	})
+	_ = (&B.Section).Lease(func() error {
+		A.value = 3
+		return nil
+	})
+	s := &B.Section
+	_ = s.Lease(func() error {
+		A.value = 4
+		return nil
+	})
+}
+
+func main() {
+	leaseA()
+	leaseB()
+}
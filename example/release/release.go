@@ -0,0 +1,103 @@
+package main
+
+import (
+	"github.com/jetsetilly/critsec/crit"
+)
+
+// misuse of the crit.Release returned by Acquire() and of the token from a
+// crit.ChanSection. the following should be reported:
+//
+//   - the second release in twice()
+//   - the release in maybeTwice(), which has already been called on one path
+//   - the release stored in the release field of O in keep()
+//   - the release appended to the pending slice in queueRelease()
+//   - the release sent on the channel in handOff()
+//   - the token from In released to Out in swapped()
+type buffer struct {
+	crit.Section
+	data []byte
+}
+
+var B buffer
+
+var pending []crit.Release
+
+type owner struct {
+	release crit.Release
+}
+
+var O owner
+
+type pipe struct {
+	crit.ChanSection
+	buf []byte
+}
+
+var In pipe
+var Out pipe
+
+func once() {
+	release := B.Acquire()
+	defer release()
+	B.data = nil
+}
+
+func twice() {
+	release := B.Acquire()
+	B.data = nil
+	release()
+	release()
+}
+
+func maybeTwice(flush bool) {
+	release := B.Acquire()
+	if flush {
+		B.data = nil
+		release()
+	}
+	release()
+}
+
+func reacquired() {
+	release := B.Acquire()
+	B.data = nil
+	release()
+	release = B.Acquire()
+	B.data = append(B.data, 0)
+	release()
+}
+
+func keep() {
+	O.release = B.Acquire()
+}
+
+func queueRelease() {
+	release := B.Acquire()
+	pending = append(pending, release)
+}
+
+func handOff(c chan crit.Release) {
+	c <- B.Acquire()
+}
+
+func matched() {
+	t := <-In.AcquireC()
+	In.Release(t)
+}
+
+func swapped() {
+	t := <-In.AcquireC()
+	Out.Release(t)
+}
+
+func main() {
+	go once()
+	go twice()
+	go maybeTwice(true)
+	go reacquired()
+	go keep()
+	go queueRelease()
+	go handOff(make(chan crit.Release, 1))
+	go matched()
+	go swapped()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"github.com/jetsetilly/critsec/crit"
+)
+
+// operations under a read lease that change the contents of a field without
+// assigning to it. the following should be reported with the read-lease-write
+// rule:
+//
+//   - the writes to the map names, the delete() and the clear() in reader()
+//   - the write to an element of values and the copy() into values in reader()
+//   - the append() to values in grow(), which is called under the read lease
+//
+// the reads of names and values in reader() are not reported, nor is the
+// append() in writer(), which holds the write lease
+type table struct {
+	crit.RWSection
+	names  map[string]int
+	values []int
+}
+
+var T table
+
+func reader() {
+	_ = T.RLease(func() error {
+		T.names["x"] = 1
+		T.names["y"]++
+		delete(T.names, "z")
+		T.values[0] = 2
+		copy(T.values, []int{1})
+		grow()
+
+		_ = T.names["q"] + len(T.values)
+		for _, v := range T.values {
+			_ = v
+		}
+
+		clear(T.names)
+		return nil
+	})
+}
+
+func grow() []int {
+	return append(T.values, 3)
+}
+
+func writer() {
+	_ = T.Lease(func() error {
+		T.values = append(T.values, 1)
+		return nil
+	})
+}
+
+func main() {
+	go reader()
+	go writer()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"github.com/jetsetilly/critsec/crit"
+)
+
+// reads and writes under the two leases of a crit.RWSection. reads are allowed
+// under either lease but writes are only allowed under Lease(). the writes in
+// readLease() and in increment(), when called from readLease(), should be
+// reported. the Lease() in total() only reads and should be reported as a
+// candidate for RLease()
+//
+// TryRLease() and TryLease() have the same rules as RLease() and Lease(). the
+// write in tryRead() should be reported, as should the TryLease() in
+// tryTotal(), both as a candidate for TryRLease() and because whether the
+// function was called is discarded
+type rwState struct {
+	crit.RWSection
+	value int
+	total int
+}
+
+var S rwState
+
+func current() int {
+	return S.value
+}
+
+func increment() {
+	S.total++
+}
+
+func readLease() int {
+	var v int
+	_ = S.RLease(func() error {
+		v = current()
+		S.value = v + 1
+		increment()
+		return nil
+	})
+	return v
+}
+
+func writeLease() {
+	_ = S.Lease(func() error {
+		S.value = current() + 1
+		increment()
+		for S.value, S.total = range []int{1, 2} {
+		}
+		return nil
+	})
+}
+
+func total() int {
+	var t int
+	_ = S.Lease(func() error {
+		t = S.value + S.total
+		return nil
+	})
+	return t
+}
+
+func tryRead() bool {
+	ok, _ := S.TryRLease(func() error {
+		S.total = S.value
+		return nil
+	})
+	return ok
+}
+
+func tryTotal() int {
+	var t int
+	_, _ = S.TryLease(func() error {
+		t = S.value + S.total
+		return nil
+	})
+	return t
+}
+
+func main() {
+	done := make(chan bool)
+	go func() {
+		writeLease()
+		done <- true
+	}()
+	_ = readLease()
+	_ = total()
+	_ = tryRead()
+	_ = tryTotal()
+	<-done
+}
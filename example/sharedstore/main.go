@@ -0,0 +1,53 @@
+// crit.Section derived values stored in a sync.Map, an atomic.Value or an
+// atomic.Pointer[T]. the following should be reported:
+//
+//   - the pointer to the section stored in the sync.Map
+//   - the slice field stored in the atomic.Value, which is also an access
+//     without the lease
+//   - the address of the section stored with CompareAndSwap()
+//   - the pointer stored in the atomic.Pointer[T]
+//
+// the snapshot stored in the atomic.Value is a copy and is not reported. nor
+// is the key looked up with Load()
+package main
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jetsetilly/critsec/crit"
+)
+
+type counters struct {
+	crit.Section
+	values []int
+}
+
+var C counters
+
+var (
+	registry sync.Map
+	latest   atomic.Value
+	current  atomic.Pointer[counters]
+)
+
+func publish() {
+	registry.Store("counters", &C)
+	latest.Store(C.values)
+	latest.CompareAndSwap(nil, &C)
+	current.Store(&C)
+}
+
+func snapshot() {
+	s := crit.Snapshot(&C, func() []int {
+		return slices.Clone(C.values)
+	})
+	latest.Store(s)
+	_, _ = registry.Load("counters")
+}
+
+func main() {
+	go publish()
+	go snapshot()
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"github.com/jetsetilly/critsec/crit"
+)
+
+// accesses and assignments in every statement position. none of the accesses
+// are leased so every one of them should be reported
+type statementsExample struct {
+	crit.Section
+	value int
+	other int
+	keys  []int
+	table map[int]int
+}
+
+var C statementsExample
+
+func forPost() {
+	for i := 0; i < 10; C.value++ {
+		_ = i
+	}
+}
+
+func forInit() {
+	for C.value = 0; C.other < 10; {
+		break
+	}
+}
+
+func ifInit() {
+	if v := C.value; v > 0 {
+		return
+	}
+}
+
+func switchInit() {
+	switch C.value = 1; C.other {
+	case 0:
+	}
+}
+
+func typeSwitchInit() {
+	var x any
+	switch C.other++; x.(type) {
+	case int:
+	}
+}
+
+func multipleAssign() {
+	var x int
+	x, C.value = 1, 2
+	C.other, x = 3, 4
+	_ = x
+}
+
+func compoundAssign() {
+	C.value += 1
+	C.other--
+}
+
+func rangeAssign() {
+	for C.value, C.other = range C.keys {
+	}
+}
+
+func loopVariable(n int) {
+	for C.value = 0; C.value < n; C.value++ {
+	}
+}
+
+func rangeMap() {
+	for C.value, C.other = range C.table {
+	}
+}
+
+func labelled() {
+	i := 0
+again:
+	C.value++
+	if i++; i < 10 {
+		goto again
+	}
+outer:
+	for _, k := range C.keys {
+		for C.other = range C.table {
+			if k == 0 {
+				continue outer
+			}
+			break outer
+		}
+	}
+}
+
+// a lease in a loop made with goto is reported as a lease in a loop. the
+// labelled lease returns nil early, which only skips the rest of the lease
+func gotoLeased() {
+	i := 0
+again:
+	_ = C.Lease(func() error {
+		C.value++
+		return nil
+	})
+	if i++; i < 10 {
+		goto again
+	}
+done:
+	_ = C.Lease(func() error {
+		if C.value > 0 {
+			return nil
+		}
+		C.value, C.other = 0, 0
+		C.keys = nil
+		C.table = nil
+		return nil
+	})
+	if i++; i < 20 {
+		goto done
+	}
+}
+
+func leased() {
+	_ = C.Lease(func() error {
+		for i := 0; i < 10; C.value++ {
+			_ = i
+		}
+		if v := C.value; v > 0 {
+			C.other--
+		}
+		return nil
+	})
+}
+
+// the accesses are reached from main() and from a goroutine started by main(),
+// so the section is shared
+func main() {
+	go run()
+	run()
+}
+
+func run() {
+	forPost()
+	forInit()
+	ifInit()
+	switchInit()
+	typeSwitchInit()
+	multipleAssign()
+	compoundAssign()
+	rangeAssign()
+	loopVariable(10)
+	rangeMap()
+	labelled()
+	gotoLeased()
+	leased()
+}
@@ -0,0 +1,44 @@
+// the testdouble directive is only recognised in test files. the following
+// should be reported with the test-double rule:
+//
+//   - fakeCounter, which is declared in a file that is not a test file. the
+//     directive has no effect, so the second instance of counter is reported
+//     with the multiple-instance rule
+package main
+
+import (
+	"github.com/jetsetilly/critsec/crit"
+)
+
+type counter struct {
+	crit.Section
+	value int
+}
+
+var C counter
+
+// fakeCounter is meant to stand in for counter in tests
+//
+//critsec:testdouble
+type fakeCounter struct {
+	counter
+	calls int
+}
+
+func main() {
+	f := fakeCounter{}
+	_ = f.Lease(func() error {
+		f.calls++
+		return nil
+	})
+	go func() {
+		_ = C.Lease(func() error {
+			C.value++
+			return nil
+		})
+	}()
+	_ = C.Lease(func() error {
+		C.value++
+		return nil
+	})
+}
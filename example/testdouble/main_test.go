@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/jetsetilly/critsec/crit"
+)
+
+// stubCounter is declared in a test file so the testdouble directive is
+// recognised. none of the following should be reported:
+//
+//   - the instances of stubCounter in TestStub(), and the package variable
+//   - passing a stubCounter to check()
+//
+// the accesses to the fields of stubCounter are still checked and the access
+// in check() should be reported
+//
+//critsec:testdouble
+type stubCounter struct {
+	crit.Section
+	value int
+}
+
+var stub stubCounter
+
+func check(t *testing.T, s *stubCounter, want int) {
+	if s.value != want {
+		t.Errorf("value is %d, want %d", s.value, want)
+	}
+}
+
+func TestStub(t *testing.T) {
+	a := stubCounter{}
+	b := stubCounter{}
+	_ = a.Lease(func() error {
+		a.value++
+		return nil
+	})
+	check(t, &a, 1)
+	check(t, &b, 0)
+	_ = stub.Lease(func() error {
+		stub.value++
+		return nil
+	})
+}
@@ -0,0 +1,20 @@
+package testroots_test
+
+import (
+	"testing"
+
+	"github.com/jetsetilly/critsec/example/testroots"
+)
+
+func TestExternal(t *testing.T) {
+	testroots.Add(1)
+	if n := testroots.Len(); n == 0 {
+		t.Error("length is 0")
+	}
+}
+
+func TestExternalTwice(t *testing.T) {
+	var a testroots.Store
+	var b testroots.Store
+	_, _ = &a, &b
+}
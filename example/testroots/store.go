@@ -0,0 +1,43 @@
+// Package testroots is analysed with its tests. the test functions are roots of
+// the callgraph and each test may create its own instance of a crit.Section
+// derived type. the following should be reported:
+//
+//   - the second instance in TestTwice(), which is in the same test as the
+//     first, and the second instance in TestExternalTwice() in the external
+//     test package
+//   - the unleased assignment in reset(), which is only called by a test
+//
+// the instances in the table tests TestAdd() and TestRemove() should not be
+// reported
+package testroots
+
+import (
+	"github.com/jetsetilly/critsec/crit"
+)
+
+// Store is a crit.Section derived type that is used by the tests
+type Store struct {
+	crit.Section
+	items []int
+}
+
+// Shared is the instance used outside of the tests
+var Shared Store
+
+// Add adds an item to the shared store
+func Add(v int) {
+	_ = Shared.Lease(func() error {
+		Shared.items = append(Shared.items, v)
+		return nil
+	})
+}
+
+// Len returns the number of items in the shared store
+func Len() int {
+	var n int
+	_ = Shared.Lease(func() error {
+		n = len(Shared.items)
+		return nil
+	})
+	return n
+}
@@ -0,0 +1,56 @@
+package testroots
+
+import (
+	"testing"
+)
+
+func TestAdd(t *testing.T) {
+	for _, items := range [][]int{nil, {1}, {1, 2, 3}} {
+		var s Store
+		_ = s.Lease(func() error {
+			s.items = append(s.items, items...)
+			if len(s.items) != len(items) {
+				t.Errorf("length is %d, want %d", len(s.items), len(items))
+			}
+			return nil
+		})
+	}
+}
+
+func TestRemove(t *testing.T) {
+	var s Store
+	_ = s.Lease(func() error {
+		s.items = []int{1, 2}
+		s.items = s.items[:1]
+		if len(s.items) != 1 {
+			t.Errorf("length is %d, want 1", len(s.items))
+		}
+		return nil
+	})
+}
+
+func TestTwice(t *testing.T) {
+	var a Store
+	var b Store
+	_ = a.Lease(func() error {
+		a.items = []int{1}
+		return nil
+	})
+	_ = b.Lease(func() error {
+		b.items = []int{2}
+		return nil
+	})
+}
+
+// reset is only used by the tests. the assignment is not leased
+func reset() {
+	Shared.items = nil
+}
+
+func TestReset(t *testing.T) {
+	Add(1)
+	reset()
+	if n := Len(); n != 0 {
+		t.Errorf("length is %d, want 0", n)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"github.com/jetsetilly/critsec/crit"
+)
+
+// a job is created by the producer and handed to a consumer with the transfer
+// directive. the producer owns the job until it is sent and the consumer owns
+// it after it is received, so neither needs the lease. the access in
+// producer() after the send and the access in unowned() should be reported
+//
+//critsec:multi
+type job struct {
+	crit.Section
+	input  int
+	output int
+}
+
+func newJob(input int) *job {
+	return &job{input: input}
+}
+
+func producer(jobs chan *job) {
+	for i := 0; i < 10; i++ {
+		j := newJob(i)
+		j.output = -1
+		jobs <- j //critsec:transfer
+		j.output = 0
+	}
+	close(jobs)
+}
+
+func consumer(jobs chan *job, done chan bool) {
+	for j := range jobs {
+		j.output = j.input * 2
+		finish(j) //critsec:transfer
+	}
+	done <- true
+}
+
+func finish(j *job) {
+	j.output++
+
+	//critsec:transfer
+	record(j)
+}
+
+func record(j *job) {
+	j.output++
+}
+
+var shared job
+
+func unowned() {
+	shared.output = 1
+}
+
+func main() {
+	jobs := make(chan *job)
+	done := make(chan bool)
+	go producer(jobs)
+	go consumer(jobs, done)
+	go unowned()
+	<-done
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"github.com/jetsetilly/critsec/crit"
+)
+
+// sections that do nothing. marker has no fields other than the section and
+// local is only used from main(). both should be reported. the unleased
+// assignment to local in main() should not be reported as well. shared is used
+// by a second goroutine and should not be reported
+type marker struct {
+	crit.Section
+}
+
+type local struct {
+	crit.Section
+	count int
+}
+
+type shared struct {
+	crit.Section
+	count int
+}
+
+var L local
+var S shared
+
+func countLocal() {
+	_ = L.Lease(func() error {
+		L.count++
+		return nil
+	})
+}
+
+func countShared() {
+	_ = S.Lease(func() error {
+		S.count++
+		return nil
+	})
+}
+
+func main() {
+	L.count = 10
+	done := make(chan bool)
+	go func() {
+		countShared()
+		done <- true
+	}()
+	countShared()
+	countLocal()
+	<-done
+}
@@ -0,0 +1,82 @@
+// functions run on a goroutine of their own don't hold the leases of the
+// function that started them. this is true of go statements, and of the
+// functions passed to errgroup.Group.Go(), errgroup.Group.TryGo() and
+// sync.WaitGroup.Go(). the following should be reported:
+//
+//   - the access in the go statement started inside the lease
+//   - the access in the function passed to errgroup.Group.Go() inside the lease
+//   - the access in the semaphore-limited worker started inside the lease
+//
+// the function passed to errgroup.Group.Go() that takes the lease itself is
+// not reported
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jetsetilly/critsec/crit"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+)
+
+type jobs struct {
+	crit.Section
+	done int
+}
+
+var J jobs
+
+func spawn() {
+	var wg sync.WaitGroup
+	_ = J.Lease(func() error {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			J.done++
+		}()
+		return nil
+	})
+	wg.Wait()
+}
+
+func group() error {
+	var g errgroup.Group
+	_ = J.Lease(func() error {
+		g.Go(func() error {
+			J.done++
+			return nil
+		})
+		g.Go(func() error {
+			return J.Lease(func() error {
+				J.done++
+				return nil
+			})
+		})
+		return nil
+	})
+	return g.Wait()
+}
+
+func limited(ctx context.Context) {
+	sem := semaphore.NewWeighted(2)
+	_ = J.Lease(func() error {
+		for i := 0; i < 4; i++ {
+			if sem.Acquire(ctx, 1) != nil {
+				break
+			}
+			go func() {
+				defer sem.Release(1)
+				J.done++
+			}()
+		}
+		return nil
+	})
+	_ = sem.Acquire(ctx, 2)
+}
+
+func main() {
+	spawn()
+	_ = group()
+	limited(context.Background())
+}
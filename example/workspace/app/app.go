@@ -0,0 +1,19 @@
+package main
+
+import (
+	"example.com/state"
+)
+
+func main() {
+	var S state.Shared
+
+	go func() {
+		S.Lease(func() error {
+			S.Value = 1
+			return nil
+		})
+	}()
+
+	// deliberate critical section violation
+	S.Value = 2
+}
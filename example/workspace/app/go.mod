@@ -0,0 +1,5 @@
+module example.com/app
+
+go 1.22.0
+
+require github.com/jetsetilly/critsec v0.0.0
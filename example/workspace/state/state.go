@@ -0,0 +1,13 @@
+package state
+
+import (
+	"github.com/jetsetilly/critsec/crit"
+)
+
+// Shared is a crit.Section derived type declared in a different module to the
+// one that uses it. access to its fields should be checked in the same way as
+// if it had been declared in the same package
+type Shared struct {
+	crit.Section
+	Value int
+}
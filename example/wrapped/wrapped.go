@@ -0,0 +1,82 @@
+package main
+
+import (
+	"github.com/jetsetilly/critsec/crit"
+)
+
+// accesses to sections wrapped in parentheses, pointer dereferences,
+// conversions and type assertions. the wrapping must not hide the section from
+// the analysis. the accesses in unleased(), the access of W.b in wrongLease()
+// and the address stored in published() should be reported
+type wrapped struct {
+	crit.Section
+	value int
+}
+
+type pair struct {
+	a, b wrapped
+}
+
+var W pair
+
+type inner struct {
+	*crit.Section
+	entries int
+}
+
+type outer struct {
+	crit.Section
+	cache inner
+}
+
+var O outer
+
+var P *int
+
+func unleased() {
+	_ = (W.a).value
+	_ = (&W.a).value
+	(*(&W.a)).value = 1
+	var x any = &W.a
+	_ = x.(*wrapped).value
+	_ = (*wrapped)(&W.a).value
+}
+
+func leased() {
+	_ = (&W.a).Lease(func() error {
+		(W.a).value = 1
+		(*(&W.a)).value = 2
+		return nil
+	})
+	_ = O.Lease(func() error {
+		(O.cache).entries = 1
+		return nil
+	})
+}
+
+func wrongLease() {
+	_ = (*wrapped)(&W.a).Lease(func() error {
+		W.a.value = 1
+		(W.b).value = 2
+		return nil
+	})
+}
+
+func published() {
+	_ = W.a.Lease(func() error {
+		P = (*int)(&(W.a.value))
+		return nil
+	})
+}
+
+func main() {
+	done := make(chan bool)
+	go func() {
+		unleased()
+		done <- true
+	}()
+	leased()
+	wrongLease()
+	published()
+	<-done
+}
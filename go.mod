@@ -2,9 +2,9 @@ module github.com/jetsetilly/critsec
 
 go 1.22.0
 
-require golang.org/x/tools v0.20.0
-
 require (
-	golang.org/x/mod v0.17.0 // indirect
-	golang.org/x/sync v0.7.0 // indirect
+	golang.org/x/sync v0.7.0
+	golang.org/x/tools v0.20.0
 )
+
+require golang.org/x/mod v0.17.0 // indirect